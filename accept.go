@@ -0,0 +1,135 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a media range in an Accept header, with its quality.
+type acceptRange struct {
+	mediaType string // such as "image/png", "image/*" or "*/*"
+	q         float64
+}
+
+// parseAccept returns the media ranges in Accept header 'accept'. Ranges that
+// can't be parsed are skipped.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, rawval := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(rawval)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mt, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of media type 'mt' in 'ranges', from the
+// most specific range that matches it; or -1 if no range matches.
+func acceptQuality(ranges []acceptRange, mt string) float64 {
+	q, specificity := -1.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mediaType == mt:
+			s = 2
+		case r.mediaType == "*/*":
+			s = 0
+		case strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mt, r.mediaType[:len(r.mediaType)-1]):
+			s = 1
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// Accepts returns true if the request Accept header allows a response in media
+// type 'mediatype', such as "image/png". Requests without an Accept header
+// accept any media type.
+//
+//	if ctx.Accepts("image/png") {
+//		ctx.Header().Set("Content-Type", "image/png")
+//		ctx.Write(thumbnail)
+//		return
+//	}
+//	ctx.Respond(metadata)
+func (ctx *Context) Accepts(mediatype string) bool {
+	accept := ctx.Request.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	return acceptQuality(parseAccept(accept), strings.ToLower(mediatype)) > 0
+}
+
+// PreferredMediaType returns the media type in 'types' that the request Accept
+// header prefers, by quality; types with the same quality are preferred in the
+// order given. Requests without an Accept header prefer the first type.
+// Returns an empty string if none of the types is acceptable.
+//
+//	switch ctx.PreferredMediaType("image/webp", "image/png", "application/json") {
+//	case "image/webp", "image/png":
+//		...
+//	case "application/json":
+//		...
+//	default:
+//		ctx.Error(http.StatusNotAcceptable, "That media type is not supported for response.")
+//	}
+func (ctx *Context) PreferredMediaType(types ...string) string {
+	accept := ctx.Request.Header.Get("Accept")
+	if accept == "" {
+		if len(types) == 0 {
+			return ""
+		}
+		return types[0]
+	}
+	ranges := parseAccept(accept)
+	best, bestq := "", 0.0
+	for _, mt := range types {
+		if q := acceptQuality(ranges, strings.ToLower(mt)); q > bestq {
+			best, bestq = mt, q
+		}
+	}
+	return best
+}
+
+/*
+Negotiate returns the media type in 'offers' that the request Accept header
+prefers, as PreferredMediaType does. If none of the offers is acceptable, it
+returns a *StatusError with a 406-"Not Acceptable" status, with a localized
+message and the offers as the alternative media types, ready to send with
+Error.
+
+	mt, err := ctx.Negotiate("text/csv", "application/json")
+	if err != nil {
+		e := err.(*relax.StatusError)
+		ctx.Error(e.Code, e.Message, e.Details)
+		return
+	}
+	if mt == "text/csv" {
+		...
+	}
+*/
+func (ctx *Context) Negotiate(offers ...string) (string, error) {
+	if mt := ctx.PreferredMediaType(offers...); mt != "" {
+		return mt, nil
+	}
+	return "", &StatusError{
+		Code:    errNotAcceptable.Code,
+		Message: ctx.Localize(errNotAcceptable.Message),
+		Details: &Alternatives{MediaTypes: append([]string{}, offers...)},
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError is a validation error of a payload field, sent in the details of
+// the errors returned by Context.Bind.
+type FieldError struct {
+	// Field is the field name, as in the payload. Nested fields are joined by
+	// dots, such as "address.city".
+	Field string `json:"field" xml:"field"`
+	// Rule is the validation rule that failed, such as "required" or "min=1".
+	Rule string `json:"rule" xml:"rule"`
+	// Message describes the error.
+	Message string `json:"message" xml:"message"`
+}
+
+/*
+Bind decodes the request payload into the struct pointed by 'v', sets the
+default values of its empty fields, and validates them. Fields are set and
+validated with struct tags:
+
+	type User struct {
+		Name  string   `json:"name" validate:"required,max=64"`
+		Email string   `json:"email" validate:"required,email"`
+		Role  string   `json:"role" default:"member" validate:"oneof=member admin"`
+		Tags  []string `json:"tags" validate:"max=10"`
+	}
+
+	func (u *Users) Create(ctx *relax.Context) {
+		var user User
+		if err := ctx.Bind(&user); err != nil {
+			ctx.DecodeError(err)
+			return
+		}
+		...
+	}
+
+The "default" tag value is set to fields that are zero after decoding; so a
+default can't be overridden with a zero value. The "validate" tag is a comma
+separated list of rules:
+
+	required      // the value is not zero
+	min=N         // numbers are at least N; strings, slices and maps have at least N items
+	max=N         // numbers are at most N; strings, slices and maps have at most N items
+	len=N         // strings, slices and maps have exactly N items
+	oneof=a b c   // the value is one of the space separated values
+	email         // strings are an email address
+	uuid          // strings are an UUID
+
+Rules other than required are not checked for zero values. Nested structs are
+validated too, their field names are joined by dots.
+
+Returns nil on success. Otherwise a decoding error, see DecodeError; or a
+StatusError with code 422 and the list of FieldError's in the details. This
+function panics if a tag has an unknown rule or a bad value.
+*/
+func (ctx *Context) Bind(v interface{}) error {
+	if ctx.Decode == nil {
+		return errUndecodablePayload.withDetails(nil)
+	}
+	if err := ctx.Decode(ctx.Request.Body, v); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	return validate(rv.Elem())
+}
+
+/*
+BindRequest is like Bind, but the struct pointed by 'v' is the input of the
+request: fields are also set from the path values, the query and the headers,
+with the tags "path", "query" and "header". The payload is decoded first, if
+there's one; then the parameters are set, then the defaults, then the fields
+are validated.
+
+	type ListPosts struct {
+		UserID int64    `path:"id"`
+		Tenant string   `header:"X-Tenant" validate:"required"`
+		Page   int      `query:"page" default:"1" validate:"min=1"`
+		Tags   []string `query:"tag"`
+	}
+
+	// GET /users/{uint:id}/posts?page=2&tag=go&tag=rest
+	func (u *Users) Posts(ctx *relax.Context) {
+		var in ListPosts
+		if err := ctx.BindRequest(&in); err != nil {
+			ctx.DecodeError(err)
+			return
+		}
+		...
+	}
+
+Parameters can be set to fields of type string, bool, numbers, time.Duration,
+and slices of them for parameters with many values. Fields of embedded
+structs are set too.
+
+Returns nil on success. Otherwise a decoding error; or a StatusError with code
+400 if a parameter value can't be set to its field; or code 422 if the fields
+are not valid. The StatusError details have the list of FieldError's. This
+function panics if 'v' is not a pointer to a struct.
+*/
+func (ctx *Context) BindRequest(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("relax: BindRequest needs a pointer to a struct, got %T", v))
+	}
+	r := ctx.Request
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		if ctx.Decode == nil {
+			return errUndecodablePayload.withDetails(nil)
+		}
+		if err := ctx.Decode(r.Body, v); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	var errs []*FieldError
+	ctx.bindParams(rv.Elem(), r.URL.Query(), &errs)
+	if errs != nil {
+		return errBadParams.withDetails(errs)
+	}
+	return validate(rv.Elem())
+}
+
+// bindParams sets the fields of struct 'sv' with "path", "query" and "header"
+// tags to the request values. 'query' are the query values. The errors are
+// appended to 'errs'.
+func (ctx *Context) bindParams(sv reflect.Value, query url.Values, errs *[]*FieldError) {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := sv.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			ctx.bindParams(fv, query, errs)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		var name string
+		var values []string
+		if name = sf.Tag.Get("path"); name != "" {
+			values = ctx.PathValues[name]
+		} else if name = sf.Tag.Get("query"); name != "" {
+			values = query[name]
+		} else if name = sf.Tag.Get("header"); name != "" {
+			values = ctx.Request.Header.Values(name)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, values); err != nil {
+			*errs = append(*errs, &FieldError{Field: name, Rule: "type",
+				Message: fmt.Sprintf("The value must be of type %s.", sf.Type)})
+		}
+	}
+}
+
+// setField sets field 'fv' to 'values'; slices get all the values, other
+// types the first value.
+func setField(fv reflect.Value, values []string) error {
+	if fv.Kind() != reflect.Slice {
+		return setValue(fv, values[0])
+	}
+	slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+	for i := range values {
+		if err := setValue(slice.Index(i), values[i]); err != nil {
+			return err
+		}
+	}
+	fv.Set(slice)
+	return nil
+}
+
+// validate sets the defaults and validates the fields of struct 'sv'.
+// Returns a StatusError with the FieldError's, or nil if valid.
+func validate(sv reflect.Value) error {
+	var errs []*FieldError
+	bindStruct(sv, "", &errs)
+	if errs != nil {
+		return errInvalidPayload.withDetails(errs)
+	}
+	return nil
+}
+
+// fieldName returns the payload name of struct field 'sf', from its json tag.
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// bindStruct sets the defaults and validates the fields of struct 'sv'. The
+// errors are appended to 'errs', with field names prefixed by 'prefix'.
+func bindStruct(sv reflect.Value, prefix string, errs *[]*FieldError) {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		fv, name := sv.Field(i), prefix+fieldName(sf)
+		if def, ok := sf.Tag.Lookup("default"); ok && fv.IsZero() {
+			if err := setValue(fv, def); err != nil {
+				panic(fmt.Sprintf("relax: Invalid default for field %q: %s", name, err))
+			}
+		}
+		if rules := sf.Tag.Get("validate"); rules != "" {
+			for _, rule := range strings.Split(rules, ",") {
+				if msg := checkRule(fv, rule); msg != "" {
+					*errs = append(*errs, &FieldError{Field: name, Rule: rule, Message: msg})
+					break
+				}
+			}
+		}
+		if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			bindStruct(fv, name+".", errs)
+		}
+	}
+}
+
+// setValue sets field 'fv' to the string 's', converted to its type.
+func setValue(fv reflect.Value, s string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			fv.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// checkRule returns a message if field 'fv' doesn't pass validation 'rule',
+// or an empty string if it does.
+func checkRule(fv reflect.Value, rule string) string {
+	name, arg := rule, ""
+	if idx := strings.Index(rule, "="); idx != -1 {
+		name, arg = rule[:idx], rule[idx+1:]
+	}
+	if name == "required" {
+		if fv.IsZero() {
+			return "The field is required."
+		}
+		return ""
+	}
+	if fv.IsZero() {
+		return ""
+	}
+	if fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("relax: Invalid validation rule %q", rule))
+		}
+		n, isLen := ruleValue(fv)
+		if (name == "min" && n >= limit) || (name == "max" && n <= limit) || (name == "len" && n == limit) {
+			return ""
+		}
+		what := "The value"
+		if isLen {
+			what = "The length"
+		}
+		switch name {
+		case "min":
+			return fmt.Sprintf("%s must be at least %s.", what, arg)
+		case "max":
+			return fmt.Sprintf("%s must be at most %s.", what, arg)
+		}
+		return fmt.Sprintf("%s must be %s.", what, arg)
+	case "oneof":
+		value := fmt.Sprint(fv.Interface())
+		for _, s := range strings.Fields(arg) {
+			if s == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("The value must be one of: %s.", strings.Join(strings.Fields(arg), ", "))
+	case "email":
+		if addr, err := mail.ParseAddress(fv.String()); err == nil && addr.Address == fv.String() {
+			return ""
+		}
+		return "The value must be an email address."
+	case "uuid":
+		if IsUUID(fv.String()) {
+			return ""
+		}
+		return "The value must be an UUID."
+	}
+	panic(fmt.Sprintf("relax: Unknown validation rule %q", rule))
+}
+
+// ruleValue returns the value of 'fv' compared by the min, max and len rules:
+// the number, or the length of strings, slices and maps.
+func ruleValue(fv reflect.Value) (float64, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(len([]rune(fv.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false
+	}
+	panic(fmt.Sprintf("relax: Validation rule for unsupported type %s", fv.Type()))
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+type Member struct {
+	Name    string   `json:"name" validate:"required,max=8"`
+	Email   string   `json:"email" validate:"email"`
+	Role    string   `json:"role" default:"member" validate:"oneof=member admin"`
+	Age     int      `json:"age" validate:"min=18"`
+	Tags    []string `json:"tags" validate:"max=2"`
+	Address struct {
+		City string `json:"city" validate:"required"`
+	} `json:"address"`
+}
+
+type Members struct{}
+
+func (m *Members) Index(ctx *relax.Context) {}
+
+func (m *Members) Create(ctx *relax.Context) {
+	var member Member
+	if err := ctx.Bind(&member); err != nil {
+		ctx.DecodeError(err)
+		return
+	}
+	ctx.Respond(&member, http.StatusCreated)
+}
+
+func TestBind(t *testing.T) {
+	svc := relax.NewService("/")
+	members := &Members{}
+	svc.Resource(members).POST("", members.Create)
+
+	tests := []struct {
+		Body     string
+		Status   int
+		Response string
+	}{
+		{`{"name":"jane","age":20,"address":{"city":"Austin"}}`, 201,
+			`{"name":"jane","email":"","role":"member","age":20,"tags":null,"address":{"city":"Austin"}}`},
+		{`{"name":"jane","address":{"city":"Austin"}`, 400, ``},
+		{`{"name":"jane doe jr","email":"nope","role":"root","age":12,"tags":["a","b","c"]}`, 422,
+			`{"code":422,"message":"The request payload is not valid.","details":[` +
+				`{"field":"name","rule":"max=8","message":"The length must be at most 8."},` +
+				`{"field":"email","rule":"email","message":"The value must be an email address."},` +
+				`{"field":"role","rule":"oneof=member admin","message":"The value must be one of: member, admin."},` +
+				`{"field":"age","rule":"min=18","message":"The value must be at least 18."},` +
+				`{"field":"tags","rule":"max=2","message":"The length must be at most 2."},` +
+				`{"field":"address.city","rule":"required","message":"The field is required."}]}`},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/members", strings.NewReader(tt.Body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || (tt.Response != "" && strings.TrimSpace(w.Body.String()) != tt.Response) {
+			t.Errorf("%d: expected %d %s, got %d %s", i, tt.Status, tt.Response, w.Code, w.Body.String())
+		}
+	}
+}
+
+type ListPosts struct {
+	UserID int64    `path:"id" json:"user_id"`
+	Tenant string   `header:"X-Tenant" json:"tenant" validate:"required"`
+	Page   int      `query:"page" json:"page" default:"1" validate:"min=1"`
+	Tags   []string `query:"tag" json:"tags"`
+}
+
+func TestBindRequest(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Root().GET("users/{uint:id}/posts", func(ctx *relax.Context) {
+		var in ListPosts
+		if err := ctx.BindRequest(&in); err != nil {
+			ctx.DecodeError(err)
+			return
+		}
+		ctx.Respond(&in)
+	})
+
+	tests := []struct {
+		Path     string
+		Tenant   string
+		Status   int
+		Response string
+	}{
+		{"/users/7/posts?tag=go&tag=rest", "acme", 200, `{"user_id":7,"tenant":"acme","page":1,"tags":["go","rest"]}`},
+		{"/users/7/posts?page=3", "acme", 200, `{"user_id":7,"tenant":"acme","page":3,"tags":null}`},
+		{"/users/7/posts?page=x", "acme", 400, `{"code":400,"message":"The request parameters are not valid.","details":[{"field":"page","rule":"type","message":"The value must be of type int."}]}`},
+		{"/users/7/posts", "", 422, `{"code":422,"message":"The request payload is not valid.","details":[{"field":"tenant","rule":"required","message":"The field is required."}]}`},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", tt.Path, nil)
+		if tt.Tenant != "" {
+			req.Header.Set("X-Tenant", tt.Tenant)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || strings.TrimSpace(w.Body.String()) != tt.Response {
+			t.Errorf("%d: expected %d %s, got %d %s", i, tt.Status, tt.Response, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import "strings"
+
+/*
+Catalog is a collection of localized messages. It is indexed by language tag,
+as negotiated by content (see Content), and then by the default message text.
+The default messages are in English, and they are used as-is when no
+translation is found.
+
+	svc.Catalog = relax.Catalog{
+		"es": {
+			"That route was not found.":     "Esa ruta no fue encontrada.",
+			"That method is not supported": "Ese método no es compatible",
+		},
+	}
+
+Language lookups try the full tag first ("es-MX") then the primary language ("es").
+*/
+type Catalog map[string]map[string]string
+
+// Lookup returns the translation of 'msg' for language 'lang'. If there is no
+// translation available, then 'msg' is returned unchanged.
+func (c Catalog) Lookup(lang, msg string) string {
+	if c == nil || lang == "" {
+		return msg
+	}
+	if t, ok := c[lang][msg]; ok {
+		return t
+	}
+	if idx := strings.Index(lang, "-"); idx != -1 {
+		if t, ok := c[lang[:idx]][msg]; ok {
+			return t
+		}
+	}
+	return msg
+}
+
+// Set adds or replaces the translation of 'msg' for language 'lang'.
+func (c Catalog) Set(lang, msg, translation string) {
+	if c[lang] == nil {
+		c[lang] = make(map[string]string)
+	}
+	c[lang][msg] = translation
+}
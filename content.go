@@ -7,6 +7,7 @@ package relax
 import (
 	"mime"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -37,15 +38,16 @@ using the vendor extension, the default values are used:
 By decoupling version and lang from the media type, it allows us to have separate
 versions for the same resource and with individual language coverage.
 
-When Accept indicates all media types "*&#5C;*", the media subtype can be requested
-through the URL path's extension. If the service doesn't support the media encoding,
-then it will respond with an HTTP error code.
+When Accept indicates all media types "*&#5C;*" and Service.PathExtensions is
+true, the media subtype can be requested through the URL path's extension.
 
 	GET /api/v1/tickets.xml
 	GET /company/users/123.json
 
 Note that the extension should be appended to a collection or a resource item.
 The extension is removed before the request is dispatched to the routing engine.
+Only extensions of the service encoders are removed, and only if the full path
+doesn't match a route; so IDs with dots, such as "1.2.3", are safe.
 
 If the request header Accept-Language is found, the value for content language
 is automatically set to that. The underlying application should use this to
@@ -53,13 +55,34 @@ construct a proper respresentation in that language.
 
 Content passes down the following info to filters:
 
-	ctx.Get("content.encoding") // media type used for encoding
-	ctx.Get("content.decoding") // Type used in payload requests POST/PUT/PATCH
-	ctx.Get("content.version")  // requested version, or "current"
-	ctx.Get("content.language") // requested language, or "en-US"
+	ctx.Get("content.encoding")      // media type used for encoding
+	ctx.Get("content.decoding")      // Type used in payload requests POST/PUT/PATCH
+	ctx.Get("content.max_body_size") // payload size limit of the decoder, if any
+	ctx.Get("content.version")       // requested version, or "current"
+	ctx.Get("content.language")      // requested language, or "en-US"
 
 Requests and responses can use mixed representations if the service supports the
-media types.
+media types. The request payload is decoded using Content-Type, and the response
+is encoded using Accept, independently:
+
+	Content-Type: application/json
+	Accept: application/xml
+
+Accept may also list registered media types directly, the one with the highest
+quality is used. Content-Type may use the vendor extension too:
+
+	Content-Type: application/vnd.relax+xml
+
+To limit the request media types accepted by a route, use Consumes.
+
+Legacy media type names can be mapped to current ones with Service.MediaAliases.
+The Accept and Content-Type headers are changed before negotiation; parameters
+in the alias, such as version, are added to the media type:
+
+	myservice.MediaAliases = map[string]string{
+		"text/json":                      "application/json",
+		"application/vnd.company.v1+json": "application/vnd.codehack.relax+json; version=v1",
+	}
 
 See also, http://tools.ietf.org/html/rfc5646; tags to identify languages.
 */
@@ -75,94 +98,503 @@ var Content struct {
 	Language string
 }
 
-// content is the function that does the actual content-negotiation described above.
-func (svc *Service) content(next HandlerFunc) HandlerFunc {
-	// JSON is our default representation.
-	json := svc.encoders["application/json"]
+// Negotiation is the result of content negotiation for a request.
+type Negotiation struct {
+	// Encoder is used to encode the response.
+	Encoder Encoder
+	// Decoder is used to decode the request payload. It's nil if the request
+	// has no payload.
+	Decoder Encoder
+	// Decoding is the media type of the request payload.
+	Decoding string
+	// Version is the requested content version.
+	Version string
+	// Language is the requested content language.
+	Language string
+}
 
-	return func(ctx *Context) {
-		ctx.Encode = json.Encode
-		ctx.Decode = json.Decode
+/*
+Negotiator is implemented by objects that do content negotiation. It allows
+services with their own media type schemes to replace the vendor extension
+described in Content. Negotiate receives the request and the service encoders,
+keyed by media type, and returns the encoder, decoder, version and language.
+
+If negotiation fails, Negotiate returns an error; a *StatusError is sent as
+the response, other errors are sent as 400-"Bad Request". The Negotiation
+returned with an error may have an Encoder for the error response, otherwise
+JSON is used.
+
+	myservice.Use(relax.NegotiatorFunc(func(r *http.Request, encoders map[string]relax.Encoder) (*relax.Negotiation, error) {
+		n, err := relax.VendorNegotiator{}.Negotiate(r, encoders)
+		if err == nil && r.Header.Get("X-Api-Version") != "" {
+			n.Version = r.Header.Get("X-Api-Version")
+		}
+		return n, err
+	}))
+
+Negotiators must not modify 'encoders'.
+*/
+type Negotiator interface {
+	Negotiate(*http.Request, map[string]Encoder) (*Negotiation, error)
+}
+
+// NegotiatorFunc is an adapter to use ordinary functions as a Negotiator.
+type NegotiatorFunc func(*http.Request, map[string]Encoder) (*Negotiation, error)
 
-		encoder := json
+// Negotiate calls f(r, encoders).
+func (f NegotiatorFunc) Negotiate(r *http.Request, encoders map[string]Encoder) (*Negotiation, error) {
+	return f(r, encoders)
+}
+
+// VendorNegotiator is the default Negotiator, it implements the vendor
+// extension media type scheme described in Content.
+type VendorNegotiator struct{}
 
-		version := acceptVersion(ctx.Request.Header.Get("Accept-Version"))
+// Negotiate implements Negotiator.
+func (VendorNegotiator) Negotiate(r *http.Request, encoders map[string]Encoder) (*Negotiation, error) {
+	// JSON is our default representation.
+	json := encoders["application/json"]
+
+	n := &Negotiation{
+		Encoder:  json,
+		Version:  acceptVersion(r.Header.Get("Accept-Version")),
+		Language: acceptLanguage(r.Header.Get("Accept-Language")),
+	}
 
-		language := acceptLanguage(ctx.Request.Header.Get("Accept-Language"))
+	accept := r.Header.Get("Accept")
 
-		accept := ctx.Request.Header.Get("Accept")
-		if accept == "*/*" {
-			// Check if subtype is in the requested URL path's extension.
-			// Path: /api/v1/users.xml
-			if ext := PathExt(ctx.Request.URL.Path); ext != "" {
-				// remove extension from path.
-				ctx.Request.URL.Path = strings.TrimSuffix(ctx.Request.URL.Path, ext)
-				// create vendor media type and fallthrough
-				accept = Content.Mediatype + "+" + ext[1:]
+	// We check our vendor media type for requests of a specific subtype.
+	// Everything else will default to "application/json" (see above).
+	if strings.HasPrefix(accept, Content.Mediatype) {
+		// Accept: application/vnd.relax+{subtype}; version={version}; lang={lang}
+		mt, op, err := mime.ParseMediaType(accept)
+		if err != nil {
+			return n, &StatusError{http.StatusBadRequest, err.Error(), nil}
+		}
+		// check for media subtype (encoding) request.
+		if idx := strings.Index(mt, "+"); idx != -1 {
+			tbe := mime.TypeByExtension("." + mt[idx+1:])
+			enc, ok := encoders[tbe]
+			if !ok {
+				return n, errNotAcceptable.withDetails(NewAlternatives(encoders))
 			}
+			n.Encoder = enc
 		}
 
-		// We check our vendor media type for requests of a specific subtype.
-		// Everything else will default to "application/json" (see above).
-		if strings.HasPrefix(accept, Content.Mediatype) {
-			// Accept: application/vnd.relax+{subtype}; version={version}; lang={lang}
-			mt, op, err := mime.ParseMediaType(accept)
-			if err != nil {
-				ctx.Header().Set("Content-Type", json.ContentType())
-				ctx.Error(http.StatusBadRequest, err.Error())
-				return
+		// If version or language were specified they are preferred over Accept-* headers.
+		if v, ok := op["version"]; ok {
+			n.Version = v
+		}
+		if v, ok := op["lang"]; ok {
+			n.Language = v
+		}
+	} else if enc := acceptEncoder(encoders, accept); enc != nil {
+		// Accept: application/xml, application/json;q=0.5
+		n.Encoder = enc
+	}
+
+	// Now check for payload representation for unsafe methods: POST PUT PATCH.
+	if r.Method[0] == 'P' {
+		// Content-Type: application/{subtype}
+		ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return n, &StatusError{http.StatusBadRequest, err.Error(), nil}
+		}
+		// Content-Type: application/vnd.relax+{subtype}
+		if strings.HasPrefix(ct, Content.Mediatype+"+") {
+			ct = mime.TypeByExtension("." + ct[len(Content.Mediatype)+1:])
+		}
+		decoder, ok := encoders[ct]
+		if !ok {
+			return n, errUnsupportedType.withDetails(&PayloadDetails{Supported: mediaTypes(encoders)})
+		}
+		n.Decoder = decoder
+		n.Decoding = ct
+	}
+
+	return n, nil
+}
+
+// content is the function that does the actual content-negotiation described
+// above, using the service Negotiator.
+func (svc *Service) content(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if svc.MediaAliases != nil {
+			svc.mediaAlias(ctx.Request)
+		}
+		if svc.PathExtensions {
+			svc.pathExtension(ctx.Request)
+		}
+		// resources with their own encoders negotiate again, see Resource.UseEncoder
+		if !svc.negotiate(ctx, svc.encoders, svc.scopedEncoders) {
+			return
+		}
+		next(ctx)
+	}
+}
+
+// negotiate does content-negotiation for the request in 'ctx' with 'encoders',
+// using the service Negotiator. If negotiation fails, it responds with an error
+// and returns false; unless 'deferErr' is true, then the error is passed down
+// in "content.error" and JSON is used until a resource negotiates again.
+func (svc *Service) negotiate(ctx *Context, encoders map[string]Encoder, deferErr bool) bool {
+	negotiator := svc.negotiator
+	if negotiator == nil {
+		negotiator = VendorNegotiator{}
+	}
+
+	n, err := negotiator.Negotiate(ctx.Request, encoders)
+	if err != nil {
+		// JSON is our default representation.
+		encoder := svc.encoders["application/json"]
+		if n != nil && n.Encoder != nil {
+			encoder = n.Encoder
+		}
+		ctx.Encode, ctx.encoder = encoder.Encode, encoder
+		ctx.Header().Set("Content-Type", encoder.ContentType())
+		// the error is localized in the requested language.
+		if n != nil && n.Language != "" {
+			ctx.Set("content.language", n.Language)
+		} else {
+			ctx.Set("content.language", acceptLanguage(ctx.Request.Header.Get("Accept-Language")))
+		}
+		if deferErr {
+			ctx.Decode, ctx.decoder = encoder.Decode, encoder
+			ctx.Set("content.error", err)
+			return true
+		}
+		svc.contentError(ctx, err)
+		return false
+	}
+	if ctx.Get("content.error") != nil {
+		ctx.Set("content.error", nil)
+	}
+
+	// At this point we know the response media type.
+	ctx.Encode, ctx.encoder = n.Encoder.Encode, n.Encoder
+	ctx.Decode, ctx.decoder = n.Encoder.Decode, n.Encoder
+	ctx.Header().Set("Content-Type", n.Encoder.ContentType())
+
+	// Pass the info down to other handlers.
+	ctx.Set("content.encoding", n.Encoder.Accept())
+	ctx.Set("content.version", n.Version)
+	ctx.Set("content.language", n.Language)
+
+	if n.Decoder != nil {
+		if bl, ok := n.Decoder.(BodyLimiter); ok {
+			if limit := bl.BodyLimit(); limit > 0 {
+				if ctx.Request.ContentLength > limit {
+					ctx.Error(errPayloadTooLarge.Code, errPayloadTooLarge.Message, &PayloadDetails{MaxBodySize: limit})
+					return false
+				}
+				ctx.Set("content.max_body_size", limit)
 			}
-			// check for media subtype (encoding) request.
-			if idx := strings.Index(mt, "+"); idx != -1 {
-				tbe := mime.TypeByExtension("." + mt[idx+1:])
-				enc, ok := svc.encoders[tbe]
-				if !ok {
-					ctx.Header().Set("Content-Type", json.ContentType())
-					ctx.Error(http.StatusNotAcceptable,
-						"That media type is not supported for response.",
-						"You may use type '"+json.Accept()+"'")
-					return
+		}
+		ctx.Decode, ctx.decoder = n.Decoder.Decode, n.Decoder
+		ctx.Set("content.decoding", n.Decoding)
+	}
+	return true
+}
+
+// Encoder returns the encoder negotiated for the response, whose Encode
+// function is ctx.Encode; or nil before content negotiation. Encoders are
+// shared by all requests, so they must not be changed; use SetEncoder with a
+// copy to change its options for one request.
+func (ctx *Context) Encoder() Encoder {
+	return ctx.encoder
+}
+
+// Decoder returns the encoder negotiated for the request payload, whose Decode
+// function is ctx.Decode; or nil before content negotiation. It's the response
+// encoder if the request has no payload.
+func (ctx *Context) Decoder() Encoder {
+	return ctx.decoder
+}
+
+/*
+SetEncoder changes the response encoder of the request to 'enc', setting
+ctx.Encode, the Content-Type header and "content.encoding". It must be called
+before the response is written.
+
+	if enc, ok := ctx.Encoder().(*relax.EncoderJSON); ok && ctx.Query().Has("pretty") {
+		pretty := *enc
+		pretty.Indented = true
+		ctx.SetEncoder(&pretty)
+	}
+*/
+func (ctx *Context) SetEncoder(enc Encoder) {
+	ctx.Encode, ctx.encoder = enc.Encode, enc
+	ctx.Header().Set("Content-Type", enc.ContentType())
+	ctx.Set("content.encoding", enc.Accept())
+}
+
+// contentError responds with the negotiation error 'err'.
+func (svc *Service) contentError(ctx *Context, err error) {
+	if e, ok := err.(*StatusError); ok {
+		if a, ok := e.Details.(*Alternatives); ok && svc.Catalog != nil {
+			a.addLanguages(svc.Catalog)
+		}
+		ctx.Error(e.Code, e.Message, e.Details)
+		return
+	}
+	ctx.Error(http.StatusBadRequest, err.Error())
+}
+
+/*
+UseEncoder adds encoders to the resource, in addition to the service encoders,
+so the resource can respond in media types that other resources don't. An
+encoder replaces the service encoder of the same media type, in this resource.
+
+	reports.UseEncoder(csv.NewEncoder())
+
+Returns the resource itself for chaining.
+See also: AllowOnly
+*/
+func (r *Resource) UseEncoder(encoders ...Encoder) *Resource {
+	if r.encoders == nil {
+		r.encoders = make(map[string]Encoder)
+	}
+	for _, enc := range encoders {
+		r.encoders[enc.Accept()] = enc
+	}
+	r.service.scopedEncoders = true
+	return r
+}
+
+/*
+AllowOnly limits the media types of the resource to 'mediaTypes', from the
+service encoders and the resource encoders. Requests for other media types get
+a 406-"Not Acceptable" response, and payloads in other media types get a
+415-"Unsupported Media Type" response.
+
+	// this resource only speaks JSON.
+	events.AllowOnly("application/json")
+
+Returns the resource itself for chaining.
+See also: UseEncoder
+*/
+func (r *Resource) AllowOnly(mediaTypes ...string) *Resource {
+	r.allow = mediaTypes
+	r.service.scopedEncoders = true
+	return r
+}
+
+// encoderSet returns the encoders of the resource, see UseEncoder and AllowOnly.
+func (r *Resource) encoderSet() map[string]Encoder {
+	set := make(map[string]Encoder, len(r.service.encoders)+len(r.encoders))
+	for mt, enc := range r.service.encoders {
+		set[mt] = enc
+	}
+	for mt, enc := range r.encoders {
+		set[mt] = enc
+	}
+	if r.allow != nil {
+		for mt := range set {
+			allowed := false
+			for i := range r.allow {
+				if r.allow[i] == mt {
+					allowed = true
+					break
 				}
-				encoder = enc
-				ctx.Encode = encoder.Encode
 			}
+			if !allowed {
+				delete(set, mt)
+			}
+		}
+	}
+	return set
+}
 
-			// If version or language were specified they are preferred over Accept-* headers.
-			if v, ok := op["version"]; ok {
-				version = v
+// contentHandler negotiates the content again for resources with their own
+// encoders, or responds with the service negotiation error, if any.
+func (r *Resource) contentHandler(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if r.encoders == nil && r.allow == nil {
+			if err, ok := ctx.Get("content.error").(error); ok {
+				r.service.contentError(ctx, err)
+				return
 			}
-			if v, ok := op["lang"]; ok {
-				language = v
+			next(ctx)
+			return
+		}
+		if !r.service.negotiate(ctx, r.encoderSet(), false) {
+			return
+		}
+		next(ctx)
+	}
+}
+
+// pathExtension checks if the media subtype is in the request URL path's
+// extension, when all media types are accepted. If the extension belongs to an
+// encoder, it's removed from the path and the request Accept header is changed
+// to the vendor media type, for the Negotiator.
+//
+//	GET /api/v1/users.xml  =>  Accept: application/vnd.relax+xml
+//
+// The extension is kept if the full path matches a route, such as a PSE
+// matching IDs with dots.
+func (svc *Service) pathExtension(r *http.Request) {
+	if r.Header.Get("Accept") != "*/*" {
+		return
+	}
+	ext := PathExt(r.URL.Path)
+	if ext == "" {
+		return
+	}
+	if _, ok := svc.encoders[mime.TypeByExtension(ext)]; !ok {
+		return
+	}
+	if _, _, err := svc.findHandler(r, nil, nil); err == nil {
+		return
+	}
+	r.URL.Path = strings.TrimSuffix(r.URL.Path, ext)
+	r.Header.Set("Accept", Content.Mediatype+"+"+ext[1:])
+}
+
+// mediaAlias changes the legacy media types in the request Accept and
+// Content-Type headers to their aliases in Service.MediaAliases.
+//
+//	Accept: text/json;q=0.9, application/xml  =>  Accept: application/json;q=0.9, application/xml
+func (svc *Service) mediaAlias(r *http.Request) {
+	if accept := r.Header.Get("Accept"); accept != "" {
+		ranges := strings.Split(accept, ",")
+		for i := range ranges {
+			ranges[i] = svc.aliasMediaType(strings.TrimSpace(ranges[i]))
+		}
+		r.Header.Set("Accept", strings.Join(ranges, ", "))
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		r.Header.Set("Content-Type", svc.aliasMediaType(ct))
+	}
+}
+
+// aliasMediaType returns the alias of media type 'value', with the parameters
+// of both. If 'value' has no alias, it's returned unchanged.
+func (svc *Service) aliasMediaType(value string) string {
+	mt, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return value
+	}
+	alias, ok := svc.MediaAliases[mt]
+	if !ok {
+		return value
+	}
+	amt, aparams, err := mime.ParseMediaType(alias)
+	if err != nil {
+		return value
+	}
+	for k, v := range aparams {
+		params[k] = v
+	}
+	if s := mime.FormatMediaType(amt, params); s != "" {
+		return s
+	}
+	return value
+}
+
+// Alternatives are the details sent with 406 responses, listing the
+// representations available, so clients can pick one.
+type Alternatives struct {
+	// MediaTypes are the media types of the service encoders.
+	MediaTypes []string `json:"media_types" xml:"media_types>type"`
+	// Vendor is the vendor media type template, see Content.
+	Vendor string `json:"vendor,omitempty" xml:"vendor,omitempty"`
+	// Versions are the content versions available.
+	Versions []string `json:"versions,omitempty" xml:"versions>version,omitempty"`
+	// Languages are the content languages available.
+	Languages []string `json:"languages,omitempty" xml:"languages>language,omitempty"`
+}
+
+// NewAlternatives returns the Alternatives for 'encoders', with the default
+// content version and language. Negotiators can use it with 406 responses;
+// the service adds the languages in its Catalog.
+func NewAlternatives(encoders map[string]Encoder) *Alternatives {
+	return &Alternatives{
+		MediaTypes: mediaTypes(encoders),
+		Vendor:     Content.Mediatype + "+{subtype}; version={version}; lang={language}",
+		Versions:   []string{Content.Version},
+		Languages:  []string{Content.Language},
+	}
+}
+
+// addLanguages adds the languages in 'catalog' to the alternatives, sorted
+// after the languages already listed.
+func (a *Alternatives) addLanguages(catalog Catalog) {
+	n := len(a.Languages)
+	for lang := range catalog {
+		found := false
+		for i := range a.Languages {
+			if a.Languages[i] == lang {
+				found = true
+				break
 			}
 		}
+		if !found {
+			a.Languages = append(a.Languages, lang)
+		}
+	}
+	sort.Strings(a.Languages[n:])
+}
 
-		// At this point we know the response media type.
-		ctx.Header().Set("Content-Type", encoder.ContentType())
+// PayloadDetails are the details sent with 413 and 415 responses, so clients
+// can correct their requests.
+type PayloadDetails struct {
+	// Supported is the list of media types accepted for request payloads.
+	Supported []string `json:"supported,omitempty" xml:"supported>type,omitempty"`
+	// MaxBodySize is the maximum payload size in bytes.
+	MaxBodySize int64 `json:"max_body_size,omitempty" xml:"max_body_size,omitempty"`
+}
 
-		// Pass the info down to other handlers.
-		ctx.Set("content.encoding", encoder.Accept())
-		ctx.Set("content.version", version)
-		ctx.Set("content.language", language)
-
-		// Now check for payload representation for unsafe methods: POST PUT PATCH.
-		if ctx.Request.Method[0] == 'P' {
-			// Content-Type: application/{subtype}
-			ct, _, err := mime.ParseMediaType(ctx.Request.Header.Get("Content-Type"))
-			if err != nil {
-				ctx.Error(http.StatusBadRequest, err.Error())
-				return
+// mediaTypes returns the sorted list of media types of 'encoders'.
+func mediaTypes(encoders map[string]Encoder) []string {
+	types := make([]string, 0, len(encoders))
+	for mt := range encoders {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// acceptEncoder returns the encoder with the highest quality in the Accept
+// header 'accept', or nil if none is in 'encoders'.
+func acceptEncoder(encoders map[string]Encoder, accept string) Encoder {
+	var best Encoder
+	var bestq float64
+	for _, r := range parseAccept(accept) {
+		if enc, ok := encoders[r.mediaType]; ok && r.q > bestq {
+			best, bestq = enc, r.q
+		}
+	}
+	return best
+}
+
+/*
+Consumes is a Filter that limits the request media types accepted by a route
+or resource. Requests with a payload in any other media type get a response
+with HTTP status 415-"Unsupported Media Type". Requests without a payload
+(GET, DELETE, ...) are not checked.
+
+	// this route only accepts XML payloads, but may respond in JSON.
+	res.POST("import", Import, relax.Consumes{"application/xml"})
+*/
+type Consumes []string
+
+// Run runs the filter. No info is passed.
+func (c Consumes) Run(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if ct, ok := ctx.Get("content.decoding").(string); ok {
+			allowed := false
+			for i := range c {
+				if c[i] == ct {
+					allowed = true
+					break
+				}
 			}
-			decoder, ok := svc.encoders[ct]
-			if !ok {
-				ctx.Error(http.StatusUnsupportedMediaType,
-					"That media type is not supported for transfer.",
-					"You may use type '"+json.Accept()+"'")
+			if !allowed {
+				ctx.Error(errUnsupportedType.Code, errUnsupportedType.Message, &PayloadDetails{Supported: c})
 				return
 			}
-			ctx.Decode = decoder.Decode
-			ctx.Set("content.decoding", ct)
 		}
-
 		next(ctx)
 	}
 }
@@ -0,0 +1,299 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax_test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+	xmlenc "github.com/srfrog/go-relax/encoder/xml"
+)
+
+type Note struct {
+	XMLName xml.Name `json:"-" xml:"note"`
+	Text    string   `json:"text" xml:"text"`
+}
+
+type Notes struct{}
+
+func (n *Notes) Index(ctx *relax.Context) {}
+
+func (n *Notes) Create(ctx *relax.Context) {
+	note := &Note{}
+	if err := ctx.Decode(ctx.Request.Body, note); err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.Respond(note, http.StatusCreated)
+}
+
+var testMixedRequests = []struct {
+	ContentType string
+	Accept      string
+	Body        string
+	Path        string
+	Status      int
+	Response    string
+}{
+	// same representation
+	{"application/json", "", `{"text":"hi"}`, "/notes", 201, `{"text":"hi"}`},
+	{"application/xml", "application/xml", `<note><text>hi</text></note>`, "/notes", 201, `<note><text>hi</text></note>`},
+	// mixed representations
+	{"application/json", "application/xml", `{"text":"hi"}`, "/notes", 201, `<note><text>hi</text></note>`},
+	{"application/xml; charset=utf-8", "application/json", `<note><text>hi</text></note>`, "/notes", 201, `{"text":"hi"}`},
+	{"application/vnd.codehack.relax+xml", "application/vnd.codehack.relax+json", `<note><text>hi</text></note>`, "/notes", 201, `{"text":"hi"}`},
+	{"application/json", "application/json;q=0.5, application/xml", `{"text":"hi"}`, "/notes", 201, `<note><text>hi</text></note>`},
+	// unsupported response type
+	{"application/json", "application/vnd.codehack.relax+csv", `{"text":"hi"}`, "/notes", 406, `{"code":406,"message":"That media type is not supported for response.","details":{"media_types":["application/json","application/xml"],"vendor":"application/vnd.codehack.relax+{subtype}; version={version}; lang={language}","versions":["current"],"languages":["en-US"]}}`},
+	// unsupported request type
+	{"text/csv", "", `text`, "/notes", 415, ``},
+	// payload too large
+	{"application/json", "", `{"text":"` + strings.Repeat("x", 2<<20) + `"}`, "/notes", 413, `{"code":413,"message":"The request payload is too large.","details":{"max_body_size":2097152}}`},
+	// route allowlist
+	{"application/xml", "application/json", `<note><text>hi</text></note>`, "/notes/json", 415, ``},
+	{"application/json", "application/xml", `{"text":"hi"}`, "/notes/json", 201, `<note><text>hi</text></note>`},
+}
+
+func TestMixedEncoders(t *testing.T) {
+	svc := relax.NewService("/", xmlenc.NewEncoder())
+	notes := &Notes{}
+	svc.Resource(notes).
+		POST("", notes.Create).
+		POST("json", notes.Create, relax.Consumes{"application/json"})
+
+	for i, tr := range testMixedRequests {
+		req := httptest.NewRequest("POST", tr.Path, strings.NewReader(tr.Body))
+		req.Header.Set("Content-Type", tr.ContentType)
+		if tr.Accept != "" {
+			req.Header.Set("Accept", tr.Accept)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tr.Status {
+			t.Errorf("%d: expected status %d, got %d: %s", i, tr.Status, w.Code, w.Body.String())
+			continue
+		}
+		if !strings.HasSuffix(strings.TrimSpace(w.Body.String()), tr.Response) {
+			t.Errorf("%d: expected response %s, got %s", i, tr.Response, w.Body.String())
+		}
+	}
+}
+
+var testPathExtensions = []struct {
+	Path        string
+	Extensions  bool
+	ContentType string
+	Name        string
+}{
+	{"/notes/abc.xml", true, "application/xml", "abc"},
+	{"/notes/abc.xml", false, "application/json", ""},
+	{"/notes/files/abc.xml", true, "application/json", "abc.xml"},
+	{"/notes/files/1.2.3", true, "application/json", "1.2.3"},
+	{"/notes/v1.2/abc", true, "application/json", "abc"},
+}
+
+func TestPathExtensions(t *testing.T) {
+	for i, tr := range testPathExtensions {
+		var name string
+		svc := relax.NewService("/", xmlenc.NewEncoder())
+		svc.PathExtensions = tr.Extensions
+		notes := &Notes{}
+		svc.Resource(notes).
+			GET("{word:name}", func(ctx *relax.Context) { name = ctx.PathValues.Get("name") }).
+			GET("files/{re:(.+)}", func(ctx *relax.Context) { name = ctx.PathValues.Get("_1") }).
+			GET("v1.2/{name}", func(ctx *relax.Context) { name = ctx.PathValues.Get("name") })
+
+		req := httptest.NewRequest("GET", tr.Path, nil)
+		req.Header.Set("Accept", "*/*")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tr.ContentType) {
+			t.Errorf("%d: expected content type %s, got %s", i, tr.ContentType, ct)
+		}
+		if name != tr.Name {
+			t.Errorf("%d: expected path value %q, got %q", i, tr.Name, name)
+		}
+	}
+}
+
+func TestMediaAliases(t *testing.T) {
+	var version string
+	svc := relax.NewService("/", xmlenc.NewEncoder())
+	svc.MediaAliases = map[string]string{
+		"text/json":                       "application/json",
+		"text/xml":                        "application/xml",
+		"application/vnd.company.v1+json": "application/vnd.codehack.relax+json; version=v1",
+	}
+	notes := &Notes{}
+	svc.Resource(notes).
+		GET("", func(ctx *relax.Context) { version = ctx.Get("content.version").(string) }).
+		POST("", notes.Create)
+
+	req := httptest.NewRequest("GET", "/notes", nil)
+	req.Header.Set("Accept", "application/vnd.company.v1+json")
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected content type application/json, got %s", ct)
+	}
+	if version != "v1" {
+		t.Errorf("expected version v1, got %q", version)
+	}
+
+	req = httptest.NewRequest("POST", "/notes", strings.NewReader(`{"text":"hi"}`))
+	req.Header.Set("Content-Type", "text/json")
+	req.Header.Set("Accept", "text/xml")
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated || !strings.HasSuffix(strings.TrimSpace(w.Body.String()), `<note><text>hi</text></note>`) {
+		t.Errorf("expected XML note, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+type Reports struct{}
+
+func (r *Reports) Index(ctx *relax.Context) { ctx.Respond(&Note{Text: "report"}) }
+
+type Events struct{}
+
+func (e *Events) Index(ctx *relax.Context) { ctx.Respond(&Note{Text: "event"}) }
+
+func TestResourceEncoders(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Resource(&Notes{}).GET("", func(ctx *relax.Context) { ctx.Respond(&Note{Text: "note"}) })
+	svc.Resource(&Reports{}).UseEncoder(xmlenc.NewEncoder())
+	svc.Resource(&Events{}).UseEncoder(xmlenc.NewEncoder()).AllowOnly("application/json")
+
+	tests := []struct {
+		Path        string
+		Accept      string
+		Status      int
+		ContentType string
+	}{
+		{"/notes", "application/json", 200, "application/json"},
+		{"/notes", "application/vnd.codehack.relax+xml", 406, "application/json"},
+		{"/reports", "application/vnd.codehack.relax+xml", 200, "application/xml"},
+		{"/reports", "application/json", 200, "application/json"},
+		{"/events", "application/json", 200, "application/json"},
+		{"/events", "application/vnd.codehack.relax+xml", 406, "application/json"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", tt.Path, nil)
+		req.Header.Set("Accept", tt.Accept)
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || !strings.HasPrefix(w.Header().Get("Content-Type"), tt.ContentType) {
+			t.Errorf("%d: expected %d %s, got %d %s: %s", i, tt.Status, tt.ContentType, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestAcceptPatch(t *testing.T) {
+	svc := relax.NewService("/", xmlenc.NewEncoder())
+	notes := &Notes{}
+	svc.Resource(notes).POST("", notes.Create).PATCH("", notes.Create)
+	svc.Resource(&Events{}).AllowOnly("application/json").POST("", notes.Create)
+
+	tests := []struct {
+		Path        string
+		AcceptPost  string
+		AcceptPatch string
+	}{
+		{"/notes", "application/json, application/xml", "application/json, application/xml"},
+		{"/events", "application/json", ""},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("OPTIONS", tt.Path, nil))
+		if w.Header().Get("Accept-Post") != tt.AcceptPost || w.Header().Get("Accept-Patch") != tt.AcceptPatch {
+			t.Errorf("%d: expected %q %q, got %v", i, tt.AcceptPost, tt.AcceptPatch, w.Header())
+		}
+	}
+}
+
+func TestContextEncoder(t *testing.T) {
+	svc := relax.NewService("/", xmlenc.NewEncoder())
+	svc.Resource(&Notes{}).POST("", func(ctx *relax.Context) {
+		if ctx.Decoder().Accept() != "application/xml" {
+			t.Errorf("expected XML decoder, got %s", ctx.Decoder().Accept())
+		}
+		if enc, ok := ctx.Encoder().(*relax.EncoderJSON); ok && ctx.Query().Has("pretty") {
+			pretty := *enc
+			pretty.Indented = true
+			ctx.SetEncoder(&pretty)
+		}
+		ctx.Respond(&Note{Text: "hi"})
+	})
+
+	req := httptest.NewRequest("POST", "/notes?pretty", strings.NewReader(`<note><text>hi</text></note>`))
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "\n\t\"text\": \"hi\"") {
+		t.Errorf("expected indented JSON, got %s", w.Body.String())
+	}
+}
+
+func TestNegotiatorAlternatives(t *testing.T) {
+	var languages []string
+	svc := relax.NewService("/")
+	svc.Use(relax.NegotiatorFunc(func(r *http.Request, encoders map[string]relax.Encoder) (*relax.Negotiation, error) {
+		return nil, &relax.StatusError{Code: 406, Message: "Nope.", Details: &relax.Alternatives{Languages: languages}}
+	}))
+	svc.Resource(&Notes{})
+
+	tests := []struct {
+		Languages []string
+		Catalog   relax.Catalog
+		Response  string
+	}{
+		{nil, relax.Catalog{}, `{"code":406,"message":"Nope.","details":{"media_types":null}}`},
+		{[]string{"fr", "de"}, relax.Catalog{"es": {}, "en": {}}, `{"code":406,"message":"Nope.","details":{"media_types":null,"languages":["fr","de","en","es"]}}`},
+	}
+	for i, tt := range tests {
+		languages, svc.Catalog = tt.Languages, tt.Catalog
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", "/notes", nil))
+		if w.Code != 406 || strings.TrimSpace(w.Body.String()) != tt.Response {
+			t.Errorf("%d: expected 406 %s, got %d %s", i, tt.Response, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLocalizedNegotiation(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Catalog = relax.Catalog{"es": {
+		"That media type is not supported for response.": "Ese tipo de medio no es soportado para respuesta.",
+		"That media type is not supported for transfer.": "Ese tipo de medio no es soportado para transferencia.",
+	}}
+	notes := &Notes{}
+	svc.Resource(notes).POST("", notes.Create)
+
+	tests := []struct {
+		ContentType string
+		Accept      string
+		Code        int
+		Message     string
+	}{
+		{"application/json", "application/vnd.codehack.relax+csv", 406, "Ese tipo de medio no es soportado para respuesta."},
+		{"text/csv", "", 415, "Ese tipo de medio no es soportado para transferencia."},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", "/notes", strings.NewReader(`{"text":"hola"}`))
+		req.Header.Set("Content-Type", tt.ContentType)
+		req.Header.Set("Accept", tt.Accept)
+		req.Header.Set("Accept-Language", "es")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Code || !strings.Contains(w.Body.String(), `"message":"`+tt.Message+`"`) {
+			t.Errorf("%d: expected %d %q, got %d %s", i, tt.Code, tt.Message, w.Code, w.Body.String())
+		}
+	}
+}
@@ -5,13 +5,20 @@
 package relax
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"context"
@@ -26,6 +33,9 @@ type HandlerFunc func(*Context)
 type Context struct {
 	context.Context
 
+	// service points to the service handling this request.
+	service *Service
+
 	// ResponseWriter is the response object passed from ``net/http``.
 	http.ResponseWriter
 	wroteHeader bool
@@ -43,9 +53,21 @@ type Context struct {
 	//		ctx.PathValues.Get("_2")       // values are also accessible by index
 	//		ctx.PathValues["colors"]       // if more than one color value.
 	//
-	// See also: Router, url.Values
+	// See also: Router, url.Values, PathInt
 	PathValues url.Values
 
+	// PathParams are the values in PathValues, in the order matched in the
+	// path, with their PSE types. The numbered values in PathValues, "_1",
+	// "_2", ..., are the values in this list. It's nil if the router doesn't
+	// implement ParamsRouter.
+	//
+	//		for _, p := range ctx.PathParams {
+	//			fmt.Println(p.Name, p.Type, p.Value) // "id", "uint", "123"
+	//		}
+	//
+	// See also: PathParam
+	PathParams []PathParam
+
 	// Encode is the media encoding function requested by the client.
 	// To see the media type use:
 	//
@@ -63,6 +85,58 @@ type Context struct {
 	//
 	// See also: Encoder.Decode
 	Decode func(io.Reader, interface{}) error
+
+	// encoder and decoder are the negotiated encoders of Encode and Decode.
+	// See: Encoder, Decoder
+	encoder Encoder
+	decoder Encoder
+
+	// buffer is the response buffer of a captured context, and parent is the
+	// context it was captured from. See: Capture
+	buffer *ResponseBuffer
+	parent *Context
+
+	// trailers are the response trailers, shared with clones. See: Trailer
+	trailers *trailers
+
+	// query is the parsed request query, see Query.
+	query *QueryValues
+
+	// values is the request storage of Set and Get, shared with clones. It's
+	// kept with the context in the pool, to save allocations.
+	values *contextValues
+
+	// panics are the panic hooks of the request, shared with clones. See: OnPanic
+	panics *[]panicHook
+
+	// route is the entry of the resource route of the request, found once
+	// and shared with clones. See: RoutePattern
+	route *routeMemo
+
+	// origin is the context of the request that clones were made from, nil
+	// in the origin itself. hijacked is true if its connection was hijacked.
+	origin   *Context
+	hijacked bool
+}
+
+// contextValues is the storage of Set and Get. It's locked, so values can be
+// used by goroutines of the request while the handler runs.
+type contextValues struct {
+	sync.RWMutex
+	m map[string]interface{}
+}
+
+// routeMemo has the route entry of a request, so logs and filters don't look
+// it up on each use.
+type routeMemo struct {
+	sync.Once
+	entry *routeEntry
+}
+
+// panicHook is a hook added with OnPanic, and the context it was added with.
+type panicHook struct {
+	ctx *Context
+	fn  func(*Context, interface{})
 }
 
 // contextPool allows us to reuse some Context objects to conserve resources.
@@ -77,19 +151,51 @@ func newContext(parent context.Context, w http.ResponseWriter, r *http.Request)
 	ctx.Context = parent
 	ctx.ResponseWriter = w
 	ctx.Request = r
+	if ctx.trailers == nil {
+		ctx.trailers = new(trailers)
+	}
+	ctx.trailers.reset(ctx)
+	if ctx.values == nil {
+		ctx.values = new(contextValues)
+	}
+	if ctx.route == nil {
+		ctx.route = new(routeMemo)
+	}
 	return ctx
 }
 
 // free frees a Context object back to the usage pool for later, to conserve
 // system resources.
 func (ctx *Context) free() {
+	ctx.service = nil
 	ctx.ResponseWriter = nil
 	ctx.wroteHeader = false
 	ctx.status = 0
 	ctx.bytes = 0
 	ctx.PathValues = nil
+	ctx.PathParams = nil
+	ctx.query = nil
+	if ctx.values != nil {
+		ctx.values.Lock()
+		for k := range ctx.values.m {
+			delete(ctx.values.m, k)
+		}
+		ctx.values.Unlock()
+	}
+	if ctx.panics != nil {
+		*ctx.panics = (*ctx.panics)[:0]
+	}
+	if ctx.route != nil {
+		*ctx.route = routeMemo{}
+	}
+	ctx.origin = nil
+	ctx.hijacked = false
 	ctx.Decode = nil
 	ctx.Encode = nil
+	ctx.decoder = nil
+	ctx.encoder = nil
+	ctx.buffer = nil
+	ctx.parent = nil
 	contextPool.Put(ctx)
 }
 
@@ -98,27 +204,228 @@ func (ctx *Context) free() {
 func (ctx *Context) Clone(w http.ResponseWriter) *Context {
 	clone := contextPool.Get().(*Context)
 	clone.Context = ctx.Context
+	clone.service = ctx.service
 	clone.ResponseWriter = w
 	clone.Request = ctx.Request
 	clone.PathValues = ctx.PathValues
+	clone.PathParams = ctx.PathParams
+	clone.query = ctx.query
+	if ctx.values == nil {
+		ctx.values = new(contextValues)
+	}
+	clone.values = ctx.values
+	if ctx.panics == nil {
+		ctx.panics = new([]panicHook)
+	}
+	clone.panics = ctx.panics
+	if ctx.route == nil {
+		ctx.route = new(routeMemo)
+	}
+	clone.route = ctx.route
+	clone.origin = ctx.root()
 	clone.bytes = ctx.bytes
 	clone.Decode = ctx.Decode
 	clone.Encode = ctx.Encode
+	clone.decoder = ctx.decoder
+	clone.encoder = ctx.encoder
+	clone.trailers = ctx.trailers
+	return clone
+}
+
+/*
+Capture returns a clone of the context in buffered mode; the response headers,
+status and content are written to a ResponseBuffer instead of the client. This
+allows filters to inspect or change the response before it's sent. The buffered
+response must be sent with Release, or dropped with Discard.
+
+	func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+		return func(ctx *relax.Context) {
+			bctx := ctx.Capture()
+			next(bctx)
+			if bctx.Buffered().Status() == http.StatusOK {
+				bctx.Buffered().Header().Set("X-Checked", "yes")
+			}
+			bctx.Release()
+		}
+	}
+*/
+func (ctx *Context) Capture() *Context {
+	rb := NewResponseBuffer(ctx)
+	clone := ctx.Clone(rb)
+	clone.buffer = rb
+	clone.parent = ctx
 	return clone
 }
 
-// Set stores the value of key in the Context k/v tree.
+// Buffered returns the ResponseBuffer of a context returned by Capture, or nil
+// if the context is not in buffered mode or it was released.
+func (ctx *Context) Buffered() *ResponseBuffer {
+	return ctx.buffer
+}
+
+// Release sends the buffered response to the context it was captured from,
+// and frees the buffer. It does nothing if the context is not in buffered mode.
+// Returns the number of content bytes sent, or error on failure.
+// See also: Capture
+func (ctx *Context) Release() (int64, error) {
+	if ctx.buffer == nil {
+		return 0, nil
+	}
+	rb := ctx.buffer
+	ctx.buffer = nil
+	return rb.Flush(ctx.parent)
+}
+
+// Discard frees the buffered response without sending it, so the filter can
+// send a different response with the context it was captured from.
+// It does nothing if the context is not in buffered mode.
+// See also: Capture
+func (ctx *Context) Discard() {
+	if ctx.buffer == nil {
+		return
+	}
+	ctx.buffer.Free()
+	ctx.buffer = nil
+}
+
+// Set stores the value of key in the request storage. The storage is shared by
+// the context and its clones, and it's emptied when the request is done.
+// Set and Get are safe for concurrent use by the goroutines of the request,
+// such as filters that watch the handler.
 func (ctx *Context) Set(key string, value interface{}) {
-	ctx.Context = context.WithValue(ctx.Context, key, value)
+	if ctx.values == nil {
+		ctx.values = new(contextValues)
+	}
+	ctx.values.Lock()
+	if ctx.values.m == nil {
+		ctx.values.m = make(map[string]interface{})
+	}
+	ctx.values.m[key] = value
+	ctx.values.Unlock()
 }
 
 // Get retrieves the value of key from Context storage. The value is returned
 // as an interface so it must be converted to an actual type. If the type implements
 // fmt.Stringer then it may be used by functions that expect a string.
+// Keys not in the storage are looked up in the parent context.Context.
 func (ctx *Context) Get(key string) interface{} {
+	if ctx.values != nil {
+		ctx.values.RLock()
+		value, ok := ctx.values.m[key]
+		ctx.values.RUnlock()
+		if ok {
+			return value
+		}
+	}
+	if ctx.Context == nil {
+		return nil
+	}
+	return ctx.Context.Value(key)
+}
+
+// Value implements context.Context, so values stored with Set are found by
+// code that gets the Context as a context.Context.
+func (ctx *Context) Value(key interface{}) interface{} {
+	if k, ok := key.(string); ok {
+		return ctx.Get(k)
+	}
+	if ctx.Context == nil {
+		return nil
+	}
 	return ctx.Context.Value(key)
 }
 
+/*
+OnPanic adds 'fn' to the panic hooks of the request. If a handler panics, the
+hooks are called with the panic value, in reverse order, before the service
+Recovery handler responds. Each hook gets the context it was added with.
+Panics in hooks are logged and ignored.
+
+	func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+		return func(ctx *relax.Context) {
+			tx := f.DB.Begin()
+			ctx.OnPanic(func(ctx *relax.Context, err interface{}) {
+				tx.Rollback()
+			})
+			ctx.Set("tx", tx)
+			next(ctx)
+			tx.Commit()
+		}
+	}
+
+See also: PanicHandler
+*/
+func (ctx *Context) OnPanic(fn func(ctx *Context, err interface{})) {
+	if ctx.panics == nil {
+		ctx.panics = new([]panicHook)
+	}
+	*ctx.panics = append(*ctx.panics, panicHook{ctx, fn})
+}
+
+// runPanicHooks calls the panic hooks with panic value 'err', in reverse order.
+func (ctx *Context) runPanicHooks(err interface{}) {
+	if ctx.panics == nil {
+		return
+	}
+	hooks := *ctx.panics
+	for i := len(hooks) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if e := recover(); e != nil && ctx.service != nil {
+					ctx.service.log.Errorf("relax: Panic in panic hook: %s", e)
+				}
+			}()
+			hooks[i].fn(hooks[i].ctx, err)
+		}()
+	}
+}
+
+// Nonce returns a random value that is unique to this request, meant for
+// Content-Security-Policy nonces. The value is made on first use and the same
+// value is returned for the rest of the request, so the CSP header and the
+// rendered content agree.
+//
+//		<script nonce="{{ .Nonce }}">...</script>
+//
+// See also: security.Filter.CSPOptions
+func (ctx *Context) Nonce() string {
+	if nonce, ok := ctx.Get("context.nonce").(string); ok {
+		return nonce
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	// URL-safe characters, so templates don't escape the value in attributes.
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	ctx.Set("context.nonce", nonce)
+	return nonce
+}
+
+// Debugf writes a debug log entry for this request. If a LogBuffer was set in
+// "log.buffer", such as by the logs filter, the entry is kept in the buffer;
+// otherwise it goes to the service Log at LevelDebug.
+//
+//		ctx.Debugf("cache miss for %q", key)
+func (ctx *Context) Debugf(format string, args ...interface{}) {
+	if b, ok := ctx.Get("log.buffer").(*LogBuffer); ok {
+		b.Printf(format, args...)
+		return
+	}
+	if ctx.service != nil {
+		ctx.service.log.Debugf(format, args...)
+	}
+}
+
+// Log returns the Log of the service that runs the request, for filters and
+// handlers to log at any level. See: Service.Log
+func (ctx *Context) Log() *Log {
+	if ctx.service == nil {
+		return NewLog(nil)
+	}
+	return ctx.service.log
+}
+
 // Header implements ResponseWriter.Header
 func (ctx *Context) Header() http.Header {
 	return ctx.ResponseWriter.Header()
@@ -126,20 +433,48 @@ func (ctx *Context) Header() http.Header {
 
 // Write implements ResponseWriter.Write
 func (ctx *Context) Write(b []byte) (int, error) {
+	if ctx.root().hijacked {
+		return 0, http.ErrHijacked
+	}
+	if ctx.wroteHeader && !BodyAllowed(ctx.status) {
+		// the status doesn't allow content, drop it.
+		if len(b) > 0 {
+			ctx.Debugf("relax: Response content dropped, status %d can't have content", ctx.status)
+		}
+		return len(b), nil
+	}
+	if !ctx.wroteHeader {
+		// the first write sends the implicit status, the response is started.
+		ctx.wroteHeader = true
+		ctx.status = http.StatusOK
+	}
 	n, err := ctx.ResponseWriter.Write(b)
 	ctx.bytes += n
+	if t := ctx.trailers; t != nil && t.hash != nil && t.root == ctx {
+		t.hash.Write(b[:n])
+	}
 	return n, err
 }
 
 // WriteHeader will force a status code header, if one hasn't been set.
 // If no call to WriteHeader is done within this context, it defaults to
 // http.StatusOK (200), which is sent by net/http.
+// For status codes that can't have content, such as 204 and 304, the content
+// headers are removed and any content written after is dropped. See: BodyAllowed
 func (ctx *Context) WriteHeader(code int) {
-	if ctx.wroteHeader {
+	if ctx.wroteHeader || ctx.root().hijacked {
+		return
+	}
+	if code < 200 {
+		// informational, the final status is written later.
+		ctx.ResponseWriter.WriteHeader(code)
 		return
 	}
 	ctx.wroteHeader = true
 	ctx.status = code
+	if !BodyAllowed(code) {
+		stripContentHeaders(ctx.Header())
+	}
 	ctx.ResponseWriter.WriteHeader(code)
 }
 
@@ -162,8 +497,11 @@ should be contained within a structure.
 
 'v' is the object value to be encoded. 'code' is an optional HTTP status code.
 
-If at any point the response fails (due to encoding or system issues), an
-error is returned but not written back to the client.
+The value is encoded before the status is sent. If encoding fails, such as
+with values that the encoder can't marshal, the service EncodeFailure handler
+responds instead, and the error is returned. If the response fails to be
+written (system issues), the error is returned but not written back to the
+client.
 
 	type Message struct {
 		Status int    `json:"status"`
@@ -172,27 +510,84 @@ error is returned but not written back to the client.
 
 	ctx.Respond(&Message{Status: 201, Text: "Ticket created"}, http.StatusCreated)
 
-See also: Context.Encode, WriteHeader
+If the service has a ResponseWrapper, the value it returns for 'v' is encoded
+instead. So all responses can have a standard envelope, or internal fields
+can be stripped, in one place. Error responses are sent with Respond too, the
+wrapper gets them as *StatusError values:
+
+	svc.ResponseWrapper = func(ctx *relax.Context, v interface{}) interface{} {
+		if _, ok := v.(*relax.StatusError); ok {
+			return map[string]interface{}{"error": v}
+		}
+		return map[string]interface{}{"data": v, "meta": ctx.Get("page")}
+	}
+
+See also: Context.Encode, WriteHeader, Service.EncodeFailure, Service.ResponseWrapper
 */
 func (ctx *Context) Respond(v interface{}, code ...int) error {
-	if code != nil {
-		ctx.WriteHeader(code[0])
+	buf := getBuffer(int(atomic.LoadInt32(&respondSizeHint)))
+	defer putBuffer(buf)
+
+	if ctx.service != nil && ctx.service.ResponseWrapper != nil {
+		v = ctx.service.ResponseWrapper(ctx, v)
 	}
-	err := ctx.Encode(ctx.ResponseWriter, v)
-	if err != nil {
+	if err := ctx.Encode(buf, v); err != nil {
 		// encoding failed, most likely we tried to encode something that hasn't
 		// been made marshable yet.
-		panic(err)
+		if ctx.service != nil && ctx.service.EncodeFailure != nil {
+			ctx.service.EncodeFailure(ctx, v, err)
+		} else {
+			EncodeFailed(ctx, v, err)
+		}
+		return err
+	}
+	if buf.Len() < math.MaxInt32 {
+		atomic.StoreInt32(&respondSizeHint, int32(buf.Len()))
 	}
+	if code != nil {
+		ctx.WriteHeader(code[0])
+	}
+	_, err := ctx.Write(buf.Bytes())
 	return err
 }
 
+// respondSizeHint is the size of the last response encoded by Respond, used
+// to pick the buffer from the pools.
+var respondSizeHint int32
+
+// EncodeFailureHandler responds to a request whose response value 'v' failed
+// to be encoded with error 'err'. See: Service.EncodeFailure
+type EncodeFailureHandler func(ctx *Context, v interface{}, err error)
+
+// EncodeFailed logs the encoding error and responds with HTTP status code
+// 500-"Internal Server Error", without the details of the error. It does
+// nothing else if the response was already started.
+// This function is the default service encode failure handler.
+func EncodeFailed(ctx *Context, v interface{}, err error) {
+	if ctx.service != nil {
+		ctx.service.log.Errorf("relax: Encoding %T failed: %s", v, err)
+	}
+	if ctx.wroteHeader {
+		return
+	}
+	var response interface{} = &StatusError{
+		Code:    errEncodeFailed.Code,
+		Message: ctx.Localize(errEncodeFailed.Message),
+	}
+	if ctx.service != nil && ctx.service.ResponseWrapper != nil {
+		response = ctx.service.ResponseWrapper(ctx, response)
+	}
+	ctx.WriteHeader(http.StatusInternalServerError)
+	ctx.Encode(ctx, response)
+}
+
 /*
 Error sends an error response, with appropriate encoding. It basically calls
 Respond using a status code and wrapping the message in a StatusError object.
 
 'code' is the HTTP status code of the error. 'message' is the actual error message
 or reason. 'details' are additional details about this error (optional).
+The message is localized using the service Catalog, if a translation exists.
 
 	type RouteDetails struct {
 		Method string `json:"method"`
@@ -203,13 +598,91 @@ or reason. 'details' are additional details about this error (optional).
 See also: Respond, StatusError
 */
 func (ctx *Context) Error(code int, message string, details ...interface{}) {
-	response := &StatusError{code, message, nil}
+	response := &StatusError{code, ctx.Localize(message), nil}
 	if details != nil {
 		response.Details = details[0]
 	}
 	ctx.Respond(response, code)
 }
 
+/*
+DecodeError sends an error response for an error returned by Decode or Bind. If the
+payload is too large, the response has HTTP status 413-"Request Entity Too Large"
+and the size limit in the details. A StatusError, such as the validation errors
+of Bind, is sent with its code and details. Otherwise it's 400-"Bad Request".
+
+	if err := ctx.Decode(ctx.Request.Body, &user); err != nil {
+		ctx.DecodeError(err)
+		return
+	}
+*/
+func (ctx *Context) DecodeError(err error) {
+	if err == ErrBodyTooLarge {
+		limit, _ := ctx.Get("content.max_body_size").(int64)
+		ctx.Error(errPayloadTooLarge.Code, errPayloadTooLarge.Message, &PayloadDetails{MaxBodySize: limit})
+		return
+	}
+	if e, ok := err.(*StatusError); ok {
+		ctx.Error(e.Code, e.Message, e.Details)
+		return
+	}
+	ctx.Error(http.StatusBadRequest, err.Error())
+}
+
+// Localize returns the translation of 'msg' in the negotiated content language,
+// using the service Catalog. If no translation is found, 'msg' is returned.
+//
+// See also: Catalog, Service.Catalog
+func (ctx *Context) Localize(msg string) string {
+	if ctx.service == nil || ctx.service.Catalog == nil {
+		return msg
+	}
+	lang, _ := ctx.Get("content.language").(string)
+	return ctx.service.Catalog.Lookup(lang, msg)
+}
+
+// LogEntry has the fields of a request and its response, for structured logs.
+type LogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Duration  float64   `json:"duration"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+
+	// Debug are the buffered debug entries of the request, and DebugDropped
+	// the number of entries dropped, when the log filter logs them.
+	Debug        []string `json:"debug,omitempty"`
+	DebugDropped int      `json:"debug_dropped,omitempty"`
+}
+
+// LogEntry returns the log fields of this request. Duration is in seconds.
+// ClientIP is the proxied client address, or the remote address if not proxied.
+//
+// See also: Format
+func (ctx *Context) LogEntry() *LogEntry {
+	entry := &LogEntry{
+		Method: ctx.Request.Method,
+		Path:   ctx.Request.URL.Path,
+		Status: ctx.Status(),
+		Bytes:  ctx.Bytes(),
+	}
+	if t, ok := ctx.Get("request.start_time").(time.Time); ok {
+		entry.Time = t
+		entry.Duration = time.Since(t).Seconds()
+	}
+	entry.RequestID, _ = ctx.Get("request.id").(string)
+	if entry.ClientIP = GetRealIP(ctx.Request); entry.ClientIP == "unknown" {
+		entry.ClientIP = ctx.Request.RemoteAddr
+		if host, _, err := net.SplitHostPort(entry.ClientIP); err == nil {
+			entry.ClientIP = host
+		}
+	}
+	return entry
+}
+
 /*
 Format implements the fmt.Formatter interface, based on Apache HTTP's
 CustomLog directive. This allows a Context object to have Sprintf verbs for
@@ -222,23 +695,29 @@ its values. See: https://httpd.apache.org/docs/2.4/mod/mod_log_config.html#forma
 	%a  	Client remote address
 	%b  	Size of response in bytes, excluding headers. Or '-' if zero.
 	%#a 	Proxy client address, or unknown.
+	%e  	Response media type, from content negotiation. Or '-' if none.
 	%h  	Remote hostname. Will perform lookup.
+	%j  	Request and response fields as a JSON object (see LogEntry).
 	%l  	Remote ident, will write '-' (only for Apache log support).
 	%m  	Request method
+	%o  	Route path pattern matched, with PSE's. Or '-' if none.
 	%q  	Request query string.
 	%r  	Request line.
 	%#r 	Request line without protocol.
 	%s  	Response status code.
 	%#s 	Response status code and text.
 	%t  	Request time, as string.
-	%u  	Remote user, if any.
+	%u  	Remote user, from auth filters or the URL. Or '-' if none.
 	%v  	Request host name.
 	%A  	User agent.
 	%B  	Size of response in bytes, excluding headers.
 	%D  	Time lapsed to serve request, in seconds.
+	%E  	TLS version, such as "TLS1.3". Or '-' if not TLS.
+	%#E 	TLS version and cipher suite.
 	%H  	Request protocol.
 	%I  	Bytes received.
 	%L  	Request ID.
+	%N  	Negotiated protocol, such as "h2" or "http/1.1".
 	%P  	Server port used.
 	%R  	Referer.
 	%U  	Request path.
@@ -251,6 +730,11 @@ Example:
 	// Output:
 	// "GET /v1/" 192.168.1.10
 
+	// Print security and routing details.
+	fmt.Printf("%#E %[1]N %[1]u %[1]o", ctx)
+	// Output:
+	// TLS1.3 TLS_AES_128_GCM_SHA256 h2 alice /v1/users/{uint:id}
+
 */
 func (ctx *Context) Format(f fmt.State, c rune) {
 	var str string
@@ -275,14 +759,32 @@ func (ctx *Context) Format(f fmt.State, c rune) {
 		fallthrough
 	case 'B':
 		str = strconv.Itoa(ctx.Bytes())
+	case 'e':
+		if str, _ = ctx.Get("content.encoding").(string); str == "" {
+			f.Write([]byte{45})
+			return
+		}
 	case 'h':
 		t := strings.Split(ctx.Request.RemoteAddr, ":")
 		str = t[0]
+	case 'j':
+		b, err := json.Marshal(ctx.LogEntry())
+		if err != nil {
+			f.Write([]byte("%!(BADJSON)"))
+			return
+		}
+		pok = false
+		str = string(b)
 	case 'l':
 		f.Write([]byte{45})
 		return
 	case 'm':
 		str = ctx.Request.Method
+	case 'o':
+		if str = ctx.RoutePattern(); str == "" {
+			f.Write([]byte{45})
+			return
+		}
 	case 'q':
 		str = ctx.Request.URL.RawQuery
 	case 'r':
@@ -294,12 +796,15 @@ func (ctx *Context) Format(f fmt.State, c rune) {
 	case 's':
 		str = strconv.Itoa(ctx.Status())
 		if f.Flag('#') {
-			str += " " + http.StatusText(ctx.Status())
+			str += " " + StatusText(ctx.Status())
 		}
 	case 't':
 		t := ctx.Get("request.start_time").(time.Time)
 		str = t.Format("[02/Jan/2006:15:04:05 -0700]")
 	case 'u':
+		if str, _ = ctx.Get("auth.user").(string); str != "" {
+			break
+		}
 		// XXX: i dont think net/http sets User
 		if ctx.Request.URL.User == nil {
 			f.Write([]byte{45})
@@ -318,12 +823,23 @@ func (ctx *Context) Format(f fmt.State, c rune) {
 		}
 		pok = false
 		str = strconv.FormatFloat(time.Since(when).Seconds(), 'f', p, 32)
+	case 'E':
+		if ctx.Request.TLS == nil {
+			f.Write([]byte{45})
+			return
+		}
+		str = tlsVersionName(ctx.Request.TLS.Version)
+		if f.Flag('#') {
+			str += " " + tls.CipherSuiteName(ctx.Request.TLS.CipherSuite)
+		}
 	case 'H':
 		str = ctx.Request.Proto
 	case 'I':
 		str = fmt.Sprintf("%d", ctx.Request.ContentLength)
 	case 'L':
 		str = ctx.Get("request.id").(string)
+	case 'N':
+		str = negotiatedProtocol(ctx.Request)
 	case 'P':
 		s := strings.Split(ctx.Request.Host, ":")
 		if len(s) > 1 {
@@ -341,3 +857,34 @@ func (ctx *Context) Format(f fmt.State, c rune) {
 	}
 	f.Write([]byte(str))
 }
+
+// tlsVersionName returns the name of TLS version 'v', such as "TLS1.3".
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS1.0"
+	case tls.VersionTLS11:
+		return "TLS1.1"
+	case tls.VersionTLS12:
+		return "TLS1.2"
+	case tls.VersionTLS13:
+		return "TLS1.3"
+	}
+	return fmt.Sprintf("0x%04X", v)
+}
+
+// negotiatedProtocol returns the protocol of request 'r' as named by ALPN,
+// negotiated with TLS or guessed from the request protocol: "h2", "h2c" or
+// "http/1.1".
+func negotiatedProtocol(r *http.Request) string {
+	if r.TLS != nil && r.TLS.NegotiatedProtocol != "" {
+		return r.TLS.NegotiatedProtocol
+	}
+	if r.ProtoMajor == 2 {
+		if r.TLS != nil {
+			return "h2"
+		}
+		return "h2c"
+	}
+	return strings.ToLower(r.Proto)
+}
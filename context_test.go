@@ -0,0 +1,644 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func BenchmarkContextValues(b *testing.B) {
+	svc := NewService("/")
+	svc.Root().GET("ping", func(ctx *Context) {
+		for _, k := range []string{"auth.user", "auth.scopes", "log.buffer", "content.language"} {
+			ctx.Set(k, k)
+		}
+		for _, k := range []string{"request.id", "auth.user", "content.encoding", "missing"} {
+			_ = ctx.Get(k)
+		}
+	})
+	handler := svc.Adapter()
+	req := httptest.NewRequest("GET", "/ping", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handler(httptest.NewRecorder(), req)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().
+		GET("panic", func(ctx *Context) { panic("boom") }).
+		GET("late", func(ctx *Context) {
+			ctx.Respond(map[string]string{"ok": "yes"})
+			panic("boom")
+		})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 500 || w.Header().Get("Request-Id") == "" ||
+		w.Header().Get("Content-Type") != "application/json;charset=utf-8" {
+		t.Errorf("expected JSON 500 with request ID, got %d %v", w.Code, w.Header())
+	}
+
+	// the response was started, it's not changed.
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/late", nil))
+	if w.Code != 200 || w.Body.String() != "{\"ok\":\"yes\"}\n" {
+		t.Errorf("expected 200 response only, got %d %q", w.Code, w.Body.String())
+	}
+
+	svc.Recovery = RecoveryFunc(InternalServerError)
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 500 || w.Header().Get("Request-Id") == "" {
+		t.Errorf("expected 500 with request ID, got %d %v", w.Code, w.Header())
+	}
+}
+
+type testPanicFilter struct {
+	name  string
+	calls *[]string
+}
+
+func (f *testPanicFilter) Run(next HandlerFunc) HandlerFunc { return next }
+
+func (f *testPanicFilter) HandlePanic(ctx *Context, err interface{}) {
+	*f.calls = append(*f.calls, f.name)
+}
+
+func TestPanicHooks(t *testing.T) {
+	var calls []string
+	svc := NewService("/")
+	svc.Use(&testPanicFilter{"service", &calls})
+	svc.Root().GET("panic", func(ctx *Context) {
+		ctx.OnPanic(func(ctx *Context, err interface{}) { calls = append(calls, "handler") })
+		ctx.OnPanic(func(ctx *Context, err interface{}) { panic("again") })
+		panic("boom")
+	}, &testPanicFilter{"route", &calls})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 500 || fmt.Sprint(calls) != "[handler route service]" {
+		t.Errorf("expected 500 and hooks in reverse order, got %d %v", w.Code, calls)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	svc := NewService("/").RequestTimeout(20 * time.Millisecond)
+	svc.Root().
+		GET("slow", func(ctx *Context) { <-ctx.Done() }).
+		GET("late", func(ctx *Context) {
+			ctx.Respond(map[string]string{"ok": "yes"})
+			<-ctx.Done()
+		}).
+		GET("fast", func(ctx *Context) {
+			if _, ok := ctx.Request.Context().Deadline(); ok {
+				ctx.Respond("ok")
+			}
+		})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != 503 {
+		t.Errorf("expected 503, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != 200 || w.Body.Len() == 0 {
+		t.Errorf("expected 200 with deadline, got %d", w.Code)
+	}
+	// the response was sent before the deadline, it's not changed.
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/late", nil))
+	if w.Code != 200 || w.Body.String() != "{\"ok\":\"yes\"}\n" {
+		t.Errorf("expected 200 response only, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestStream(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().GET("export", func(ctx *Context) {
+		n := 0
+		ctx.Header().Set("Content-Type", "text/plain")
+		ctx.Stream(func(w io.Writer) bool {
+			n++
+			fmt.Fprintf(w, "part %d\n", n)
+			return n < 3
+		})
+	})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil))
+	if w.Code != 200 || !w.Flushed || w.Body.String() != "part 1\npart 2\npart 3\n" {
+		t.Errorf("expected 3 flushed parts, got %d %t %q", w.Code, w.Flushed, w.Body.String())
+	}
+}
+
+func TestBodyNotAllowed(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().
+		DELETE("item", func(ctx *Context) { ctx.Respond("deleted", 204) }).
+		GET("item", func(ctx *Context) {
+			ctx.Header().Set("ETag", `"v1"`)
+			ctx.WriteHeader(304)
+			ctx.Write([]byte("stale"))
+		})
+
+	for _, method := range []string{"DELETE", "GET"} {
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest(method, "/item", nil))
+		if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+			t.Errorf("%s: expected no content, got %d %v %q", method, w.Code, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	ctx := &Context{Request: httptest.NewRequest("GET", "/", nil)}
+	if !ctx.Accepts("image/png") || ctx.PreferredMediaType("image/png", "application/json") != "image/png" {
+		t.Error("expected any media type without Accept")
+	}
+	ctx.Request.Header.Set("Accept", "image/*;q=0.8, image/gif;q=0, application/json")
+	tests := []struct {
+		Type    string
+		Accepts bool
+	}{
+		{"image/png", true},
+		{"image/gif", false},
+		{"application/json", true},
+		{"text/html", false},
+	}
+	for i, tt := range tests {
+		if ctx.Accepts(tt.Type) != tt.Accepts {
+			t.Errorf("%d: expected Accepts(%q) %t", i, tt.Type, tt.Accepts)
+		}
+	}
+	if mt := ctx.PreferredMediaType("image/png", "application/json"); mt != "application/json" {
+		t.Errorf("expected application/json, got %q", mt)
+	}
+	if mt := ctx.PreferredMediaType("image/gif", "text/html"); mt != "" {
+		t.Errorf("expected none, got %q", mt)
+	}
+	if mt, err := ctx.Negotiate("text/csv", "application/json"); mt != "application/json" || err != nil {
+		t.Errorf("expected application/json, got %q %v", mt, err)
+	}
+	_, err := ctx.Negotiate("text/csv", "text/html")
+	if e, ok := err.(*StatusError); !ok || e.Code != http.StatusNotAcceptable ||
+		!reflect.DeepEqual(e.Details, &Alternatives{MediaTypes: []string{"text/csv", "text/html"}}) {
+		t.Errorf("expected 406 with the offers only, got %#v", err)
+	}
+
+	svc := NewService("/")
+	svc.Catalog = Catalog{"es": {errNotAcceptable.Message: "Ese tipo de medio no es soportado para respuesta."}}
+	ctx = &Context{Request: ctx.Request, service: svc}
+	ctx.Set("content.language", "es")
+	if _, err := ctx.Negotiate("text/csv"); err == nil || err.Error() != "Ese tipo de medio no es soportado para respuesta." {
+		t.Errorf("expected localized 406 message, got %v", err)
+	}
+}
+
+func TestHijack(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().GET("ws", func(ctx *Context) {
+		clone := ctx.Clone(NewResponseBuffer(ctx))
+		conn, rw, err := clone.Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %s", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello\n")
+		rw.Flush()
+		if _, err := ctx.Write([]byte("late")); err != http.ErrHijacked {
+			t.Errorf("expected ErrHijacked, got %v", err)
+		}
+	})
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("expected 101, got %d", res.StatusCode)
+	}
+
+	w := httptest.NewRecorder()
+	svc.Root().GET("nows", func(ctx *Context) {
+		if _, _, err := ctx.Hijack(); err != http.ErrNotSupported {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+	})
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/nows", nil))
+}
+
+func TestServeContent(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().
+		GET("report", func(ctx *Context) {
+			ctx.ServeContent("report.csv", time.Time{}, strings.NewReader("a,b\nc,d\n"))
+		}).
+		GET("export", func(ctx *Context) {
+			ctx.Attachment("export.csv", io.LimitReader(strings.NewReader("a,b\n"), 4))
+		}).
+		GET("missing", func(ctx *Context) {
+			ctx.ServeFile("testdata/missing.pdf")
+		})
+
+	req := httptest.NewRequest("GET", "/report", nil)
+	req.Header.Set("Range", "bytes=4-6")
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	if w.Code != 206 || w.Body.String() != "c,d" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("expected partial CSV, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil))
+	if w.Code != 200 || w.Body.String() != "a,b\n" || w.Header().Get("Content-Disposition") != `attachment; filename=export.csv` {
+		t.Errorf("expected CSV attachment, got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != 404 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("expected 404 error, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestResponders(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().
+		GET("old", func(ctx *Context) { ctx.Redirect(http.StatusMovedPermanently, "/new") }).
+		DELETE("item", func(ctx *Context) { ctx.NoContent() }).
+		PUT("item", func(ctx *Context) { ctx.Created("/item/1", map[string]int{"id": 1}) }).
+		PATCH("item", func(ctx *Context) { ctx.Accepted("/jobs/1") })
+
+	tests := []struct {
+		Method, Path string
+		Status       int
+		Location     string
+		Body         string
+	}{
+		{"GET", "/old", 301, "/new", ""},
+		{"DELETE", "/item", 204, "", ""},
+		{"PUT", "/item", 201, "/item/1", `{"id":1}`},
+		{"PATCH", "/item", 202, "/jobs/1", ""},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.Method, tt.Path, nil)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || w.Header().Get("Location") != tt.Location || strings.TrimSpace(w.Body.String()) != tt.Body {
+			t.Errorf("%d: expected %d %q %q, got %d %v %q", i, tt.Status, tt.Location, tt.Body, w.Code, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestCookies(t *testing.T) {
+	svc := NewService("/").CookieKey([]byte("0123456789abcdef0123456789abcdef"))
+	var signed, encrypted string
+	var errs []error
+	svc.Root().
+		GET("login", func(ctx *Context) {
+			ctx.SetCookie(&http.Cookie{Name: "theme", Value: "dark"})
+			ctx.SetSignedCookie(&http.Cookie{Name: "user", Value: "alice"})
+			ctx.SetEncryptedCookie(&http.Cookie{Name: "token", Value: "s3cr3t"})
+		}).
+		GET("me", func(ctx *Context) {
+			signed, encrypted, errs = "", "", nil
+			if c, err := ctx.SignedCookie("user"); err == nil {
+				signed = c.Value
+			} else {
+				errs = append(errs, err)
+			}
+			if c, err := ctx.EncryptedCookie("token"); err == nil {
+				encrypted = c.Value
+			} else {
+				errs = append(errs, err)
+			}
+		})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 3 || cookies[0].Value != "dark" || strings.Contains(cookies[2].Value, "s3cr3t") {
+		t.Fatalf("expected 3 cookies, got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/me", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+	if signed != "alice" || encrypted != "s3cr3t" {
+		t.Errorf("expected cookie values, got %q %q: %v", signed, encrypted, errs)
+	}
+
+	req = httptest.NewRequest("GET", "/me", nil)
+	req.AddCookie(&http.Cookie{Name: "user", Value: "Ym9i." + strings.SplitN(cookies[1].Value, ".", 2)[1]})
+	tampered := []byte(cookies[2].Value)
+	tampered[len(tampered)-1] ^= 1
+	req.AddCookie(&http.Cookie{Name: "token", Value: string(tampered)})
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+	if len(errs) != 2 || errs[0] != ErrCookieInvalid || errs[1] != ErrCookieInvalid {
+		t.Errorf("expected invalid cookies, got %q %q: %v", signed, encrypted, errs)
+	}
+
+	// rotated keys still accept the cookies of old keys.
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	for i, keys := range [][][]byte{{newKey, []byte("0123456789abcdef0123456789abcdef")}, {newKey}} {
+		svc.CookieKey(keys[0], keys[1:]...)
+		req = httptest.NewRequest("GET", "/me", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		svc.ServeHTTP(httptest.NewRecorder(), req)
+		if valid := signed == "alice" && encrypted == "s3cr3t"; valid != (i == 0) {
+			t.Errorf("%d: expected valid cookies %t, got %q %q: %v", i, i == 0, signed, encrypted, errs)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for empty old key")
+		}
+	}()
+	svc.CookieKey(newKey, []byte(""))
+}
+
+func TestFormatVerbs(t *testing.T) {
+	var line string
+	svc := NewService("/")
+	svc.Root().GET("users/{uint:id}", func(ctx *Context) {
+		ctx.Set("auth.user", "alice")
+		line = fmt.Sprintf("%#E|%[1]N|%[1]e|%[1]u|%[1]o", ctx)
+	})
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, NegotiatedProtocol: "h2"}
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+	if expected := "TLS1.3 TLS_AES_128_GCM_SHA256|h2|application/json|alice|/users/{uint:id}"; line != expected {
+		t.Errorf("expected %q, got %q", expected, line)
+	}
+
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/2", nil))
+	if expected := "-|http/1.1|application/json|alice|/users/{uint:id}"; line != expected {
+		t.Errorf("expected %q, got %q", expected, line)
+	}
+}
+
+// pushRecorder is a ResponseRecorder that supports HTTP/2 push.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (r *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	r.pushed = append(r.pushed, target)
+	return nil
+}
+
+// wrapWriter is a ResponseWriter set by a filter, which can be unwrapped.
+type wrapWriter struct{ http.ResponseWriter }
+
+func (w *wrapWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+func TestWriterPassthrough(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().
+		GET("buffered", func(ctx *Context) {
+			clone := ctx.Clone(NewResponseBuffer(ctx))
+			if err := clone.Push("/style.css", nil); err != nil {
+				t.Errorf("expected push, got %s", err)
+			}
+			if _, ok := clone.Unwrap().(*pushRecorder); !ok {
+				t.Errorf("expected connection writer, got %T", clone.Unwrap())
+			}
+		}).
+		GET("wrapped", func(ctx *Context) {
+			clone := ctx.Clone(&wrapWriter{ctx})
+			clone.Write([]byte("part"))
+			clone.Flush()
+		})
+
+	w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/buffered", nil))
+	if len(w.pushed) != 1 {
+		t.Errorf("expected 1 push, got %v", w.pushed)
+	}
+
+	rec := httptest.NewRecorder()
+	svc.ServeHTTP(rec, httptest.NewRequest("GET", "/wrapped", nil))
+	if !rec.Flushed || rec.Body.String() != "part" {
+		t.Errorf("expected flushed part, got %t %q", rec.Flushed, rec.Body.String())
+	}
+}
+
+func TestRespondCached(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	svc := NewService("/")
+	svc.Root().
+		GET("user", func(ctx *Context) { ctx.RespondCached(map[string]int{"version": 7}, "v7", modified) }).
+		PUT("user", func(ctx *Context) { ctx.RespondCached(map[string]int{"version": 8}, "W/v8", time.Time{}) })
+
+	tests := []struct {
+		Method, Header, Value string
+		Status                int
+		ETag                  string
+	}{
+		{"GET", "", "", 200, `"v7"`},
+		{"GET", "If-None-Match", `"v6", W/"v7"`, 304, `"v7"`},
+		{"GET", "If-None-Match", `"v6"`, 200, `"v7"`},
+		{"GET", "If-Modified-Since", modified.Format(http.TimeFormat), 304, `"v7"`},
+		{"GET", "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), 200, `"v7"`},
+		{"PUT", "If-None-Match", "*", 200, `W/"v8"`},
+		{"PUT", "If-None-Match", `"v8"`, 200, `W/"v8"`},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.Method, "/user", nil)
+		req.Header.Set("Content-Type", "application/json")
+		if tt.Header != "" {
+			req.Header.Set(tt.Header, tt.Value)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || w.Header().Get("ETag") != tt.ETag || (tt.Status != 200 && w.Body.Len() > 0) {
+			t.Errorf("%d: expected %d %s, got %d %v %q", i, tt.Status, tt.ETag, w.Code, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestEncodeFailure(t *testing.T) {
+	var respondErr error
+	svc := NewService("/")
+	svc.Root().GET("bad", func(ctx *Context) {
+		respondErr = ctx.Respond(map[string]interface{}{"ch": make(chan int)}, http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/bad", nil))
+	if respondErr == nil || w.Code != 500 || !strings.Contains(w.Body.String(), "The response could not be encoded.") {
+		t.Errorf("expected encoded 500 and error, got %v %d %q", respondErr, w.Code, w.Body.String())
+	}
+
+	var failed interface{}
+	svc.EncodeFailure = func(ctx *Context, v interface{}, err error) {
+		failed = v
+		ctx.Error(http.StatusBadGateway, "upstream data")
+	}
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/bad", nil))
+	if failed == nil || w.Code != 502 {
+		t.Errorf("expected custom handler response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestResponseWrapper(t *testing.T) {
+	svc := NewService("/")
+	svc.ResponseWrapper = func(ctx *Context, v interface{}) interface{} {
+		if _, ok := v.(*StatusError); ok {
+			return map[string]interface{}{"error": v}
+		}
+		return map[string]interface{}{"data": v}
+	}
+	svc.Root().
+		GET("ok", func(ctx *Context) { ctx.Respond([]int{1, 2}) }).
+		GET("fail", func(ctx *Context) { ctx.Error(http.StatusConflict, "nope") }).
+		GET("bad", func(ctx *Context) { ctx.Respond(make(chan int)) })
+
+	tests := []struct {
+		Path string
+		Code int
+		Body string
+	}{
+		{"/ok", 200, `{"data":[1,2]}`},
+		{"/fail", 409, `{"error":{"code":409,"message":"nope"}}`},
+		{"/bad", 500, `{"error":{"code":500,"message":"The response could not be encoded."}}`},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", tt.Path, nil))
+		if w.Code != tt.Code || strings.TrimSpace(w.Body.String()) != tt.Body {
+			t.Errorf("%d: expected %d %s, got %d %s", i, tt.Code, tt.Body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestErrorCatalog(t *testing.T) {
+	errNoReport := RegisterError(&StatusError{http.StatusNotFound, "That report was not found.", nil}, "No report has the id.")
+	svc := NewService("/")
+	svc.Catalog = Catalog{"es": {errNoReport.Message: "Ese reporte no fue encontrado."}}
+
+	var found bool
+	framework := map[string]bool{errMethodNotAllowed.Message: false, errInternal.Message: false}
+	errs := svc.ErrorCatalog()
+	for i, e := range errs {
+		if _, ok := framework[e.Message]; ok {
+			framework[e.Message] = true
+		}
+		if i > 0 && e.Code < errs[i-1].Code {
+			t.Errorf("expected errors sorted by code, got %d after %d", e.Code, errs[i-1].Code)
+		}
+		if e.Message == errNoReport.Message {
+			found = e.Code == 404 && e.Description == "No report has the id." &&
+				e.Translations["es"] == "Ese reporte no fue encontrado."
+		}
+	}
+	if !found || len(errs) < 2 {
+		t.Errorf("expected registered error in catalog, got %v", errs)
+	}
+	for message, listed := range framework {
+		if !listed {
+			t.Errorf("expected framework error %q in catalog", message)
+		}
+	}
+}
+
+func TestValuesConcurrent(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().GET("", func(ctx *Context) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				ctx.Get("step")
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			ctx.Set("step", i)
+		}
+		<-done
+	})
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestCapture(t *testing.T) {
+	var captured *ResponseBuffer
+	svc := NewService("/")
+	capture := func(discard bool) HandlerFunc {
+		return func(ctx *Context) {
+			bctx := ctx.Capture()
+			captured = bctx.Buffered()
+			bctx.Header().Set("X-Handler", "yes")
+			bctx.WriteHeader(http.StatusCreated)
+			bctx.Write([]byte("captured"))
+			if ctx.wroteHeader || ctx.Bytes() != 0 {
+				t.Error("expected nothing sent while captured")
+			}
+			if discard {
+				bctx.Discard()
+				ctx.WriteHeader(http.StatusAccepted)
+				ctx.Write([]byte("replaced"))
+			} else if n, err := bctx.Release(); n != 8 || err != nil {
+				t.Errorf("expected 8 bytes released, got %d %v", n, err)
+			}
+			if bctx.Buffered() != nil || captured.header != nil || captured.Len() != 0 {
+				t.Error("expected captured buffer freed")
+			}
+			if n, err := bctx.Release(); n != 0 || err != nil {
+				t.Errorf("expected nothing to release again, got %d %v", n, err)
+			}
+			bctx.Discard()
+		}
+	}
+	svc.Root().
+		GET("release", capture(false)).
+		GET("discard", capture(true))
+
+	tests := []struct {
+		Path, Handler string
+		Code          int
+		Body          string
+	}{
+		{"/release", "yes", http.StatusCreated, "captured"},
+		{"/discard", "", http.StatusAccepted, "replaced"},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", tt.Path, nil))
+		if w.Code != tt.Code || w.Body.String() != tt.Body || w.Header().Get("X-Handler") != tt.Handler {
+			t.Errorf("%d: expected %d %q, got %d %q %v", i, tt.Code, tt.Body, w.Code, w.Body.String(), w.Header())
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// minCookieKeySize is the minimum size of the cookie keys, in bytes.
+const minCookieKeySize = 32
+
+/*
+CookieKey sets the secret 'key' used to sign and encrypt cookies, with
+Context.SetSignedCookie and Context.SetEncryptedCookie. The key should be
+random and at least 32 bytes long, and kept out of the source code:
+
+	svc.CookieKey([]byte(os.Getenv("COOKIE_KEY")))
+
+Separate keys for signing and encryption are derived from it. Changing the
+key invalidates all the cookies sent before, unless the previous keys are
+listed in 'old'. New cookies are always sent with 'key', but cookies sent with
+an old key are still accepted; so keys can be rotated without dropping the
+clients cookies, and old keys removed once those cookies expire:
+
+	svc.CookieKey(newKey, oldKey)
+
+Keys can be rotated while requests are served.
+This function panics if any of the keys is shorter than 32 bytes, such as
+keys read from an unset environment variable; a short key would let clients
+forge cookies.
+Returns the service itself, for chaining.
+*/
+func (svc *Service) CookieKey(key []byte, old ...[]byte) *Service {
+	keys := append([][]byte{key}, old...)
+	ring := &cookieKeyring{
+		signing: make([][]byte, len(keys)),
+		aeads:   make([]cipher.AEAD, len(keys)),
+	}
+	for i, k := range keys {
+		if len(k) < minCookieKeySize {
+			panic(fmt.Sprintf("relax: Cookie key %d is shorter than %d bytes", i, minCookieKeySize))
+		}
+		ring.signing[i] = cookieSubkey(k, "signed")
+		block, err := aes.NewCipher(cookieSubkey(k, "encrypted"))
+		if err != nil {
+			panic("relax: Cookie key cipher: " + err.Error())
+		}
+		if ring.aeads[i], err = cipher.NewGCM(block); err != nil {
+			panic("relax: Cookie key cipher: " + err.Error())
+		}
+	}
+	svc.cookieKeys.Store(ring)
+	return svc
+}
+
+// cookieKeyring has the keys of signed cookies and the ciphers of encrypted
+// cookies, derived from the service keys, the current key first.
+type cookieKeyring struct {
+	signing [][]byte
+	aeads   []cipher.AEAD
+}
+
+// cookieSubkey returns the key for 'purpose', derived from 'key'.
+func cookieSubkey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("relax " + purpose + " cookie"))
+	return mac.Sum(nil)
+}
+
+// cookieKeyring returns the keys of the service. Returns ErrCookieKey if the
+// service has no key.
+func (ctx *Context) cookieKeyring() (*cookieKeyring, error) {
+	if ctx.service == nil {
+		return nil, ErrCookieKey
+	}
+	ring, _ := ctx.service.cookieKeys.Load().(*cookieKeyring)
+	if ring == nil {
+		return nil, ErrCookieKey
+	}
+	return ring, nil
+}
+
+// SetCookie adds the Set-Cookie header for cookie 'c' to the response.
+// Cookies with invalid names are dropped. See also: http.SetCookie
+func (ctx *Context) SetCookie(c *http.Cookie) {
+	http.SetCookie(ctx, c)
+}
+
+// Cookie returns the request cookie 'name', or http.ErrNoCookie if not found.
+func (ctx *Context) Cookie(name string) (*http.Cookie, error) {
+	return ctx.Request.Cookie(name)
+}
+
+// cookieMAC returns the signature of the value of cookie 'name' with 'key'.
+func cookieMAC(key []byte, name, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + value))
+	return mac.Sum(nil)
+}
+
+/*
+SetSignedCookie is like SetCookie, but the value of cookie 'c' is signed with
+the service cookie key, so changes by the client can be detected. The value is
+not encrypted, it can be read by the client; use SetEncryptedCookie for
+secrets.
+
+	ctx.SetSignedCookie(&http.Cookie{Name: "session", Value: id, HttpOnly: true, Secure: true})
+
+Returns ErrCookieKey if the service has no cookie key. See: Service.CookieKey
+*/
+func (ctx *Context) SetSignedCookie(c *http.Cookie) error {
+	ring, err := ctx.cookieKeyring()
+	if err != nil {
+		return err
+	}
+	sc := *c
+	value := base64.RawURLEncoding.EncodeToString([]byte(c.Value))
+	sc.Value = value + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(ring.signing[0], c.Name, value))
+	ctx.SetCookie(&sc)
+	return nil
+}
+
+// SignedCookie returns the request cookie 'name' sent with SetSignedCookie,
+// with its original value. The signature is checked with the current and the
+// old service keys. Returns http.ErrNoCookie if not found, ErrCookieInvalid if
+// the signature doesn't match, or ErrCookieKey if the service has no cookie key.
+func (ctx *Context) SignedCookie(name string) (*http.Cookie, error) {
+	ring, err := ctx.cookieKeyring()
+	if err != nil {
+		return nil, err
+	}
+	c, err := ctx.Cookie(name)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i == -1 {
+		return nil, ErrCookieInvalid
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(c.Value[i+1:])
+	if err != nil {
+		return nil, ErrCookieInvalid
+	}
+	valid := false
+	for _, key := range ring.signing {
+		if hmac.Equal(sum, cookieMAC(key, name, c.Value[:i])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrCookieInvalid
+	}
+	value, err := base64.RawURLEncoding.DecodeString(c.Value[:i])
+	if err != nil {
+		return nil, ErrCookieInvalid
+	}
+	c.Value = string(value)
+	return c, nil
+}
+
+/*
+SetEncryptedCookie is like SetCookie, but the value of cookie 'c' is encrypted
+and authenticated with the service cookie key (AES-GCM), so the client can't
+read it nor change it.
+
+Returns ErrCookieKey if the service has no cookie key. See: Service.CookieKey
+*/
+func (ctx *Context) SetEncryptedCookie(c *http.Cookie) error {
+	ring, err := ctx.cookieKeyring()
+	if err != nil {
+		return err
+	}
+	aead := ring.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(c.Value)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sc := *c
+	sc.Value = base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(c.Value), []byte(c.Name)))
+	ctx.SetCookie(&sc)
+	return nil
+}
+
+// EncryptedCookie returns the request cookie 'name' sent with
+// SetEncryptedCookie, with its original value. It's decrypted with the current
+// or the old service keys. Returns http.ErrNoCookie if not found,
+// ErrCookieInvalid if it can't be decrypted, or ErrCookieKey if the service has
+// no cookie key.
+func (ctx *Context) EncryptedCookie(name string) (*http.Cookie, error) {
+	ring, err := ctx.cookieKeyring()
+	if err != nil {
+		return nil, err
+	}
+	c, err := ctx.Cookie(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return nil, ErrCookieInvalid
+	}
+	for _, aead := range ring.aeads {
+		if len(data) < aead.NonceSize() {
+			break
+		}
+		value, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+		if err == nil {
+			c.Value = string(value)
+			return c, nil
+		}
+	}
+	return nil, ErrCookieInvalid
+}
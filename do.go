@@ -0,0 +1,88 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// DoOption changes the request made by Service.Do, and returns it.
+type DoOption func(*http.Request) *http.Request
+
+// DoHeader is a DoOption that sets the request header 'key' to 'value'.
+func DoHeader(key, value string) DoOption {
+	return func(r *http.Request) *http.Request {
+		r.Header.Set(key, value)
+		return r
+	}
+}
+
+// DoWithContext is a DoOption that sets the request context to 'parent', for
+// cancellation and deadlines.
+func DoWithContext(parent context.Context) DoOption {
+	return func(r *http.Request) *http.Request {
+		return r.WithContext(parent)
+	}
+}
+
+// DoFrom is a DoOption for requests made while serving request 'ctx', such as
+// batches and includes. The request gets the context, remote address and the
+// headers Accept, Accept-Language, Authorization and Request-Id of 'ctx'.
+func DoFrom(ctx *Context) DoOption {
+	return func(r *http.Request) *http.Request {
+		for _, k := range []string{"Accept", "Accept-Language", "Authorization", "Request-Id"} {
+			if v := ctx.Request.Header.Get(k); v != "" {
+				r.Header.Set(k, v)
+			}
+		}
+		r.RemoteAddr = ctx.Request.RemoteAddr
+		return r.WithContext(ctx.Request.Context())
+	}
+}
+
+/*
+Do makes an in-process request to the service, through the service filters,
+content negotiation and the resource handlers, without a network hop. 'path'
+is an absolute path or a path relative to the service, with an optional
+query. 'body' is the request body, or nil; it's sent as "application/json"
+unless the Content-Type header is set with DoHeader. 'opts' change the request.
+
+	rb, err := svc.Do("GET", "users/123", nil, relax.DoFrom(ctx))
+	if err != nil {
+		return err
+	}
+	defer rb.Free()
+	if rb.Status() == http.StatusOK {
+		user := rb.Bytes()
+		...
+	}
+
+Returns the buffered response, which should be freed with Free after use; or
+an error if the request can't be made.
+*/
+func (svc *Service) Do(method, path string, body io.Reader, opts ...DoOption) (*ResponseBuffer, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, svc.URI.ResolveReference(ref).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, opt := range opts {
+		req = opt(req)
+	}
+
+	rb := responseBufferPool.Get().(*ResponseBuffer)
+	rb.header = make(http.Header)
+	svc.Adapter().ServeHTTP(rb, req)
+	return rb, nil
+}
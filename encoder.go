@@ -38,6 +38,13 @@ type Encoder interface {
 	Decode(io.Reader, interface{}) error
 }
 
+// BodyLimiter is implemented by encoders that limit the size of the payloads
+// they decode. The limit is checked before decoding, and sent with 413 responses.
+type BodyLimiter interface {
+	// BodyLimit returns the maximum payload size in bytes, or 0 if unlimited.
+	BodyLimit() int64
+}
+
 // EncoderJSON implements the Encoder interface. It encode/decodes JSON data.
 type EncoderJSON struct {
 	// MaxBodySize is the maximum size (in bytes) of JSON payload to read.
@@ -56,6 +63,17 @@ type EncoderJSON struct {
 	// ContentTypeHeader is the media type used in Content-Type HTTP header
 	// Defaults to "application/json;charset=utf-8"
 	ContentTypeHeader string
+
+	// TimeFormat is the layout used to encode time values, such as time.RFC3339
+	// to drop the fractional seconds; or TimeEpochMillis to encode them as the
+	// milliseconds since the Unix epoch. Decoding is not affected.
+	// Defaults to "", time.RFC3339Nano as in encoding/json.
+	TimeFormat string
+
+	// NullNonFinite if true, NaN and infinite floats are encoded as null.
+	// Otherwise encoding them fails with an error, as in encoding/json.
+	// Defaults to false
+	NullNonFinite bool
 }
 
 // NewEncoder returns an EncoderJSON object. This function will initiallize
@@ -75,6 +93,11 @@ func (e *EncoderJSON) Accept() string {
 	return e.AcceptHeader
 }
 
+// BodyLimit implements BodyLimiter, it returns MaxBodySize.
+func (e *EncoderJSON) BodyLimit() int64 {
+	return e.MaxBodySize
+}
+
 // ContentType returns the media type for JSON content, used in the
 // Content-Type header.
 func (e *EncoderJSON) ContentType() string {
@@ -82,19 +105,26 @@ func (e *EncoderJSON) ContentType() string {
 }
 
 // Encode will try to encode the value of v into JSON. If EncoderJSON.Indented
-// is true, then the JSON will be indented with tabs.
+// is true, then the JSON will be indented with tabs. Time values and
+// non-finite floats are encoded as set by TimeFormat and NullNonFinite.
+// The JSON is written at once by encoding/json, so nothing is written if
+// encoding fails.
 // Returns nil on success, error on failure.
 func (e *EncoderJSON) Encode(writer io.Writer, v interface{}) error {
-	if e.Indented {
-		// indented is much slower...
-		b, err := json.MarshalIndent(v, "", "\t")
-		if err != nil {
+	if e.TimeFormat != "" || e.NullNonFinite {
+		hook := &jsonHook{timeFormat: e.TimeFormat, nullNonFinite: e.NullNonFinite}
+		var err error
+		if v, err = hook.rewrite(v); err != nil {
 			return err
 		}
-		_, err = writer.Write(b)
-		return err
 	}
-	return json.NewEncoder(writer).Encode(v)
+
+	enc := json.NewEncoder(writer)
+	if e.Indented {
+		// indented is much slower...
+		enc.SetIndent("", "\t")
+	}
+	return enc.Encode(v)
 }
 
 // Decode reads a JSON payload (usually from Request.Body) and tries to
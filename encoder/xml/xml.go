@@ -47,6 +47,11 @@ func (e *EncoderXML) Accept() string {
 	return e.AcceptHeader
 }
 
+// BodyLimit implements relax.BodyLimiter, it returns MaxBodySize.
+func (e *EncoderXML) BodyLimit() int64 {
+	return e.MaxBodySize
+}
+
 // ContentType returns the media type for XML content, used in the
 // Content-Type header.
 func (e *EncoderXML) ContentType() string {
@@ -0,0 +1,128 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type benchItem struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Email string   `json:"email"`
+	Tags  []string `json:"tags"`
+}
+
+func BenchmarkEncoderJSON(b *testing.B) {
+	items := make([]benchItem, 100)
+	for i := range items {
+		items[i] = benchItem{i, "user", strings.Repeat("x", 20) + "@example.com", []string{"a", "b", "c"}}
+	}
+	for _, indented := range []bool{false, true} {
+		enc := NewEncoder()
+		enc.Indented = indented
+		name := "plain"
+		if indented {
+			name = "indented"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				enc.Encode(io.Discard, items)
+			}
+		})
+	}
+	b.Run("buffered", func(b *testing.B) {
+		enc := NewEncoder()
+		w := httptest.NewRecorder()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rb := NewResponseBuffer(w)
+			enc.Encode(rb, items)
+			rb.Free()
+		}
+	})
+	b.Run("hooked", func(b *testing.B) {
+		enc := NewEncoder()
+		enc.TimeFormat = time.RFC3339
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enc.Encode(io.Discard, items)
+		}
+	})
+}
+
+type hookBase struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type hookItem struct {
+	hookBase
+	Name    string             `json:"name"`
+	Note    string             `json:"note,omitempty"`
+	Count   int64              `json:"count,string"`
+	Updated *time.Time         `json:"updated"`
+	Score   float64            `json:"score"`
+	Scores  map[string]float64 `json:"scores"`
+	IP      net.IP             `json:"ip"`
+	Skip    string             `json:"-"`
+	hidden  string
+}
+
+func TestEncoderJSONOptions(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	item := hookItem{
+		hookBase: hookBase{ID: 1, Created: created},
+		Name:     "alpha", Count: 42, Updated: &created,
+		Score: 0.5, Scores: map[string]float64{"b": 2, "a": 1},
+		IP: net.ParseIP("10.0.0.1"), Skip: "x", hidden: "y",
+	}
+
+	// with options that don't apply, the output is the same as encoding/json.
+	var buf bytes.Buffer
+	enc := NewEncoder()
+	enc.NullNonFinite = true
+	if err := enc.Encode(&buf, item); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := json.Marshal(item)
+	if strings.TrimSpace(buf.String()) != string(expected) {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+
+	tests := []struct {
+		TimeFormat    string
+		NullNonFinite bool
+		Score         float64
+		Contains      string
+		Fails         bool
+	}{
+		{time.RFC3339, false, 1, `"created":"2024-05-01T10:00:00Z"`, false},
+		{time.RFC3339, false, 1, `"updated":"2024-05-01T10:00:00Z"`, false},
+		{TimeEpochMillis, false, 1, `"created":1714557600123`, false},
+		{"", true, math.NaN(), `"score":null`, false},
+		{"", true, math.Inf(-1), `"score":null`, false},
+		{"", false, math.NaN(), ``, true},
+	}
+	for i, tt := range tests {
+		buf.Reset()
+		enc := NewEncoder()
+		enc.TimeFormat, enc.NullNonFinite = tt.TimeFormat, tt.NullNonFinite
+		item.Score = tt.Score
+		err := enc.Encode(&buf, item)
+		if (err != nil) != tt.Fails || !strings.Contains(buf.String(), tt.Contains) {
+			t.Errorf("%d: expected %q, got %v %s", i, tt.Contains, err, buf.String())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ErrorInfo describes an error response a service may send, for client SDK
+// generators and documentation. See: Service.ErrorCatalog
+type ErrorInfo struct {
+	// Code is the HTTP status code of the error.
+	Code int `json:"code"`
+	// Message is the error message, in English. It's the value of
+	// StatusError.Message in responses, so clients can match it.
+	Message string `json:"message"`
+	// Description explains when the error is sent.
+	Description string `json:"description,omitempty"`
+	// Translations are the localized messages by language tag, from the
+	// service Catalog.
+	Translations map[string]string `json:"translations,omitempty"`
+}
+
+// errorRegistry has the errors added with RegisterError, keyed by code and message.
+var (
+	errorMu       sync.RWMutex
+	errorRegistry = make(map[StatusError]string)
+)
+
+/*
+RegisterError adds 'err' to the errors listed by Service.ErrorCatalog, with a
+'description' of when it's sent, and returns it. Only the code and message of
+'err' are listed; details are per response. Registering an error again
+replaces its description.
+
+	var ErrUserNotFound = relax.RegisterError(
+		&relax.StatusError{http.StatusNotFound, "That user was not found.", nil},
+		"The user id doesn't exist, or the user was deleted.")
+
+	func (u *Users) Read(ctx *relax.Context) {
+		...
+		ctx.Error(ErrUserNotFound.Code, ErrUserNotFound.Message)
+	}
+*/
+func RegisterError(err *StatusError, description string) *StatusError {
+	errorMu.Lock()
+	errorRegistry[StatusError{Code: err.Code, Message: err.Message}] = description
+	errorMu.Unlock()
+	return err
+}
+
+/*
+ErrorCatalog returns the errors the service may send: the errors of the
+framework and those added with RegisterError, sorted by code and message.
+Each error has the translations of its message in the service Catalog.
+The list is JSON-encodable, to export for SDK generators:
+
+	svc.Root().GET("errors", func(ctx *relax.Context) {
+		ctx.Respond(svc.ErrorCatalog())
+	})
+
+Errors of filters and messages built at runtime are not listed, unless they
+are registered.
+*/
+func (svc *Service) ErrorCatalog() []ErrorInfo {
+	errorMu.RLock()
+	errs := make([]ErrorInfo, 0, len(errorRegistry))
+	for e, description := range errorRegistry {
+		errs = append(errs, ErrorInfo{Code: e.Code, Message: e.Message, Description: description})
+	}
+	errorMu.RUnlock()
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Code != errs[j].Code {
+			return errs[i].Code < errs[j].Code
+		}
+		return errs[i].Message < errs[j].Message
+	})
+	for i := range errs {
+		for lang, messages := range svc.Catalog {
+			if t, ok := messages[errs[i].Message]; ok {
+				if errs[i].Translations == nil {
+					errs[i].Translations = make(map[string]string)
+				}
+				errs[i].Translations[lang] = t
+			}
+		}
+	}
+	return errs
+}
+
+// These are the errors sent by the framework, listed by Service.ErrorCatalog.
+// Responses use their code and message, with their own details.
+var (
+	errBadParams          = RegisterError(&StatusError{Code: http.StatusBadRequest, Message: "The request parameters are not valid."}, "Query or path values can't be bound to the handler parameters.")
+	errFileForbidden      = RegisterError(&StatusError{Code: http.StatusForbidden, Message: "That file is not accessible."}, "The file exists but can't be read.")
+	errFileNotFound       = RegisterError(&StatusError{Code: http.StatusNotFound, Message: "That file was not found."}, "The requested file doesn't exist.")
+	errMethodNotAllowed   = RegisterError(&StatusError{Code: http.StatusMethodNotAllowed, Message: "The method %s is not allowed."}, "The resource doesn't allow the request method, %s is the method.")
+	errNotAcceptable      = RegisterError(&StatusError{Code: http.StatusNotAcceptable, Message: "That media type is not supported for response."}, "No encoder matches the Accept header; details list the alternatives.")
+	errPayloadTooLarge    = RegisterError(&StatusError{Code: http.StatusRequestEntityTooLarge, Message: "The request payload is too large."}, "The payload is larger than the encoder limit; details have the limit.")
+	errUnsupportedType    = RegisterError(&StatusError{Code: http.StatusUnsupportedMediaType, Message: "That media type is not supported for transfer."}, "No encoder matches the Content-Type header; details list the supported types.")
+	errUndecodablePayload = RegisterError(&StatusError{Code: http.StatusUnsupportedMediaType, Message: "The request payload can't be decoded."}, "The payload is not valid in its media type.")
+	errInvalidPayload     = RegisterError(&StatusError{Code: http.StatusUnprocessableEntity, Message: "The request payload is not valid."}, "The payload failed validation; details list the fields.")
+	errInternal           = RegisterError(&StatusError{Code: http.StatusInternalServerError, Message: http.StatusText(http.StatusInternalServerError)}, "The handler panicked.")
+	errEncodeFailed       = RegisterError(&StatusError{Code: http.StatusInternalServerError, Message: "The response could not be encoded."}, "The handler response can't be encoded in the negotiated media type.")
+	errNotImplemented     = RegisterError(&StatusError{Code: http.StatusNotImplemented, Message: "That route is not implemented."}, "The resource doesn't implement the route handler.")
+	errNotReady           = RegisterError(&StatusError{Code: http.StatusServiceUnavailable, Message: "The resource is not ready."}, "The resource is starting or unhealthy; details have the reason.")
+	errTimedOut           = RegisterError(&StatusError{Code: http.StatusServiceUnavailable, Message: "The request timed out."}, "The handler didn't respond within the request timeout.")
+)
+
+func init() {
+	RegisterError(ErrRouteNotFound, "No route matches the request path.")
+	RegisterError(ErrRouteBadMethod, "The route doesn't support the request method.")
+}
+
+// withDetails returns a copy of 'e' with 'details', to send without changing 'e'.
+func (e *StatusError) withDetails(details interface{}) *StatusError {
+	return &StatusError{Code: e.Code, Message: e.Message, Details: details}
+}
@@ -4,6 +4,63 @@
 
 package relax
 
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnknownEntity is returned by UseE for entities that don't implement
+	// any of the interfaces used by a service.
+	ErrUnknownEntity = errors.New("relax: Unknown entity to use")
+
+	// ErrFilterNotUsable is returned by UseE for limited filters that can't
+	// be used with a service, or a resource.
+	ErrFilterNotUsable = errors.New("relax: Filter not usable")
+
+	// ErrRouteName is returned by URLFor when no route has the name.
+	ErrRouteName = errors.New("relax: Unknown route name")
+
+	// ErrRouteParams is returned by URLFor when the values don't match the
+	// route path.
+	ErrRouteParams = errors.New("relax: Invalid route values")
+
+	// ErrRouterImmutable is returned when changing routes at runtime with a
+	// router that doesn't implement MutableRouter.
+	ErrRouterImmutable = errors.New("relax: Router can't change routes")
+
+	// ErrRoutePattern is returned by AddRouteE and RouteE when a route PSE is
+	// not valid, such as a bad regexp or an unknown PSE type.
+	ErrRoutePattern = errors.New("relax: Invalid route pattern")
+
+	// ErrRouteConflict is reported when a route conflicts with a route added
+	// before, see Service.RouteConflicts.
+	ErrRouteConflict = errors.New("relax: Route conflict")
+
+	// ErrCookieKey is returned by the signed and encrypted cookie functions
+	// when the service has no cookie key, see Service.CookieKey.
+	ErrCookieKey = errors.New("relax: No cookie key")
+
+	// ErrCookieInvalid is returned when a signed or encrypted cookie can't be
+	// verified, such as cookies changed by the client.
+	ErrCookieInvalid = errors.New("relax: Invalid cookie")
+)
+
+// UseError is returned by Service.UseE with the errors of all the entities
+// that were ignored.
+type UseError struct {
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *UseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		msgs[i] = e.Errors[i].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
 // StatusError is an error with a HTTP Status code. It allows errors to be
 // complete and uniform.
 type StatusError struct {
@@ -0,0 +1,104 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+ServeFile sends the contents of the file at 'path' as the response, with
+support for Range and conditional requests. The Content-Type is set from the
+file extension. Unlike http.ServeFile, directories are not listed and the
+request path is not redirected.
+
+	func (r *Reports) Download(ctx *relax.Context) {
+		ctx.ServeFile(filepath.Join(r.dir, ctx.PathValues.Get("name")+".pdf"))
+	}
+
+If the file doesn't exist or is a directory, the response is an error
+404-"Not Found"; if it can't be read, 403-"Forbidden". Returns the error
+opening the file, or nil.
+
+See also: ServeContent, Attachment
+*/
+func (ctx *Context) ServeFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			ctx.Error(errFileForbidden.Code, errFileForbidden.Message)
+		} else {
+			ctx.Error(errFileNotFound.Code, errFileNotFound.Message)
+		}
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		ctx.Error(errFileNotFound.Code, errFileNotFound.Message)
+		return err
+	}
+	ctx.ServeContent(fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
+/*
+ServeContent sends 'content' as the response, with support for Range and
+conditional requests, using http.ServeContent. The Content-Type of the
+encoder is replaced with the type for the extension of 'name', or sniffed
+from the content if the extension is unknown. If 'modtime' is not zero, it's
+sent in the Last-Modified header.
+*/
+func (ctx *Context) ServeContent(name string, modtime time.Time, content io.ReadSeeker) {
+	if ctype := mime.TypeByExtension(filepath.Ext(name)); ctype != "" {
+		ctx.Header().Set("Content-Type", ctype)
+	} else {
+		ctx.Header().Del("Content-Type")
+	}
+	http.ServeContent(ctx, ctx.Request, name, modtime, content)
+}
+
+/*
+Attachment sends the content read from 'r' as a file download named 'name',
+using the Content-Disposition header. Such as generated exports:
+
+	func (r *Reports) Export(ctx *relax.Context) {
+		var buf bytes.Buffer
+		r.writeCSV(&buf)
+		ctx.Attachment("report.csv", bytes.NewReader(buf.Bytes()))
+	}
+
+If 'r' is an io.ReadSeeker, the content is sent with ServeContent, with
+support for Range requests. Otherwise, it's copied as is with status 200-"OK"
+and the Content-Type for the extension of 'name', or
+"application/octet-stream" if unknown.
+Returns the error reading from 'r', or nil.
+*/
+func (ctx *Context) Attachment(name string, r io.Reader) error {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	ctx.Header().Set("Content-Disposition", disposition)
+
+	if rs, ok := r.(io.ReadSeeker); ok {
+		ctx.ServeContent(name, time.Time{}, rs)
+		return nil
+	}
+	ctype := mime.TypeByExtension(filepath.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	ctx.Header().Set("Content-Type", ctype)
+	ctx.WriteHeader(http.StatusOK)
+	_, err := io.Copy(ctx, r)
+	return err
+}
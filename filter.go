@@ -19,6 +19,11 @@ Some included filters: CORS, method override, security, basic auth and content n
 Adding filters is a matter of creating new objects that implement the Filter interface.
 The position of the ``next()`` handler function is important to the effect of the particular
 filter execution.
+
+Panics in handlers and filters propagate up the chain to the service, which runs the
+panic hooks of the request, in reverse order, and then the service Recovery handler.
+Filters that need to clean up on panic, such as rolling back a transaction, implement
+PanicHandler or add a hook with Context.OnPanic, instead of recovering the panic.
 */
 type Filter interface {
 	// Run executes the current filter in a chain.
@@ -48,3 +53,35 @@ The ``RunIn()`` func should return true for the type(s) allowed, false otherwise
 type LimitedFilter interface {
 	RunIn(interface{}) bool
 }
+
+/*
+PanicHandler is implemented by filters that handle panics from the handlers
+after them. HandlePanic is added to the panic hooks of the request when the
+filter runs, so hooks run in reverse filter order, before the service Recovery
+handler responds.
+
+	func (f *TxFilter) HandlePanic(ctx *relax.Context, err interface{}) {
+		if tx, ok := ctx.Get("tx").(*sql.Tx); ok {
+			tx.Rollback()
+		}
+	}
+
+See also: Context.OnPanic
+*/
+type PanicHandler interface {
+	HandlePanic(ctx *Context, err interface{})
+}
+
+// runFilter returns handler 'h' wrapped by filter 'f'. If 'f' is a PanicHandler
+// its hook is added when the filter runs.
+func runFilter(f Filter, h HandlerFunc) HandlerFunc {
+	h = f.Run(h)
+	ph, ok := f.(PanicHandler)
+	if !ok {
+		return h
+	}
+	return func(ctx *Context) {
+		ctx.OnPanic(ph.HandlePanic)
+		h(ctx)
+	}
+}
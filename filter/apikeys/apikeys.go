@@ -0,0 +1,107 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package apikeys
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/srfrog/go-relax"
+	"github.com/srfrog/go-relax/filter/limits"
+)
+
+/*
+Filter APIKeys authenticates clients with API keys sent in a request header.
+Keys are checked against a KeyStore, which keeps only key hashes.
+
+	store := apikeys.NewMemStore()
+	svc.Use(&apikeys.Filter{Store: store})
+
+	// routes that need specific permissions.
+	res.DELETE("{id}", Remove, &apikeys.Filter{Store: store, Scopes: []string{"write"}})
+
+Keys can be used for per-key rate limits, with limits.Usage:
+
+	&limits.Usage{Keygen: apikeys.Keygen, Cost: apikeys.Cost}
+*/
+type Filter struct {
+	// Store is the key storage.
+	// Defaults to an empty MemStore.
+	Store KeyStore
+
+	// Header is the request header that has the API key.
+	// Defaults to "X-Api-Key"
+	Header string
+
+	// Scopes is a list of scopes a key must have, all of them, to access a route.
+	// Defaults to nil (any)
+	Scopes []string
+}
+
+// Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("auth.user")   // auth user, the key owner
+//	ctx.Get("auth.type")   // auth scheme type, "apikey"
+//	ctx.Get("auth.scopes") // auth scopes, the key scopes
+//	ctx.Get("apikeys.key") // key record, *Key
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	if f.Store == nil {
+		f.Store = NewMemStore()
+	}
+	if f.Header == "" {
+		f.Header = "X-Api-Key"
+	}
+	return func(ctx *relax.Context) {
+		secret := ctx.Request.Header.Get(f.Header)
+		if secret == "" {
+			ctx.Error(http.StatusUnauthorized, "An API key is required.")
+			return
+		}
+
+		key, err := f.Store.Get(splitKey(secret))
+		if err != nil && err != ErrNotFound {
+			ctx.Error(http.StatusInternalServerError, "Unable to check the API key.")
+			return
+		}
+		if key == nil || subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(key.Hash)) != 1 || !key.Valid() {
+			ctx.Error(http.StatusUnauthorized, "Invalid API key.")
+			return
+		}
+
+		for _, scope := range f.Scopes {
+			if !key.HasScope(scope) {
+				ctx.Error(http.StatusForbidden, "The API key doesn't have the required scopes.", strings.Join(f.Scopes, " "))
+				return
+			}
+		}
+
+		ctx.Set("auth.user", key.Owner)
+		ctx.Set("auth.type", "apikey")
+		ctx.Set("auth.scopes", key.Scopes)
+		ctx.Set("apikeys.key", key)
+
+		next(ctx)
+	}
+}
+
+// Keygen is a limits.Usage Keygen that makes keys from the API key ID, so
+// each API key has its own bucket. It must run after Filter. Requests without
+// an API key use limits.MD5RequestKey.
+func Keygen(ctx relax.Context) string {
+	if key, ok := ctx.Get("apikeys.key").(*Key); ok {
+		return "apikey:" + key.ID
+	}
+	return limits.MD5RequestKey(ctx)
+}
+
+// Cost is a limits.Usage Cost function that returns Key.Cost for requests
+// with an API key. It returns -1 otherwise, so the Usage Ration is used.
+func Cost(ctx *relax.Context) int {
+	if key, ok := ctx.Get("apikeys.key").(*Key); ok && key.Cost > 0 {
+		return key.Cost
+	}
+	return -1
+}
@@ -0,0 +1,140 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package apikeys
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/srfrog/go-relax"
+	"github.com/srfrog/go-relax/filter/limits"
+)
+
+func serveKey(svc *relax.Service, method, path, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Api-Key", secret)
+	}
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	return w
+}
+
+func TestFilter(t *testing.T) {
+	store := NewMemStore()
+	reader, _, _ := Issue(store, "acme", []string{"read"}, time.Time{})
+	writer, _, _ := Issue(store, "globex", []string{"read", "write"}, time.Time{})
+	expired, _, _ := Issue(store, "initech", []string{"read", "write"}, time.Now().Add(-time.Minute))
+
+	svc := relax.NewService("/")
+	svc.Root().
+		GET("items", func(ctx *relax.Context) { ctx.Respond(ctx.Get("auth.user")) }, &Filter{Store: store}).
+		DELETE("items", func(ctx *relax.Context) { ctx.WriteHeader(204) }, &Filter{Store: store, Scopes: []string{"write"}})
+
+	tests := []struct {
+		Method, Secret string
+		Code           int
+	}{
+		{"GET", "", 401},
+		{"GET", "malformed", 401},
+		{"GET", reader[:strings.Index(reader, ".")] + ".wrong", 401},
+		{"GET", reader, 200},
+		{"GET", expired, 401},
+		{"DELETE", reader, 403},
+		{"DELETE", writer, 204},
+	}
+	for i, tt := range tests {
+		if w := serveKey(svc, tt.Method, "/items", tt.Secret, ""); w.Code != tt.Code {
+			t.Errorf("%d: expected %d, got %d %s", i, tt.Code, w.Code, w.Body.String())
+		}
+	}
+	if w := serveKey(svc, "GET", "/items", writer, ""); w.Body.String() != "\"globex\"\n" {
+		t.Errorf("expected key owner as user, got %s", w.Body.String())
+	}
+}
+
+func TestKeys(t *testing.T) {
+	store := NewMemStore()
+	svc := relax.NewService("/")
+	svc.Resource(&Keys{Store: store}).CRUD("{key}")
+	svc.Root().GET("items", func(ctx *relax.Context) { ctx.WriteHeader(200) }, &Filter{Store: store})
+
+	w := serveKey(svc, "POST", "/keys", "", `{"owner":"acme","scopes":["read"]}`)
+	var created KeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || w.Code != 201 || created.Secret == "" {
+		t.Fatalf("expected created key, got %d %v", w.Code, err)
+	}
+	if code := serveKey(svc, "GET", "/items", created.Secret, "").Code; code != 200 {
+		t.Errorf("expected created key to work, got %d", code)
+	}
+	if w := serveKey(svc, "POST", "/keys", "", `{}`); w.Code != 400 {
+		t.Errorf("expected 400 without owner, got %d", w.Code)
+	}
+
+	// rotated keys keep their ID, the old secret stops working.
+	w = serveKey(svc, "PUT", "/keys/"+created.ID, "", `{}`)
+	var rotated KeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&rotated); err != nil || w.Code != 200 || rotated.ID != created.ID {
+		t.Fatalf("expected rotated key, got %d %v", w.Code, err)
+	}
+	if code := serveKey(svc, "GET", "/items", created.Secret, "").Code; code != 401 {
+		t.Errorf("expected old secret rejected, got %d", code)
+	}
+	if code := serveKey(svc, "GET", "/items", rotated.Secret, "").Code; code != 200 {
+		t.Errorf("expected new secret to work, got %d", code)
+	}
+
+	// revoked keys are kept, but don't work.
+	if code := serveKey(svc, "DELETE", "/keys/"+created.ID, "", "").Code; code != 204 {
+		t.Errorf("expected 204 on revoke, got %d", code)
+	}
+	if code := serveKey(svc, "GET", "/items", rotated.Secret, "").Code; code != 401 {
+		t.Errorf("expected revoked key rejected, got %d", code)
+	}
+	if code := serveKey(svc, "PUT", "/keys/"+created.ID, "", `{}`).Code; code != 409 {
+		t.Errorf("expected 409 rotating revoked key, got %d", code)
+	}
+	if w := serveKey(svc, "GET", "/keys/"+created.ID, "", ""); w.Code != 200 || !strings.Contains(w.Body.String(), `"revoked":true`) {
+		t.Errorf("expected revoked key record, got %d %s", w.Code, w.Body.String())
+	}
+	if code := serveKey(svc, "GET", "/keys/unknown", "", "").Code; code != 404 {
+		t.Errorf("expected 404 for unknown key, got %d", code)
+	}
+}
+
+func TestCost(t *testing.T) {
+	store := NewMemStore()
+	cheap, _, _ := Issue(store, "acme", nil, time.Time{})
+	pricey, key, _ := Issue(store, "globex", nil, time.Time{})
+	key.Cost = 5
+	store.Put(key)
+
+	svc := relax.NewService("/")
+	svc.Root().GET("items", func(ctx *relax.Context) { ctx.WriteHeader(200) },
+		&Filter{Store: store},
+		&limits.Usage{Container: limits.NewMemBucket(10, 10, 1), Keygen: Keygen, Cost: Cost})
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		w := serveKey(svc, "GET", "/items", pricey, "")
+		codes = append(codes, w.Code)
+		if i == 0 && w.Header().Get("RateLimit-Cost") != "5" {
+			t.Errorf("expected key cost, got %q", w.Header().Get("RateLimit-Cost"))
+		}
+	}
+	if fmt.Sprint(codes) != "[200 200 429]" {
+		t.Errorf("expected bucket spent at key cost, got %v", codes)
+	}
+	// each key has its own bucket, at the Usage ration.
+	w := serveKey(svc, "GET", "/items", cheap, "")
+	if w.Code != 200 || w.Header().Get("RateLimit-Cost") != "1" {
+		t.Errorf("expected 200 at ration cost, got %d %q", w.Code, w.Header().Get("RateLimit-Cost"))
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package apikeys
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Keys is an admin resource to manage API keys. It implements relax.Resourcer
+and relax.CRUD; it must be protected with admin-only filters.
+
+	keys := &apikeys.Keys{Store: store}
+	svc.Resource(keys, &authbasic.Filter{Provider: admins}).CRUD("{key}")
+
+The following routes are added:
+
+	GET /api/keys           => list keys
+	POST /api/keys          => create a key; the full key is in the response
+	GET /api/keys/{key}     => show key
+	PUT /api/keys/{key}     => rotate key; the new full key is in the response
+	DELETE /api/keys/{key}  => revoke key
+*/
+type Keys struct {
+	Store KeyStore
+}
+
+// KeyRequest is the request body used to create keys.
+type KeyRequest struct {
+	Owner   string    `json:"owner"`
+	Scopes  []string  `json:"scopes,omitempty"`
+	Cost    int       `json:"cost,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// KeyResponse is the response to created or rotated keys. Secret is the full
+// key, it's only sent in this response.
+type KeyResponse struct {
+	*Key
+	Secret string `json:"secret"`
+}
+
+// Index handles "GET /keys"
+func (k *Keys) Index(ctx *relax.Context) {
+	keys, err := k.Store.List()
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Respond(keys)
+}
+
+// Create handles "POST /keys"
+func (k *Keys) Create(ctx *relax.Context) {
+	var req KeyRequest
+	if err := ctx.Decode(ctx.Request.Body, &req); err != nil {
+		ctx.Error(http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Owner == "" {
+		ctx.Error(http.StatusBadRequest, "The key owner is required.")
+		return
+	}
+	secret, id, err := Generate()
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	key := &Key{
+		ID:      id,
+		Hash:    Hash(secret),
+		Owner:   req.Owner,
+		Scopes:  req.Scopes,
+		Cost:    req.Cost,
+		Created: time.Now(),
+		Expires: req.Expires,
+	}
+	if err := k.Store.Put(key); err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Respond(&KeyResponse{key, secret}, http.StatusCreated)
+}
+
+// Read handles "GET /keys/{key}"
+func (k *Keys) Read(ctx *relax.Context) {
+	key, ok := k.find(ctx)
+	if !ok {
+		return
+	}
+	ctx.Respond(key)
+}
+
+// Update handles "PUT /keys/{key}". It rotates the key, the old key stops
+// working immediately.
+func (k *Keys) Update(ctx *relax.Context) {
+	key, ok := k.find(ctx)
+	if !ok {
+		return
+	}
+	if key.Revoked {
+		ctx.Error(http.StatusConflict, "The key was revoked.")
+		return
+	}
+	secret, id, err := Generate()
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the key ID is kept, so limits and logs stay the same.
+	secret = key.ID + secret[len(id):]
+	key.Hash = Hash(secret)
+	key.Created = time.Now()
+	if err := k.Store.Put(key); err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Respond(&KeyResponse{key, secret})
+}
+
+// Delete handles "DELETE /keys/{key}". The key is kept as revoked.
+func (k *Keys) Delete(ctx *relax.Context) {
+	key, ok := k.find(ctx)
+	if !ok {
+		return
+	}
+	key.Revoked = true
+	if err := k.Store.Put(key); err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.WriteHeader(http.StatusNoContent)
+}
+
+// find returns the key in the request path, or sends an error response.
+func (k *Keys) find(ctx *relax.Context) (*Key, bool) {
+	key, err := k.Store.Get(ctx.PathValues.Get("key"))
+	if err == ErrNotFound {
+		ctx.Error(http.StatusNotFound, "That key was not found.")
+		return nil, false
+	}
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return key, true
+}
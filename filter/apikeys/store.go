@@ -0,0 +1,185 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a KeyStore when a key doesn't exist.
+var ErrNotFound = errors.New("apikeys: Key not found")
+
+// Key is an API key record. The secret part of the key is never stored,
+// only its hash.
+type Key struct {
+	// ID is the public part of the key, used to find it in a KeyStore.
+	ID string `json:"id"`
+
+	// Hash is the SHA-256 hash of the full key, in hex.
+	Hash string `json:"-"`
+
+	// Owner is the user or client that owns the key. It's passed down as
+	// "auth.user" on successful requests.
+	Owner string `json:"owner"`
+
+	// Scopes is a list of permissions granted to the key.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Cost is the number of rate limit tokens spent per request made with the
+	// key, overriding the Ration of limits.Usage filters that use apikeys.Cost.
+	// Zero uses the filter Ration.
+	Cost int `json:"cost,omitempty"`
+
+	// Created is the time the key was created or last rotated.
+	Created time.Time `json:"created"`
+
+	// Expires is the time the key expires. Zero means it doesn't expire.
+	Expires time.Time `json:"expires,omitempty"`
+
+	// Revoked is true if the key was revoked.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// Valid returns true if the key is not revoked nor expired.
+func (k *Key) Valid() bool {
+	return !k.Revoked && (k.Expires.IsZero() || time.Now().Before(k.Expires))
+}
+
+// HasScope returns true if the key was granted 'scope'.
+func (k *Key) HasScope(scope string) bool {
+	for i := range k.Scopes {
+		if k.Scopes[i] == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyStore is implemented by API key storage backends.
+type KeyStore interface {
+	// Get returns the key with 'id', or ErrNotFound.
+	Get(id string) (*Key, error)
+
+	// Put saves a key, replacing any key with the same ID.
+	Put(key *Key) error
+
+	// Delete removes the key with 'id', or returns ErrNotFound.
+	Delete(id string) error
+
+	// List returns all the keys.
+	List() ([]*Key, error)
+}
+
+// MemStore is a KeyStore that keeps keys in memory. It's useful for tests and
+// for services with a static list of keys.
+type MemStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+// NewMemStore returns a new MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{keys: make(map[string]*Key)}
+}
+
+// Get implements KeyStore.
+func (s *MemStore) Get(id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	k := *key
+	return &k, nil
+}
+
+// Put implements KeyStore.
+func (s *MemStore) Put(key *Key) error {
+	k := *key
+	s.mu.Lock()
+	s.keys[key.ID] = &k
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements KeyStore.
+func (s *MemStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// List implements KeyStore. Keys are sorted by ID.
+func (s *MemStore) List() ([]*Key, error) {
+	s.mu.RLock()
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		k := *key
+		keys = append(keys, &k)
+	}
+	s.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// Hash returns the hash of API key 'secret', as stored in Key.Hash.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new random API key with the format "{id}.{secret}",
+// and its ID.
+func Generate() (string, string, error) {
+	b := make([]byte, 36)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id := hex.EncodeToString(b[:6])
+	return id + "." + base64.RawURLEncoding.EncodeToString(b[6:]), id, nil
+}
+
+// splitKey returns the ID part of an API key, or "" if the key is malformed.
+func splitKey(secret string) string {
+	idx := strings.Index(secret, ".")
+	if idx < 1 {
+		return ""
+	}
+	return secret[:idx]
+}
+
+// Issue creates a new key for 'owner' and saves it in 'store'. The full key
+// is returned only once, it can't be recovered from the store later.
+func Issue(store KeyStore, owner string, scopes []string, expires time.Time) (string, *Key, error) {
+	secret, id, err := Generate()
+	if err != nil {
+		return "", nil, err
+	}
+	key := &Key{
+		ID:      id,
+		Hash:    Hash(secret),
+		Owner:   owner,
+		Scopes:  scopes,
+		Created: time.Now(),
+		Expires: expires,
+	}
+	if err := store.Put(key); err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
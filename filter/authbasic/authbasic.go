@@ -7,10 +7,16 @@ package authbasic
 import (
 	"encoding/base64"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/srfrog/go-relax"
+	"github.com/srfrog/go-relax/filter/authcache"
 )
 
 // Filter AuthBasic is a Filter that implements HTTP Basic Authentication as
@@ -26,7 +32,92 @@ type Filter struct {
 	// credentials are accepted; false otherwise.
 	// If no function is assigned, it defaults to a function that denies all
 	// (false).
+	//
+	// Deprecated: use Provider, which has access to the request context.
 	Authenticate func(string, string) bool
+
+	// Provider is the credentials store used to authenticate users. If set,
+	// it's used instead of Authenticate.
+	// See also, Credentials, Htpasswd, ProviderFunc
+	Provider Provider
+
+	// Cache is an optional authentication cache. If set, successful
+	// authentications are cached and the Provider is only used for new
+	// or expired credentials.
+	// Defaults to nil (no caching)
+	Cache *authcache.Cache
+
+	// MaxFailures is the number of failed authentication attempts allowed per
+	// client address within FailureWindow. After that, requests from the client
+	// are dropped with HTTP status 429-"Too Many Requests" until the window ends.
+	// Defaults to 0 (disabled)
+	MaxFailures int
+
+	// FailureWindow is the period of time failed attempts are counted.
+	// Defaults to 15 minutes.
+	FailureWindow time.Duration
+
+	once     sync.Once
+	failures *failureCounter
+}
+
+// failureCounter counts failed authentication attempts per client address.
+type failureCounter struct {
+	sync.Mutex
+	window time.Duration
+	counts map[string]*failureCount
+}
+
+type failureCount struct {
+	n     int
+	until time.Time
+}
+
+// wait returns the time left before 'addr' can try again, after 'max' failures.
+func (fc *failureCounter) wait(addr string, max int) time.Duration {
+	fc.Lock()
+	defer fc.Unlock()
+	c, ok := fc.counts[addr]
+	if !ok {
+		return 0
+	}
+	left := time.Until(c.until)
+	if left <= 0 {
+		delete(fc.counts, addr)
+		return 0
+	}
+	if c.n < max {
+		return 0
+	}
+	return left
+}
+
+// fail records a failed attempt for 'addr'.
+func (fc *failureCounter) fail(addr string) {
+	fc.Lock()
+	defer fc.Unlock()
+	now := time.Now()
+	c, ok := fc.counts[addr]
+	if !ok || now.After(c.until) {
+		c = &failureCount{until: now.Add(fc.window)}
+		fc.counts[addr] = c
+	}
+	c.n++
+	// drop expired entries once in a while, so the map doesn't keep growing.
+	if len(fc.counts) > 10000 {
+		for k, v := range fc.counts {
+			if now.After(v.until) {
+				delete(fc.counts, k)
+			}
+		}
+	}
+}
+
+// clear removes the failed attempts of 'addr'.
+func (fc *failureCounter) clear(addr string) {
+	fc.Lock()
+	delete(fc.counts, addr)
+	fc.Unlock()
 }
 
 // Errors returned by Filter AuthBasic that are general and could be reused.
@@ -57,7 +148,7 @@ func getUserPass(header string) ([]string, error) {
 		return nil, err
 	}
 
-	userpass := strings.Split(string(authstr), ":")
+	userpass := strings.SplitN(string(authstr), ":", 2)
 	if len(userpass) != 2 {
 		return nil, ErrAuthInvalidSyntax
 	}
@@ -71,16 +162,48 @@ func getUserPass(header string) ([]string, error) {
 //		ctx.Get("auth.type") // auth scheme type. e.g., "basic"
 //
 func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
-	if f.Realm == "" {
-		f.Realm = "Authorization Required"
-	}
-	f.Realm = strings.Replace(f.Realm, `"'`, "", -1)
+	// the service chain may be built again, set up the filter and its
+	// failure counts once.
+	f.once.Do(func() {
+		if f.Realm == "" {
+			f.Realm = "Authorization Required"
+		}
+		f.Realm = strings.Replace(f.Realm, `"'`, "", -1)
 
-	if f.Authenticate == nil {
-		f.Authenticate = denyAllAccess
-	}
+		if f.Authenticate == nil {
+			f.Authenticate = denyAllAccess
+		}
+
+		if f.Provider == nil {
+			f.Provider = ProviderFunc(func(ctx *relax.Context, username, password string) bool {
+				return f.Authenticate(username, password)
+			})
+		}
+
+		if f.FailureWindow == 0 {
+			f.FailureWindow = 15 * time.Minute
+		}
+
+		f.failures = &failureCounter{
+			window: f.FailureWindow,
+			counts: make(map[string]*failureCount),
+		}
+	})
 
 	return func(ctx *relax.Context) {
+		addr, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+		if err != nil {
+			addr = ctx.Request.RemoteAddr
+		}
+
+		if f.MaxFailures != 0 {
+			if wait := f.failures.wait(addr, f.MaxFailures); wait > 0 {
+				ctx.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				ctx.Error(http.StatusTooManyRequests, "Too many failed authentication attempts.")
+				return
+			}
+		}
+
 		header := ctx.Request.Header.Get("Authorization")
 		if header == "" {
 			MustAuthenticate(ctx, "Basic realm=\""+f.Realm+"\"")
@@ -89,15 +212,22 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 
 		userpass, err := getUserPass(header)
 		if err != nil {
-			http.Error(ctx, err.Error(), http.StatusBadRequest)
+			ctx.Error(http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if !f.Authenticate(userpass[0], userpass[1]) {
+		if !f.authenticate(ctx, userpass[0], userpass[1]) {
+			if f.MaxFailures != 0 {
+				f.failures.fail(addr)
+			}
 			MustAuthenticate(ctx, "Basic realm=\""+f.Realm+"\"")
 			return
 		}
 
+		if f.MaxFailures != 0 {
+			f.failures.clear(addr)
+		}
+
 		ctx.Set("auth.user", userpass[0])
 		ctx.Set("auth.type", "basic")
 
@@ -105,11 +235,33 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	}
 }
 
+// authenticate checks the credentials with the cache, if any, and the provider.
+func (f *Filter) authenticate(ctx *relax.Context, username, password string) bool {
+	if f.Cache != nil {
+		if user, ok := f.Cache.Get("basic", username, password); ok && user == username {
+			return true
+		}
+	}
+	if !f.Provider.Authenticate(ctx, username, password) {
+		return false
+	}
+	if f.Cache != nil {
+		f.Cache.Add(username, "basic", username, password)
+	}
+	return true
+}
+
 // MustAuthenticate is a helper function used to send the WWW-Authenticate
 // HTTP header.
 // challenge is the auth scheme and the realm, as specified in section 2 of
 // RFC 2617.
+// If 'w' is a relax.Context, the error response is sent with the negotiated
+// encoding.
 func MustAuthenticate(w http.ResponseWriter, challenge string) {
 	w.Header().Set("WWW-Authenticate", challenge)
+	if ctx, ok := w.(*relax.Context); ok {
+		ctx.Error(http.StatusUnauthorized, relax.StatusText(http.StatusUnauthorized))
+		return
+	}
 	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 }
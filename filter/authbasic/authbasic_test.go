@@ -0,0 +1,144 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package authbasic
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func serveBasic(svc *relax.Service, addr, user, pass string) int {
+	req := httptest.NewRequest("GET", "/secret", nil)
+	req.RemoteAddr = addr
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestProviders(t *testing.T) {
+	tests := []struct {
+		Filter *Filter
+		User   string
+		Pass   string
+		Code   int
+	}{
+		{&Filter{}, "Pi", "3.14159", 401},
+		{&Filter{Provider: Credentials{"Pi": "3.14159"}}, "", "", 401},
+		{&Filter{Provider: Credentials{"Pi": "3.14159"}}, "Pi", "3.14159", 200},
+		{&Filter{Provider: Credentials{"Pi": "3.14159"}}, "Pi", "3.14", 401},
+		{&Filter{Provider: Credentials{"Pi": "3.14159"}}, "Tau", "3.14159", 401},
+		{&Filter{Authenticate: func(user, pass string) bool { return user == "e" && pass == "2.71828" }}, "e", "2.71828", 200},
+		{&Filter{Provider: ProviderFunc(func(ctx *relax.Context, user, pass string) bool {
+			return ctx.Request.URL.Path == "/secret" && user == pass
+		})}, "phi", "phi", 200},
+	}
+	for i, tt := range tests {
+		svc := relax.NewService("/")
+		svc.Root().GET("secret", func(ctx *relax.Context) {
+			ctx.Respond(ctx.Get("auth.user"))
+		}, tt.Filter)
+		if code := serveBasic(svc, "192.0.2.1:1234", tt.User, tt.Pass); code != tt.Code {
+			t.Errorf("%d: expected %d, got %d", i, tt.Code, code)
+		}
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	bhash, err := bcrypt.GenerateFromPassword([]byte("3.14159"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("saltsaltsaltsalt")
+	key := argon2.IDKey([]byte("2.71828"), salt, 1, 64, 1, 32)
+	ahash := fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$%s$%s", argon2.Version,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "htpasswd")
+	data := "# users\nPi:" + string(bhash) + "\n\ne:" + ahash + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		User, Pass string
+		Ok         bool
+	}{
+		{"Pi", "3.14159", true},
+		{"Pi", "3.14", false},
+		{"e", "2.71828", true},
+		{"e", "2.7", false},
+		{"Tau", "6.28318", false},
+	}
+	for i, tt := range tests {
+		if ok := users.Authenticate(nil, tt.User, tt.Pass); ok != tt.Ok {
+			t.Errorf("%d: expected %v, got %v", i, tt.Ok, ok)
+		}
+	}
+
+	// bad files are rejected, and the current users are kept.
+	for _, data := range []string{"Pi:{SHA}Y2fEjdGT1W6nsLqtJbGUVeUp9e4=\n", "no-hash\n"} {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Reload(); err == nil {
+			t.Errorf("expected error loading %q", data)
+		}
+	}
+	if !users.Authenticate(nil, "Pi", "3.14159") {
+		t.Error("expected users kept after failed reload")
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	// service filters run for each request, the failures must be kept.
+	svc := relax.NewService("/")
+	svc.Use(&Filter{Provider: Credentials{"Pi": "3.14159"}, MaxFailures: 2})
+	svc.Root().GET("secret", func(ctx *relax.Context) {
+		ctx.Respond(ctx.Get("auth.user"))
+	})
+
+	var codes []int
+	for i := 0; i < 4; i++ {
+		codes = append(codes, serveBasic(svc, "192.0.2.1:1234", "Pi", "bad"))
+	}
+	if fmt.Sprint(codes) != "[401 401 429 429]" {
+		t.Errorf("expected throttling after 2 failures, got %v", codes)
+	}
+	// other clients are not throttled.
+	if code := serveBasic(svc, "192.0.2.2:1234", "Pi", "3.14159"); code != 200 {
+		t.Errorf("expected 200 for other client, got %d", code)
+	}
+
+	// failures are counted across concurrent requests.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveBasic(svc, "192.0.2.3:1234", "Pi", "bad")
+		}()
+	}
+	wg.Wait()
+	if code := serveBasic(svc, "192.0.2.3:1234", "Pi", "3.14159"); code != 429 {
+		t.Errorf("expected 429 after concurrent failures, got %d", code)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package authbasic
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/srfrog/go-relax"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrHtpasswdHash is returned when an htpasswd file has a password hash
+// that is not supported.
+var ErrHtpasswdHash = errors.New("auth: Unsupported htpasswd hash")
+
+// dummyHash is compared against when a user is not found, so unknown users
+// take about as long as known users. It's the bcrypt hash of "relax".
+const dummyHash = "$2a$10$ub13b0MxhUO4BRGo1w7GFeSUDNWYErj9mokNYSf7ej8iO8eoJorvC"
+
+/*
+Htpasswd is a Provider that authenticates users with an htpasswd file. Each
+line of the file has the format "username:hash". The supported hash formats are:
+
+	$2a$, $2b$, $2y$   // bcrypt, as made by "htpasswd -B"
+	$argon2id$, $argon2i$  // argon2, in PHC string format
+
+Lines that are empty or begin with "#" are ignored.
+
+	users, err := authbasic.NewHtpasswd("/etc/relax/htpasswd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc.Use(&authbasic.Filter{Provider: users})
+*/
+type Htpasswd struct {
+	// Path is the location of the htpasswd file.
+	Path string
+
+	mu    sync.RWMutex
+	users map[string]string
+}
+
+// NewHtpasswd returns a new Htpasswd object loaded with the users in file 'path'.
+// Returns an error if the file can't be read or if it has unsupported hashes.
+func NewHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{Path: path}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload reads the htpasswd file again, replacing all the users.
+// If the file can't be loaded, the current users are kept.
+func (h *Htpasswd) Reload() error {
+	f, err := os.Open(h.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		userhash := strings.SplitN(line, ":", 2)
+		if len(userhash) != 2 || userhash[0] == "" {
+			return fmt.Errorf("auth: Invalid htpasswd line %d", n)
+		}
+		if !isBcrypt(userhash[1]) && !isArgon2(userhash[1]) {
+			return fmt.Errorf("%w, line %d", ErrHtpasswdHash, n)
+		}
+		users[userhash[0]] = userhash[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.users = users
+	h.mu.Unlock()
+	return nil
+}
+
+// Authenticate checks that 'username' exists and 'password' matches its hash.
+func (h *Htpasswd) Authenticate(ctx *relax.Context, username, password string) bool {
+	h.mu.RLock()
+	hash, ok := h.users[username]
+	h.mu.RUnlock()
+	if !ok {
+		bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		return false
+	}
+	if isArgon2(hash) {
+		return compareArgon2(hash, password)
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func isArgon2(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$") || strings.HasPrefix(hash, "$argon2i$")
+}
+
+// compareArgon2 compares 'password' with an argon2 hash in PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func compareArgon2(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+	var derived []byte
+	if parts[1] == "argon2id" {
+		derived = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	} else {
+		derived = argon2.Key([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	}
+	return subtle.ConstantTimeCompare(derived, key) == 1
+}
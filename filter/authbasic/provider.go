@@ -0,0 +1,61 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package authbasic
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"github.com/srfrog/go-relax"
+)
+
+// Provider is implemented by credential stores that can authenticate users.
+type Provider interface {
+	// Authenticate checks the credentials 'username' and 'password' sent with
+	// the request in 'ctx'.
+	// Returns true if the credentials are accepted, false otherwise.
+	Authenticate(ctx *relax.Context, username, password string) bool
+}
+
+// ProviderFunc is an adapter to use ordinary functions as a Provider.
+//
+//	&authbasic.Filter{
+//		Provider: authbasic.ProviderFunc(func(ctx *relax.Context, user, pass string) bool {
+//			return db.CheckUser(ctx, user, pass)
+//		}),
+//	}
+type ProviderFunc func(*relax.Context, string, string) bool
+
+// Authenticate calls f(ctx, username, password).
+func (f ProviderFunc) Authenticate(ctx *relax.Context, username, password string) bool {
+	return f(ctx, username, password)
+}
+
+// Credentials is a Provider with a static map of username=password values.
+// Passwords are compared in constant time.
+//
+//	&authbasic.Filter{Provider: authbasic.Credentials{"Pi": "3.14159"}}
+type Credentials map[string]string
+
+// Authenticate checks that 'username' exists and its password matches 'password'.
+func (c Credentials) Authenticate(ctx *relax.Context, username, password string) bool {
+	expected, ok := c[username]
+	if !ok {
+		// compare anyway, so unknown users take as long as known users.
+		SecureCompare(password, password)
+		return false
+	}
+	return SecureCompare(password, expected)
+}
+
+// SecureCompare compares strings 'a' and 'b' in constant time, so the time
+// it takes doesn't reveal how much of the strings match. The strings are
+// hashed first so their lengths aren't revealed either.
+// Returns true if the strings are equal, false otherwise.
+func SecureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,136 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package authcache
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+/*
+Cache keeps the results of successful authentications for a period of time,
+so auth filters don't need to check credentials against the user store on
+every request. Credentials are never stored, only their SHA-256 hash.
+
+A Cache can be shared by many auth filters:
+
+	cache := authcache.New(5*time.Minute, 10000)
+	res.GET("", Index, &authbasic.Filter{Provider: users, Cache: cache})
+
+	// when a user changes password or is disabled:
+	cache.Revoke("jdoe")
+
+Cache is go-routine safe.
+*/
+type Cache struct {
+	// TTL is the time an authentication result is valid.
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of results kept. When full, expired
+	// results are dropped, and if needed, some random results.
+	MaxEntries int
+
+	// OnRevoke is an optional function called after a user is revoked. It
+	// can be used to propagate revocations to other service instances.
+	OnRevoke func(user string)
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*entry
+}
+
+type entry struct {
+	user    string
+	expires time.Time
+}
+
+// New returns a new Cache that keeps up to 'max' results for duration 'ttl'.
+func New(ttl time.Duration, max int) *Cache {
+	return &Cache{
+		TTL:        ttl,
+		MaxEntries: max,
+		entries:    make(map[[sha256.Size]byte]*entry),
+	}
+}
+
+// key returns the cache key for the credential parts.
+func key(credential ...string) [sha256.Size]byte {
+	h := sha256.New()
+	for i := range credential {
+		h.Write([]byte(credential[i]))
+		h.Write([]byte{0})
+	}
+	var k [sha256.Size]byte
+	copy(k[:], h.Sum(nil))
+	return k
+}
+
+// Get returns the user authenticated with 'credential', such as a username
+// and password pair or a token.
+// Returns the user and true if a valid result was found, or "" and false otherwise.
+func (c *Cache) Get(credential ...string) (string, bool) {
+	k := key(credential...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[k]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, k)
+		return "", false
+	}
+	return e.user, true
+}
+
+// Add saves the result of a successful authentication of 'user' with 'credential'.
+func (c *Cache) Add(user string, credential ...string) {
+	k := key(credential...)
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evict(now)
+	}
+	c.entries[k] = &entry{user: user, expires: now.Add(c.TTL)}
+}
+
+// evict drops expired entries. If none expired, it drops a tenth of the
+// entries, in map order (random).
+func (c *Cache) evict(now time.Time) {
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.MaxEntries-c.MaxEntries/10 {
+			break
+		}
+		delete(c.entries, k)
+	}
+}
+
+// Revoke drops all the results for 'user', so the next request is checked
+// against the user store.
+func (c *Cache) Revoke(user string) {
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if e.user == user {
+			delete(c.entries, k)
+		}
+	}
+	c.mu.Unlock()
+	if c.OnRevoke != nil {
+		c.OnRevoke(user)
+	}
+}
+
+// Purge drops all the results.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[[sha256.Size]byte]*entry)
+	c.mu.Unlock()
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package authcache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var revoked []string
+	c := New(time.Hour, 100)
+	c.OnRevoke = func(user string) { revoked = append(revoked, user) }
+
+	c.Add("jdoe", "basic", "jdoe", "secret")
+	c.Add("jdoe", "bearer", "token1")
+	c.Add("alice", "basic", "alice", "secret")
+
+	tests := []struct {
+		Credential []string
+		User       string
+		Ok         bool
+	}{
+		{[]string{"basic", "jdoe", "secret"}, "jdoe", true},
+		{[]string{"bearer", "token1"}, "jdoe", true},
+		{[]string{"basic", "jdoe", "wrong"}, "", false},
+		// values are not concatenated.
+		{[]string{"basic", "jdoesecret"}, "", false},
+		{[]string{"basic", "alice", "secret"}, "alice", true},
+	}
+	for i, tt := range tests {
+		if user, ok := c.Get(tt.Credential...); user != tt.User || ok != tt.Ok {
+			t.Errorf("%d: expected %q %v, got %q %v", i, tt.User, tt.Ok, user, ok)
+		}
+	}
+
+	// all the credentials of a user are revoked.
+	c.Revoke("jdoe")
+	if _, ok := c.Get("basic", "jdoe", "secret"); ok {
+		t.Error("expected revoked basic credential")
+	}
+	if _, ok := c.Get("bearer", "token1"); ok {
+		t.Error("expected revoked bearer credential")
+	}
+	if _, ok := c.Get("basic", "alice", "secret"); !ok {
+		t.Error("expected other users kept")
+	}
+	if len(revoked) != 1 || revoked[0] != "jdoe" {
+		t.Errorf("expected OnRevoke with jdoe, got %v", revoked)
+	}
+
+	c.Purge()
+	if _, ok := c.Get("basic", "alice", "secret"); ok {
+		t.Error("expected empty cache after purge")
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := New(20*time.Millisecond, 0)
+	c.Add("jdoe", "basic", "jdoe", "secret")
+	if _, ok := c.Get("basic", "jdoe", "secret"); !ok {
+		t.Fatal("expected cache hit")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("basic", "jdoe", "secret"); ok {
+		t.Error("expected expired result")
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	c := New(time.Hour, 10)
+	for i := 0; i < 50; i++ {
+		c.Add("user"+strconv.Itoa(i), "basic", strconv.Itoa(i))
+		if n := len(c.entries); n > 10 {
+			t.Fatalf("expected at most 10 entries, got %d", n)
+		}
+	}
+	if _, ok := c.Get("basic", "49"); !ok {
+		t.Error("expected the last result kept")
+	}
+}
@@ -29,14 +29,24 @@ var (
 	allowHeadersDefault = []string{"Authorization", "Content-Type", "If-Match", "If-Modified-Since", "If-None-Match", "If-Unmodified-Since", "X-Requested-With"}
 
 	// exposeHeadersDefault are headers used regularly by both client/server
-	exposeHeadersDefault = []string{"Etag", "Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Poll-Interval"}
-
-	// allowOriginRegexp holds our pre-compiled origin regex patterns.
-	allowOriginRegexp = []*regexp.Regexp{}
+	exposeHeadersDefault = []string{"Etag", "Link", "RateLimit-Cost", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Poll-Interval"}
 )
 
 // Filter CORS implements the Cross-Origin Resource Sharing (CORS) recommendation, as
 // described in http://www.w3.org/TR/cors/ (W3C).
+//
+// The filter can be used at service, resource and route level. The settings of
+// the filter closest to the route override the others, for both simple and
+// preflight requests; so different resources or routes can allow different
+// origins:
+//
+//	svc.Use(&cors.Filter{AllowAnyOrigin: true})
+//	svc.Resource(partners, &cors.Filter{AllowOrigin: []string{"https://*.partner.com"}, AllowCredentials: true})
+//	svc.Resource(public).POST("feedback", public.Feedback, &cors.Filter{AllowAnyOrigin: true, AllowMethods: []string{"POST"}})
+//
+// Preflight requests are answered by the filter that runs first, which uses the
+// settings of the route of the method requested. Route-level settings need a
+// service or resource-level filter to answer their preflight requests.
 type Filter struct {
 	// AllowOrigin is the list of URI patterns that are allowed to use the resource.
 	// The patterns consist of text with zero or more wildcards '*' '?' '+'.
@@ -86,7 +96,7 @@ type Filter struct {
 	// ExposeHeaders is a list of HTTP headers that can be exposed to the API. This list should
 	// include any custom headers that are needed to complete the response.
 	//
-	// Default: "Etag", "Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Poll-Interval"
+	// Default: "Etag", "Link", "RateLimit-Cost", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "X-Poll-Interval"
 	ExposeHeaders []string
 
 	// MaxAge is a number of seconds the permission request (preflight) results should be cached.
@@ -102,6 +112,9 @@ type Filter struct {
 	//
 	// Default: false
 	Strict bool
+
+	// originRx holds our pre-compiled origin regex patterns.
+	originRx []*regexp.Regexp
 }
 
 func (f *Filter) corsHeaders(origin string) http.Header {
@@ -161,7 +174,7 @@ func (f *Filter) handleSimpleRequest(origin string) http.Header {
 }
 
 func (f *Filter) isOriginAllowed(origin string) bool {
-	for _, re := range allowOriginRegexp {
+	for _, re := range f.originRx {
 		if re.MatchString(origin) {
 			return true
 		}
@@ -169,10 +182,23 @@ func (f *Filter) isOriginAllowed(origin string) bool {
 	return false
 }
 
+// routeFilter returns the CORS filter of the route for 'method' closest to the
+// route, or the filter itself if the route has none.
+func (f *Filter) routeFilter(ctx *relax.Context, method string) *Filter {
+	filters := ctx.RouteFilters(method)
+	for i := len(filters) - 1; i >= 0; i-- {
+		if rf, ok := filters[i].(*Filter); ok {
+			return rf
+		}
+	}
+	return f
+}
+
 // Run runs the filter and passes down the following Info:
 //
 //		ctx.Get("cors.request") // boolean, whether or not this was a CORS request.
 //		ctx.Get("cors.origin")  // Origin of the request, if it's a CORS request.
+//		ctx.Get("cors.filter")  // *Filter, whose settings were used for the CORS request.
 //
 func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	if f.AllowMethods == nil {
@@ -192,79 +218,93 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	f.ExposeHeaders = strarr.Map(http.CanonicalHeaderKey,
 		strarr.Diff(f.ExposeHeaders, simpleHeaders))
 
-	for _, v := range f.AllowOrigin {
-		str := regexp.QuoteMeta(strings.ToLower(v))
-		str = strings.Replace(str, `\+`, `.+`, -1)
-		str = strings.Replace(str, `\*`, `.*`, -1)
-		str = strings.Replace(str, `\?`, `.`, -1)
-		str = strings.Replace(str, `_`, `.?`, -1)
-		allowOriginRegexp = append(allowOriginRegexp, regexp.MustCompile(str))
+	// resource filters run for each route, compile the patterns once.
+	if len(f.originRx) != len(f.AllowOrigin) {
+		f.originRx = make([]*regexp.Regexp, 0, len(f.AllowOrigin))
+		for _, v := range f.AllowOrigin {
+			str := regexp.QuoteMeta(strings.ToLower(v))
+			str = strings.Replace(str, `\+`, `.+`, -1)
+			str = strings.Replace(str, `\*`, `.*`, -1)
+			str = strings.Replace(str, `\?`, `.`, -1)
+			str = strings.Replace(str, `_`, `.?`, -1)
+			f.originRx = append(f.originRx, regexp.MustCompile(str))
+		}
 	}
 
 	return func(ctx *relax.Context) {
 		origin := ctx.Request.Header.Get("Origin")
 
-		// ctx.Set("cors.request", false)
-
-		// This is not a CORS request, carry on.
-		if origin == "" {
+		// This is not a CORS request, or an outer CORS filter handled it.
+		if origin == "" || ctx.Get("cors.filter") != nil {
 			next(ctx)
 			return
 		}
 
-		if !f.AllowAnyOrigin && !f.isOriginAllowed(origin) {
-			if f.Strict {
-				ctx.Error(http.StatusForbidden, "Invalid CORS origin")
-				return
-			}
-			next(ctx)
-			return
+		// Method requested
+		method := ctx.Request.Header.Get("Access-Control-Request-Method")
+		preflight := ctx.Request.Method == "OPTIONS" && method != ""
+		if !preflight {
+			method = ctx.Request.Method
 		}
 
-		// Check that Origin: is sane and does not match Host:
-		// http://www.w3.org/TR/cors/#resource-security
+		rf := f.routeFilter(ctx, method)
+		ctx.Set("cors.filter", rf)
+		rf.handle(ctx, next, origin, method, preflight)
+	}
+}
+
+// handle handles the CORS request from 'origin' with the filter settings.
+// 'method' is the method requested, if 'preflight' is true.
+func (f *Filter) handle(ctx *relax.Context, next relax.HandlerFunc, origin, method string, preflight bool) {
+	if !f.AllowAnyOrigin && !f.isOriginAllowed(origin) {
 		if f.Strict {
-			u, err := url.ParseRequestURI(origin)
-			if err != nil {
-				ctx.Error(http.StatusBadRequest, err.Error())
-				return
-			}
-			if ctx.Request.Host == u.Host || u.Path != "" || !strings.HasPrefix(u.Scheme, "http") {
-				ctx.Error(http.StatusBadRequest, "Invalid CORS origin syntax")
-				return
-			}
+			ctx.Error(http.StatusForbidden, "Invalid CORS origin")
+			return
 		}
+		next(ctx)
+		return
+	}
 
-		// Method requested
-		method := ctx.Request.Header.Get("Access-Control-Request-Method")
+	// Check that Origin: is sane and does not match Host:
+	// http://www.w3.org/TR/cors/#resource-security
+	if f.Strict {
+		u, err := url.ParseRequestURI(origin)
+		if err != nil {
+			ctx.Error(http.StatusBadRequest, err.Error())
+			return
+		}
+		if ctx.Request.Host == u.Host || u.Path != "" || !strings.HasPrefix(u.Scheme, "http") {
+			ctx.Error(http.StatusBadRequest, "Invalid CORS origin syntax")
+			return
+		}
+	}
 
-		// Preflight request
-		if ctx.Request.Method == "OPTIONS" && method != "" {
-			headers, err := f.handlePreflightRequest(origin, method, ctx.Request.Header.Get("Access-Control-Request-Headers"))
-			if err != nil {
-				if (err.(*relax.StatusError)).Code == http.StatusMethodNotAllowed {
-					ctx.Header().Set("Allow", strings.Join(f.AllowMethods, ", "))
-				}
-				ctx.Error(err.(*relax.StatusError).Code, err.Error())
-				return
-			}
-			for k, v := range headers {
-				ctx.Header()[k] = v
+	// Preflight request
+	if preflight {
+		headers, err := f.handlePreflightRequest(origin, method, ctx.Request.Header.Get("Access-Control-Request-Headers"))
+		if err != nil {
+			if (err.(*relax.StatusError)).Code == http.StatusMethodNotAllowed {
+				ctx.Header().Set("Allow", strings.Join(f.AllowMethods, ", "))
 			}
-			ctx.WriteHeader(http.StatusNoContent)
+			ctx.Error(err.(*relax.StatusError).Code, err.Error())
 			return
 		}
-
-		// Simple request
-		headers := f.handleSimpleRequest(origin)
 		for k, v := range headers {
 			ctx.Header()[k] = v
 		}
+		ctx.WriteHeader(http.StatusNoContent)
+		return
+	}
 
-		// let other downstream filters know that this is a CORS request
-		ctx.Set("cors.request", true)
-		ctx.Set("cors.origin", origin)
-
-		next(ctx)
+	// Simple request
+	headers := f.handleSimpleRequest(origin)
+	for k, v := range headers {
+		ctx.Header()[k] = v
 	}
+
+	// let other downstream filters know that this is a CORS request
+	ctx.Set("cors.request", true)
+	ctx.Set("cors.origin", origin)
+
+	next(ctx)
 }
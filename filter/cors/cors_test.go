@@ -0,0 +1,56 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cors_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+	"github.com/srfrog/go-relax/filter/cors"
+)
+
+type Partners struct{}
+
+func (p *Partners) Index(ctx *relax.Context) {}
+
+type Feeds struct{}
+
+func (f *Feeds) Index(ctx *relax.Context) {}
+
+func TestRouteOverrides(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Use(&cors.Filter{AllowOrigin: []string{"https://app.example.com"}})
+	svc.Resource(&Partners{}, &cors.Filter{AllowOrigin: []string{"https://*.partner.com"}, AllowCredentials: true})
+	feeds := &Feeds{}
+	svc.Resource(feeds).
+		POST("import", feeds.Index, &cors.Filter{AllowAnyOrigin: true, AllowMethods: []string{"POST"}})
+
+	tests := []struct {
+		Method, Path, Origin, Request string
+		AllowOrigin, AllowMethods     string
+	}{
+		{"GET", "/feeds", "https://app.example.com", "", "*", ""},
+		{"GET", "/feeds", "https://x.partner.com", "", "", ""},
+		{"GET", "/partners", "https://x.partner.com", "", "https://x.partner.com", ""},
+		{"GET", "/partners", "https://app.example.com", "", "", ""},
+		{"OPTIONS", "/partners", "https://x.partner.com", "GET", "https://x.partner.com", "GET, POST, PATCH, PUT, DELETE"},
+		{"OPTIONS", "/feeds/import", "https://any.org", "POST", "*", "POST"},
+		{"OPTIONS", "/feeds", "https://app.example.com", "GET", "*", "GET, POST, PATCH, PUT, DELETE"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.Method, tt.Path, nil)
+		req.Header.Set("Origin", tt.Origin)
+		if tt.Request != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.Request)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Header().Get("Access-Control-Allow-Origin") != tt.AllowOrigin ||
+			w.Header().Get("Access-Control-Allow-Methods") != tt.AllowMethods {
+			t.Errorf("%d: expected %q %q, got %d %v", i, tt.AllowOrigin, tt.AllowMethods, w.Code, w.Header())
+		}
+	}
+}
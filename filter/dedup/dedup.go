@@ -0,0 +1,140 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dedup
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Filter Dedup drops duplicate deliveries of a request, such as webhooks that
+providers deliver again when unsure they were received. Deliveries are
+identified by the value of a header; a delivery with an ID seen within
+Window gets a 200-"OK" response without running the handler, so handlers
+that aren't idempotent run once per delivery.
+
+	hooks.POST("github", hooks.GitHub, &dedup.Filter{Header: "X-GitHub-Delivery"})
+
+If the handler fails with a 5xx status, or panics, the ID is forgotten so the
+next delivery is handled. A delivery that arrives while the same ID is still being
+handled gets a 409-"Conflict" response with Retry-After, so the provider
+delivers it again if the first one fails. Requests without the header are not
+checked.
+*/
+type Filter struct {
+	// Header is the request header with the delivery ID.
+	// Defaults to "Webhook-Id", see https://www.standardwebhooks.com
+	Header string
+
+	// Window is the time during which a delivery ID is remembered.
+	// Defaults to 1 hour.
+	Window time.Duration
+
+	// Store keeps the delivery IDs seen.
+	// Defaults to a MemStore.
+	Store SeenStore
+
+	// OnError is an optional function called with store errors. The request
+	// is handled when the store fails.
+	// Defaults to nil
+	OnError func(*relax.Context, error)
+
+	// running has the keys of the deliveries being handled by this filter.
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// start marks the delivery 'key' as being handled. Returns false if it's
+// already being handled.
+func (f *Filter) start(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.running[key] {
+		return false
+	}
+	if f.running == nil {
+		f.running = make(map[string]bool)
+	}
+	f.running[key] = true
+	return true
+}
+
+// done marks the delivery 'key' as handled.
+func (f *Filter) done(key string) {
+	f.mu.Lock()
+	delete(f.running, key)
+	f.mu.Unlock()
+}
+
+// Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("dedup.id") // the delivery ID, if any
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	if f.Header == "" {
+		f.Header = "Webhook-Id"
+	}
+	if f.Window == 0 {
+		f.Window = time.Hour
+	}
+	if f.Store == nil {
+		f.Store = NewMemStore()
+	}
+	return func(ctx *relax.Context) {
+		id := ctx.Request.Header.Get(f.Header)
+		if id == "" {
+			next(ctx)
+			return
+		}
+		key := ctx.Request.URL.Path + " " + id
+
+		if !f.start(key) {
+			ctx.Header().Set("Retry-After", "1")
+			ctx.Error(http.StatusConflict, "That delivery is being handled.")
+			return
+		}
+		defer f.done(key)
+
+		added, err := f.Store.Add(key, f.Window)
+		if err != nil {
+			if f.OnError != nil {
+				f.OnError(ctx, err)
+			}
+			next(ctx)
+			return
+		}
+		if !added {
+			ctx.Header().Set("X-Duplicate-Delivery", "true")
+			ctx.WriteHeader(http.StatusOK)
+			return
+		}
+
+		ctx.Set("dedup.id", id)
+		// a handler panic is a 5xx failure too, forget the ID and re-panic.
+		defer func() {
+			if err := recover(); err != nil {
+				f.forget(ctx, key)
+				panic(err)
+			}
+		}()
+
+		next(ctx)
+
+		if ctx.Status() >= 500 {
+			f.forget(ctx, key)
+		}
+	}
+}
+
+// forget removes the delivery 'key' from the Store, so the next delivery is
+// handled.
+func (f *Filter) forget(ctx *relax.Context, key string) {
+	if err := f.Store.Delete(key); err != nil && f.OnError != nil {
+		f.OnError(ctx, err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dedup
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	svc := relax.NewService("/")
+	svc.Root().POST("hook", func(ctx *relax.Context) {
+		started <- struct{}{}
+		<-release
+		ctx.WriteHeader(500)
+	}, &Filter{})
+
+	deliver := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hook", nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Webhook-Id", "msg_1")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- deliver() }()
+	<-started
+
+	if w := deliver(); w.Code != 409 || w.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 409 with Retry-After while handled, got %d %v", w.Code, w.Header())
+	}
+	close(release)
+	if w := <-first; w.Code != 500 {
+		t.Errorf("expected first delivery 500, got %d", w.Code)
+	}
+
+	// the first delivery failed, the next one is handled.
+	go func() { <-started }()
+	if w := deliver(); w.Code != 500 {
+		t.Errorf("expected delivery handled again, got %d", w.Code)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	var calls int
+	code := 200
+	svc := relax.NewService("/")
+	svc.Root().POST("hook", func(ctx *relax.Context) {
+		calls++
+		ctx.WriteHeader(code)
+	}, &Filter{})
+
+	deliver := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hook", nil)
+		req.Header.Set("Content-Type", "application/json")
+		if id != "" {
+			req.Header.Set("Webhook-Id", id)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := deliver("msg_1"); w.Code != 200 || calls != 1 || w.Header().Get("X-Duplicate-Delivery") != "" {
+		t.Errorf("expected first delivery handled, got %d %d %v", w.Code, calls, w.Header())
+	}
+	if w := deliver("msg_1"); w.Code != 200 || calls != 1 || w.Header().Get("X-Duplicate-Delivery") != "true" {
+		t.Errorf("expected duplicate dropped, got %d %d %v", w.Code, calls, w.Header())
+	}
+
+	// requests without the header are not checked.
+	deliver("")
+	deliver("")
+	if calls != 3 {
+		t.Errorf("expected requests without ID handled, got %d calls", calls)
+	}
+
+	// failed deliveries are forgotten.
+	code = 503
+	deliver("msg_2")
+	code = 200
+	if w := deliver("msg_2"); w.Code != 200 || calls != 5 || w.Header().Get("X-Duplicate-Delivery") != "" {
+		t.Errorf("expected failed delivery handled again, got %d %d %v", w.Code, calls, w.Header())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var calls int
+	svc := relax.NewService("/")
+	svc.Root().POST("hook", func(ctx *relax.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		ctx.WriteHeader(200)
+	}, &Filter{})
+
+	deliver := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hook", nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Webhook-Id", "msg_1")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := deliver(); w.Code != 500 {
+		t.Errorf("expected 500 from panic, got %d", w.Code)
+	}
+	// the first delivery panicked, the next one is handled.
+	if w := deliver(); w.Code != 200 || calls != 2 || w.Header().Get("X-Duplicate-Delivery") != "" {
+		t.Errorf("expected delivery handled again, got %d %d %v", w.Code, calls, w.Header())
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// SeenStore is implemented by storage backends of delivery IDs. Stores shared
+// by several service instances, such as Redis with SET NX and an expiration,
+// drop duplicates delivered to any instance.
+type SeenStore interface {
+	// Add records 'key' for duration 'ttl'. Returns true if the key was added,
+	// or false if it was already recorded and not expired.
+	Add(key string, ttl time.Duration) (bool, error)
+
+	// Delete removes 'key', so it can be added again.
+	Delete(key string) error
+}
+
+// MemStore is a SeenStore that keeps keys in memory.
+type MemStore struct {
+	mu    sync.Mutex
+	keys  map[string]time.Time
+	prune time.Time
+}
+
+// NewMemStore returns a new MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{keys: make(map[string]time.Time)}
+}
+
+// Add implements SeenStore. Expired keys are removed periodically.
+func (s *MemStore) Add(key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.After(s.prune) {
+		for k, expires := range s.keys {
+			if now.After(expires) {
+				delete(s.keys, k)
+			}
+		}
+		s.prune = now.Add(ttl)
+	}
+	if expires, ok := s.keys[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+	s.keys[key] = now.Add(ttl)
+	return true, nil
+}
+
+// Delete implements SeenStore.
+func (s *MemStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.keys, key)
+	s.mu.Unlock()
+	return nil
+}
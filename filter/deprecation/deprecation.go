@@ -0,0 +1,140 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package deprecation
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Filter Deprecation marks the routes or resources of a deprecated API, and
+records which clients still call them, so they can be contacted before the API
+is removed. It must run after the auth filters, to know the client.
+
+	store := deprecation.NewMemStore()
+	v1 := svc.Version("v1")
+	v1.Resource(users, &deprecation.Filter{API: "v1", Store: store, Sunset: sunset})
+
+	// admin endpoint: GET /api/usage
+	svc.Resource(&deprecation.Usage{Store: store}, &authbasic.Filter{Provider: admins})
+
+Responses have the headers "Deprecation" and "Sunset", when the dates are set.
+See: https://tools.ietf.org/html/rfc9745 and https://tools.ietf.org/html/rfc8594
+*/
+type Filter struct {
+	// API is the name of the deprecated API, such as "v1" or "GET /v1/users".
+	// Defaults to the request method and the pattern of the matched route,
+	// such as "GET /v1/users/{uint:id}", so all the requests of a route are
+	// one API.
+	API string
+
+	// Store is where usage records are saved.
+	// Defaults to a MemStore.
+	Store UsageStore
+
+	// Keygen returns the client key of a request.
+	// Defaults to a function that returns the authenticated user, as set by
+	// auth filters in "auth.user", or "anonymous".
+	Keygen func(*relax.Context) string
+
+	// Date is when the API was deprecated, sent in the "Deprecation" header.
+	// Defaults to zero, no header.
+	Date time.Time
+
+	// Sunset is when the API will be removed, sent in the "Sunset" header.
+	// Defaults to zero, no header.
+	Sunset time.Time
+
+	// Link is the URL of a document about the deprecation, sent as a
+	// Link with rel="deprecation".
+	// Defaults to "", no link.
+	Link string
+
+	// OnError is called when a usage record can't be saved. The request is
+	// not affected.
+	// Defaults to nil, the error is logged in the service Log.
+	OnError func(error)
+}
+
+// Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("deprecation.api")    // name of the deprecated API
+//	ctx.Get("deprecation.client") // client key of the request
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	if f.Store == nil {
+		f.Store = NewMemStore()
+	}
+	if f.Keygen == nil {
+		f.Keygen = func(ctx *relax.Context) string {
+			if user, ok := ctx.Get("auth.user").(string); ok && user != "" {
+				return user
+			}
+			return "anonymous"
+		}
+	}
+	return func(ctx *relax.Context) {
+		api := f.API
+		if api == "" {
+			api = ctx.Request.Method + " " + ctx.RoutePattern()
+		}
+		client := f.Keygen(ctx)
+		ctx.Set("deprecation.api", api)
+		ctx.Set("deprecation.client", client)
+
+		if !f.Date.IsZero() {
+			ctx.Header().Set("Deprecation", "@"+strconv.FormatInt(f.Date.Unix(), 10))
+		}
+		if !f.Sunset.IsZero() {
+			ctx.Header().Set("Sunset", f.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if f.Link != "" {
+			ctx.Header().Add("Link", (&relax.Link{URI: f.Link, Rel: "deprecation"}).String())
+		}
+
+		if err := f.Store.Add(client, api, time.Now()); err != nil {
+			if f.OnError != nil {
+				f.OnError(err)
+			} else {
+				ctx.Log().Errorf("deprecation: Store error: %s", err)
+			}
+		}
+
+		next(ctx)
+	}
+}
+
+/*
+Usage is an admin resource that lists the usage of deprecated APIs. It
+implements relax.Resourcer; it must be protected with admin-only filters.
+
+	GET /api/usage                => list all records
+	GET /api/usage?api=v1         => list the clients of API "v1"
+	GET /api/usage?client=acme    => list the deprecated APIs used by "acme"
+*/
+type Usage struct {
+	Store UsageStore
+}
+
+// Index handles "GET /usage"
+func (u *Usage) Index(ctx *relax.Context) {
+	records, err := u.Store.List()
+	if err != nil {
+		ctx.Error(http.StatusInternalServerError, err.Error())
+		return
+	}
+	query := ctx.Request.URL.Query()
+	api, client := query.Get("api"), query.Get("client")
+	list := records[:0]
+	for _, rec := range records {
+		if (api == "" || rec.API == api) && (client == "" || rec.Client == client) {
+			list = append(list, rec)
+		}
+	}
+	ctx.Respond(list)
+}
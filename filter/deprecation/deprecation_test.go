@@ -0,0 +1,85 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package deprecation
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestDeprecation(t *testing.T) {
+	store := NewMemStore()
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	svc := relax.NewService("/")
+	svc.Root().GET("items/{uint:id}", func(ctx *relax.Context) {
+		ctx.Respond(ctx.Get("deprecation.api"))
+	}, &Filter{
+		Store:  store,
+		Keygen: func(ctx *relax.Context) string { return ctx.Request.Header.Get("X-Client") },
+		Date:   date,
+		Sunset: sunset,
+		Link:   "https://example.com/deprecation",
+	})
+	svc.Resource(&Usage{Store: store})
+
+	get := func(path, client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Client", client)
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/items/1", "acme")
+	h := w.Header()
+	if h.Get("Deprecation") != "@1704067200" ||
+		h.Get("Sunset") != "Wed, 01 Jan 2025 00:00:00 GMT" ||
+		h.Get("Link") != `<https://example.com/deprecation>; rel="deprecation"` {
+		t.Errorf("expected deprecation headers, got %v", h)
+	}
+	get("/items/2", "acme")
+	get("/items/3", "globex")
+
+	records, _ := store.List()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if r := records[0]; r.Client != "acme" || r.API != "GET /items/{uint:id}" || r.Count != 2 {
+		t.Errorf("expected route usage by acme, got %+v", r)
+	}
+
+	tests := []struct {
+		Query   string
+		Clients []string
+	}{
+		{"", []string{"acme", "globex"}},
+		{"?client=globex", []string{"globex"}},
+		{"?api=GET+/items/{uint:id}", []string{"acme", "globex"}},
+		{"?api=v1", nil},
+	}
+	for i, tt := range tests {
+		w := get("/usage"+tt.Query, "")
+		var list []*Record
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil || w.Code != 200 {
+			t.Errorf("%d: expected usage list, got %d %v", i, w.Code, err)
+			continue
+		}
+		if len(list) != len(tt.Clients) {
+			t.Errorf("%d: expected %v, got %d records", i, tt.Clients, len(list))
+			continue
+		}
+		for j, rec := range list {
+			if rec.Client != tt.Clients[j] {
+				t.Errorf("%d: expected client %q, got %q", i, tt.Clients[j], rec.Client)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package deprecation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record is the usage of a deprecated API by a client.
+type Record struct {
+	Client    string    `json:"client"`
+	API       string    `json:"api"`
+	Count     int64     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// UsageStore is implemented by storage backends of deprecated API usage.
+type UsageStore interface {
+	// Add records a call to deprecated 'api' by 'client' at time 't'.
+	Add(client, api string, t time.Time) error
+
+	// List returns all the usage records.
+	List() ([]*Record, error)
+}
+
+// MemStore is a UsageStore that keeps usage records in memory.
+type MemStore struct {
+	mu      sync.Mutex
+	records map[[2]string]*Record
+}
+
+// NewMemStore returns a new MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{records: make(map[[2]string]*Record)}
+}
+
+// Add implements UsageStore.
+func (s *MemStore) Add(client, api string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{client, api}
+	rec, ok := s.records[key]
+	if !ok {
+		rec = &Record{Client: client, API: api, FirstSeen: t}
+		s.records[key] = rec
+	}
+	rec.Count++
+	if t.After(rec.LastSeen) {
+		rec.LastSeen = t
+	}
+	return nil
+}
+
+// List implements UsageStore. Records are sorted by client and API.
+func (s *MemStore) List() ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Record, 0, len(s.records))
+	for _, rec := range s.records {
+		r := *rec
+		list = append(list, &r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Client != list[j].Client {
+			return list[i].Client < list[j].Client
+		}
+		return list[i].API < list[j].API
+	})
+	return list, nil
+}
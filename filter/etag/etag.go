@@ -7,6 +7,7 @@ package etag
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -25,6 +26,27 @@ type Filter struct {
 	// still be generated, if possible.
 	// Defaults to false
 	DisableConditionals bool
+
+	// Store is used to get entity-tags precomputed by the application, so
+	// responses aren't hashed. On GET and HEAD requests, If-None-Match is
+	// checked with the stored entity-tag before running the handler. Handlers
+	// use Save and Invalidate to manage the entity-tags. See: EtagStore
+	// Defaults to nil, entity-tags are always computed.
+	Store EtagStore
+
+	// Keygen makes the Store key of a request.
+	// Defaults to PathKey
+	Keygen func(*relax.Context) string
+
+	// Current returns the current entity-tag of the item in an unsafe request
+	// (DELETE PATCH POST PUT), for items without a stored entity-tag. It's used
+	// to check If-Match and If-None-Match before the handler runs. 'ok' is
+	// false if the entity-tag is unknown; an empty 'etag' with 'ok' true means
+	// the item doesn't exist. Conditional unsafe requests for items whose
+	// entity-tag is unknown, in Store and Current, get a response with HTTP
+	// status 428-"Precondition Required" and the handler isn't run.
+	// Defaults to nil, only stored entity-tags are used.
+	Current func(ctx *relax.Context) (etag string, ok bool)
 }
 
 // etagStrongCmp does strong comparison of If-Match entity values.
@@ -49,15 +71,61 @@ func etagWeakCmp(etags, etag string) bool {
 }
 
 // Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("etag.store") // the EtagStore, if any. See: Save
+//	ctx.Get("etag.key")   // the store key of the request
 func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	if f.Keygen == nil {
+		f.Keygen = PathKey
+	}
 	return func(ctx *relax.Context) {
-		var etag string
+		var etag, stored, key string
+
+		if f.Store != nil {
+			key = f.Keygen(ctx)
+			ctx.Set("etag.store", f.Store)
+			ctx.Set("etag.key", key)
+			stored, _ = f.Store.Get(key)
+		}
+
+		if !f.DisableConditionals {
+			if isEtagMethod(ctx.Request.Method) {
+				// the item didn't change, skip the handler.
+				ifnone := ctx.Request.Header.Get("If-None-Match")
+				if ifnone != "" && etagWeakCmp(ifnone, stored) {
+					ctx.Header().Set("ETag", stored)
+					ctx.Header().Add("Vary", "If-None-Match")
+					ctx.WriteHeader(http.StatusNotModified)
+					return
+				}
+			} else {
+				// unsafe methods are checked before the handler changes anything.
+				// If the current entity-tag isn't known, the conditions can't be
+				// checked, and the request fails without running the handler.
+				ok, checked := f.preconditions(ctx, stored)
+				if !ok {
+					ctx.WriteHeader(http.StatusPreconditionFailed)
+					return
+				}
+				if !checked {
+					ctx.WriteHeader(http.StatusPreconditionRequired)
+					return
+				}
+			}
+		}
 
 		// Start a buffered context. All writes are diverted to a ResponseBuffer.
 		rb := relax.NewResponseBuffer(ctx)
 		next(ctx.Clone(rb))
 		defer rb.Flush(ctx)
 
+		// The item changed, drop its stored etag unless the handler saved a new one.
+		if f.Store != nil && !isEtagMethod(ctx.Request.Method) && rb.Status() >= 200 && rb.Status() < 300 {
+			if ctx.Request.Method == "DELETE" || rb.Header().Get("ETag") == "" {
+				f.Store.Delete(key)
+			}
+		}
+
 		// Do not pass GO. Do not collect $200
 		if rb.Status() < 200 || rb.Status() == http.StatusNoContent ||
 			(rb.Status() > 299 && rb.Status() != http.StatusPreconditionFailed) ||
@@ -68,6 +136,9 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 		etag = rb.Header().Get("ETag")
 
 		if isEtagMethod(ctx.Request.Method) && rb.Status() == http.StatusOK {
+			if etag == "" && stored != "" {
+				etag = stored
+			}
 			if etag == "" {
 				alter := ""
 				// Change etag when using content encoding.
@@ -75,24 +146,16 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 					alter = "-" + ce
 				}
 				h := sha1.New()
-				h.Write(rb.Bytes())
+				io.Copy(h, rb.Reader())
 				etag = `"` + hex.EncodeToString(h.Sum(nil)) + alter + `"`
 			}
 		}
 
-		if !f.DisableConditionals {
+		// Conditionals of unsafe methods were checked before the handler.
+		if !f.DisableConditionals && isEtagMethod(ctx.Request.Method) {
 			// If-Match
 			ifmatch := ctx.Request.Header.Get("If-Match")
 			if ifmatch != "" && ((ifmatch == "*" && etag == "") || !etagStrongCmp(ifmatch, etag)) {
-				/*
-					// FIXME: need to verify Status per request.
-					if strings.Contains("DELETE PATCH POST PUT", ctx.Request.Method) && rb.Status() != http.StatusPreconditionFailed {
-						// XXX: we cant confirm it's the same resource item without re-GET'ing it.
-						// XXX: maybe etag should be changed from strong to weak.
-						etag = ""
-						goto Finish
-					}
-				*/
 				ctx.WriteHeader(http.StatusPreconditionFailed)
 				rb.Free()
 				return
@@ -113,22 +176,16 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 			// If-None-Match
 			ifnone := ctx.Request.Header.Get("If-None-Match")
 			if ifnone != "" && ((ifnone == "*" && etag != "") || etagWeakCmp(ifnone, etag)) {
-				// defer rb.Reset()
-				if isEtagMethod(ctx.Request.Method) {
-					rb.Header().Set("ETag", etag)
-					rb.Header().Add("Vary", "If-None-Match")
-					rb.WriteHeader(http.StatusNotModified)
-					rb.Reset()
-					return
-				}
-				ctx.WriteHeader(http.StatusPreconditionFailed)
-				rb.Free()
+				rb.Header().Set("ETag", etag)
+				rb.Header().Add("Vary", "If-None-Match")
+				rb.WriteHeader(http.StatusNotModified)
+				rb.Reset()
 				return
 			}
 
 			// If-Modified-Since
 			ifmods := ctx.Request.Header.Get("If-Modified-Since")
-			if ifnone == "" && ifmods != "" && !isEtagMethod(ctx.Request.Method) {
+			if ifnone == "" && ifmods != "" {
 				modtime, _ := time.Parse(http.TimeFormat, ifmods)
 				lastmod, _ := time.Parse(http.TimeFormat, rb.Header().Get("Last-Modified"))
 				if !modtime.IsZero() && !lastmod.IsZero() && (lastmod.Before(modtime) || lastmod.Equal(modtime)) {
@@ -152,6 +209,43 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	}
 }
 
+/*
+preconditions checks If-Match and If-None-Match of unsafe methods against the
+current entity-tag of the item, before the handler runs. The current entity-tag
+is 'stored', or the one returned by Filter.Current. If it's not known, the
+conditions can't be checked. If-Unmodified-Since can't be checked either,
+because the last modification time isn't known before the handler.
+Returns 'ok' false if a condition fails, and 'checked' false if the conditions
+can't be checked.
+*/
+func (f *Filter) preconditions(ctx *relax.Context, stored string) (ok, checked bool) {
+	ifmatch := ctx.Request.Header.Get("If-Match")
+	ifnone := ctx.Request.Header.Get("If-None-Match")
+	if ifmatch == "" && ifnone == "" {
+		// If-Unmodified-Since needs the response Last-Modified.
+		return true, ctx.Request.Header.Get("If-Unmodified-Since") == ""
+	}
+
+	current, known := stored, stored != ""
+	if !known && f.Current != nil {
+		current, known = f.Current(ctx)
+	}
+	if !known {
+		return true, false
+	}
+
+	// If-Match: "*" requires that the item exists.
+	if ifmatch != "" && ((ifmatch == "*" && current == "") || (ifmatch != "*" && !etagStrongCmp(ifmatch, current))) {
+		return false, true
+	}
+	// If-None-Match: "*" requires that the item doesn't exist, used to prevent
+	// overwriting items with PUT.
+	if ifnone != "" && ((ifnone == "*" && current != "") || (ifnone != "*" && etagWeakCmp(ifnone, current))) {
+		return false, true
+	}
+	return true, true
+}
+
 func isEtagMethod(m string) bool {
 	return m == "GET" || m == "HEAD"
 }
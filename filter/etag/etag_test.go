@@ -0,0 +1,141 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package etag
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestUnsafePreconditions(t *testing.T) {
+	var writes int
+	svc := relax.NewService("/")
+	svc.Root().
+		PUT("items/{uint:id}", func(ctx *relax.Context) {
+			writes++
+			ctx.Header().Set("ETag", `"v2"`)
+			ctx.Respond(map[string]string{"name": "item"})
+		}, &Filter{}).
+		PUT("known/{uint:id}", func(ctx *relax.Context) {
+			writes++
+			ctx.Respond(map[string]string{"name": "item"})
+		}, &Filter{Current: func(*relax.Context) (string, bool) { return `"v1"`, true }})
+
+	tests := []struct {
+		Path    string
+		IfMatch string
+		Code    int
+		Writes  int
+	}{
+		// unknown etag: can't be checked, the handler is not run.
+		{"/items/1", `"v1"`, 428, 0},
+		{"/items/1", `"v2"`, 428, 0},
+		// known etag: checked before the handler.
+		{"/known/1", `"v0"`, 412, 0},
+		{"/known/1", `"v1"`, 200, 1},
+	}
+	for i, tt := range tests {
+		writes = 0
+		req := httptest.NewRequest("PUT", tt.Path, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", tt.IfMatch)
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Code || writes != tt.Writes {
+			t.Errorf("%d: expected %d with %d writes, got %d with %d", i, tt.Code, tt.Writes, w.Code, writes)
+		}
+	}
+}
+
+func TestConditionals(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Root().GET("items/{uint:id}", func(ctx *relax.Context) {
+		ctx.Respond(map[string]string{"name": "item"})
+	}, &Filter{})
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/items/1", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Body.Len() == 0 {
+		t.Fatalf("expected 200 with an etag, got %d %q", w.Code, etag)
+	}
+
+	tests := []struct {
+		Header, Value string
+		Code          int
+	}{
+		{"If-None-Match", etag, 304},
+		{"If-None-Match", `"other"`, 200},
+		{"If-Match", etag, 200},
+		{"If-Match", `"other"`, 412},
+	}
+	for i, tt := range tests {
+		w := get(tt.Header, tt.Value)
+		if w.Code != tt.Code {
+			t.Errorf("%d: expected %d, got %d", i, tt.Code, w.Code)
+		}
+		if tt.Code != 200 && w.Body.Len() != 0 {
+			t.Errorf("%d: expected no body, got %q", i, w.Body.String())
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	var reads int
+	filter := &Filter{Store: NewMemStore()}
+	svc := relax.NewService("/")
+	svc.Root().
+		GET("items/{uint:id}", func(ctx *relax.Context) {
+			reads++
+			ctx.Respond(map[string]string{"name": "item"})
+		}, filter).
+		PUT("items/{uint:id}", func(ctx *relax.Context) {
+			Save(ctx, "v1")
+			ctx.Respond(map[string]string{"name": "item"})
+		}, filter).
+		DELETE("items/{uint:id}", func(ctx *relax.Context) {
+			ctx.WriteHeader(204)
+		}, filter)
+
+	serve := func(method, ifnone string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/items/1", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		if ifnone != "" {
+			req.Header.Set("If-None-Match", ifnone)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("PUT", ""); w.Code != 200 || w.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("expected saved etag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	// the stored etag matches, the handler is skipped.
+	if w := serve("GET", `"v1"`); w.Code != 304 || reads != 0 || w.Header().Get("ETag") != `"v1"` {
+		t.Errorf("expected 304 without the handler, got %d with %d reads", w.Code, reads)
+	}
+	if w := serve("GET", ""); w.Code != 200 || reads != 1 || w.Header().Get("ETag") != `"v1"` {
+		t.Errorf("expected stored etag on 200, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+
+	// the item was deleted, its etag is dropped.
+	serve("DELETE", "")
+	if w := serve("GET", `"v1"`); w.Code != 200 || reads != 2 {
+		t.Errorf("expected handler after delete, got %d with %d reads", w.Code, reads)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package etag
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/srfrog/go-relax"
+)
+
+// EtagStore is implemented by validator storage backends. Applications save
+// the entity-tag of a resource item when it's written, so the filter can use it
+// on reads without hashing the response body. Keys are made by Filter.Keygen.
+type EtagStore interface {
+	// Get returns the entity-tag of 'key', or an empty string if none is stored.
+	Get(key string) (string, error)
+
+	// Set stores the entity-tag 'etag' for 'key'.
+	Set(key, etag string) error
+
+	// Delete removes the entity-tag of 'key'.
+	Delete(key string) error
+}
+
+// MemStore is an EtagStore that keeps entity-tags in memory.
+type MemStore struct {
+	mu    sync.RWMutex
+	etags map[string]string
+}
+
+// NewMemStore returns a new MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{etags: make(map[string]string)}
+}
+
+// Get implements EtagStore.
+func (s *MemStore) Get(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.etags[key], nil
+}
+
+// Set implements EtagStore.
+func (s *MemStore) Set(key, etag string) error {
+	s.mu.Lock()
+	s.etags[key] = etag
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements EtagStore.
+func (s *MemStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.etags, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// PathKey makes store keys from the request path, which includes the route
+// and the resource item ID. So "GET /users/123" and "PUT /users/123" share a key.
+func PathKey(ctx *relax.Context) string {
+	return strings.TrimRight(ctx.Request.URL.Path, "/")
+}
+
+/*
+Save stores 'etag' as the entity-tag of the resource item in the request,
+using the EtagStore of the filter. It's meant to be called by handlers that
+write items, with a validator computed at write time, such as a version
+number or a hash of the item.
+
+	func (u *Users) Update(ctx *relax.Context) {
+		user, err := u.db.Save(ctx)
+		...
+		etag.Save(ctx, strconv.Itoa(user.Version))
+		ctx.Respond(user)
+	}
+
+The entity-tag is quoted if needed. Returns nil if the filter has no store.
+*/
+func Save(ctx *relax.Context, etag string) error {
+	store, _ := ctx.Get("etag.store").(EtagStore)
+	if store == nil {
+		return nil
+	}
+	if !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	ctx.Header().Set("ETag", etag)
+	return store.Set(ctx.Get("etag.key").(string), etag)
+}
+
+/*
+Invalidate removes the stored entity-tags of 'keys', using the EtagStore of
+the filter. If no keys are given, the key of the request item is used. It's
+meant to be called by handlers that change or delete items without a new
+validator.
+
+	func (u *Users) Delete(ctx *relax.Context) {
+		...
+		etag.Invalidate(ctx)
+	}
+
+Returns nil if the filter has no store.
+*/
+func Invalidate(ctx *relax.Context, keys ...string) error {
+	store, _ := ctx.Get("etag.store").(EtagStore)
+	if store == nil {
+		return nil
+	}
+	if len(keys) == 0 {
+		keys = []string{ctx.Get("etag.key").(string)}
+	}
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
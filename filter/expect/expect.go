@@ -0,0 +1,96 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package expect
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Filter Expect handles requests with the header "Expect: 100-continue", which
+clients send before uploading large payloads. net/http sends the interim
+response "100 Continue" when the handler first reads the request body; this
+filter makes sure requests that would be rejected get a final response first,
+so clients don't upload data that is discarded.
+
+Requests with any other expectation get a response with HTTP status
+417-"Expectation Failed". Payloads larger than MaxBodySize get a response with
+413-"Request Entity Too Large". Then Check is run, such as to authenticate the
+client, before the body is read.
+
+	svc.Use(&expect.Filter{
+		MaxBodySize: 100 << 20,
+		Check: func(ctx *relax.Context) error {
+			if ctx.Get("auth.user") == nil {
+				return &relax.StatusError{Code: http.StatusUnauthorized, Message: "Sign in to upload."}
+			}
+			return nil
+		},
+	})
+
+Filters that check requests without reading the body, such as authentication
+and limits, can also run before this one; their error responses are final.
+Requests without the Expect header are passed through unchecked, except for
+unknown expectations.
+*/
+type Filter struct {
+	// MaxBodySize is the maximum payload size in bytes, checked with the
+	// request Content-Length. If zero, the payload size limit of the request
+	// decoder is used, if any.
+	// Defaults to 0
+	MaxBodySize int64
+
+	// Check is an optional function that checks a request before the client
+	// sends the payload. If it returns an error, the request is rejected. A
+	// *relax.StatusError is sent as the response, other errors are sent as
+	// 417-"Expectation Failed".
+	// Defaults to nil
+	Check func(*relax.Context) error
+}
+
+// Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("expect.continue") // true if the client expects "100 Continue"
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	return func(ctx *relax.Context) {
+		expect := ctx.Request.Header.Get("Expect")
+		if expect == "" {
+			next(ctx)
+			return
+		}
+		if !strings.EqualFold(expect, "100-continue") {
+			ctx.Error(http.StatusExpectationFailed, "That expectation is not supported.")
+			return
+		}
+
+		limit := f.MaxBodySize
+		if limit == 0 {
+			limit, _ = ctx.Get("content.max_body_size").(int64)
+		}
+		if limit > 0 && ctx.Request.ContentLength > limit {
+			ctx.Error(http.StatusRequestEntityTooLarge,
+				"The request payload is too large.",
+				&relax.PayloadDetails{MaxBodySize: limit})
+			return
+		}
+
+		if f.Check != nil {
+			if err := f.Check(ctx); err != nil {
+				if e, ok := err.(*relax.StatusError); ok {
+					ctx.Error(e.Code, e.Message, e.Details)
+					return
+				}
+				ctx.Error(http.StatusExpectationFailed, err.Error())
+				return
+			}
+		}
+
+		ctx.Set("expect.continue", true)
+		next(ctx)
+	}
+}
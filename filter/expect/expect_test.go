@@ -0,0 +1,57 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package expect
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestExpect(t *testing.T) {
+	var checkErr error
+	svc := relax.NewService("/")
+	svc.Root().PUT("upload", func(ctx *relax.Context) {
+		if ctx.Get("expect.continue") != nil {
+			ctx.Header().Set("X-Continue", "true")
+		}
+		ctx.WriteHeader(204)
+	}, &Filter{
+		MaxBodySize: 10,
+		Check:       func(ctx *relax.Context) error { return checkErr },
+	})
+
+	tests := []struct {
+		Expect, Body string
+		Check        error
+		Code         int
+		Continue     string
+	}{
+		{"", "hello", nil, 204, ""},
+		{"", "payload larger than the limit", nil, 204, ""},
+		{"100-continue", "hello", nil, 204, "true"},
+		{"100-Continue", "hello", nil, 204, "true"},
+		{"200-ok", "hello", nil, 417, ""},
+		{"100-continue", "payload larger than the limit", nil, 413, ""},
+		{"100-continue", "hello", &relax.StatusError{Code: 401, Message: "Sign in to upload."}, 401, ""},
+		{"100-continue", "hello", errors.New("quota exceeded"), 417, ""},
+	}
+	for i, tt := range tests {
+		checkErr = tt.Check
+		req := httptest.NewRequest("PUT", "/upload", strings.NewReader(tt.Body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.Expect != "" {
+			req.Header.Set("Expect", tt.Expect)
+		}
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Code || w.Header().Get("X-Continue") != tt.Continue {
+			t.Errorf("%d: expected %d %q, got %d %q", i, tt.Code, tt.Continue, w.Code, w.Header().Get("X-Continue"))
+		}
+	}
+}
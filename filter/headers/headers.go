@@ -0,0 +1,187 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/srfrog/go-relax"
+)
+
+// Op is the operation of a Rule on a response header.
+type Op int
+
+// Rule operations.
+const (
+	// Set sets the header value, replacing any values.
+	Set Op = iota
+	// Add appends the value to the header values.
+	Add
+	// Remove deletes the header.
+	Remove
+)
+
+// Rule is a change to a response header, made when the response headers are
+// written, if the conditions match. Conditions that are empty always match.
+type Rule struct {
+	// Op is the operation: Set, Add or Remove.
+	Op Op
+
+	// Name is the header name.
+	Name string
+
+	// Value is the header value, for Set and Add.
+	Value string
+
+	// Status limits the rule to responses with these status codes. Codes are
+	// numbers, such as "404", or classes, such as "2xx".
+	Status []string
+
+	// ContentType limits the rule to responses with these media types, such
+	// as "application/json" or "text/*".
+	ContentType []string
+}
+
+/*
+Filter Headers applies a policy of Rules to the response headers, when they
+are written. It can be used at service, resource or route level, instead of
+many small filters that only add a header. Rules are applied in order.
+
+	policy := &headers.Filter{Rules: []headers.Rule{
+		{Op: headers.Set, Name: "Cache-Control", Value: "no-store", Status: []string{"4xx", "5xx"}},
+		{Op: headers.Add, Name: "Vary", Value: "Accept-Language"},
+		{Op: headers.Set, Name: "X-Content-Type-Options", Value: "nosniff", ContentType: []string{"text/*"}},
+		{Op: headers.Remove, Name: "X-Powered-By"},
+	}}
+	svc.Use(policy)
+
+This function will panic if a rule status is not a status code or class.
+*/
+type Filter struct {
+	// Rules is the header policy.
+	Rules []Rule
+}
+
+// checkStatus returns an error if 'status' isn't a status code or class.
+func checkStatus(status string) error {
+	if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+		return nil
+	}
+	if code, err := strconv.Atoi(status); err == nil && code >= 100 && code <= 999 {
+		return nil
+	}
+	return fmt.Errorf("headers: Invalid rule status %q", status)
+}
+
+// match returns true if the rule conditions match the response 'status' and
+// content type 'ct'.
+func (rule *Rule) match(status int, ct string) bool {
+	if rule.Status != nil {
+		code, class := strconv.Itoa(status), strconv.Itoa(status/100)+"xx"
+		found := false
+		for _, s := range rule.Status {
+			if s == code || s == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.ContentType != nil {
+		if idx := strings.Index(ct, ";"); idx != -1 {
+			ct = ct[:idx]
+		}
+		ct = strings.TrimSpace(ct)
+		found := false
+		for _, mt := range rule.ContentType {
+			if mt == ct || (strings.HasSuffix(mt, "/*") && strings.HasPrefix(ct, mt[:len(mt)-1])) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// apply applies the rules to 'header', for a response with 'status'.
+func (f *Filter) apply(header http.Header, status int) {
+	ct := header.Get("Content-Type")
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		if !rule.match(status, ct) {
+			continue
+		}
+		switch rule.Op {
+		case Set:
+			header.Set(rule.Name, rule.Value)
+		case Add:
+			header.Add(rule.Name, rule.Value)
+		case Remove:
+			header.Del(rule.Name)
+		}
+	}
+}
+
+// policyWriter applies the filter rules before the headers are written.
+type policyWriter struct {
+	http.ResponseWriter
+	filter  *Filter
+	applied bool
+}
+
+func (w *policyWriter) apply(status int) {
+	if !w.applied {
+		w.applied = true
+		w.filter.apply(w.Header(), status)
+	}
+}
+
+func (w *policyWriter) WriteHeader(code int) {
+	w.apply(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *policyWriter) Write(b []byte) (int, error) {
+	w.apply(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, so streamed responses get the rules too.
+func (w *policyWriter) Flush() {
+	w.apply(http.StatusOK)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the ResponseWriter wrapped, for http.ResponseController.
+func (w *policyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Run runs the filter. No info is passed.
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	for i := range f.Rules {
+		for _, s := range f.Rules[i].Status {
+			if err := checkStatus(s); err != nil {
+				panic(err.Error())
+			}
+		}
+	}
+	return func(ctx *relax.Context) {
+		w := &policyWriter{ResponseWriter: ctx, filter: f}
+		next(ctx.Clone(w))
+		// nothing was written, the headers are sent after the handler.
+		w.apply(ctx.Status())
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package headers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestRules(t *testing.T) {
+	policy := &Filter{Rules: []Rule{
+		{Op: Set, Name: "Cache-Control", Value: "no-store", Status: []string{"4xx", "503"}},
+		{Op: Add, Name: "Vary", Value: "Accept-Language"},
+		{Op: Set, Name: "X-Content-Type-Options", Value: "nosniff", ContentType: []string{"text/*"}},
+		{Op: Remove, Name: "X-Powered-By"},
+	}}
+	svc := relax.NewService("/")
+	svc.Root().
+		GET("text", func(ctx *relax.Context) {
+			ctx.Header().Set("X-Powered-By", "relax")
+			ctx.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			ctx.Write([]byte("hello"))
+		}, policy).
+		GET("missing", func(ctx *relax.Context) {
+			ctx.Error(404, "That item was not found.")
+		}, policy).
+		GET("busy", func(ctx *relax.Context) {
+			ctx.WriteHeader(503)
+		}, policy).
+		GET("empty", func(ctx *relax.Context) {
+			ctx.Header().Set("X-Powered-By", "relax")
+		}, policy)
+
+	tests := []struct {
+		Path                        string
+		Code                        int
+		CacheControl, Vary, NoSniff string
+	}{
+		{"/text", 200, "", "Accept-Language", "nosniff"},
+		{"/missing", 404, "no-store", "Accept-Language", ""},
+		{"/busy", 503, "no-store", "Accept-Language", ""},
+		// nothing written, the rules are applied after the handler.
+		{"/empty", 200, "", "Accept-Language", ""},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", tt.Path, nil))
+		h := w.Header()
+		if w.Code != tt.Code || h.Get("Cache-Control") != tt.CacheControl ||
+			h.Get("X-Content-Type-Options") != tt.NoSniff || h.Get("X-Powered-By") != "" {
+			t.Errorf("%d: expected %d %q %q, got %d %v", i, tt.Code, tt.CacheControl, tt.NoSniff, w.Code, h)
+		}
+		if vary := h.Values("Vary"); len(vary) == 0 || vary[len(vary)-1] != tt.Vary {
+			t.Errorf("%d: expected Vary %q, got %q", i, tt.Vary, vary)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Root().GET("stream", func(ctx *relax.Context) {
+		ctx.Flush()
+		ctx.Header().Set("X-Late", "yes")
+	}, &Filter{Rules: []Rule{{Op: Set, Name: "X-Policy", Value: "on"}}})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/stream", nil))
+	if !w.Flushed || w.Header().Get("X-Policy") != "on" {
+		t.Errorf("expected flushed response with the rules, got %v %v", w.Flushed, w.Header())
+	}
+}
+
+func TestInvalidStatus(t *testing.T) {
+	for _, status := range []string{"6xx", "2x", "abc", "99"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for rule status %q", status)
+				}
+			}()
+			(&Filter{Rules: []Rule{{Op: Remove, Name: "Server", Status: []string{status}}}}).Run(nil)
+		}()
+	}
+}
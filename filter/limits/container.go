@@ -5,9 +5,11 @@
 package limits
 
 import (
+	"container/list"
+	"hash/fnv"
+	"math"
+	"sync"
 	"time"
-
-	"camlistore.org/pkg/lru"
 )
 
 // Container objects that implement this interface can serve as token bucket
@@ -25,27 +27,120 @@ type Container interface {
 	Reset(string)
 }
 
-// MemBucket implements Container using an in-memory LRU cache.
+// Banner is implemented by Container objects that can place keys in a
+// penalty box (ban) for some time, after repeated abuse.
+type Banner interface {
+	// Strike records an abuse signal for a key.
+	// Returns the number of consecutive strikes for the key.
+	Strike(string) int
+
+	// Pardon clears all the strikes for a key.
+	Pardon(string)
+
+	// Ban places a key in the penalty box for a duration.
+	Ban(string, time.Duration)
+
+	// Banned returns the time left for a key in the penalty box, or zero if
+	// the key is not banned.
+	Banned(string) time.Duration
+}
+
+// StrikeCounter is implemented by Banner containers that can tell the strikes
+// of a key without changing them. Usage uses it to pardon only the keys with
+// strikes, instead of on every request.
+type StrikeCounter interface {
+	// Strikes returns the number of consecutive strikes for a key.
+	Strikes(string) int
+}
+
+// memBucketShards is the number of shards used by MemBucket. Each shard has its
+// own lock, so concurrent requests for different keys rarely contend.
+const memBucketShards = 32
+
+// MemBucket implements Container using an in-memory map, split into shards
+// with their own LRU list. Keys that are idle for longer than TTL are expired.
 // This container is ideal for single-host applications, and it's go-routine
-// safe.
+// safe. MemBucket objects are created with NewMemBucket, the former Cache field
+// was removed. A MemBucket with only Size and Rate set has no limit of keys.
 type MemBucket struct {
-	Size  int        // max tokens allowed, capacity.
-	Rate  int        // tokens added per minute
-	Cache *lru.Cache // LRU cache storage
+	Size int // max tokens allowed, capacity.
+	Rate int // tokens added per minute
+
+	// TTL is the time an idle key is kept in the container. After this time
+	// the key's bucket would be full anyway, so it's safe to drop it.
+	// Defaults to the time it takes to fill-up an empty bucket.
+	TTL time.Duration
+
+	// Clock returns the current time. It can be changed to control time in tests.
+	// Defaults to time.Now
+	Clock func() time.Time
+
+	once   sync.Once
+	shards []*memShard
+}
+
+// memShard is a section of MemBucket keys, with its own lock and LRU list.
+type memShard struct {
+	sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+	max   int // max keys, or zero for no limit.
 }
 
 type tokenBucket struct {
-	Tokens int       // current token count
-	When   time.Time // time of last check
+	Key     string    // key of this bucket
+	Tokens  int       // current token count
+	When    time.Time // time of last check
+	Strikes int       // consecutive strikes count
+	Until   time.Time // time when a ban ends
+	Expires time.Time // time when this bucket expires
 }
 
-// NewMemBucket returns a new MemBucket container object. It initializes
-// the LRU cache with 'maxKeys'.
+// NewMemBucket returns a new MemBucket container object. It can monitor up to
+// 'maxKeys' keys, after which the least recently used keys are dropped. If
+// 'maxKeys' is zero, the number of keys is not limited. The keys are split in
+// shards of the same size, so up to 31 more keys than 'maxKeys' can be kept;
+// for fewer than 32 keys a single shard is used, with exactly 'maxKeys'.
 func NewMemBucket(maxKeys, capacity, rate int) Container {
-	return &MemBucket{
-		Size:  capacity,
-		Rate:  rate,
-		Cache: lru.New(maxKeys),
+	shards := memBucketShards
+	if maxKeys > 0 && maxKeys < shards {
+		shards = 1
+	}
+	return newMemBucket(shards, maxKeys, capacity, rate)
+}
+
+func newMemBucket(shards, maxKeys, capacity, rate int) *MemBucket {
+	b := &MemBucket{
+		Size: capacity,
+		Rate: rate,
+	}
+	b.once.Do(func() { b.init(shards, maxKeys) })
+	return b
+}
+
+// init sets the defaults of the fields that are not set, and makes 'shards'
+// shards for up to 'maxKeys' keys.
+func (b *MemBucket) init(shards, maxKeys int) {
+	if b.TTL == 0 {
+		b.TTL = time.Duration(math.Ceil(float64(b.Size)/float64(b.Rate))) * time.Minute
+	}
+	if b.Clock == nil {
+		b.Clock = time.Now
+	}
+	max := 0
+	if maxKeys > 0 {
+		max = maxKeys / shards
+		if maxKeys%shards != 0 {
+			max++
+		}
+	}
+	b.shards = make([]*memShard, shards)
+	for i := range b.shards {
+		b.shards[i] = &memShard{
+			items: make(map[string]*list.Element),
+			lru:   list.New(),
+			max:   max,
+		}
 	}
 }
 
@@ -55,23 +150,80 @@ func (b *MemBucket) Capacity() int {
 }
 
 // Consume removes a token from the key-indexed bucket at n-rate.
-func (b *MemBucket) Consume(key string, n int) (int, int, bool) {
-	tb := b.fill(key)
-	if tb.Tokens < n {
-		return tb.Tokens, b.wait(n - tb.Tokens), false
-	}
-	tb.Tokens -= n
-	return tb.Tokens, b.wait(b.Size), true
+func (b *MemBucket) Consume(key string, n int) (tokens int, wait int, ok bool) {
+	b.update(key, func(tb *tokenBucket) {
+		if tb.Tokens < n {
+			tokens, wait = tb.Tokens, b.wait(n-tb.Tokens)
+			return
+		}
+		tb.Tokens -= n
+		tokens, wait, ok = tb.Tokens, b.wait(b.Size), true
+	})
+	return
 }
 
 // Reset re-fills the bucket and resets the rate.
 func (b *MemBucket) Reset(key string) {
-	cache, ok := b.Cache.Get(key)
-	if ok {
-		tb := cache.(*tokenBucket)
+	b.peek(key, func(tb *tokenBucket) {
 		tb.Tokens = b.Size
-		tb.When = time.Now()
+		tb.When = b.Clock()
+	})
+}
+
+// Strike records an abuse signal for a key, and returns the consecutive
+// strikes count.
+func (b *MemBucket) Strike(key string) (strikes int) {
+	b.update(key, func(tb *tokenBucket) {
+		tb.Strikes++
+		strikes = tb.Strikes
+	})
+	return
+}
+
+// Strikes returns the consecutive strikes count of a key.
+func (b *MemBucket) Strikes(key string) (strikes int) {
+	b.peek(key, func(tb *tokenBucket) {
+		strikes = tb.Strikes
+	})
+	return
+}
+
+// Pardon clears the strikes count of a key.
+func (b *MemBucket) Pardon(key string) {
+	b.peek(key, func(tb *tokenBucket) {
+		tb.Strikes = 0
+	})
+}
+
+// Ban places a key in the penalty box for duration 'd'.
+func (b *MemBucket) Ban(key string, d time.Duration) {
+	b.update(key, func(tb *tokenBucket) {
+		tb.Strikes = 0
+		tb.Until = b.Clock().Add(d)
+	})
+}
+
+// Banned returns the time left in the penalty box for a key.
+func (b *MemBucket) Banned(key string) (left time.Duration) {
+	b.peek(key, func(tb *tokenBucket) {
+		if d := tb.Until.Sub(b.Clock()); d > 0 {
+			left = d
+		}
+	})
+	return
+}
+
+// Len returns the number of keys in the container, including expired keys
+// that haven't been evicted yet.
+func (b *MemBucket) Len() int {
+	b.once.Do(func() { b.init(memBucketShards, 0) })
+	n := 0
+	for _, shard := range b.shards {
+		shard.Lock()
+		n += shard.lru.Len()
+		shard.Unlock()
 	}
+	return n
 }
 
 func (b *MemBucket) wait(needed int) int {
@@ -79,22 +231,90 @@ func (b *MemBucket) wait(needed int) int {
 	return int(estimate)
 }
 
-func (b *MemBucket) fill(key string) *tokenBucket {
-	now := time.Now()
-	cache, ok := b.Cache.Get(key)
+// shard returns the shard that holds 'key'. A MemBucket that was not made by
+// NewMemBucket gets its shards on first use, without a limit of keys.
+func (b *MemBucket) shard(key string) *memShard {
+	b.once.Do(func() { b.init(memBucketShards, 0) })
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return b.shards[h.Sum32()%uint32(len(b.shards))]
+}
+
+// peek calls 'fn' with the bucket of 'key', if it exists and it's not expired.
+// The shard is locked during the call.
+func (b *MemBucket) peek(key string, fn func(*tokenBucket)) {
+	shard := b.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	e, ok := shard.items[key]
 	if !ok {
-		tb := &tokenBucket{
+		return
+	}
+	now := b.Clock()
+	tb := e.Value.(*tokenBucket)
+	if now.After(tb.Expires) {
+		shard.remove(e)
+		return
+	}
+	b.fill(tb, now)
+	fn(tb)
+}
+
+// update calls 'fn' with the bucket of 'key', creating a new bucket if needed.
+// The shard is locked during the call, and the bucket expiration is renewed.
+func (b *MemBucket) update(key string, fn func(*tokenBucket)) {
+	shard := b.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+	now := b.Clock()
+	e, ok := shard.items[key]
+	if ok && now.After(e.Value.(*tokenBucket).Expires) {
+		shard.remove(e)
+		ok = false
+	}
+	if !ok {
+		e = shard.lru.PushFront(&tokenBucket{
+			Key:    key,
 			Tokens: b.Size,
 			When:   now,
+		})
+		shard.items[key] = e
+		for shard.max > 0 && shard.lru.Len() > shard.max {
+			shard.remove(shard.lru.Back())
 		}
-		b.Cache.Add(key, tb)
-		return tb
+	} else {
+		shard.lru.MoveToFront(e)
 	}
-	tb := cache.(*tokenBucket)
-	if tb.Tokens < b.Size {
-		delta := float64(b.Rate) * time.Since(tb.When).Minutes()
-		tb.Tokens = Min(b.Size, tb.Tokens+int(delta))
+	tb := e.Value.(*tokenBucket)
+	b.fill(tb, now)
+	fn(tb)
+	tb.Expires = now.Add(b.TTL)
+	if tb.Until.After(tb.Expires) {
+		tb.Expires = tb.Until
 	}
-	tb.When = now
-	return tb
+}
+
+// fill adds the tokens earned since the last check. Only the time used by whole
+// tokens is accounted, so frequent checks don't lose partial tokens.
+func (b *MemBucket) fill(tb *tokenBucket, now time.Time) {
+	if tb.Tokens >= b.Size {
+		tb.When = now
+		return
+	}
+	delta := int(float64(b.Rate) * now.Sub(tb.When).Minutes())
+	if delta <= 0 {
+		return
+	}
+	tb.Tokens = Min(b.Size, tb.Tokens+delta)
+	if tb.Tokens == b.Size {
+		tb.When = now
+		return
+	}
+	tb.When = tb.When.Add(time.Duration(delta) * time.Minute / time.Duration(b.Rate))
+}
+
+// remove drops an element from the shard.
+func (s *memShard) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.items, e.Value.(*tokenBucket).Key)
 }
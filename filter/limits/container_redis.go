@@ -6,16 +6,76 @@ package limits
 
 import (
 	"net/url"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"github.com/srfrog/go-relax"
 )
 
-// RedisBucket implements Container using Redis strings.
+// RedisPool is implemented by Redis connection pools. redis.Pool implements it,
+// and so do Redis Cluster clients such as redisc.Cluster. For Redis Sentinel,
+// use a redis.Pool with a Dial function that resolves the current master.
+//
+// All the keys used by a single RedisBucket operation hash to the same cluster slot.
+type RedisPool interface {
+	Get() redis.Conn
+}
+
+// consumeScript refills and takes tokens from a bucket in a single atomic step.
+// The bucket is a hash with the fields "tokens" and "ts" (last fill time, in ms).
+//
+// KEYS[1] = bucket key
+// ARGV[1] = capacity, ARGV[2] = rate (tokens per minute), ARGV[3] = tokens to take.
+// Returns {tokens left, 1 if tokens were taken or 0 otherwise}.
+var consumeScript = redis.NewScript(1, `
+if redis.replicate_commands then redis.replicate_commands() end
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local b = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(b[1])
+local ts = tonumber(b[2])
+if tokens == nil or ts == nil or tokens >= capacity then
+	tokens = math.min(tokens or capacity, capacity)
+	ts = now
+else
+	local delta = math.floor((now - ts) * rate / 60000)
+	if delta > 0 then
+		tokens = math.min(capacity, tokens + delta)
+		ts = ts + math.floor(delta * 60000 / rate)
+	end
+end
+local ok = 0
+if tokens >= n then
+	tokens = tokens - n
+	ok = 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", ts)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate) * 60000)
+return {tokens, ok}
+`)
+
+// RedisBucket implements Container using Redis hashes. All bucket updates are
+// done atomically with a Lua script, so many service instances can share
+// the same buckets.
+//
+// Redis errors never stop requests, the bucket fails open and the error is
+// sent to OnError.
 type RedisBucket struct {
 	Size int // max tokens allowed
-	Rate int // tokens added per second
-	Pool *redis.Pool
+	Rate int // tokens added per minute
+	Pool RedisPool
+
+	// OnError is called when a Redis command fails.
+	// Defaults to nil, the error is logged in the Log of the service that
+	// uses the bucket in a Usage filter.
+	OnError func(error)
+
+	log atomic.Value // *relax.Log of the service, for Redis errors.
 }
 
 // Capacity returns the max number of tokens per client
@@ -27,67 +87,127 @@ func (b *RedisBucket) Capacity() int {
 // Returns the number of tokens available, time in seconds for next one, and
 // a boolean indicating whether of not a token was consumed.
 func (b *RedisBucket) Consume(key string, n int) (int, int, bool) {
-	tokens := b.fill(key)
-	if tokens < n {
+	tokens, ok, err := b.consume(key, n)
+	if err != nil {
+		b.error(err)
+		return b.Size, 0, true
+	}
+	if !ok {
 		return tokens, b.wait(n - tokens), false
 	}
+	return tokens, b.wait(b.Size), true
+}
+
+func (b *RedisBucket) consume(key string, n int) (int, bool, error) {
 	c := b.Pool.Get()
 	defer c.Close()
-	tokens, _ = redis.Int(c.Do("DECRBY", key, n))
-	return tokens, b.wait(b.Size), true
+	values, err := redis.Ints(consumeScript.Do(c, key, b.Size, b.Rate, n))
+	if err != nil {
+		return 0, false, err
+	}
+	return values[0], values[1] == 1, nil
 }
 
 // Reset will fill-up a bucket regardless of time/count.
 func (b *RedisBucket) Reset(key string) {
 	c := b.Pool.Get()
 	defer c.Close()
-	panicIf(c.Send("SET", key, b.Size, "EX", b.wait(b.Size), "XX"))
+	if _, err := c.Do("DEL", key); err != nil {
+		b.error(err)
+	}
 }
 
-func (b *RedisBucket) wait(needed int) int {
-	estimate := float64(needed/b.Rate) + float64(needed%b.Rate)*(1e-9/60.0)*60.0
-	return int(estimate)
+// Strike records an abuse signal for a key, and returns the consecutive
+// strikes count. Strikes expire after an hour of no activity.
+func (b *RedisBucket) Strike(key string) int {
+	c := b.Pool.Get()
+	defer c.Close()
+	c.Send("MULTI")
+	c.Send("INCR", redisKey(key, "strikes"))
+	c.Send("EXPIRE", redisKey(key, "strikes"), 3600)
+	values, err := redis.Ints(c.Do("EXEC"))
+	if err != nil {
+		b.error(err)
+		return 0
+	}
+	return values[0]
 }
 
-func (b *RedisBucket) fill(key string) int {
-	var ttl, tokens int
+// Strikes returns the consecutive strikes count of a key.
+func (b *RedisBucket) Strikes(key string) int {
+	c := b.Pool.Get()
+	defer c.Close()
+	n, err := redis.Int(c.Do("GET", redisKey(key, "strikes")))
+	if err != nil && err != redis.ErrNil {
+		b.error(err)
+	}
+	return n
+}
 
+// Pardon clears the strikes count of a key.
+func (b *RedisBucket) Pardon(key string) {
 	c := b.Pool.Get()
 	defer c.Close()
+	if _, err := c.Do("DEL", redisKey(key, "strikes")); err != nil {
+		b.error(err)
+	}
+}
 
+// Ban places a key in the penalty box for duration 'd'.
+func (b *RedisBucket) Ban(key string, d time.Duration) {
+	c := b.Pool.Get()
+	defer c.Close()
 	c.Send("MULTI")
-	c.Send("TTL", key)
-	c.Send("GET", key)
-	values, err := redis.Values(c.Do("EXEC"))
+	c.Send("DEL", redisKey(key, "strikes"))
+	c.Send("SET", redisKey(key, "ban"), 1, "PX", int64(d/time.Millisecond))
+	if _, err := c.Do("EXEC"); err != nil {
+		b.error(err)
+	}
+}
+
+// Banned returns the time left in the penalty box for a key.
+func (b *RedisBucket) Banned(key string) time.Duration {
+	c := b.Pool.Get()
+	defer c.Close()
+	ms, err := redis.Int64(c.Do("PTTL", redisKey(key, "ban")))
 	if err != nil {
-		c.Do("DISCARD")
+		b.error(err)
 		return 0
 	}
-
-	if _, err := redis.Scan(values, &ttl, &tokens); err != nil {
-		panicIf(err)
+	if ms < 0 {
 		return 0
 	}
+	return time.Duration(ms) * time.Millisecond
+}
 
-	when := b.wait(b.Size)
+func (b *RedisBucket) wait(needed int) int {
+	estimate := float64(needed/b.Rate) + float64(needed%b.Rate)*(1e-9/60.0)*60.0
+	return int(estimate)
+}
 
-	if ttl == -2 {
-		panicIf(c.Send("SET", key, b.Size, "EX", when))
-		return b.Size
+func (b *RedisBucket) error(err error) {
+	if b.OnError != nil {
+		b.OnError(err)
+		return
+	}
+	l, _ := b.log.Load().(*relax.Log)
+	if l == nil {
+		l = relax.NewLog(nil)
 	}
+	l.Errorf("limits: Redis bucket error: %s", err)
+}
 
-	if tokens < b.Size {
-		since := when - ttl
-		if since > 60 {
-			delta := float64(b.Rate) * (time.Duration(since) * time.Second).Minutes()
-			tokens = Min(b.Size, tokens+int(delta))
-			panicIf(c.Send("SET", key, tokens, "EX", when, "XX"))
-			return tokens
-		}
+// useLog sets the Log of Redis errors, if not set yet. It implements logUser.
+func (b *RedisBucket) useLog(l *relax.Log) {
+	if b.log.Load() == nil {
+		b.log.Store(l)
 	}
+}
 
-	panicIf(c.Send("EXPIRE", key, when))
-	return tokens
+// redisKey returns a key derived from 'key', that is stored in the same
+// Redis Cluster slot.
+func redisKey(key, suffix string) string {
+	return "{" + key + "}:" + suffix
 }
 
 // newRedisPool returns a new Redis connection pool.
@@ -96,7 +216,7 @@ func (b *RedisBucket) fill(key string) int {
 // 	{network}://:{auth@}{host:port}/{index}
 //
 // Where:
-// 	{network} is "tcp" or "udp" for network type.
+// 	{network} is "tcp" or "udp" for network type, or "tls" for TCP over TLS.
 //		{auth} is authentication password.
 //		{host:[port]} host address with optional port.
 //		{index} an optional database index
@@ -105,24 +225,37 @@ func (b *RedisBucket) fill(key string) int {
 // 	tcp://:secret@company.com:1234/5
 //
 // Defaults to port 6379 and index 0.
-func newRedisPool(uri string) *redis.Pool {
-	var auth, idx string
-
+//
+// 'options' are passed to redis.Dial, they can be used to set timeouts and
+// TLS configuration.
+func newRedisPool(uri string, options ...redis.DialOption) (*redis.Pool, error) {
 	u, err := url.Parse(uri)
-	panicIf(err)
+	if err != nil {
+		return nil, err
+	}
 
 	if _, port := SplitPort(u.Host); port == "" {
 		u.Host += ":6379"
 	}
 
+	network := u.Scheme
+	if network == "tls" {
+		network = "tcp"
+		options = append([]redis.DialOption{redis.DialUseTLS(true)}, options...)
+	}
+
 	if u.User != nil {
 		if value, ok := u.User.Password(); ok {
-			auth = value
+			options = append([]redis.DialOption{redis.DialPassword(value)}, options...)
 		}
 	}
 
-	if u.Path != "" {
-		idx = u.Path[1:]
+	if len(u.Path) > 1 {
+		idx, err := strconv.Atoi(u.Path[1:])
+		if err != nil {
+			return nil, err
+		}
+		options = append([]redis.DialOption{redis.DialDatabase(idx)}, options...)
 	}
 
 	return &redis.Pool{
@@ -130,42 +263,42 @@ func newRedisPool(uri string) *redis.Pool {
 		MaxActive:   100,
 		IdleTimeout: 300 * time.Second,
 		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial(u.Scheme, u.Host)
-			if err != nil {
-				return nil, err
-			}
-			if auth != "" {
-				if err = c.Send("AUTH", auth); err != nil {
-					c.Close()
-					return nil, err
-				}
-			}
-			if idx != "" {
-				if err := c.Send("SELECT", idx); err != nil {
-					c.Close()
-					return nil, err
-				}
-			}
-			return c, err
+			return redis.Dial(network, u.Host, options...)
 		},
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
 			_, err := c.Do("PING")
 			return err
 		},
+	}, nil
+}
+
+// NewRedisBucket returns a new Redis bucket, connected to the Redis server at
+// 'uri'. The URI format is "{network}://:{auth@}{host:port}/{index}", where
+// network is "tcp", "udp" or "tls". Optional 'options' are used when dialing
+// the server, such as:
+//
+// 	limits.NewRedisBucket("tls://:secret@redis.company.com", 100, 10,
+// 		redis.DialConnectTimeout(time.Second),
+// 		redis.DialReadTimeout(100*time.Millisecond))
+//
+// Returns an error if the URI is invalid.
+func NewRedisBucket(uri string, capacity, rate int, options ...redis.DialOption) (*RedisBucket, error) {
+	pool, err := newRedisPool(uri, options...)
+	if err != nil {
+		return nil, err
 	}
+	return NewRedisPoolBucket(pool, capacity, rate), nil
 }
 
-// NewRedisBucket returns a new Redis bucket.
-func NewRedisBucket(uri string, capacity, rate int) *RedisBucket {
+// NewRedisPoolBucket returns a new Redis bucket that uses connections
+// from 'pool'. Use this with Redis Cluster or Sentinel setups.
+func NewRedisPoolBucket(pool RedisPool, capacity, rate int) *RedisBucket {
 	return &RedisBucket{
 		Size: capacity,
 		Rate: rate,
-		Pool: newRedisPool(uri),
-	}
-}
-
-func panicIf(err error) {
-	if err != nil {
-		panic(err)
+		Pool: pool,
 	}
 }
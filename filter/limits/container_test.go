@@ -0,0 +1,134 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package limits
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testClock is a clock that only moves when told.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestMemBucket(t *testing.T) {
+	clock := &testClock{now: time.Date(2014, 8, 14, 6, 20, 48, 0, time.UTC)}
+	b := newMemBucket(4, 8, 10, 2)
+	b.Clock = clock.Now
+
+	for i := 0; i < 10; i++ {
+		if _, _, ok := b.Consume("key", 1); !ok {
+			t.Fatalf("consume %d: expected a token", i)
+		}
+	}
+	if tokens, _, ok := b.Consume("key", 1); ok || tokens != 0 {
+		t.Fatalf("expected empty bucket, got %d tokens", tokens)
+	}
+
+	// 2 tokens per minute, in 30 second steps.
+	clock.Advance(30 * time.Second)
+	if _, _, ok := b.Consume("key", 1); !ok {
+		t.Fatal("expected a token after 30s")
+	}
+	clock.Advance(30 * time.Second)
+	if tokens, _, ok := b.Consume("key", 1); !ok || tokens != 0 {
+		t.Fatalf("expected last token after 60s, got %d tokens", tokens)
+	}
+
+	// idle keys expire and come back full.
+	clock.Advance(b.TTL + time.Second)
+	if tokens, _, ok := b.Consume("key", 1); !ok || tokens != 9 {
+		t.Fatalf("expected expired key to be renewed, got %d tokens", tokens)
+	}
+
+	// strikes are counted until pardoned.
+	b.Strike("key")
+	if n := b.Strike("key"); n != 2 || b.Strikes("key") != 2 {
+		t.Fatalf("expected 2 strikes, got %d %d", n, b.Strikes("key"))
+	}
+	b.Pardon("key")
+	if n := b.Strikes("key"); n != 0 {
+		t.Fatalf("expected strikes pardoned, got %d", n)
+	}
+
+	// bans outlive the key TTL.
+	b.Ban("key", 2*b.TTL)
+	clock.Advance(b.TTL + time.Second)
+	if b.Banned("key") == 0 {
+		t.Fatal("expected key to be banned")
+	}
+	clock.Advance(b.TTL)
+	if b.Banned("key") != 0 {
+		t.Fatal("expected ban to be over")
+	}
+}
+
+func TestMemBucketEviction(t *testing.T) {
+	b := newMemBucket(1, 3, 10, 1)
+	for i := 0; i < 5; i++ {
+		b.Consume(strconv.Itoa(i), 1)
+	}
+	if b.Len() != 3 {
+		t.Fatalf("expected 3 keys, got %d", b.Len())
+	}
+	if b.Strike("4"); b.Strike("0") != 1 {
+		t.Fatal("expected key 0 to be evicted")
+	}
+}
+
+func TestMemBucketKeys(t *testing.T) {
+	tests := []struct {
+		Bucket *MemBucket
+		Keys   int
+	}{
+		// no limit of keys.
+		{NewMemBucket(0, 2, 1).(*MemBucket), 100},
+		{&MemBucket{Size: 2, Rate: 1}, 100},
+		// fewer keys than shards.
+		{NewMemBucket(5, 2, 1).(*MemBucket), 5},
+	}
+	for i, tt := range tests {
+		for k := 0; k < 100; k++ {
+			tt.Bucket.Consume(strconv.Itoa(k), 1)
+		}
+		if n := tt.Bucket.Len(); n != tt.Keys {
+			t.Errorf("%d: expected %d keys, got %d", i, tt.Keys, n)
+		}
+		// limits apply to the keys kept.
+		tt.Bucket.Consume("key", 1)
+		if tokens, _, ok := tt.Bucket.Consume("key", 1); !ok || tokens != 0 {
+			t.Errorf("%d: expected last token, got %d %v", i, tokens, ok)
+		}
+		if _, _, ok := tt.Bucket.Consume("key", 1); ok {
+			t.Errorf("%d: expected empty bucket", i)
+		}
+	}
+}
+
+func benchmarkMemBucket(b *testing.B, shards int) {
+	bucket := newMemBucket(shards, 10000, 1e6, 1e6)
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "quota:" + strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			bucket.Consume(keys[i%len(keys)], 1)
+			i++
+		}
+	})
+}
+
+func BenchmarkMemBucketSingleLock(b *testing.B) { benchmarkMemBucket(b, 1) }
+
+func BenchmarkMemBucketSharded(b *testing.B) { benchmarkMemBucket(b, memBucketShards) }
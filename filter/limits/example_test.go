@@ -35,9 +35,11 @@ func Example_basic() {
 	})
 
 	// Usage limit check, 10 tokens
-	svc.Use(&limits.Usage{
-		Container: limits.NewRedisBucket("tcp://127.0.0.1", 10, 1),
-	})
+	bucket, err := limits.NewRedisBucket("tcp://127.0.0.1", 10, 1)
+	if err != nil {
+		panic(err)
+	}
+	svc.Use(&limits.Usage{Container: bucket})
 
 	svc.Resource(&c)
 	svc.Run()
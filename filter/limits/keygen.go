@@ -0,0 +1,185 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package limits
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/srfrog/go-relax"
+)
+
+// Keygen is a function that generates semi-unique keys for clients.
+// See also, Usage.Keygen
+type Keygen func(relax.Context) string
+
+// ErrKeygenSpec is returned by ParseKeygen when the key generator spec is not valid.
+var ErrKeygenSpec = errors.New("limits: Invalid keygen spec")
+
+// hashKey returns a quota key made from an MD5 hash of 'values'. Each value
+// is prefixed with its length, so different values don't make the same key,
+// such as ("ab", "c") and ("a", "bc").
+func hashKey(values ...string) string {
+	h := md5.New()
+	for i := range values {
+		h.Write([]byte(strconv.Itoa(len(values[i])) + ":" + values[i]))
+	}
+	return "quota:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// HeaderKey returns a Keygen that makes keys from the value of the request
+// header 'name', such as an API key header. Requests without the header use
+// MD5RequestKey.
+//
+//	&limits.Usage{Keygen: limits.HeaderKey("X-Api-Key")}
+func HeaderKey(name string) Keygen {
+	return func(c relax.Context) string {
+		value := c.Request.Header.Get(name)
+		if value == "" {
+			return MD5RequestKey(c)
+		}
+		return hashKey(name, value)
+	}
+}
+
+// UserKey makes keys from the name of the authenticated user, as set by
+// auth filters in "auth.user". Requests without a user use MD5RequestKey.
+func UserKey(c relax.Context) string {
+	user, _ := c.Get("auth.user").(string)
+	if user == "" {
+		return MD5RequestKey(c)
+	}
+	return hashKey("user", user)
+}
+
+// JWTSubjectKey makes keys from the "sub" claim of a JSON Web Token sent in
+// the Authorization header as a bearer token. Requests without a token, or
+// with a malformed token, use MD5RequestKey.
+//
+// Note that the token signature is NOT verified. This key should be used after
+// a filter that authenticates the token, otherwise clients can pick their key.
+func JWTSubjectKey(c relax.Context) string {
+	auth := c.Request.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return MD5RequestKey(c)
+	}
+	parts := strings.Split(auth[7:], ".")
+	if len(parts) != 3 {
+		return MD5RequestKey(c)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return MD5RequestKey(c)
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return MD5RequestKey(c)
+	}
+	return hashKey("sub", claims.Subject)
+}
+
+// NetworkKey returns a Keygen that makes keys from the client network, so
+// all clients in the same network share a key. 'ipv4Bits' and 'ipv6Bits' are
+// the prefix lengths (CIDR) of IPv4 and IPv6 networks.
+//
+//	// aggregate clients in /24 IPv4 and /64 IPv6 networks.
+//	&limits.Usage{Keygen: limits.NetworkKey(24, 64)}
+func NetworkKey(ipv4Bits, ipv6Bits int) Keygen {
+	mask4 := net.CIDRMask(ipv4Bits, 32)
+	mask6 := net.CIDRMask(ipv6Bits, 128)
+	return func(c relax.Context) string {
+		host, _ := SplitPort(c.Request.RemoteAddr)
+		ip := net.ParseIP(strings.Trim(host, "[]"))
+		if ip == nil {
+			return MD5RequestKey(c)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return hashKey("net", ip4.Mask(mask4).String())
+		}
+		return hashKey("net", ip.Mask(mask6).String())
+	}
+}
+
+// CompositeKey returns a Keygen that combines the keys of all 'keygens'.
+//
+//	// one key per API key and client network.
+//	limits.CompositeKey(limits.HeaderKey("X-Api-Key"), limits.NetworkKey(24, 64))
+func CompositeKey(keygens ...Keygen) Keygen {
+	return func(c relax.Context) string {
+		keys := make([]string, len(keygens))
+		for i := range keygens {
+			keys[i] = keygens[i](c)
+		}
+		return hashKey(keys...)
+	}
+}
+
+/*
+ParseKeygen returns the Keygen function that matches 'spec', so key generators
+can be selected through configuration. The spec is a list of one or more key
+names joined with "+", which makes a composite key. The key names are:
+
+	addr           // MD5RequestKey, client address and user agent.
+	user           // UserKey, authenticated user name.
+	jwt            // JWTSubjectKey, JWT "sub" claim.
+	header:{name}  // HeaderKey, value of header {name}.
+	net:{v4},{v6}  // NetworkKey, client network with prefix lengths {v4} and {v6}.
+
+For example:
+
+	keygen, err := limits.ParseKeygen("header:X-Api-Key+net:24,64")
+
+Returns the Keygen, or ErrKeygenSpec if the spec is not valid.
+*/
+func ParseKeygen(spec string) (Keygen, error) {
+	var keygens []Keygen
+	for _, name := range strings.Split(spec, "+") {
+		arg := ""
+		if idx := strings.Index(name, ":"); idx != -1 {
+			name, arg = name[:idx], name[idx+1:]
+		}
+		switch name {
+		case "addr":
+			keygens = append(keygens, MD5RequestKey)
+		case "user":
+			keygens = append(keygens, UserKey)
+		case "jwt":
+			keygens = append(keygens, JWTSubjectKey)
+		case "header":
+			if arg == "" {
+				return nil, ErrKeygenSpec
+			}
+			keygens = append(keygens, HeaderKey(arg))
+		case "net":
+			bits := strings.Split(arg, ",")
+			if len(bits) != 2 {
+				return nil, ErrKeygenSpec
+			}
+			v4, err := strconv.Atoi(bits[0])
+			if err != nil || v4 < 0 || v4 > 32 {
+				return nil, ErrKeygenSpec
+			}
+			v6, err := strconv.Atoi(bits[1])
+			if err != nil || v6 < 0 || v6 > 128 {
+				return nil, ErrKeygenSpec
+			}
+			keygens = append(keygens, NetworkKey(v4, v6))
+		default:
+			return nil, ErrKeygenSpec
+		}
+	}
+	if len(keygens) == 1 {
+		return keygens[0], nil
+	}
+	return CompositeKey(keygens...), nil
+}
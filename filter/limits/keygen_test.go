@@ -0,0 +1,16 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package limits
+
+import "testing"
+
+func TestHashKey(t *testing.T) {
+	if hashKey("ab", "c") == hashKey("a", "bc") {
+		t.Error("expected different keys for different values")
+	}
+	if hashKey("user", "alice") != hashKey("user", "alice") {
+		t.Error("expected the same key for the same values")
+	}
+}
@@ -50,7 +50,7 @@ func (f *Memory) Run(next relax.HandlerFunc) relax.HandlerFunc {
 			if f.RetryAfter != 0 {
 				ctx.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
 			}
-			http.Error(ctx, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			ctx.Error(http.StatusServiceUnavailable, relax.StatusText(http.StatusServiceUnavailable))
 			return
 		}
 
@@ -5,7 +5,7 @@
 package limits
 
 import (
-	"net/http"
+	"math"
 	"time"
 
 	"github.com/srfrog/go-relax"
@@ -27,6 +27,11 @@ type Throttle struct {
 	// value of Requests to get the time period to throttle.
 	// Defaults to 1 second (time.Second)
 	Per time.Duration
+
+	// Policy is an identifier for this throttle, sent with the details of
+	// a 429 response.
+	// Defaults to "throttle"
+	Policy string
 }
 
 // Run processes the filter. No info is passed.
@@ -37,6 +42,9 @@ func (f *Throttle) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	if f.Per == 0 {
 		f.Per = time.Second
 	}
+	if f.Policy == "" {
+		f.Policy = "throttle"
+	}
 
 	limiter := f.process()
 	return func(ctx *relax.Context) {
@@ -44,7 +52,12 @@ func (f *Throttle) Run(next relax.HandlerFunc) relax.HandlerFunc {
 		case <-limiter:
 			next(ctx)
 		default:
-			http.Error(ctx, http.StatusText(relax.StatusTooManyRequests), relax.StatusTooManyRequests)
+			TooManyRequests(ctx, &LimitDetails{
+				Limit:     f.Requests,
+				Remaining: 0,
+				Reset:     int(math.Ceil((f.Per / time.Duration(f.Requests)).Seconds())),
+				Policy:    f.Policy,
+			})
 			return
 		}
 	}
@@ -5,8 +5,11 @@
 package limits
 
 import (
+	"math"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/srfrog/go-relax"
 )
@@ -38,13 +41,232 @@ type Usage struct {
 	Container
 
 	// Ration is the number of tokens to consume per request.
+	// Routes with a different token cost can use their own Usage filter
+	// sharing the same Container, but with a different Ration. Note that
+	// the costs of nested Usage filters add up.
+	//
+	// 		bucket := limits.NewMemBucket(1000, 100, 1)
+	// 		res.GET("", List, &limits.Usage{Container: bucket})
+	// 		res.GET("report", Report, &limits.Usage{Container: bucket, Ration: 10})
+	//
 	// Defaults to 1.
 	Ration int
 
+	// Cost is an optional function that returns the number of tokens a request
+	// will consume. It's used instead of Ration when the cost depends on the
+	// request. If it returns a negative value, Ration is used.
+	// Defaults to nil (use Ration)
+	Cost func(*relax.Context) int
+
 	// Keygen is a function used to generate semi-unique ID's for each client.
 	// The default function, MD5RequestKey, uses an MD5 hash on client address
 	// and user agent, or the username of an authenticated client.
+	// Other built-in functions are HeaderKey, UserKey, JWTSubjectKey, NetworkKey
+	// and CompositeKey; or use ParseKeygen to select one from configuration.
 	Keygen func(relax.Context) string
+
+	// Policy is an identifier for this usage limit, sent with the details of
+	// a 429 response.
+	// Defaults to "usage"
+	Policy string
+
+	// BanAfter is the number of consecutive requests a client can send before
+	// the Retry-After of its last 429 response expires (or strikes), before
+	// it's placed in a penalty box. Clients that wait as told are not struck. While banned, all requests
+	// are dropped with HTTP status 403-"Forbidden". The Container must implement
+	// the Banner interface.
+	// Defaults to 0 (disabled)
+	BanAfter int
+
+	// BanFor is the duration of a ban.
+	// Defaults to 10 minutes.
+	BanFor time.Duration
+
+	// OnBan is an optional function called when a client is banned, for
+	// auditing purposes. It receives the request context, the client key and
+	// the ban duration.
+	// Defaults to nil
+	OnBan func(*relax.Context, string, time.Duration)
+
+	// Tarpit is the delay of the 429 response to a client that ignored the
+	// Retry-After of its previous 429, and kept sending requests. The delay
+	// doubles with each consecutive strike, up to TarpitMax, so clients that
+	// hammer the service are slowed down while compliant clients are not.
+	// Delayed requests hold their connection, so TarpitMax should be short,
+	// and only TarpitLimit requests per client are delayed.
+	// The Container must implement the Banner interface. Use with BanAfter
+	// to ban the clients that still don't comply.
+	// Defaults to 0 (disabled)
+	Tarpit time.Duration
+
+	// TarpitMax is the maximum delay of a 429 response, see Tarpit.
+	// Defaults to 10 seconds.
+	TarpitMax time.Duration
+
+	// TarpitLimit is the maximum number of delayed requests per client. The
+	// requests over the limit are answered without delay, with the delay
+	// added to their Retry-After instead, so a client can't hold many
+	// connections open.
+	// Defaults to 1.
+	TarpitLimit int
+
+	retries retryLog
+}
+
+// retryLog records when the Retry-After of the last 429 response to each
+// client expires, and how many of its requests are delayed in the tarpit.
+// The zero value is ready to use.
+type retryLog struct {
+	sync.Mutex
+	m     map[string]*retryState
+	sweep int              // len of m when expired entries are removed.
+	clock func() time.Time // defaults to time.Now, for tests.
+}
+
+type retryState struct {
+	until   time.Time
+	waiting int
+}
+
+func (l *retryLog) now() time.Time {
+	if l.clock != nil {
+		return l.clock()
+	}
+	return time.Now()
+}
+
+// early returns true if the client 'key' sent the request before the
+// Retry-After of its last 429 response expired.
+func (l *retryLog) early(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+	rs, ok := l.m[key]
+	return ok && l.now().Before(rs.until)
+}
+
+// retryAfter records that the client 'key' was told to retry after 'd'.
+func (l *retryLog) retryAfter(key string, d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	if l.m == nil {
+		l.m = make(map[string]*retryState)
+	}
+	if len(l.m) >= l.sweep {
+		for k, rs := range l.m {
+			if rs.waiting == 0 && !now.Before(rs.until) {
+				delete(l.m, k)
+			}
+		}
+		if l.sweep = 2 * len(l.m); l.sweep < 1024 {
+			l.sweep = 1024
+		}
+	}
+	rs, ok := l.m[key]
+	if !ok {
+		rs = &retryState{}
+		l.m[key] = rs
+	}
+	rs.until = now.Add(d)
+}
+
+// hold adds a request of the client 'key' to the tarpit. Returns false if the
+// client has 'limit' requests there already.
+func (l *retryLog) hold(key string, limit int) bool {
+	l.Lock()
+	defer l.Unlock()
+	rs, ok := l.m[key]
+	if !ok {
+		if l.m == nil {
+			l.m = make(map[string]*retryState)
+		}
+		rs = &retryState{}
+		l.m[key] = rs
+	}
+	if rs.waiting >= limit {
+		return false
+	}
+	rs.waiting++
+	return true
+}
+
+// release removes a request of the client 'key' from the tarpit.
+func (l *retryLog) release(key string) {
+	l.Lock()
+	if rs, ok := l.m[key]; ok {
+		rs.waiting--
+	}
+	l.Unlock()
+}
+
+// logUser is implemented by containers that log their errors, such as
+// RedisBucket, to get the service Log.
+type logUser interface {
+	useLog(*relax.Log)
+}
+
+// strike records a strike for the client 'key', if strikes are used. Returns
+// the number of consecutive strikes, and true if the client was banned.
+func (f *Usage) strike(ctx *relax.Context, key string) (int, bool) {
+	banner, ok := f.Container.(Banner)
+	if !ok || (f.BanAfter == 0 && f.Tarpit == 0) {
+		return 0, false
+	}
+	strikes := banner.Strike(key)
+	if f.BanAfter == 0 || strikes < f.BanAfter {
+		return strikes, false
+	}
+	banner.Ban(key, f.BanFor)
+	if f.OnBan != nil {
+		f.OnBan(ctx, key, f.BanFor)
+	}
+	return strikes, true
+}
+
+// tarpit returns the delay of a 429 response after 'strikes' consecutive
+// strikes.
+func (f *Usage) tarpit(strikes int) time.Duration {
+	if f.Tarpit == 0 || strikes < 1 {
+		return 0
+	}
+	d := f.Tarpit
+	for i := 1; i < strikes && d < f.TarpitMax; i++ {
+		d *= 2
+	}
+	if d > f.TarpitMax {
+		d = f.TarpitMax
+	}
+	return d
+}
+
+// pardon clears the strikes of the client 'key', if it has any.
+func (f *Usage) pardon(key string) {
+	banner, ok := f.Container.(Banner)
+	if !ok {
+		return
+	}
+	if sc, ok := banner.(StrikeCounter); ok && sc.Strikes(key) == 0 {
+		return
+	}
+	banner.Pardon(key)
+}
+
+// keygen returns the client key of the request in 'ctx', with Keygen or
+// MD5RequestKey if it's not set.
+func (f *Usage) keygen(ctx *relax.Context) string {
+	if f.Keygen == nil {
+		return MD5RequestKey(*ctx)
+	}
+	return f.Keygen(*ctx)
+}
+
+// Strike records an abuse signal for the client in 'ctx'. After BanAfter
+// consecutive strikes the client is banned. Handlers and filters may use this
+// to penalize clients for reasons other than usage (e.g., failed logins).
+// Returns true if the client was banned, false otherwise.
+func (f *Usage) Strike(ctx *relax.Context) bool {
+	_, banned := f.strike(ctx, f.keygen(ctx))
+	return banned
 }
 
 // Run processes the filter. No info is passed.
@@ -58,15 +280,97 @@ func (f *Usage) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	if f.Ration == 0 {
 		f.Ration = 1
 	}
+	if f.Policy == "" {
+		f.Policy = "usage"
+	}
+	if f.BanFor == 0 {
+		f.BanFor = 10 * time.Minute
+	}
+	if f.TarpitMax == 0 {
+		f.TarpitMax = 10 * time.Second
+	}
+	if f.TarpitLimit == 0 {
+		f.TarpitLimit = 1
+	}
+	banner, _ := f.Container.(Banner)
+	if banner == nil {
+		f.BanAfter, f.Tarpit = 0, 0
+	}
+	lu, _ := f.Container.(logUser)
 	return func(ctx *relax.Context) {
+		if lu != nil {
+			lu.useLog(ctx.Log())
+		}
 		// Usage limits
-		key := f.Keygen(*ctx)
-		tokens, when, ok := f.Consume(key, f.Ration)
+		key := f.keygen(ctx)
+		if f.BanAfter != 0 {
+			if d := banner.Banned(key); d > 0 {
+				wait := int(math.Ceil(d.Seconds()))
+				ctx.Header().Set("Retry-After", strconv.Itoa(wait))
+				ctx.Error(http.StatusForbidden, relax.StatusText(http.StatusForbidden), &LimitDetails{
+					Limit:  f.Capacity(),
+					Reset:  wait,
+					Policy: f.Policy,
+				})
+				return
+			}
+		}
+		cost := f.Ration
+		if f.Cost != nil {
+			if n := f.Cost(ctx); n >= 0 {
+				cost = n
+			}
+		}
+		ctx.Header().Set("RateLimit-Cost", strconv.Itoa(cost))
+		tokens, when, ok := f.Consume(key, cost)
 		if !ok {
+			var strikes int
+			if f.BanAfter != 0 || f.Tarpit != 0 {
+				// only the clients that didn't wait as told are struck.
+				if f.retries.early(key) {
+					var banned bool
+					strikes, banned = f.strike(ctx, key)
+					if banned {
+						ctx.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(f.BanFor.Seconds()))))
+						ctx.Error(http.StatusForbidden, relax.StatusText(http.StatusForbidden))
+						return
+					}
+				}
+			}
+			if d := f.tarpit(strikes); d > 0 {
+				if f.retries.hold(key, f.TarpitLimit) {
+					t := time.NewTimer(d)
+					select {
+					case <-t.C:
+						f.retries.release(key)
+					case <-ctx.Done():
+						// the client gave up waiting.
+						t.Stop()
+						f.retries.release(key)
+						return
+					}
+				} else {
+					// the client has enough connections held, make it wait
+					// longer instead.
+					when += int(math.Ceil(d.Seconds()))
+				}
+			}
+			if f.BanAfter != 0 || f.Tarpit != 0 {
+				f.retries.retryAfter(key, time.Duration(when)*time.Second)
+			}
 			ctx.Header().Set("Retry-After", strconv.Itoa(when))
-			http.Error(ctx, http.StatusText(relax.StatusTooManyRequests), relax.StatusTooManyRequests)
+			TooManyRequests(ctx, &LimitDetails{
+				Limit:     f.Capacity(),
+				Remaining: tokens,
+				Reset:     when,
+				Cost:      cost,
+				Policy:    f.Policy,
+			})
 			return
 		}
+		if f.BanAfter != 0 || f.Tarpit != 0 {
+			f.pardon(key)
+		}
 		ctx.Header().Set("RateLimit-Limit", strconv.Itoa(f.Capacity()))
 		ctx.Header().Set("RateLimit-Remaining", strconv.Itoa(tokens))
 		ctx.Header().Set("RateLimit-Reset", strconv.Itoa(when))
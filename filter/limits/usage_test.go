@@ -0,0 +1,144 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package limits
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestUsageTarpit(t *testing.T) {
+	f := &Usage{
+		Container: NewMemBucket(10, 1, 1),
+		Keygen:    func(relax.Context) string { return "client" },
+		Tarpit:    100 * time.Millisecond,
+		TarpitMax: 250 * time.Millisecond,
+	}
+	svc := relax.NewService("/")
+	svc.Root().GET("", func(ctx *relax.Context) {}, f)
+
+	tests := []struct {
+		Code  int
+		Delay time.Duration
+	}{
+		{200, 0},
+		{429, 0},
+		{429, 100 * time.Millisecond},
+		{429, 200 * time.Millisecond},
+		{429, 250 * time.Millisecond},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		start := time.Now()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		elapsed := time.Since(start)
+		if w.Code != tt.Code || elapsed < tt.Delay || elapsed > tt.Delay+80*time.Millisecond {
+			t.Errorf("%d: expected %d after %s, got %d after %s", i, tt.Code, tt.Delay, w.Code, elapsed)
+		}
+	}
+}
+
+func TestUsageTarpitCompliant(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+	bucket := newMemBucket(1, 10, 1, 1)
+	bucket.Clock = clock
+	f := &Usage{
+		Container: bucket,
+		Keygen:    func(relax.Context) string { return "client" },
+		Tarpit:    100 * time.Millisecond,
+		TarpitMax: 250 * time.Millisecond,
+		BanAfter:  2,
+	}
+	f.retries.clock = clock
+	svc := relax.NewService("/")
+	svc.Root().GET("", func(ctx *relax.Context) {}, f)
+
+	tests := []struct {
+		Wait  time.Duration // clock advance before the request
+		Code  int
+		Delay time.Duration
+	}{
+		{0, 200, 0},
+		{0, 429, 0},
+		{61 * time.Second, 429, 0}, // waited as told, not struck
+		{61 * time.Second, 429, 0},
+		{0, 429, 100 * time.Millisecond}, // early, first strike
+		{0, 403, 0},                      // early, second strike: banned
+	}
+	for i, tt := range tests {
+		now = now.Add(tt.Wait)
+		if tt.Wait > 0 {
+			// another request took the new token.
+			bucket.Consume("client", 1)
+		}
+		w := httptest.NewRecorder()
+		start := time.Now()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		elapsed := time.Since(start)
+		if w.Code != tt.Code || elapsed < tt.Delay || elapsed > tt.Delay+80*time.Millisecond {
+			t.Errorf("%d: expected %d after %s, got %d after %s", i, tt.Code, tt.Delay, w.Code, elapsed)
+		}
+	}
+}
+
+func TestUsageTarpitLimit(t *testing.T) {
+	f := &Usage{
+		Container: NewMemBucket(10, 1, 1),
+		Keygen:    func(relax.Context) string { return "client" },
+		Tarpit:    2 * time.Second,
+		TarpitMax: 2 * time.Second,
+	}
+	svc := relax.NewService("/")
+	svc.Root().GET("", func(ctx *relax.Context) {}, f)
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	}
+	wait, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+
+	// the first early request is held in the tarpit.
+	held := make(chan struct{})
+	go func() {
+		svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(held)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// the second is answered now, with a longer Retry-After.
+	w = httptest.NewRecorder()
+	start := time.Now()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected no delay over the tarpit limit, got %s", elapsed)
+	}
+	if w.Code != 429 {
+		t.Errorf("expected 429, got %d", w.Code)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != strconv.Itoa(wait+2) {
+		t.Errorf("expected Retry-After with the tarpit delay, got %q", ra)
+	}
+	<-held
+}
+
+func TestUsageStrike(t *testing.T) {
+	bucket := NewMemBucket(10, 10, 1).(*MemBucket)
+	f := &Usage{Container: bucket, BanAfter: 2}
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := &relax.Context{Request: req}
+
+	// Strike works before Run, with the default Keygen.
+	if f.Strike(ctx) || bucket.Strikes(MD5RequestKey(*ctx)) != 1 {
+		t.Errorf("expected 1 strike, got %d", bucket.Strikes(MD5RequestKey(*ctx)))
+	}
+	if !f.Strike(ctx) {
+		t.Error("expected client banned after 2 strikes")
+	}
+}
@@ -7,10 +7,36 @@ package limits
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"net/http"
 
 	"github.com/srfrog/go-relax"
 )
 
+// LimitDetails are the details sent with a 429-"Too Many Requests" response,
+// so clients can handle throttling programmatically.
+type LimitDetails struct {
+	// Limit is the total number of requests (or tokens) allowed.
+	Limit int `json:"limit"`
+
+	// Remaining is the number of requests (or tokens) left.
+	Remaining int `json:"remaining"`
+
+	// Reset is the time, in seconds, until the limit is renewed.
+	Reset int `json:"reset"`
+
+	// Cost is the number of tokens the request needed, if token-based.
+	Cost int `json:"cost,omitempty"`
+
+	// Policy is the identifier of the limit policy that was enforced.
+	Policy string `json:"policy"`
+}
+
+// TooManyRequests sends a 429-"Too Many Requests" error response, encoded
+// with the negotiated encoder, that includes the limit details.
+func TooManyRequests(ctx *relax.Context, details *LimitDetails) {
+	ctx.Error(http.StatusTooManyRequests, relax.StatusText(http.StatusTooManyRequests), details)
+}
+
 // Min returns the smaller integer between a and b.
 // If a is lesser than b it returns a, otherwise returns b.
 func Min(a, b int) int {
@@ -0,0 +1,96 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/srfrog/go-relax"
+)
+
+// Level is the verbosity of request logs. It's the same as the service log level.
+type Level = relax.Level
+
+// Log levels, from most to least verbose.
+const (
+	LevelDebug = relax.LevelDebug
+	LevelInfo  = relax.LevelInfo
+	LevelWarn  = relax.LevelWarn
+	LevelError = relax.LevelError
+)
+
+// ErrLevel is returned by ParseLevel when the level name is not known.
+var ErrLevel = relax.ErrLogLevel
+
+// ParseLevel returns the Level named 'name', one of "debug", "info", "warn" or "error".
+func ParseLevel(name string) (Level, error) {
+	return relax.ParseLevel(name)
+}
+
+// GetLevel returns the current log level.
+func (f *Filter) GetLevel() Level {
+	return Level(atomic.LoadInt32(&f.level))
+}
+
+// SetLevel changes the log level, it's safe to use while serving requests.
+func (f *Filter) SetLevel(level Level) {
+	atomic.StoreInt32(&f.level, int32(level))
+}
+
+// GetSampleRate returns the current sampling of successful responses.
+func (f *Filter) GetSampleRate() int {
+	return int(atomic.LoadInt32(&f.sample))
+}
+
+// SetSampleRate changes the sampling of successful responses to 1 of every 'n',
+// it's safe to use while serving requests.
+func (f *Filter) SetSampleRate(n int) {
+	if n < 1 {
+		n = 1
+	}
+	atomic.StoreInt32(&f.sample, int32(n))
+}
+
+// LogSettings are the runtime settings shown and changed by Control.
+type LogSettings struct {
+	Level      string `json:"level"`
+	SampleRate int    `json:"sample_rate"`
+}
+
+/*
+Control is a handler to show and change the log level and sampling at runtime.
+GET requests show the current settings, PUT and PATCH requests change them.
+The route must be protected with admin-only filters.
+
+	accesslog := &logs.Filter{SampleRate: 100}
+	svc.Use(accesslog)
+	admin := svc.Resource(&Admin{}, &authbasic.Filter{Provider: admins})
+	admin.GET("logging", accesslog.Control)
+	admin.PUT("logging", accesslog.Control)
+
+	// PUT /admin/logging {"level": "debug"}
+*/
+func (f *Filter) Control(ctx *relax.Context) {
+	if ctx.Request.Method == "PUT" || ctx.Request.Method == "PATCH" {
+		var settings LogSettings
+		if err := ctx.Decode(ctx.Request.Body, &settings); err != nil {
+			ctx.Error(http.StatusBadRequest, err.Error())
+			return
+		}
+		if settings.Level != "" {
+			level, err := ParseLevel(settings.Level)
+			if err != nil {
+				ctx.Error(http.StatusBadRequest, err.Error())
+				return
+			}
+			f.SetLevel(level)
+		}
+		if settings.SampleRate != 0 {
+			f.SetSampleRate(settings.SampleRate)
+		}
+	}
+	ctx.Respond(&LogSettings{Level: f.GetLevel().String(), SampleRate: f.GetSampleRate()})
+}
@@ -5,8 +5,12 @@
 package logs
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/srfrog/go-relax"
 )
@@ -25,6 +29,12 @@ const (
 
 	// LogFormatReferer is similar to Apache HTTP's Referer log format
 	LogFormatReferer = "%R -> %[1]U"
+
+	// LogFormatJSON is a JSON object with the fields in relax.LogEntry, for
+	// log pipelines. Use it with a Logger without prefix or flags, so each
+	// line is a valid JSON object. The default Logger has no flags with
+	// this format. Buffered debug entries are in the "debug" field.
+	LogFormatJSON = "%j"
 )
 
 /*
@@ -32,17 +42,17 @@ Filter Log provides pre- and post-request event logs. It uses a custom
 log format similar to the one used for Apache HTTP CustomLog directive.
 
 	myservice.Use(logrus.New())
-	log := &log.Filter{Logger: myservice.Logger(), PreLogFormat: LogFormatReferer}
-	log.Println("Filter implements Logger.")
+	access := &logs.Filter{Logger: myservice.Logger(), PreLogFormat: logs.LogFormatReferer}
+	myservice.Use(access)
 
-	// Context-specific format verbs (see Context.Format)
-	log.Panicf("Status is %s = bad status!", ctx)
+	// Filter implements Logger, with context-specific format verbs (see Context.Format)
+	access.Printf("Status is %s = bad status!", ctx)
 
 */
 type Filter struct {
 	// Logger is an interface that is based on Go's log package. Any logging
-	// system that implements Logger can be used.
-	// Defaults to the stdlog in 'log' package.
+	// system that implements Logger can be used, such as the service Logger.
+	// Defaults to a log.Logger that writes to stderr.
 	relax.Logger
 
 	// PreLogFormat is the format for the pre-request log entry.
@@ -53,24 +63,126 @@ type Filter struct {
 	// PostLogFormat is the format for the post-request log entry.
 	// Defaults to the value of LogFormatRelax
 	PostLogFormat string
+
+	// Level is the initial log level. At LevelDebug all requests are logged;
+	// at LevelInfo post-log entries are sampled with SampleRate; at LevelWarn
+	// and LevelError only error responses are logged, without pre-log entries.
+	// The level can be changed at runtime with SetLevel or Control.
+	// Defaults to LevelInfo
+	Level Level
+
+	// SampleRate is the initial sampling of successful responses, one of every
+	// SampleRate responses with status below 400 is logged. Error responses
+	// are always logged.
+	// The rate can be changed at runtime with SetSampleRate or Control.
+	// Defaults to 1 (log all)
+	SampleRate int
+
+	// BufferDebug if true, debug entries written with ctx.Debugf during a
+	// request are buffered, and logged after the post-log entry only if the
+	// response status is 5xx, the request took longer than LatencyBudget, or
+	// the level is LevelDebug. This gives detailed traces of failed requests
+	// without logging the details of successful ones.
+	// Defaults to false.
+	BufferDebug bool
+
+	// LatencyBudget is the request duration after which buffered debug entries
+	// are logged, when BufferDebug is true.
+	// Defaults to 0 (no latency budget)
+	LatencyBudget time.Duration
+
+	seed   sync.Once
+	level  int32
+	sample int32
+	count  uint32
 }
 
-// Run processes the filter. No info is passed.
+// Run processes the filter and passes down the following Info, if BufferDebug is true:
+//
+//	ctx.Get("log.buffer") // the request log buffer, *relax.LogBuffer
 func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 	if f.Logger == nil {
-		f.Logger = log.New(os.Stderr, "", log.LstdFlags)
+		flags := log.LstdFlags
+		if f.PostLogFormat == LogFormatJSON {
+			flags = 0
+		}
+		f.Logger = log.New(os.Stderr, "", flags)
 	}
 	if f.PostLogFormat == "" {
 		f.PostLogFormat = LogFormatRelax
 	}
+	if f.Level == 0 {
+		f.Level = LevelInfo
+	}
+	if f.SampleRate < 1 {
+		f.SampleRate = 1
+	}
+	// the service chain may be built again, keep the runtime settings.
+	f.seed.Do(func() {
+		f.SetLevel(f.Level)
+		f.SetSampleRate(f.SampleRate)
+	})
 
 	return func(ctx *relax.Context) {
-		if f.PreLogFormat != "" {
+		level := f.GetLevel()
+		if f.PreLogFormat != "" && level < LevelWarn {
 			f.Printf(f.PreLogFormat, ctx)
 		}
 
+		var buffer *relax.LogBuffer
+		if f.BufferDebug {
+			buffer = &relax.LogBuffer{}
+			ctx.Set("log.buffer", buffer)
+		}
+
 		next(ctx)
 
-		f.Printf(f.PostLogFormat, ctx)
+		flush := buffer != nil && f.flushBuffer(ctx, level)
+		if flush && f.PostLogFormat == LogFormatJSON {
+			// debug entries are fields of the entry, so lines stay JSON.
+			entry := ctx.LogEntry()
+			entry.Debug, entry.DebugDropped = buffer.Entries()
+			if b, err := json.Marshal(entry); err == nil {
+				f.Printf("%s", b)
+				return
+			}
+		}
+		if flush || f.sampled(level, ctx.Status()) {
+			f.Printf(f.PostLogFormat, ctx)
+		}
+		if flush {
+			entries, dropped := buffer.Entries()
+			for i := range entries {
+				f.Printf("  [DEBUG] %s", entries[i])
+			}
+			if dropped > 0 {
+				f.Printf("  [DEBUG] (%d more entries dropped)", dropped)
+			}
+		}
+	}
+}
+
+// flushBuffer returns true if the buffered debug entries of the request in
+// 'ctx' should be logged.
+func (f *Filter) flushBuffer(ctx *relax.Context, level Level) bool {
+	if level == LevelDebug || ctx.Status() >= 500 {
+		return true
+	}
+	if f.LatencyBudget == 0 {
+		return false
+	}
+	start, ok := ctx.Get("request.start_time").(time.Time)
+	return ok && time.Since(start) > f.LatencyBudget
+}
+
+// sampled returns true if a response with 'status' should be logged at 'level'.
+func (f *Filter) sampled(level Level, status int) bool {
+	switch {
+	case status >= 400 || level == LevelDebug:
+		return true
+	case level >= LevelWarn:
+		return false
 	}
+	n := atomic.LoadInt32(&f.sample)
+	return n <= 1 || atomic.AddUint32(&f.count, 1)%uint32(n) == 0
 }
@@ -0,0 +1,77 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestBufferDebugJSON(t *testing.T) {
+	var buf bytes.Buffer
+	svc := relax.NewService("/")
+	svc.Root().GET("fail", func(ctx *relax.Context) {
+		ctx.Debugf("step %d", 1)
+		ctx.Debugf("step %d", 2)
+		ctx.WriteHeader(500)
+	}, &Filter{Logger: log.New(&buf, "", 0), PostLogFormat: LogFormatJSON, BufferDebug: true})
+
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one log line, got %q", lines)
+	}
+	var entry relax.LogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("expected JSON log line, got %q: %s", lines[0], err)
+	}
+	if entry.Status != 500 || len(entry.Debug) != 2 || entry.Debug[1] != "step 2" {
+		t.Errorf("expected 500 entry with debug entries, got %+v", entry)
+	}
+}
+
+func TestControl(t *testing.T) {
+	var buf bytes.Buffer
+	access := &Filter{Logger: log.New(&buf, "", 0), PostLogFormat: "%s", SampleRate: 10}
+	svc := relax.NewService("/")
+	svc.Use(access)
+	svc.Root().
+		GET("logging", access.Control).
+		PUT("logging", access.Control)
+
+	serve := func(method, body string) LogSettings {
+		req := httptest.NewRequest(method, "/logging", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		var settings LogSettings
+		if err := json.NewDecoder(w.Body).Decode(&settings); err != nil {
+			t.Fatalf("%s: expected settings, got %d %s", method, w.Code, err)
+		}
+		return settings
+	}
+
+	if s := serve("GET", ""); s.Level != "info" || s.SampleRate != 10 {
+		t.Errorf("expected initial settings, got %+v", s)
+	}
+	if s := serve("PUT", `{"level":"error","sample_rate":5}`); s.Level != "error" || s.SampleRate != 5 {
+		t.Errorf("expected changed settings, got %+v", s)
+	}
+	// the settings are kept for the next requests.
+	buf.Reset()
+	if s := serve("GET", ""); s.Level != "error" || s.SampleRate != 5 {
+		t.Errorf("expected settings kept, got %+v", s)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no log at level error, got %q", buf.String())
+	}
+}
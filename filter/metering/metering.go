@@ -0,0 +1,195 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metering
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Filter Metering counts requests and bytes transferred per tenant, for usage-based
+billing. Usage is accumulated in memory and flushed to a MeterStore every
+FlushInterval.
+
+	meter := &metering.Filter{Store: store}
+	svc.Use(&apikeys.Filter{Store: keys}, meter)
+
+	// later, in a billing handler:
+	usage, err := meter.Usage(tenant)
+
+Request bytes are counted as the request body is read, response bytes are the
+bytes written. Headers are not counted.
+*/
+type Filter struct {
+	// Store is where usage totals are saved.
+	// Defaults to a MemStore.
+	Store MeterStore
+
+	// Keygen returns the tenant key of a request.
+	// Defaults to a function that returns the authenticated user, as set by
+	// auth filters in "auth.user", or "anonymous".
+	Keygen func(*relax.Context) string
+
+	// FlushInterval is the time between flushes to Store.
+	// Defaults to 1 minute.
+	FlushInterval time.Duration
+
+	// OnError is called when a flush to Store fails. The usage that failed is
+	// kept and sent in the next flush.
+	// Defaults to nil, the error is logged in the service Log.
+	OnError func(error)
+
+	mu      sync.Mutex
+	started bool
+	pending map[string]Usage
+	stop    chan struct{}
+	log     atomic.Value // *relax.Log of the service, for flush errors.
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("metering.key") // tenant key of the request
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	// the filter may run in many routes, and the service chain may be built
+	// again; set up the filter and start the only flusher once.
+	f.mu.Lock()
+	if !f.started {
+		f.started = true
+		if f.Store == nil {
+			f.Store = NewMemStore()
+		}
+		if f.Keygen == nil {
+			f.Keygen = func(ctx *relax.Context) string {
+				if user, ok := ctx.Get("auth.user").(string); ok && user != "" {
+					return user
+				}
+				return "anonymous"
+			}
+		}
+		if f.FlushInterval == 0 {
+			f.FlushInterval = time.Minute
+		}
+		if f.pending == nil {
+			f.pending = make(map[string]Usage)
+		}
+		f.stop = make(chan struct{})
+		go f.flusher(f.stop, f.FlushInterval)
+	}
+	f.mu.Unlock()
+
+	return func(ctx *relax.Context) {
+		var body *countingReader
+		if ctx.Request.Body != nil {
+			body = &countingReader{ReadCloser: ctx.Request.Body}
+			ctx.Request.Body = body
+		}
+
+		if f.log.Load() == nil {
+			f.log.Store(ctx.Log())
+		}
+		key := f.Keygen(ctx)
+		ctx.Set("metering.key", key)
+
+		next(ctx)
+
+		u := Usage{Requests: 1, BytesOut: int64(ctx.Bytes())}
+		if body != nil {
+			u.BytesIn = body.n
+		}
+		f.mu.Lock()
+		total := f.pending[key]
+		total.add(u)
+		f.pending[key] = total
+		f.mu.Unlock()
+	}
+}
+
+// flusher flushes the pending usage every FlushInterval, until Stop is called.
+func (f *Filter) flusher(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Flush sends the pending usage to the Store now.
+func (f *Filter) Flush() {
+	f.mu.Lock()
+	pending := f.pending
+	f.pending = make(map[string]Usage)
+	f.mu.Unlock()
+
+	for key, u := range pending {
+		if err := f.Store.Add(key, u); err != nil {
+			f.error(err)
+			f.mu.Lock()
+			total := f.pending[key]
+			total.add(u)
+			f.pending[key] = total
+			f.mu.Unlock()
+		}
+	}
+}
+
+// error sends a flush error to OnError, or to the service Log.
+func (f *Filter) error(err error) {
+	if f.OnError != nil {
+		f.OnError(err)
+		return
+	}
+	l, _ := f.log.Load().(*relax.Log)
+	if l == nil {
+		l = relax.NewLog(nil)
+	}
+	l.Errorf("metering: Flush error: %s", err)
+}
+
+// Stop flushes the pending usage and stops the periodic flushing. It should be
+// called when the service shuts down.
+func (f *Filter) Stop() {
+	f.mu.Lock()
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+	f.mu.Unlock()
+	f.Flush()
+}
+
+// Usage returns the usage totals of tenant 'key', including the usage not yet
+// flushed to the Store.
+func (f *Filter) Usage(key string) (Usage, error) {
+	u, err := f.Store.Get(key)
+	if err != nil {
+		return u, err
+	}
+	f.mu.Lock()
+	u.add(f.pending[key])
+	f.mu.Unlock()
+	return u, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metering
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+func newTestService(meter *Filter) *relax.Service {
+	svc := relax.NewService("/")
+	svc.Use(meter)
+	svc.Root().POST("echo", func(ctx *relax.Context) {
+		b, _ := io.ReadAll(ctx.Request.Body)
+		ctx.Write(b)
+	})
+	return svc
+}
+
+func serveMeter(svc *relax.Service, tenant, body string) {
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", tenant)
+	svc.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func tenantKey(ctx *relax.Context) string {
+	return ctx.Request.Header.Get("X-Tenant")
+}
+
+func TestMetering(t *testing.T) {
+	store := NewMemStore()
+	meter := &Filter{Store: store, Keygen: tenantKey, FlushInterval: time.Hour}
+	defer meter.Stop()
+	svc := newTestService(meter)
+
+	serveMeter(svc, "acme", "hello")
+	serveMeter(svc, "acme", "hello, world")
+	serveMeter(svc, "globex", "hi")
+
+	expected := Usage{Requests: 2, BytesIn: 17, BytesOut: 17}
+	if u, _ := meter.Usage("acme"); u != expected {
+		t.Errorf("expected pending usage %+v, got %+v", expected, u)
+	}
+	if u, _ := store.Get("acme"); u != (Usage{}) {
+		t.Errorf("expected no usage in store before flush, got %+v", u)
+	}
+
+	meter.Flush()
+	if u, _ := store.Get("acme"); u != expected {
+		t.Errorf("expected flushed usage %+v, got %+v", expected, u)
+	}
+	serveMeter(svc, "acme", "hello")
+	expected = Usage{Requests: 3, BytesIn: 22, BytesOut: 22}
+	if u, _ := meter.Usage("acme"); u != expected {
+		t.Errorf("expected total usage %+v, got %+v", expected, u)
+	}
+}
+
+type failingStore struct {
+	*MemStore
+	fail bool
+}
+
+func (s *failingStore) Add(key string, u Usage) error {
+	if s.fail {
+		return errors.New("store is down")
+	}
+	return s.MemStore.Add(key, u)
+}
+
+func TestFlushError(t *testing.T) {
+	store := &failingStore{MemStore: NewMemStore(), fail: true}
+	var errs int
+	meter := &Filter{Store: store, Keygen: tenantKey, FlushInterval: time.Hour, OnError: func(error) { errs++ }}
+	defer meter.Stop()
+	svc := newTestService(meter)
+
+	serveMeter(svc, "acme", "hello")
+	meter.Flush()
+	if errs != 1 {
+		t.Errorf("expected 1 flush error, got %d", errs)
+	}
+
+	// the usage that failed is sent in the next flush.
+	store.fail = false
+	meter.Flush()
+	if u, _ := store.Get("acme"); u.Requests != 1 || u.BytesIn != 5 {
+		t.Errorf("expected usage kept after error, got %+v", u)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	store := NewMemStore()
+	meter := &Filter{Store: store, Keygen: tenantKey, FlushInterval: time.Millisecond}
+	svc := newTestService(meter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveMeter(svc, "acme", "hello")
+		}()
+	}
+	wg.Wait()
+	meter.Stop()
+
+	if u, _ := store.Get("acme"); u.Requests != 50 || u.BytesIn != 250 {
+		t.Errorf("expected usage of 50 requests, got %+v", u)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metering
+
+import "sync"
+
+// Usage is the accumulated usage of a meter key.
+type Usage struct {
+	Requests int64 `json:"requests"`
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// add adds the values of 'u' to this usage.
+func (usage *Usage) add(u Usage) {
+	usage.Requests += u.Requests
+	usage.BytesIn += u.BytesIn
+	usage.BytesOut += u.BytesOut
+}
+
+// MeterStore is implemented by usage storage backends. The filter accumulates
+// usage in memory and sends it to the store periodically, so the store sees
+// one Add per key per flush.
+type MeterStore interface {
+	// Add adds usage 'u' to the totals of 'key'.
+	Add(key string, u Usage) error
+
+	// Get returns the totals of 'key'. Keys without usage return a zero Usage.
+	Get(key string) (Usage, error)
+}
+
+// MemStore is a MeterStore that keeps usage totals in memory.
+type MemStore struct {
+	mu    sync.Mutex
+	usage map[string]Usage
+}
+
+// NewMemStore returns a new MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{usage: make(map[string]Usage)}
+}
+
+// Add implements MeterStore.
+func (s *MemStore) Add(key string, u Usage) error {
+	s.mu.Lock()
+	total := s.usage[key]
+	total.add(u)
+	s.usage[key] = total
+	s.mu.Unlock()
+	return nil
+}
+
+// Get implements MeterStore.
+func (s *MemStore) Get(key string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[key], nil
+}
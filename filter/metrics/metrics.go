@@ -0,0 +1,149 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Filter Metrics profiles the content encoders: it measures the time spent and
+the payload sizes of encoding responses and decoding requests, per media type.
+So the cost of representations like XML or CSV can be compared with JSON.
+
+	m := &metrics.Filter{}
+	svc.Use(m)
+	svc.Root().GET("metrics/content", m.Handler).Hidden()
+
+Resources with their own encoders negotiate the content again, after the
+service filters run; use the filter at resource level to profile those.
+*/
+type Filter struct {
+	mu    sync.Mutex
+	stats map[string]*ContentStats
+}
+
+// ContentStats are the encoder totals of a media type. Durations are the
+// time spent in Encode and Decode, Bytes are the payload sizes.
+type ContentStats struct {
+	MediaType string `json:"media_type"`
+
+	Encodes        int64         `json:"encodes"`
+	EncodeBytes    int64         `json:"encode_bytes"`
+	EncodeDuration time.Duration `json:"encode_duration"`
+	EncodeMax      time.Duration `json:"encode_max"`
+
+	Decodes        int64         `json:"decodes"`
+	DecodeBytes    int64         `json:"decode_bytes"`
+	DecodeDuration time.Duration `json:"decode_duration"`
+	DecodeMax      time.Duration `json:"decode_max"`
+}
+
+// countingWriter counts the bytes encoded to a writer.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes decoded from a reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// record adds an encode, or a decode, of 'n' bytes that took 'd' to the
+// stats of media type 'mt'.
+func (f *Filter) record(mt string, encode bool, n int64, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.stats[mt]
+	if !ok {
+		s = &ContentStats{MediaType: mt}
+		f.stats[mt] = s
+	}
+	if encode {
+		s.Encodes++
+		s.EncodeBytes += n
+		s.EncodeDuration += d
+		if d > s.EncodeMax {
+			s.EncodeMax = d
+		}
+		return
+	}
+	s.Decodes++
+	s.DecodeBytes += n
+	s.DecodeDuration += d
+	if d > s.DecodeMax {
+		s.DecodeMax = d
+	}
+}
+
+// Run runs the filter. No info is passed.
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	f.mu.Lock()
+	if f.stats == nil {
+		f.stats = make(map[string]*ContentStats)
+	}
+	f.mu.Unlock()
+
+	return func(ctx *relax.Context) {
+		if encode := ctx.Encode; encode != nil {
+			ctx.Encode = func(w io.Writer, v interface{}) error {
+				mt, _ := ctx.Get("content.encoding").(string)
+				cw := &countingWriter{Writer: w}
+				start := time.Now()
+				err := encode(cw, v)
+				f.record(mt, true, cw.n, time.Since(start))
+				return err
+			}
+		}
+		if decode := ctx.Decode; decode != nil {
+			ctx.Decode = func(r io.Reader, v interface{}) error {
+				mt, _ := ctx.Get("content.decoding").(string)
+				cr := &countingReader{Reader: r}
+				start := time.Now()
+				err := decode(cr, v)
+				f.record(mt, false, cr.n, time.Since(start))
+				return err
+			}
+		}
+		next(ctx)
+	}
+}
+
+// Stats returns the encoder stats of all the media types used, sorted by
+// media type.
+func (f *Filter) Stats() []ContentStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := make([]ContentStats, 0, len(f.stats))
+	for _, s := range f.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].MediaType < stats[j].MediaType })
+	return stats
+}
+
+// Handler responds with the encoder stats, see Stats.
+func (f *Filter) Handler(ctx *relax.Context) {
+	ctx.Respond(f.Stats())
+}
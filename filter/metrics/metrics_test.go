@@ -0,0 +1,61 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestStats(t *testing.T) {
+	m := &Filter{}
+	svc := relax.NewService("/")
+	svc.Use(m)
+	svc.Root().
+		POST("echo", func(ctx *relax.Context) {
+			var v map[string]string
+			if err := ctx.Decode(ctx.Request.Body, &v); err != nil {
+				ctx.Error(400, err.Error())
+				return
+			}
+			ctx.Respond(v)
+		}).
+		GET("metrics/content", m.Handler)
+
+	body := `{"name":"relax"}`
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/echo", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	}
+
+	stats := m.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("expected stats of one media type, got %+v", stats)
+	}
+	s := stats[0]
+	if s.MediaType != "application/json" || s.Encodes != 2 || s.Decodes != 2 ||
+		s.DecodeBytes != int64(2*len(body)) || s.EncodeBytes < int64(2*len(body)) {
+		t.Errorf("expected 2 encodes and decodes, got %+v", s)
+	}
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/content", nil))
+	var list []ContentStats
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0] != s {
+		t.Errorf("expected handler stats %+v, got %+v", s, list)
+	}
+}
@@ -0,0 +1,9 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package mtls
+
+// Version is the semantic version of this package
+// More info: https://semver.org
+const Version = "1.0.0"
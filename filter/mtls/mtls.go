@@ -0,0 +1,251 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/srfrog/go-relax"
+)
+
+var (
+	// ErrUnverified is returned when a client certificate chain can't be verified.
+	ErrUnverified = errors.New("mtls: Client certificate is not verified")
+
+	// ErrForwardedCert is returned when a forwarded certificate is not valid PEM.
+	ErrForwardedCert = errors.New("mtls: Invalid forwarded certificate")
+)
+
+/*
+Filter MTLS authenticates clients with TLS client certificates (mutual TLS).
+
+The client certificate is taken from the TLS connection. When the service runs
+behind a proxy that terminates TLS, the proxy can forward the certificate in
+the header ForwardHeader; the header is only accepted from TrustedProxies.
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	svc.Use(&mtls.Filter{
+		Roots:      roots,
+		AllowedOUs: []string{"billing"},
+	})
+
+Note that the server must request client certificates for them to be sent,
+with http.Server.TLSConfig.ClientAuth set to tls.RequestClientCert or higher.
+*/
+type Filter struct {
+	// Roots is the pool of CA certificates used to verify client certificate
+	// chains. If nil, only chains already verified by the TLS server are
+	// accepted (tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert).
+	// Forwarded certificates always require Roots.
+	// Defaults to nil
+	Roots *x509.CertPool
+
+	// AllowedSANs is a list of subject alternative names allowed. A certificate
+	// is accepted if any of its DNS names, email addresses or URIs is in the list.
+	// Defaults to nil (any)
+	AllowedSANs []string
+
+	// AllowedOUs is a list of subject organizational units allowed.
+	// Defaults to nil (any)
+	AllowedOUs []string
+
+	// ForwardHeader is the request header used by trusted proxies to forward
+	// client certificates, in URL-escaped PEM format. For example, with Nginx:
+	//	proxy_set_header X-Client-Cert $ssl_client_escaped_cert;
+	// Defaults to "" (disabled)
+	ForwardHeader string
+
+	// TrustedProxies is a list of addresses or networks (CIDR) of proxies
+	// allowed to send ForwardHeader. The filter panics if a value is not valid.
+	// Defaults to nil (none)
+	TrustedProxies []string
+
+	// User returns the user name for a certificate.
+	// Defaults to a function that returns the subject common name.
+	User func(*x509.Certificate) string
+
+	once     sync.Once
+	proxies  []*net.IPNet
+	proxyErr error
+}
+
+// Run runs the filter and passes down the following Info:
+//
+//	ctx.Get("auth.user") // auth user, from the certificate subject
+//	ctx.Get("auth.type") // auth scheme type, "mtls"
+//	ctx.Get("mtls.cert") // client certificate, *x509.Certificate
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	// the service chain may be built again, parse the proxies once.
+	f.once.Do(func() {
+		if f.User == nil {
+			f.User = func(cert *x509.Certificate) string {
+				return cert.Subject.CommonName
+			}
+		}
+		f.proxies, f.proxyErr = parseProxies(f.TrustedProxies)
+	})
+	if f.proxyErr != nil {
+		panic(f.proxyErr.Error())
+	}
+
+	return func(ctx *relax.Context) {
+		cert, err := f.certificate(ctx.Request)
+		if err != nil {
+			ctx.Error(http.StatusUnauthorized, "Invalid client certificate.", err.Error())
+			return
+		}
+		if cert == nil {
+			ctx.Error(http.StatusUnauthorized, "A client certificate is required.")
+			return
+		}
+		if !f.allowed(cert) {
+			ctx.Error(http.StatusForbidden, "Client certificate not allowed.")
+			return
+		}
+
+		ctx.Set("auth.user", f.User(cert))
+		ctx.Set("auth.type", "mtls")
+		ctx.Set("mtls.cert", cert)
+
+		next(ctx)
+	}
+}
+
+// parseProxies returns the networks of the proxy addresses in 'list'. Addresses
+// without a mask are single hosts.
+func parseProxies(list []string) ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0, len(list))
+	for _, proxy := range list {
+		cidr := proxy
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("mtls: Invalid trusted proxy %q", proxy)
+		}
+		proxies = append(proxies, ipnet)
+	}
+	return proxies, nil
+}
+
+// certificate returns the verified client certificate of request 'r'.
+// Returns nil if no certificate was sent, or an error if it can't be verified.
+func (f *Filter) certificate(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		certs := r.TLS.PeerCertificates
+		if f.Roots == nil {
+			if len(r.TLS.VerifiedChains) == 0 {
+				return nil, ErrUnverified
+			}
+			return certs[0], nil
+		}
+		return certs[0], f.verify(certs[0], certs[1:])
+	}
+
+	if f.ForwardHeader == "" || !f.trusted(r.RemoteAddr) {
+		return nil, nil
+	}
+	value := r.Header.Get(f.ForwardHeader)
+	if value == "" {
+		return nil, nil
+	}
+	if f.Roots == nil {
+		return nil, ErrUnverified
+	}
+	cert, err := parseForwarded(value)
+	if err != nil {
+		return nil, err
+	}
+	return cert, f.verify(cert, nil)
+}
+
+// verify checks the chain of 'cert' against Roots.
+func (f *Filter) verify(cert *x509.Certificate, intermediates []*x509.Certificate) error {
+	opts := x509.VerifyOptions{
+		Roots:         f.Roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for i := range intermediates {
+		opts.Intermediates.AddCert(intermediates[i])
+	}
+	_, err := cert.Verify(opts)
+	return err
+}
+
+// trusted returns true if 'addr' is a trusted proxy address.
+func (f *Filter) trusted(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for i := range f.proxies {
+		if f.proxies[i].Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns true if 'cert' matches the SAN and OU allowlists.
+func (f *Filter) allowed(cert *x509.Certificate) bool {
+	if f.AllowedOUs != nil && !anyIn(cert.Subject.OrganizationalUnit, f.AllowedOUs) {
+		return false
+	}
+	if f.AllowedSANs != nil {
+		sans := append([]string{}, cert.DNSNames...)
+		sans = append(sans, cert.EmailAddresses...)
+		for _, u := range cert.URIs {
+			sans = append(sans, u.String())
+		}
+		if !anyIn(sans, f.AllowedSANs) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyIn returns true if any of 'values' is in 'list'.
+func anyIn(values, list []string) bool {
+	for i := range values {
+		for j := range list {
+			if values[i] == list[j] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseForwarded parses a URL-escaped PEM certificate.
+func parseForwarded(value string) (*x509.Certificate, error) {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, ErrForwardedCert
+	}
+	block, _ := pem.Decode([]byte(unescaped))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrForwardedCert
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
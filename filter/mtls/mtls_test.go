@@ -0,0 +1,192 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+// testCA is a certificate authority that issues client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, cn, ou, dns string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("spiffe://example.com/" + cn)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{ou}},
+		DNSNames:     []string{dns},
+		URIs:         []*url.URL{uri},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func serveCert(svc *relax.Service, cert *x509.Certificate, verified bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+	}
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	return w
+}
+
+func whoami(ctx *relax.Context) {
+	ctx.Respond(ctx.Get("auth.user"))
+}
+
+func TestCertificates(t *testing.T) {
+	ca, other := newTestCA(t, "CA"), newTestCA(t, "Other CA")
+	alice := ca.issue(t, "alice", "billing", "alice.example.com")
+	mallory := other.issue(t, "mallory", "billing", "mallory.example.com")
+
+	tests := []struct {
+		Filter   *Filter
+		Cert     *x509.Certificate
+		Verified bool
+		Code     int
+	}{
+		{&Filter{Roots: ca.pool}, nil, false, 401},
+		{&Filter{Roots: ca.pool}, alice, false, 200},
+		{&Filter{Roots: ca.pool}, mallory, false, 401},
+		// chains verified by the TLS server.
+		{&Filter{}, alice, false, 401},
+		{&Filter{}, mallory, true, 200},
+		// allowlists.
+		{&Filter{Roots: ca.pool, AllowedOUs: []string{"billing"}}, alice, false, 200},
+		{&Filter{Roots: ca.pool, AllowedOUs: []string{"admin"}}, alice, false, 403},
+		{&Filter{Roots: ca.pool, AllowedSANs: []string{"alice.example.com"}}, alice, false, 200},
+		{&Filter{Roots: ca.pool, AllowedSANs: []string{"spiffe://example.com/alice"}}, alice, false, 200},
+		{&Filter{Roots: ca.pool, AllowedSANs: []string{"bob.example.com"}}, alice, false, 403},
+		{&Filter{Roots: ca.pool, AllowedOUs: []string{"billing"}, AllowedSANs: []string{"bob.example.com"}}, alice, false, 403},
+	}
+	for i, tt := range tests {
+		svc := relax.NewService("/")
+		svc.Root().GET("whoami", whoami, tt.Filter)
+		w := serveCert(svc, tt.Cert, tt.Verified)
+		if w.Code != tt.Code {
+			t.Errorf("%d: expected %d, got %d %s", i, tt.Code, w.Code, w.Body.String())
+		}
+		if tt.Code == 200 && w.Body.String() != `"`+tt.Cert.Subject.CommonName+`"`+"\n" {
+			t.Errorf("%d: expected user %q, got %s", i, tt.Cert.Subject.CommonName, w.Body.String())
+		}
+	}
+}
+
+func TestForwardedCertificate(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	alice := ca.issue(t, "alice", "billing", "alice.example.com")
+	forwarded := url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: alice.Raw})))
+
+	svc := relax.NewService("/")
+	svc.Use(&Filter{Roots: ca.pool, ForwardHeader: "X-Client-Cert", TrustedProxies: []string{"10.0.0.0/8", "::1"}})
+	svc.Root().GET("whoami", whoami)
+
+	tests := []struct {
+		Addr  string
+		Value string
+		Code  int
+	}{
+		{"10.1.2.3:5000", forwarded, 200},
+		{"[::1]:5000", forwarded, 200},
+		{"192.0.2.1:5000", forwarded, 401},
+		{"10.1.2.3:5000", "", 401},
+		{"10.1.2.3:5000", "not-a-certificate", 401},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/whoami", nil)
+		req.RemoteAddr = tt.Addr
+		req.Header.Set("X-Client-Cert", tt.Value)
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Code {
+			t.Errorf("%d: expected %d, got %d %s", i, tt.Code, w.Code, w.Body.String())
+		}
+	}
+
+	// service filters run for each request, trusted proxies are kept.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/whoami", nil)
+			req.RemoteAddr = "10.1.2.3:5000"
+			req.Header.Set("X-Client-Cert", forwarded)
+			w := httptest.NewRecorder()
+			svc.ServeHTTP(w, req)
+			if w.Code != 200 {
+				t.Errorf("expected 200 from trusted proxy, got %d", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInvalidProxy(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil || err != `mtls: Invalid trusted proxy "10.0.0.0/33"` {
+			t.Errorf("expected panic for invalid proxy, got %v", err)
+		}
+	}()
+	(&Filter{TrustedProxies: []string{"10.0.0.1", "10.0.0.0/33"}}).Run(nil)
+}
@@ -5,6 +5,7 @@
 package override
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/srfrog/go-relax"
@@ -62,12 +63,12 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 			if override != ctx.Request.Method {
 				method, ok := f.Methods[override]
 				if !ok {
-					ctx.Error(http.StatusBadRequest, override+" method is not overridable.")
+					ctx.Error(http.StatusBadRequest, fmt.Sprintf(ctx.Localize("%s method is not overridable."), override))
 					return
 				}
 				// check that the caller method matches the expected override. e.g., used GET for OPTIONS
 				if ctx.Request.Method != method {
-					ctx.Error(http.StatusPreconditionFailed, "Must use "+method+" to override "+override)
+					ctx.Error(http.StatusPreconditionFailed, fmt.Sprintf(ctx.Localize("Must use %s to override %s"), method, override))
 					return
 				}
 				ctx.Request.Method = override
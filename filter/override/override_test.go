@@ -0,0 +1,49 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package override
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+func TestOverride(t *testing.T) {
+	svc := relax.NewService("/")
+	svc.Catalog = relax.Catalog{"es": {
+		"%s method is not overridable.": "El método %s no se puede reemplazar.",
+		"Must use %s to override %s":    "Debe usar %s para reemplazar %s",
+	}}
+	svc.Use(&Filter{})
+	svc.Root().
+		DELETE("items", func(ctx *relax.Context) { ctx.Respond(ctx.Get("override.method")) }).
+		POST("items", func(ctx *relax.Context) { ctx.WriteHeader(201) })
+
+	tests := []struct {
+		Method, Override, Lang string
+		Code                   int
+		Message                string
+	}{
+		{"POST", "", "", 201, ""},
+		{"POST", "DELETE", "", 200, ""},
+		{"POST", "TRACE", "", 400, "TRACE method is not overridable."},
+		{"POST", "TRACE", "es", 400, "El método TRACE no se puede reemplazar."},
+		{"GET", "DELETE", "", 412, "Must use POST to override DELETE"},
+		{"GET", "DELETE", "es", 412, "Debe usar POST para reemplazar DELETE"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.Method, "/items", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-HTTP-Method-Override", tt.Override)
+		req.Header.Set("Accept-Language", tt.Lang)
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Code || !strings.Contains(w.Body.String(), tt.Message) {
+			t.Errorf("%d: expected %d %q, got %d %s", i, tt.Code, tt.Message, w.Code, w.Body.String())
+		}
+	}
+}
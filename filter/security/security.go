@@ -6,6 +6,7 @@ package security
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/srfrog/go-relax"
 )
@@ -88,6 +89,22 @@ type Filter struct {
 	// For details see http://tools.ietf.org/html/rfc7234#section-5.4
 	// Defaults to false.
 	PragmaDisable bool
+
+	// CSPOptions is the value sent in a Content-Security-Policy header. The
+	// placeholder "{nonce}" is replaced with the request nonce, so inline
+	// scripts and styles can be allowed per request:
+	//		"script-src 'self' {nonce}; object-src 'none'"
+	// The nonce is available to handlers with ctx.Nonce(), and to templates
+	// with TemplateFuncs.
+	// For details see https://www.w3.org/TR/CSP3/
+	// Defaults to "" (no CSP header)
+	CSPOptions string
+
+	// CSPReportOnly if true, will send the policy in a
+	// Content-Security-Policy-Report-Only header instead, so violations are
+	// reported but not enforced.
+	// Defaults to false.
+	CSPReportOnly bool
 }
 
 // Run runs the filter.
@@ -133,6 +150,14 @@ func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
 			}
 		}
 
+		if f.CSPOptions != "" {
+			header := "Content-Security-Policy"
+			if f.CSPReportOnly {
+				header += "-Report-Only"
+			}
+			ctx.Header().Set(header, strings.Replace(f.CSPOptions, "{nonce}", "'nonce-"+ctx.Nonce()+"'", -1))
+		}
+
 		next(ctx)
 	}
 }
@@ -0,0 +1,63 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package security
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/srfrog/go-relax"
+)
+
+var page = template.Must(template.New("page").Funcs(TemplateFuncs(nil)).Parse(
+	`<script nonce="{{ nonce }}"></script><style {{ nonceAttr }}></style>`))
+
+func TestCSPNonce(t *testing.T) {
+	render := func(ctx *relax.Context) {
+		tmpl, _ := page.Clone()
+		ctx.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Funcs(TemplateFuncs(ctx)).Execute(ctx, nil); err != nil {
+			t.Error(err)
+		}
+	}
+	svc := relax.NewService("/")
+	svc.Root().
+		GET("page", render, &Filter{CSPOptions: "script-src 'self' {nonce}; style-src {nonce}"}).
+		GET("report", render, &Filter{CSPOptions: "script-src {nonce}", CSPReportOnly: true})
+
+	cspRx := regexp.MustCompile(`^script-src 'self' 'nonce-([^']+)'; style-src 'nonce-([^']+)'$`)
+	bodyRx := regexp.MustCompile(`^<script nonce="([^"]+)"></script><style nonce="([^"]+)"></style>$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/page", nil)
+		req.Header.Set("User-Agent", "relax-test")
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+
+		csp := cspRx.FindStringSubmatch(w.Header().Get("Content-Security-Policy"))
+		body := bodyRx.FindStringSubmatch(w.Body.String())
+		if csp == nil || body == nil {
+			t.Fatalf("%d: expected nonces, got %q %q", i, w.Header().Get("Content-Security-Policy"), w.Body.String())
+		}
+		nonce := csp[1]
+		if csp[2] != nonce || body[1] != nonce || body[2] != nonce {
+			t.Errorf("%d: expected the same nonce in header and page, got %q %q", i, csp[1:], body[1:])
+		}
+		if seen[nonce] {
+			t.Errorf("%d: expected a new nonce per request, got %q again", i, nonce)
+		}
+		seen[nonce] = true
+	}
+
+	req := httptest.NewRequest("GET", "/report", nil)
+	req.Header.Set("User-Agent", "relax-test")
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	if w.Header().Get("Content-Security-Policy") != "" || w.Header().Get("Content-Security-Policy-Report-Only") == "" {
+		t.Errorf("expected report-only policy, got %v", w.Header())
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package security
+
+import (
+	"html/template"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+TemplateFuncs returns template functions that use the CSP nonce of the request
+in 'ctx', the same nonce sent by the filter in the Content-Security-Policy header.
+
+	tmpl, err := template.New("page").Funcs(security.TemplateFuncs(ctx)).Parse(page)
+
+The functions are:
+
+	nonce      // the nonce value: <script nonce="{{ nonce }}">
+	nonceAttr  // the full attribute: <script {{ nonceAttr }}>
+
+Templates must be parsed with the functions, but the functions can be
+replaced per request before execution with tmpl.Funcs.
+*/
+func TemplateFuncs(ctx *relax.Context) template.FuncMap {
+	return template.FuncMap{
+		"nonce": ctx.Nonce,
+		"nonceAttr": func() template.HTMLAttr {
+			return template.HTMLAttr(`nonce="` + ctx.Nonce() + `"`)
+		},
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package watchdog
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+/*
+Filter Watchdog logs requests that take longer than Threshold, while they are
+still running. Each report includes a sample of the handler's goroutine stack,
+so hung handlers can be found before clients or proxies time out.
+
+	svc.Use(&watchdog.Filter{Threshold: 2 * time.Second})
+
+A request is reported every Threshold until it completes, and once more when
+it completes.
+*/
+type Filter struct {
+	// Logger is an interface that is based on Go's log package. Any logging
+	// system that implements Logger can be used.
+	// Defaults to the stdlog in 'log' package.
+	relax.Logger
+
+	// Threshold is the running time after which a request is reported.
+	// Defaults to 5 seconds.
+	Threshold time.Duration
+
+	// StackDisable if true, reports don't include stack samples.
+	// Defaults to false.
+	StackDisable bool
+
+	// OnSlow is an optional function called with each report, such as to
+	// send metrics. It receives the request context, the running time and the
+	// stack sample (empty if StackDisable is true). The handler is still
+	// running, so OnSlow must not write to the response.
+	// Defaults to nil
+	OnSlow func(ctx *relax.Context, elapsed time.Duration, stack []byte)
+}
+
+// watch is the state of a watched request.
+type watch struct {
+	sync.Mutex
+	done    bool
+	slow    bool
+	timer   *time.Timer
+	started time.Time
+	request string
+	gid     []byte
+}
+
+// Run runs the filter. No info is passed.
+func (f *Filter) Run(next relax.HandlerFunc) relax.HandlerFunc {
+	if f.Logger == nil {
+		f.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	if f.Threshold == 0 {
+		f.Threshold = 5 * time.Second
+	}
+	return func(ctx *relax.Context) {
+		w := &watch{
+			started: time.Now(),
+			request: ctx.Request.Method + " " + ctx.Request.URL.RequestURI(),
+			gid:     goroutineID(),
+		}
+		w.Lock()
+		w.timer = time.AfterFunc(f.Threshold, func() { f.report(ctx, w) })
+		w.Unlock()
+		// stop reporting even if the handler panics, before ctx is freed.
+		defer f.complete(w)
+
+		next(ctx)
+	}
+}
+
+// complete stops the reports of a request that is done, and logs its running
+// time if it was reported.
+func (f *Filter) complete(w *watch) {
+	w.Lock()
+	w.done = true
+	w.timer.Stop()
+	slow := w.slow
+	w.Unlock()
+	if slow {
+		f.Printf("watchdog: Slow request %q completed in %s", w.request, time.Since(w.started))
+	}
+}
+
+// report logs a request that is still running, and schedules the next report.
+func (f *Filter) report(ctx *relax.Context, w *watch) {
+	w.Lock()
+	defer w.Unlock()
+	if w.done {
+		return
+	}
+	w.slow = true
+	elapsed := time.Since(w.started)
+	var stack []byte
+	if !f.StackDisable {
+		stack = goroutineStack(w.gid)
+	}
+	f.Printf("watchdog: Slow request %q running for %s\n%s", w.request, elapsed, stack)
+	if f.OnSlow != nil {
+		f.OnSlow(ctx, elapsed, stack)
+	}
+	w.timer.Reset(f.Threshold)
+}
+
+// goroutineID returns the ID of the current goroutine, as found in stack dumps.
+func goroutineID() []byte {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// "goroutine 123 [running]:..."
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if idx := bytes.IndexByte(buf, ' '); idx != -1 {
+		buf = buf[:idx]
+	}
+	if _, err := strconv.Atoi(string(buf)); err != nil {
+		return nil
+	}
+	return buf
+}
+
+// goroutineStack returns the stack of the goroutine with ID 'gid', taken from
+// a dump of all goroutines.
+func goroutineStack(gid []byte) []byte {
+	if gid == nil {
+		return nil
+	}
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	header := append(append([]byte("goroutine "), gid...), " ["...)
+	start := bytes.Index(buf, header)
+	if start == -1 {
+		return nil
+	}
+	stack := buf[start:]
+	if end := bytes.Index(stack, []byte("\n\n")); end != -1 {
+		stack = stack[:end]
+	}
+	return stack
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package watchdog
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srfrog/go-relax"
+)
+
+// lockedBuffer is a log output that is safe to use from the report timers.
+type lockedBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *lockedBuffer) Count(s string) int {
+	b.Lock()
+	defer b.Unlock()
+	return strings.Count(b.Buffer.String(), s)
+}
+
+func TestSlowRequest(t *testing.T) {
+	var buf lockedBuffer
+	var mu sync.Mutex
+	var reports int
+	svc := relax.NewService("/")
+	svc.Root().
+		GET("slow", func(ctx *relax.Context) {
+			time.Sleep(50 * time.Millisecond)
+		}, &Filter{
+			Logger:    log.New(&buf, "", 0),
+			Threshold: 20 * time.Millisecond,
+			OnSlow: func(ctx *relax.Context, elapsed time.Duration, stack []byte) {
+				mu.Lock()
+				reports++
+				mu.Unlock()
+				if elapsed < 20*time.Millisecond || !bytes.Contains(stack, []byte("TestSlowRequest")) {
+					t.Errorf("expected report with handler stack, got %s %q", elapsed, stack)
+				}
+			},
+		}).
+		GET("fast", func(ctx *relax.Context) {}, &Filter{Logger: log.New(&buf, "", 0), Threshold: 20 * time.Millisecond})
+
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+	if buf.Count("watchdog:") != 0 {
+		t.Errorf("expected no report of fast request, got %q", buf.String())
+	}
+
+	svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	mu.Lock()
+	n := reports
+	mu.Unlock()
+	if n == 0 || buf.Count("running for") != n || buf.Count(`"GET /slow" completed in`) != 1 {
+		t.Errorf("expected reports and completion, got %d %q", n, buf.String())
+	}
+}
+
+func TestPanicStopsReports(t *testing.T) {
+	var buf lockedBuffer
+	svc := relax.NewService("/")
+	svc.Root().GET("panic", func(ctx *relax.Context) {
+		time.Sleep(30 * time.Millisecond)
+		panic("boom")
+	}, &Filter{Logger: log.New(&buf, "", 0), Threshold: 10 * time.Millisecond, StackDisable: true})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != 500 {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	n := buf.Count("running for")
+	time.Sleep(50 * time.Millisecond)
+	if n == 0 || buf.Count("running for") != n || buf.Count("completed in") != 1 {
+		t.Errorf("expected reports to stop after panic, got %q", buf.String())
+	}
+}
@@ -3,14 +3,14 @@ module github.com/srfrog/go-relax
 go 1.17
 
 require (
-	camlistore.org v0.0.0-20171230002226-a5a65f0d8b22
 	github.com/garyburd/redigo v1.6.2
 	github.com/gofrs/uuid v4.0.0+incompatible
 	github.com/sirupsen/logrus v1.8.1
 	github.com/srfrog/go-strarr v1.0.0
+	golang.org/x/crypto v0.14.0
 )
 
 require (
 	github.com/codehack/go-strarr v1.0.0 // indirect
-	golang.org/x/sys v0.0.0-20191026070338-33540a1f6037 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
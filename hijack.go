@@ -0,0 +1,82 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// root returns the context of the request this context was cloned from, or
+// the context itself if it's not a clone.
+func (ctx *Context) root() *Context {
+	if ctx.origin != nil {
+		return ctx.origin
+	}
+	return ctx
+}
+
+/*
+Hijack implements http.Hijacker, so WebSocket libraries and other protocol
+upgrades can take over the connection of the request. The Context is a
+http.ResponseWriter, so it's passed as is:
+
+	func (c *Chat) Join(ctx *relax.Context) {
+		conn, err := upgrader.Upgrade(ctx, ctx.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		...
+	}
+
+The connection is hijacked from the request, also from contexts cloned by
+filters that buffer the response, such as gzip and etag; the buffered response
+is dropped. After a hijack, writes to the context and its clones return
+http.ErrHijacked.
+
+Returns http.ErrNotSupported if the server connection can't be hijacked, such
+as with Service.Do requests.
+*/
+func (ctx *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	root := ctx.root()
+	hj, ok := root.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	root.hijacked, root.wroteHeader = true, true
+	ctx.wroteHeader = true
+	return conn, rw, nil
+}
+
+// Push implements http.Pusher, for HTTP/2 server push. The push is done on the
+// connection of the request, also from contexts cloned by filters that buffer
+// the response. Returns http.ErrNotSupported if the connection doesn't
+// support push, such as HTTP/1.x connections.
+func (ctx *Context) Push(target string, opts *http.PushOptions) error {
+	if p, ok := ctx.root().ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+/*
+Unwrap returns the ResponseWriter of the request connection, skipping the
+writers set by filters. It's used by http.ResponseController for the features
+that Context doesn't implement itself, such as write deadlines:
+
+	rc := http.NewResponseController(ctx)
+	rc.SetWriteDeadline(time.Now().Add(time.Minute))
+
+Flush, Hijack and Push are implemented by Context.
+*/
+func (ctx *Context) Unwrap() http.ResponseWriter {
+	return ctx.root().ResponseWriter
+}
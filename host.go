@@ -0,0 +1,192 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+Host is a virtual host of a service. Resources added to a host only serve
+requests with a matching Host header, but share the service filters,
+encoders, content negotiation and logging.
+
+	svc := relax.NewService("/v1")
+	svc.Use(&logs.Filter{})
+
+	// GET http://api.example.com/v1/users
+	svc.Host("api.example.com").Resource(users)
+
+	// GET http://internal.example.com/v1/stats
+	svc.Host("internal.example.com").Resource(stats)
+
+	// any host: GET /v1/status
+	svc.Resource(status)
+
+Requests are matched with the routes of their host first, then with the
+service routes, which serve all hosts. Hosts use the default routing engine.
+*/
+type Host struct {
+	service *Service
+	name    string
+	router  Router
+}
+
+// hostName returns the lowercase host name in 'hostport', without the port.
+func hostName(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		hostport = host
+	}
+	return strings.ToLower(hostport)
+}
+
+// Host returns the virtual host 'name' of the service, creating it if needed.
+// 'name' is a host name, such as "api.example.com"; ports are ignored.
+func (svc *Service) Host(name string) *Host {
+	name = hostName(name)
+	if h, ok := svc.hosts[name]; ok {
+		return h
+	}
+	if svc.hosts == nil {
+		svc.hosts = make(map[string]*Host)
+	}
+	h := &Host{service: svc, name: name, router: newRouter()}
+	if svc.routeCacheSize > 0 {
+		cacheRoutes(h.router, svc.routeCacheSize)
+	}
+	svc.hosts[name] = h
+	return h
+}
+
+// Name returns the host name.
+func (h *Host) Name() string {
+	return h.name
+}
+
+// Router returns the routing engine of the host.
+func (h *Host) Router() Router {
+	return h.router
+}
+
+// Resource is like Service.Resource, but the resource only serves requests
+// for this host.
+func (h *Host) Resource(collection Resourcer, filters ...Filter) *Resource {
+	return h.service.resource(h, "", collection, filters)
+}
+
+// findHandler returns the handler of the route that matches the request, and
+// the router that has it. The request host routes are tried first, then the
+// service routes. If no route matches and Service.MatrixParams is true, the
+// path is tried again without matrix parameters. The path values are set to
+// 'values' and 'params', if not nil. See also: Router.FindHandler
+func (svc *Service) findHandler(r *http.Request, values *url.Values, params *[]PathParam) (HandlerFunc, Router, error) {
+	handler, router, err := svc.findRoute(r.Host, r.Method, r.URL.Path, values, params)
+	if err == ErrRouteNotFound && svc.MatrixParams && strings.Contains(r.URL.Path, ";") {
+		path, matrix := matrixParams(r.URL.Path)
+		if handler, router, err = svc.findRoute(r.Host, r.Method, path, values, params); err == nil {
+			if values != nil && *values == nil {
+				*values = make(url.Values)
+			}
+			for _, p := range matrix {
+				if values != nil {
+					values.Add(p.Name, p.Value)
+				}
+				if params != nil {
+					*params = append(*params, p)
+				}
+			}
+		}
+	}
+	return handler, router, err
+}
+
+// findRoute returns the handler of the route (method + path) for host 'host',
+// and the router that has it. See findHandler.
+func (svc *Service) findRoute(host, method, path string, values *url.Values, params *[]PathParam) (HandlerFunc, Router, error) {
+	var hostErr error
+	h, ok := svc.hosts[hostName(host)]
+	if ok {
+		handler, err := findIn(h.router, method, path, values, params)
+		if err == nil {
+			return handler, h.router, nil
+		}
+		hostErr = err
+	}
+	handler, err := findIn(svc.router, method, path, values, params)
+	// the path of a host route matched, but not the method.
+	if err == ErrRouteNotFound && hostErr == ErrRouteBadMethod {
+		return nil, h.router, hostErr
+	}
+	return handler, svc.router, err
+}
+
+// findIn finds the handler of the route (method + path) in 'router'. If the
+// router is a ParamsRouter, the path values are also set to 'params'.
+func findIn(router Router, method, path string, values *url.Values, params *[]PathParam) (HandlerFunc, error) {
+	pr, ok := router.(ParamsRouter)
+	if !ok || params == nil {
+		return router.FindHandler(method, path, values)
+	}
+	handler, ps, err := pr.FindParams(method, path)
+	if err != nil {
+		return nil, err
+	}
+	*params = ps
+	if values != nil {
+		setValues(values, ps)
+	}
+	return handler, nil
+}
+
+// matrixParams returns 'path' without the matrix parameters of its segments,
+// and the parameters in order: "/cities;country=US/list" returns "/cities/list"
+// and the "country" param with value "US". Parameters without a value have an
+// empty value.
+func matrixParams(path string) (string, []PathParam) {
+	var params []PathParam
+	psegs := strings.Split(path, "/")
+	for i, pseg := range psegs {
+		parts := strings.Split(pseg, ";")
+		psegs[i] = parts[0]
+		for _, param := range parts[1:] {
+			if param == "" {
+				continue
+			}
+			k, v := param, ""
+			if idx := strings.Index(param, "="); idx != -1 {
+				k, v = param[:idx], param[idx+1:]
+			}
+			params = append(params, PathParam{Name: k, Value: v, Type: "matrix"})
+		}
+	}
+	return strings.Join(psegs, "/"), params
+}
+
+// canonicalPath returns the canonical path of request 'r', if it's different
+// from the request path and the service options allow it. 'err' is the error
+// of findHandler for the request. See: IgnoreCase, RedirectTrailingSlash
+func (svc *Service) canonicalPath(r *http.Request, err error) (string, bool) {
+	slash := svc.RedirectTrailingSlash && len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/")
+	if !slash && !(svc.IgnoreCase && err == ErrRouteNotFound) {
+		return "", false
+	}
+	routers := []Router{svc.router}
+	if h, ok := svc.hosts[hostName(r.Host)]; ok {
+		routers = []Router{h.router, svc.router}
+	}
+	for _, router := range routers {
+		cr, ok := router.(CanonicalRouter)
+		if !ok {
+			continue
+		}
+		if path, ok := cr.CanonicalPath(r.Method, r.URL.Path, svc.IgnoreCase); ok {
+			return path, path != r.URL.Path
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import "strings"
+
+/*
+Irregulars maps singular nouns to their plural, for the nouns that don't follow
+the English rules used by Singular and Plural. Uncountable nouns map to
+themselves. Applications can add their own nouns before adding resources:
+
+	relax.Irregulars["cactus"] = "cacti"
+	relax.Irregulars["metadata"] = "metadata"
+
+Keys and values are lowercase.
+*/
+var Irregulars = map[string]string{
+	"person":    "people",
+	"child":     "children",
+	"man":       "men",
+	"woman":     "women",
+	"mouse":     "mice",
+	"goose":     "geese",
+	"tooth":     "teeth",
+	"foot":      "feet",
+	"ox":        "oxen",
+	"datum":     "data",
+	"medium":    "media",
+	"criterion": "criteria",
+	"index":     "indices",
+	"matrix":    "matrices",
+	"vertex":    "vertices",
+	"analysis":  "analyses",
+	"basis":     "bases",
+	"crisis":    "crises",
+	"thesis":    "theses",
+	"alias":     "aliases",
+	"bus":       "buses",
+	"quiz":      "quizzes",
+	"movie":     "movies",
+	"cookie":    "cookies",
+	"cache":     "caches",
+	"knife":     "knives",
+	"life":      "lives",
+	"wife":      "wives",
+	"half":      "halves",
+	"shelf":     "shelves",
+	"wolf":      "wolves",
+	"news":      "news",
+	"series":    "series",
+	"species":   "species",
+	"sheep":     "sheep",
+	"fish":      "fish",
+	"feedback":  "feedback",
+	"software":  "software",
+	"equipment": "equipment",
+	"info":      "info",
+}
+
+// singularRules are the suffix replacements from plural to singular, in order.
+var singularRules = [][2]string{
+	{"sses", "ss"}, {"shes", "sh"}, {"ches", "ch"}, {"xes", "x"}, {"zzes", "zz"},
+	{"atuses", "atus"},
+}
+
+/*
+Singular returns the singular of the English noun 'word', such as "statuses" to
+"status" and "people" to "person". Words that already look singular, ending in
+"ss", "us" or "is", are returned unchanged. Irregular nouns are returned in
+lowercase. See: Irregulars
+
+CRUD uses Singular to name the item PSE of a resource.
+*/
+func Singular(word string) string {
+	w := strings.ToLower(word)
+	for singular, plural := range Irregulars {
+		if w == plural {
+			return singular
+		}
+	}
+	if _, ok := Irregulars[w]; ok {
+		return word
+	}
+	if strings.HasSuffix(w, "ies") && len(w) > 3 && !isVowel(w[len(w)-4]) {
+		return word[:len(word)-3] + "y"
+	}
+	for _, rule := range singularRules {
+		if strings.HasSuffix(w, rule[0]) && len(w) > len(rule[0]) {
+			return word[:len(word)-len(rule[0])] + rule[1]
+		}
+	}
+	if strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") &&
+		!strings.HasSuffix(w, "us") && !strings.HasSuffix(w, "is") {
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// Plural returns the plural of the English noun 'word', such as "status" to
+// "statuses" and "person" to "people". Irregular nouns are returned in
+// lowercase. See: Irregulars
+func Plural(word string) string {
+	w := strings.ToLower(word)
+	if plural, ok := Irregulars[w]; ok {
+		return plural
+	}
+	switch {
+	case strings.HasSuffix(w, "y") && len(w) > 1 && !isVowel(w[len(w)-2]):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(w, "is"):
+		return word[:len(word)-2] + "es"
+	case strings.HasSuffix(w, "s"), strings.HasSuffix(w, "sh"), strings.HasSuffix(w, "ch"),
+		strings.HasSuffix(w, "x"), strings.HasSuffix(w, "z"):
+		return word + "es"
+	}
+	return word + "s"
+}
+
+// isVowel returns true if 'c' is a lowercase vowel.
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) != -1
+}
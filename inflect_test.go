@@ -0,0 +1,52 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import "testing"
+
+func TestInflect(t *testing.T) {
+	tests := []struct {
+		Singular string
+		Plural   string
+	}{
+		{"job", "jobs"},
+		{"status", "statuses"},
+		{"address", "addresses"},
+		{"category", "categories"},
+		{"key", "keys"},
+		{"box", "boxes"},
+		{"match", "matches"},
+		{"person", "people"},
+		{"analysis", "analyses"},
+		{"sheep", "sheep"},
+		{"case", "cases"},
+		{"movie", "movies"},
+	}
+	for _, tt := range tests {
+		if s := Singular(tt.Plural); s != tt.Singular {
+			t.Errorf("expected singular of %q %q, got %q", tt.Plural, tt.Singular, s)
+		}
+		if p := Plural(tt.Singular); p != tt.Plural {
+			t.Errorf("expected plural of %q %q, got %q", tt.Singular, tt.Plural, p)
+		}
+	}
+
+	svc := NewService("/")
+	svc.Resource(&testStatuses{}).CRUD("")
+	for _, route := range svc.Routes() {
+		if route.Method == "GET" && route.Path == "/teststatuses/{teststatus}" {
+			return
+		}
+	}
+	t.Errorf("expected route GET /teststatuses/{teststatus}, got %v", svc.Routes())
+}
+
+type testStatuses struct{}
+
+func (s *testStatuses) Index(ctx *Context)  {}
+func (s *testStatuses) Create(ctx *Context) {}
+func (s *testStatuses) Read(ctx *Context)   {}
+func (s *testStatuses) Update(ctx *Context) {}
+func (s *testStatuses) Delete(ctx *Context) {}
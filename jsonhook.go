@@ -0,0 +1,359 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeEpochMillis is a value for EncoderJSON.TimeFormat that encodes time
+// values as the number of milliseconds since the Unix epoch.
+const TimeEpochMillis = "epoch_ms"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// errJSONCycle is returned for values too deep to be encoded, most likely
+	// pointer cycles.
+	errJSONCycle = errors.New("json: encountered a cycle")
+)
+
+// jsonHook rewrites values before they are marshaled, for the EncoderJSON
+// options that encoding/json doesn't support: time formats and non-finite
+// floats. Structs keep their field order and json tags.
+type jsonHook struct {
+	timeFormat    string
+	nullNonFinite bool
+}
+
+// jsonMember is a member of a jsonObject.
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+// jsonObject is a JSON object that keeps the order of its members, such as
+// the fields of a struct.
+type jsonObject []jsonMember
+
+// MarshalJSON implements json.Marshaler.
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(o[i].name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte(':')
+		if b, err = json.Marshal(o[i].value); err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonField is a struct field to encode, found by jsonFields.
+type jsonField struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	quoted    bool
+}
+
+// jsonFieldCache has the fields of the struct types seen by jsonFields,
+// map[reflect.Type][]jsonField.
+var jsonFieldCache sync.Map
+
+// jsonFields returns the fields of struct type 't' that encoding/json would
+// encode, in order; with the fields of embedded structs promoted. The fields
+// of each type are found once.
+func jsonFields(t reflect.Type) []jsonField {
+	if fields, ok := jsonFieldCache.Load(t); ok {
+		return fields.([]jsonField)
+	}
+	fields, _ := jsonFieldCache.LoadOrStore(t, typeFields(t))
+	return fields.([]jsonField)
+}
+
+// typeFields finds the fields of struct type 't' for jsonFields.
+func typeFields(t reflect.Type) []jsonField {
+	var all []jsonField
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if idx := strings.Index(tag, ","); idx != -1 {
+				name, opts = tag[:idx], tag[idx:]
+			}
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			fi := append(append([]int(nil), index...), i)
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, fi)
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue // unexported
+			}
+			f := jsonField{name: name, index: fi, tagged: name != ""}
+			if name == "" {
+				f.name = sf.Name
+			}
+			f.omitEmpty = strings.Contains(opts, ",omitempty")
+			if strings.Contains(opts, ",string") {
+				switch ft.Kind() {
+				case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+					reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+					reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+					f.quoted = true
+				}
+			}
+			all = append(all, f)
+		}
+	}
+	walk(t, nil)
+
+	// the shallowest field of a name wins, or the tagged one; others are dropped.
+	fields := make([]jsonField, 0, len(all))
+	for i := range all {
+		dominant := true
+		for j := range all {
+			if i == j || all[i].name != all[j].name {
+				continue
+			}
+			di, dj := len(all[i].index), len(all[j].index)
+			if dj < di || (dj == di && (all[j].tagged || !all[i].tagged)) {
+				dominant = false
+				break
+			}
+		}
+		if dominant {
+			fields = append(fields, all[i])
+		}
+	}
+	return fields
+}
+
+// isEmptyValue returns true if 'v' is empty, for the omitempty option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// rewrite returns 'v' rewritten for the hook options, ready for json.Marshal.
+func (h *jsonHook) rewrite(v interface{}) (interface{}, error) {
+	return h.value(reflect.ValueOf(v), 0)
+}
+
+// value returns 'v' rewritten for the hook options, ready for json.Marshal.
+func (h *jsonHook) value(v reflect.Value, depth int) (interface{}, error) {
+	if depth > 1000 {
+		return nil, errJSONCycle
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+	if v.Type() == timeType && h.timeFormat != "" {
+		t := v.Interface().(time.Time)
+		if h.timeFormat == TimeEpochMillis {
+			return t.UnixNano() / int64(time.Millisecond), nil
+		}
+		return t.Format(h.timeFormat), nil
+	}
+	if h.timeFormat != "" && v.Kind() == reflect.Ptr && v.Type().Elem() == timeType {
+		return h.value(v.Elem(), depth+1)
+	}
+	if m, ok := marshaler(v); ok {
+		return m, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return h.value(v.Elem(), depth+1)
+
+	case reflect.Float32, reflect.Float64:
+		if h.nonFinite(v) {
+			return nil, nil
+		}
+
+	case reflect.Struct:
+		fields := jsonFields(v.Type())
+		obj := make(jsonObject, 0, len(fields))
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			if f.quoted {
+				fv = reflect.Indirect(fv)
+				if fv.Kind() == reflect.String {
+					b, _ := json.Marshal(fv.String())
+					obj = append(obj, jsonMember{f.name, string(b)})
+					continue
+				}
+				if fv.IsValid() && !h.nonFinite(fv) {
+					b, err := json.Marshal(fv.Interface())
+					if err != nil {
+						return nil, err
+					}
+					obj = append(obj, jsonMember{f.name, string(b)})
+					continue
+				}
+			}
+			value, err := h.value(fv, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{f.name, value})
+		}
+		return obj, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		kt := v.Type().Key()
+		if kt.Kind() != reflect.String && !kt.Implements(textMarshalerType) {
+			switch kt.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			default:
+				return v.Interface(), nil // let encoding/json report it.
+			}
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := mapKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = h.value(iter.Value(), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 && !v.Type().Elem().Implements(jsonMarshalerType) {
+			return v.Interface(), nil // base64
+		}
+		fallthrough
+
+	case reflect.Array:
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			var err error
+			if a[i], err = h.value(v.Index(i), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	return v.Interface(), nil
+}
+
+// nonFinite returns true if 'v' is a NaN or infinite float, to be encoded as
+// null.
+func (h *jsonHook) nonFinite(v reflect.Value) bool {
+	if !h.nullNonFinite || (v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64) {
+		return false
+	}
+	f := v.Float()
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
+
+// marshaler returns 'v' as a json.Marshaler or encoding.TextMarshaler, also
+// with pointer methods if it's addressable, so it's encoded as is.
+func marshaler(v reflect.Value) (interface{}, bool) {
+	for _, t := range []reflect.Type{jsonMarshalerType, textMarshalerType} {
+		if v.Type().Implements(t) {
+			return v.Interface(), true
+		}
+		if v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(v.Type()).Implements(t) {
+			return v.Addr().Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// fieldByIndex returns the field of struct 'v' at 'index', through embedded
+// pointers. Returns false if an embedded pointer is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// mapKey returns the JSON object key of map key 'k'.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	}
+	return strconv.FormatUint(k.Uint(), 10), nil
+}
@@ -118,3 +118,13 @@ func (r *Resource) NewLink(link *Link) {
 	}
 	r.links = append(r.links, link)
 }
+
+// removeLink removes the link relation with URI 'uri' and type 'rel', if any.
+func (r *Resource) removeLink(uri, rel string) {
+	for k, v := range r.links {
+		if v.URI == uri && v.Rel == rel {
+			r.links = append(r.links[:k], r.links[k+1:]...)
+			return
+		}
+	}
+}
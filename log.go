@@ -0,0 +1,205 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is the severity of a log entry.
+type Level int32
+
+// Log levels, from most to least verbose.
+const (
+	LevelDebug Level = iota + 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// ErrLogLevel is returned by ParseLevel when the level name is not known.
+var ErrLogLevel = errors.New("relax: Invalid log level")
+
+// String returns the name of the level.
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the Level named 'name', one of "debug", "info", "warn"
+// or "error".
+func ParseLevel(name string) (Level, error) {
+	for level, s := range levelNames {
+		if strings.EqualFold(name, s) {
+			return level, nil
+		}
+	}
+	return 0, ErrLogLevel
+}
+
+// LeveledLogger is implemented by logging systems with level support, such as
+// logrus. Log sends entries to these methods instead of adding a level prefix.
+type LeveledLogger interface {
+	Debugf(string, ...interface{})
+	Infof(string, ...interface{})
+	Warnf(string, ...interface{})
+	Errorf(string, ...interface{})
+}
+
+/*
+Log is a leveled logging facade over a Logger. Print-style loggers, such as
+the standard log package, get entries prefixed with the level name; loggers
+that implement LeveledLogger get entries in their own level methods. Entries
+below the Log level are dropped before they reach the Logger.
+
+Each Service has its own Log, so services in the same program can log to
+different places and at different levels.
+
+	svc.Use(logrus.New())
+	svc.Log().SetLevel(relax.LevelDebug)
+	svc.Log().Debugf("relax: %d resources", n)
+
+Log implements Logger, entries written with Print methods are at LevelInfo.
+*/
+type Log struct {
+	logger Logger
+	level  int32
+}
+
+// NewLog returns a new Log that writes to 'logger' at LevelInfo. If 'logger'
+// is nil, the standard log package is used.
+func NewLog(logger Logger) *Log {
+	return &Log{logger: logger, level: int32(LevelInfo)}
+}
+
+// Logger returns the underlying logging system, or nil if it's the standard log.
+func (l *Log) Logger() Logger {
+	return l.logger
+}
+
+// Level returns the current log level.
+func (l *Log) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+// SetLevel changes the log level, it's safe to use while logging.
+func (l *Log) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Enabled returns true if entries at 'level' are logged.
+func (l *Log) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// Logf writes an entry at 'level'.
+func (l *Log) Logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	if ll, ok := l.logger.(LeveledLogger); ok {
+		switch level {
+		case LevelDebug:
+			ll.Debugf(format, args...)
+		case LevelWarn:
+			ll.Warnf(format, args...)
+		case LevelError:
+			ll.Errorf(format, args...)
+		default:
+			ll.Infof(format, args...)
+		}
+		return
+	}
+	if level != LevelInfo {
+		format = "[" + strings.ToUpper(level.String()) + "] " + format
+	}
+	if l.logger == nil {
+		log.Printf(format, args...)
+		return
+	}
+	l.logger.Printf(format, args...)
+}
+
+// Debugf writes an entry at LevelDebug.
+func (l *Log) Debugf(format string, args ...interface{}) { l.Logf(LevelDebug, format, args...) }
+
+// Infof writes an entry at LevelInfo.
+func (l *Log) Infof(format string, args ...interface{}) { l.Logf(LevelInfo, format, args...) }
+
+// Warnf writes an entry at LevelWarn.
+func (l *Log) Warnf(format string, args ...interface{}) { l.Logf(LevelWarn, format, args...) }
+
+// Errorf writes an entry at LevelError.
+func (l *Log) Errorf(format string, args ...interface{}) { l.Logf(LevelError, format, args...) }
+
+// Print implements Logger, writing an entry at LevelInfo.
+func (l *Log) Print(args ...interface{}) {
+	if !l.Enabled(LevelInfo) {
+		return
+	}
+	if l.logger == nil {
+		log.Print(args...)
+		return
+	}
+	l.logger.Print(args...)
+}
+
+// Printf implements Logger, writing an entry at LevelInfo.
+func (l *Log) Printf(format string, args ...interface{}) { l.Logf(LevelInfo, format, args...) }
+
+// Println implements Logger, writing an entry at LevelInfo.
+func (l *Log) Println(args ...interface{}) {
+	if !l.Enabled(LevelInfo) {
+		return
+	}
+	if l.logger == nil {
+		log.Println(args...)
+		return
+	}
+	l.logger.Println(args...)
+}
+
+// maxLogBufferEntries is the most entries kept by a LogBuffer.
+const maxLogBufferEntries = 1000
+
+// LogBuffer keeps the log entries of a single request, so they can be logged
+// only if needed, such as when the request fails.
+//
+// See also: Context.Debugf
+type LogBuffer struct {
+	mu      sync.Mutex
+	entries []string
+	dropped int
+}
+
+// Printf adds an entry to the buffer. After 1000 entries, new entries are
+// dropped and counted.
+func (b *LogBuffer) Printf(format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) >= maxLogBufferEntries {
+		b.dropped++
+		return
+	}
+	b.entries = append(b.entries, fmt.Sprintf(format, args...))
+}
+
+// Entries returns the buffered entries, and the number of entries dropped.
+func (b *LogBuffer) Entries() ([]string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.entries, b.dropped
+}
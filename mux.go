@@ -0,0 +1,102 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// muxWildcardExp matches the wildcards of http.ServeMux patterns:
+// "{name}", "{name...}" and "{$}".
+var muxWildcardExp = regexp.MustCompile(`^\{(\w*)(\.\.\.)?\}$|^\{\$\}$`)
+
+// muxMethods are the methods routed for ServeMux patterns without a method.
+var muxMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+/*
+muxPattern converts a Go 1.22 http.ServeMux pattern, "[METHOD ][HOST]/[PATH]",
+to a route method and path. Wildcards are converted to PSE's: "{name}" to
+"{name}", and "{name...}" to "{path:name}". A trailing slash, which matches
+the subtree in ServeMux, is converted to "{path:rest}"; and "{$}" is removed.
+Returns the method, "" for all methods; the path; or ErrRoutePattern if the
+pattern can't be converted.
+*/
+func muxPattern(pattern string) (string, string, error) {
+	method, path := "", strings.TrimSpace(pattern)
+	if i := strings.IndexAny(path, " \t"); i != -1 {
+		method, path = path[:i], strings.TrimLeft(path[i:], " \t")
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("%w %q: host patterns are not supported, use Service.Host", ErrRoutePattern, pattern)
+	}
+	psegs := strings.Split(path, "/")
+	for i, pseg := range psegs {
+		if !strings.Contains(pseg, "{") {
+			continue
+		}
+		m := muxWildcardExp.FindStringSubmatch(pseg)
+		if m == nil || (m[1] == "" && pseg != "{$}") {
+			return "", "", fmt.Errorf("%w %q: bad wildcard %q", ErrRoutePattern, pattern, pseg)
+		}
+		switch {
+		case pseg == "{$}":
+			if i != len(psegs)-1 {
+				return "", "", fmt.Errorf("%w %q: {$} must be at the end", ErrRoutePattern, pattern)
+			}
+			psegs[i] = ""
+		case m[2] != "":
+			if i != len(psegs)-1 {
+				return "", "", fmt.Errorf("%w %q: %s must be at the end", ErrRoutePattern, pattern, pseg)
+			}
+			psegs[i] = "{path:" + m[1] + "}"
+		}
+	}
+	if n := len(psegs); n > 2 && psegs[n-1] == "" && !strings.HasSuffix(path, "{$}") {
+		psegs[n-1] = "{path:rest}"
+	}
+	return strings.ToUpper(method), strings.Join(psegs, "/"), nil
+}
+
+/*
+Handle adds a route for the standard handler 'handler' with a Go 1.22
+http.ServeMux pattern, such as "GET /v1/users/{id}". Patterns without a method
+are routed for GET, POST, PUT, PATCH and DELETE. The path must be under the
+service path. 'filters' are route-level filters, like Route.
+
+	svc.Handle("GET /v1/files/{path...}", http.StripPrefix("/v1/files/", files))
+
+The path values are available with Request.PathValue, as in ServeMux; this is
+also true for relax handlers, which can use Context.PathValues too. Host
+patterns are not supported, see Host.
+
+This function will panic if the pattern is not valid or the path is not under
+the service path.
+*/
+func (svc *Service) Handle(pattern string, handler http.Handler, filters ...Filter) {
+	method, path, err := muxPattern(pattern)
+	if err != nil {
+		panic("relax: " + err.Error())
+	}
+	prefix := svc.Path(false)
+	if !strings.HasPrefix(path+"/", prefix) {
+		panic("relax: Handle pattern not under the service path " + prefix + ": " + pattern)
+	}
+	path = strings.TrimPrefix(path, strings.TrimRight(prefix, "/"))
+	path = strings.TrimPrefix(path, "/")
+
+	methods := muxMethods
+	if method != "" {
+		methods = []string{method}
+	}
+	h := func(ctx *Context) {
+		handler.ServeHTTP(ctx, ctx.Request)
+	}
+	for _, m := range methods {
+		svc.Root().Route(m, path, h, filters...)
+	}
+}
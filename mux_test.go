@@ -0,0 +1,72 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.22
+
+package relax
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMuxPattern(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Method  string
+		Path    string
+		Err     error
+	}{
+		{"GET /v1/users/{id}", "GET", "/v1/users/{id}", nil},
+		{"/v1/files/{path...}", "", "/v1/files/{path:path}", nil},
+		{"/v1/static/", "", "/v1/static/{path:rest}", nil},
+		{"GET /v1/users/{$}", "GET", "/v1/users/", nil},
+		{"example.com/v1/users", "", "", ErrRoutePattern},
+		{"GET /v1/{a...}/b", "", "", ErrRoutePattern},
+		{"GET /v1/{}", "", "", ErrRoutePattern},
+	}
+	for i, tt := range tests {
+		method, path, err := muxPattern(tt.Pattern)
+		if !errors.Is(err, tt.Err) || method != tt.Method || path != tt.Path {
+			t.Errorf("%d: expected %q %q %v, got %q %q %v", i, tt.Method, tt.Path, tt.Err, method, path, err)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	svc := NewService("/v1/")
+	svc.Handle("GET /v1/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user " + r.PathValue("id")))
+	}))
+	svc.Handle("/v1/files/{path...}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.PathValue("path")))
+	}))
+	svc.Resource(&testReports{}).GET("{uint:id}", func(ctx *Context) {
+		ctx.Write([]byte("report " + ctx.Request.PathValue("id")))
+	})
+
+	tests := []struct {
+		Method string
+		Path   string
+		Status int
+		Body   string
+	}{
+		{"GET", "/v1/users/123", 200, "user 123"},
+		{"POST", "/v1/users/123", 405, ""},
+		{"PUT", "/v1/files/a/b.txt", 200, "PUT a/b.txt"},
+		{"GET", "/v1/testreports/7", 200, "report 7"},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.Method, tt.Path, nil)
+		req.Header.Set("Content-Type", "application/json")
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || !strings.HasPrefix(w.Body.String(), tt.Body) {
+			t.Errorf("%d: expected %d %q, got %d %q", i, tt.Status, tt.Body, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MaxPerPage is the maximum page size that clients can request from Paginate,
+// with the per_page query value or the Range header.
+// Default: 100
+var MaxPerPage = 100
+
+// Page is the page of a collection requested, see Paginate. Offset and Limit
+// are the range of the items in the page, for queries.
+type Page struct {
+	// Number is the page number, starting at 1.
+	Number int
+	// PerPage is the page size.
+	PerPage int
+	// Offset is the index of the first item of the page, starting at 0.
+	Offset int
+	// Limit is the number of items in the page. It's less than PerPage in the
+	// last page, and 0 past the last page.
+	Limit int
+	// Total is the number of items in the collection.
+	Total int
+	// Pages is the number of pages, at least 1.
+	Pages int
+	// ranged is true if the page was requested with a Range header.
+	ranged bool
+}
+
+// Status returns the HTTP status of the response: 206-"Partial Content" if
+// the page was requested with a Range header, or 200-"OK" otherwise.
+func (p *Page) Status() int {
+	if p.ranged {
+		return http.StatusPartialContent
+	}
+	return http.StatusOK
+}
+
+// parseItemsRange returns the first and last items of a Range header value in
+// items units: "items=0-24". Returns false if it's not an items range.
+func parseItemsRange(value string) (int, int, bool) {
+	if !strings.HasPrefix(value, "items=") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, "items="), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	last, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || first < 0 || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+/*
+Paginate returns the page of a collection of 'total' items requested, and sets
+the pagination headers of the response. The page is requested with the query
+values "page" (from 1) and "per_page"; or with a Range header in items units,
+such as "Range: items=0-24". 'perPage' is the page size if the request doesn't
+have one. Clients can't request pages larger than MaxPerPage.
+
+The response has the X-Total-Count header, and Link headers to the first,
+previous, next and last pages (RFC 5988). Range requests also get the
+Content-Range header, and should be answered with Page.Status.
+
+	func (p *Posts) Index(ctx *relax.Context) {
+		total := p.db.Count()
+		page := relax.Paginate(ctx, total, 25)
+		posts := p.db.List(page.Offset, page.Limit)
+		ctx.Respond(posts, page.Status())
+	}
+*/
+func Paginate(ctx *Context, total, perPage int) *Page {
+	if total < 0 {
+		total = 0
+	}
+	q := ctx.Query()
+	page := &Page{Total: total, PerPage: q.GetInt("per_page", perPage), Number: q.GetInt("page", 1)}
+
+	first, last, ranged := parseItemsRange(ctx.Request.Header.Get("Range"))
+	if ranged {
+		page.ranged = true
+		page.PerPage = last - first + 1
+	}
+	if page.PerPage < 1 {
+		page.PerPage = perPage
+	}
+	if page.PerPage > MaxPerPage {
+		page.PerPage = MaxPerPage
+	}
+	if page.PerPage < 1 {
+		page.PerPage = 1
+	}
+	if page.Number < 1 {
+		page.Number = 1
+	}
+	page.Offset = (page.Number - 1) * page.PerPage
+	if ranged {
+		page.Offset = first
+		page.Number = first/page.PerPage + 1
+	}
+	page.Pages = (total + page.PerPage - 1) / page.PerPage
+	if page.Pages < 1 {
+		page.Pages = 1
+	}
+	if page.Offset < total {
+		page.Limit = page.PerPage
+		if page.Offset+page.Limit > total {
+			page.Limit = total - page.Offset
+		}
+	}
+
+	header := ctx.Header()
+	header.Set("X-Total-Count", strconv.Itoa(total))
+	if ranged {
+		header.Set("Accept-Ranges", "items")
+		if page.Limit > 0 {
+			header.Set("Content-Range", fmt.Sprintf("items %d-%d/%d", page.Offset, page.Offset+page.Limit-1, total))
+		} else {
+			header.Set("Content-Range", fmt.Sprintf("items */%d", total))
+		}
+	}
+	header.Add(LinkHeader(page.link(ctx, 1), `rel="first"`))
+	if page.Number > 1 {
+		prev := page.Number - 1
+		if prev > page.Pages {
+			prev = page.Pages
+		}
+		header.Add(LinkHeader(page.link(ctx, prev), `rel="prev"`))
+	}
+	if page.Number < page.Pages {
+		header.Add(LinkHeader(page.link(ctx, page.Number+1), `rel="next"`))
+	}
+	header.Add(LinkHeader(page.link(ctx, page.Pages), `rel="last"`))
+	return page
+}
+
+// link returns the URI of page 'n', with the query of the request.
+func (p *Page) link(ctx *Context, n int) string {
+	u := *ctx.Request.URL
+	values := u.Query()
+	values.Set("page", strconv.Itoa(n))
+	values.Set("per_page", strconv.Itoa(p.PerPage))
+	u.RawQuery = values.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,324 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// PathValueDetails are the details of the errors returned by the typed path
+// value accessors, such as Context.PathInt.
+type PathValueDetails struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// pathValue returns the path value 'name', or a StatusError if it's missing.
+func (ctx *Context) pathValue(name string) (string, error) {
+	if vs, ok := ctx.PathValues[name]; ok && len(vs) > 0 {
+		return vs[0], nil
+	}
+	return "", &StatusError{http.StatusBadRequest,
+		fmt.Sprintf("Missing path value %q.", name), &PathValueDetails{Name: name}}
+}
+
+// pathValueError returns the StatusError for path value 'name' with value
+// 'value' that isn't of type 'kind'.
+func pathValueError(name, value, kind string) error {
+	return &StatusError{http.StatusBadRequest,
+		fmt.Sprintf("Invalid %s path value %q.", kind, name), &PathValueDetails{name, value}}
+}
+
+// pathNumber returns 'value' without the hex prefix, and the base to parse it.
+// Values matched by the hex PSE are in base 16.
+func pathNumber(value string) (string, int) {
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		return value[2:], 16
+	}
+	return value, 10
+}
+
+/*
+PathInt returns the path value 'name' as a signed 64-bit integer, as matched
+by the int and hex PSE types. Hex values have the "0x" prefix.
+
+	// GET /users/{int:id}
+	id, err := ctx.PathInt("id")
+	if err != nil {
+		ctx.Respond(err, http.StatusBadRequest)
+		return
+	}
+
+Returns a StatusError with code 400 and PathValueDetails if the value is
+missing or isn't an integer.
+*/
+func (ctx *Context) PathInt(name string) (int64, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return 0, err
+	}
+	v, base := pathNumber(value)
+	n, err := strconv.ParseInt(v, base, 64)
+	if err != nil {
+		return 0, pathValueError(name, value, "integer")
+	}
+	return n, nil
+}
+
+// PathUint is like PathInt, but for unsigned integers, as matched by the uint
+// and hex PSE types.
+func (ctx *Context) PathUint(name string) (uint64, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return 0, err
+	}
+	v, base := pathNumber(value)
+	n, err := strconv.ParseUint(v, base, 64)
+	if err != nil {
+		return 0, pathValueError(name, value, "unsigned integer")
+	}
+	return n, nil
+}
+
+// PathFloat is like PathInt, but for floating-point numbers, as matched by
+// the float and int PSE types.
+func (ctx *Context) PathFloat(name string) (float64, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, pathValueError(name, value, "number")
+	}
+	return f, nil
+}
+
+// PathBool is like PathInt, but for boolean values, as accepted by
+// strconv.ParseBool: "1", "t", "true", "0", "f", "false" and their uppercase.
+func (ctx *Context) PathBool(name string) (bool, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, pathValueError(name, value, "boolean")
+	}
+	return b, nil
+}
+
+/*
+PathUUID returns the path value 'name' if it's an UUID, as matched by the uuid
+PSE type. The value is normalized to the canonical form: lowercase with dashes.
+
+	// GET /users/{uuid:id}
+	id, err := ctx.PathUUID("id") // "6BA7B8109DAD11D180B400C04FD430C8" => "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+Use PathValues to get the value as it was sent. See also: IsUUID
+*/
+func (ctx *Context) PathUUID(name string) (string, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return "", err
+	}
+	if !IsUUID(value) {
+		return "", pathValueError(name, value, "UUID")
+	}
+	return uuid.FromStringOrNil(value).String(), nil
+}
+
+// PathULID is like PathUUID, but for ULID's as matched by the ulid PSE type.
+// The value is normalized to uppercase. See also: IsULID
+func (ctx *Context) PathULID(name string) (string, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return "", err
+	}
+	if !IsULID(value) {
+		return "", pathValueError(name, value, "ULID")
+	}
+	return strings.ToUpper(value), nil
+}
+
+/*
+PathTime is like PathInt, but for times. Values matched by the date PSE type
+are parsed in all its ISO 8601 forms, from "2006" to "2006-01-02T15:04:05.999-07:00",
+with the missing parts at their zero value and in UTC if there's no time zone.
+Other values are parsed in RFC 3339 format.
+
+	// GET /posts/{date:day}
+	day, err := ctx.PathTime("day")
+*/
+func (ctx *Context) PathTime(name string) (time.Time, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if year := ctx.PathValues.Get(name + "_year"); year != "" {
+		if t, ok := ctx.pathDate(name, value); ok {
+			return t, nil
+		}
+	} else if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, pathValueError(name, value, "time")
+}
+
+// pathDate returns the time of 'value', matched by the date PSE 'name'. The
+// date parts are in the PSE submatches, the time zone is at the end of 'value'.
+func (ctx *Context) pathDate(name, value string) (time.Time, bool) {
+	part := func(sub string, def int) int {
+		n, err := strconv.Atoi(ctx.PathValues.Get(name + "_" + sub))
+		if err != nil {
+			return def
+		}
+		return n
+	}
+	var nsec int
+	sec := ctx.PathValues.Get(name + "_sec")
+	if len(sec) > 3 {
+		frac := (sec[3:] + "000000000")[:9]
+		nsec, _ = strconv.Atoi(frac)
+		sec = sec[:2]
+	}
+	secs, _ := strconv.Atoi(sec)
+
+	loc := time.UTC
+	if idx := strings.Index(value, "T"); idx != -1 {
+		clock := value[idx+1:]
+		if strings.HasSuffix(clock, "Z") {
+			loc = time.UTC
+		} else if zi := strings.LastIndexAny(clock, "+-"); zi != -1 {
+			zone := strings.Replace(clock[zi+1:], ":", "", 1)
+			hh, _ := strconv.Atoi(zone[:2])
+			mm := 0
+			if len(zone) == 4 {
+				mm, _ = strconv.Atoi(zone[2:])
+			}
+			offset := hh*3600 + mm*60
+			if clock[zi] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone("", offset)
+		}
+	}
+
+	t := time.Date(part("year", 0), time.Month(part("mon", 1)), part("mday", 1),
+		part("hour", 0), part("min", 0), secs, nsec, loc)
+	// out of range days, such as Feb 30, are normalized by time.Date.
+	return t, t.Day() == part("mday", 1)
+}
+
+// PathIP is like PathInt, but for IP addresses, as matched by the ip PSE type.
+func (ctx *Context) PathIP(name string) (net.IP, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, pathValueError(name, value, "IP address")
+	}
+	return ip, nil
+}
+
+/*
+PathCIDR is like PathInt, but for IP networks, as matched by the cidr PSE type.
+The prefix length follows a dash, because slashes separate path segments.
+
+	// GET /networks/{cidr:net}
+	ipnet, err := ctx.PathCIDR("net") // "10.1.0.0-16" => 10.1.0.0/16
+*/
+func (ctx *Context) PathCIDR(name string) (*net.IPNet, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return nil, err
+	}
+	idx := strings.LastIndex(value, "-")
+	if idx == -1 {
+		return nil, pathValueError(name, value, "CIDR")
+	}
+	_, ipnet, err := net.ParseCIDR(value[:idx] + "/" + value[idx+1:])
+	if err != nil {
+		return nil, pathValueError(name, value, "CIDR")
+	}
+	return ipnet, nil
+}
+
+// PathEmail is like PathInt, but for email addresses, as matched by the email
+// PSE type. Returns the address, "user@domain".
+func (ctx *Context) PathEmail(name string) (string, error) {
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return "", err
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		return "", pathValueError(name, value, "email")
+	}
+	return addr.Address, nil
+}
+
+// SemVer is a semantic version, see https://semver.org
+type SemVer struct {
+	Major, Minor, Patch uint64
+	Pre                 string // pre-release, such as "beta.1"
+	Build               string // build metadata, such as "build.42"
+}
+
+// String returns the version without prefix, such as "1.2.3-beta.1+build.42".
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// semverRx matches a complete semantic version, with optional "v" prefix.
+var semverRx = regexp.MustCompile(`^v?` + semverExp + `$`)
+
+// PathSemver is like PathInt, but for semantic versions, as matched by the
+// semver PSE type.
+func (ctx *Context) PathSemver(name string) (SemVer, error) {
+	var v SemVer
+	value, err := ctx.pathValue(name)
+	if err != nil {
+		return v, err
+	}
+	if !semverRx.MatchString(value) {
+		return v, pathValueError(name, value, "version")
+	}
+	s := strings.TrimPrefix(value, "v")
+	if idx := strings.Index(s, "+"); idx != -1 {
+		s, v.Build = s[:idx], s[idx+1:]
+	}
+	if idx := strings.Index(s, "-"); idx != -1 {
+		s, v.Pre = s[:idx], s[idx+1:]
+	}
+	nums := strings.Split(s, ".")
+	if v.Major, err = strconv.ParseUint(nums[0], 10, 64); err == nil {
+		if v.Minor, err = strconv.ParseUint(nums[1], 10, 64); err == nil {
+			v.Patch, err = strconv.ParseUint(nums[2], 10, 64)
+		}
+	}
+	if err != nil {
+		return SemVer{}, pathValueError(name, value, "version")
+	}
+	return v, nil
+}
@@ -0,0 +1,22 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.22
+
+package relax
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// setPathValues sets the named path 'values' to request 'r', so they are
+// available with Request.PathValue.
+func setPathValues(r *http.Request, values url.Values) {
+	for k, v := range values {
+		if len(v) > 0 {
+			r.SetPathValue(k, v[0])
+		}
+	}
+}
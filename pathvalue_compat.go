@@ -0,0 +1,15 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !go1.22
+
+package relax
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// setPathValues does nothing, Request.PathValue was added in Go 1.22.
+func setPathValues(r *http.Request, values url.Values) {}
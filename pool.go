@@ -0,0 +1,57 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"bytes"
+	"sync"
+)
+
+// bufferClasses are the capacities of the pooled buffers, one pool per class.
+// Buffers that grow larger than the last class are not pooled, so a few very
+// large responses don't keep their memory.
+var bufferClasses = [...]int{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// bufferPools are the buffer pools of each size class.
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// bufferClass returns the index of the smallest class that fits 'size', or -1
+// if it's too large for pooling.
+func bufferClass(size int) int {
+	for i := range bufferClasses {
+		if size <= bufferClasses[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// getBuffer returns an empty buffer from the pools, with capacity for at
+// least 'hint' bytes if it's not too large.
+func getBuffer(hint int) *bytes.Buffer {
+	i := bufferClass(hint)
+	if i == -1 {
+		return bytes.NewBuffer(make([]byte, 0, hint))
+	}
+	if buf, ok := bufferPools[i].Get().(*bytes.Buffer); ok {
+		return buf
+	}
+	return bytes.NewBuffer(make([]byte, 0, bufferClasses[i]))
+}
+
+// putBuffer returns 'buf' to the pool of the largest class that it fills, so
+// buffers are reused for content of similar size.
+func putBuffer(buf *bytes.Buffer) {
+	c := buf.Cap()
+	for i := len(bufferClasses) - 1; i >= 0; i-- {
+		if c >= bufferClasses[i] {
+			if c <= 2*bufferClasses[len(bufferClasses)-1] {
+				buf.Reset()
+				bufferPools[i].Put(buf)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import "net/http"
+
+/*
+Primer is implemented by resources that supply sample PSE values for their GET
+routes, so Service.Prime can request them. Routes without PSE's are always
+requested; routes with PSE's are requested only if their resource is a Primer.
+
+	// PrimeValues returns the most requested users.
+	func (u *Users) PrimeValues(path string) [][]interface{} {
+		if strings.HasSuffix(path, "{uint:id}") {
+			return [][]interface{}{{1}, {2}, {42}}
+		}
+		return nil
+	}
+*/
+type Primer interface {
+	// PrimeValues returns the PSE values of the route 'path', one list of
+	// values per request, in PSE order like URLFor. Returns nil to skip the route.
+	PrimeValues(path string) [][]interface{}
+}
+
+// PrimeResult is the result of a request made by Service.Prime.
+type PrimeResult struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+/*
+Prime makes a HEAD request to each GET route of the service with Do, to warm
+the caches of resources after a deploy, such as database pools and response
+caches. The etag filter doesn't save the entity-tags it computes, so its
+Store is not warmed. The PSE values of routes come from resources that
+implement Primer.
+'header' are the headers sent in all the requests, such as Accept.
+Returns the result of each request, in route order.
+
+	results := svc.Prime(http.Header{"Accept": {"application/json"}})
+
+Note that the requests go through the resource filters, auth filters must
+allow them.
+*/
+func (svc *Service) Prime(header http.Header) []PrimeResult {
+	var results []PrimeResult
+	for _, e := range svc.routeEntries() {
+		if e.method != "GET" {
+			continue
+		}
+		values := [][]interface{}{nil}
+		if isPattern(e.path) {
+			values = nil
+			if p, ok := e.res.collection.(Primer); ok {
+				values = p.PrimeValues(e.path)
+			}
+		}
+		for _, params := range values {
+			href, err := svc.routeURL(e, params)
+			if err != nil {
+				results = append(results, PrimeResult{Path: e.path, Error: err.Error()})
+				continue
+			}
+			opts := []DoOption{func(r *http.Request) *http.Request {
+				for k, v := range header {
+					r.Header[k] = v
+				}
+				if e.host != "" {
+					r.Host = e.host
+				}
+				return r
+			}}
+			rb, err := svc.Do("HEAD", href, nil, opts...)
+			if err != nil {
+				results = append(results, PrimeResult{Path: href, Error: err.Error()})
+				continue
+			}
+			results = append(results, PrimeResult{Path: href, Status: rb.Status()})
+			rb.Free()
+		}
+	}
+	return results
+}
+
+/*
+PrimeHandler is an admin handler that runs Prime and responds with the results.
+The Accept and Accept-Language headers of the request are sent in the requests.
+It's not routed by default, it must be added with admin-only filters:
+
+	svc.Root().POST("prime", svc.PrimeHandler, &authbasic.Filter{Provider: admins})
+*/
+func (svc *Service) PrimeHandler(ctx *Context) {
+	header := make(http.Header)
+	for _, k := range []string{"Accept", "Accept-Language"} {
+		if v := ctx.Request.Header.Get(k); v != "" {
+			header.Set(k, v)
+		}
+	}
+	ctx.Respond(svc.Prime(header))
+}
@@ -0,0 +1,88 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// pseBuiltinTypes are the PSE types built into segmentExp.
+var pseBuiltinTypes = map[string]bool{
+	"re": true, "word": true, "date": true, "geo": true, "hex": true,
+	"uuid": true, "float": true, "uint": true, "int": true, "path": true,
+	"ip": true, "email": true, "ulid": true, "slug": true, "semver": true,
+	"cidr": true,
+}
+
+// pseTypes are the custom PSE types added with RegisterType.
+var pseTypes = struct {
+	sync.RWMutex
+	patterns map[string]string
+}{patterns: make(map[string]string)}
+
+var (
+	pseTypeName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	pseTypeExp  = regexp.MustCompile(`\{(\w+)\:(\w+)\}`)
+)
+
+/*
+RegisterType adds a custom PSE type to the router. Once registered, the type
+can be used in any route as "{name:varname}"; 'pattern' is the regular
+expression that matches a value, it must not have named groups.
+
+	func init() {
+		relax.RegisterType("isbn", `97[89]\d{10}`)
+	}
+
+	books.GET("{isbn:id}", books.Read)
+
+Types should be registered before routes are added, usually in init().
+This function panics if 'name' is not a lowercase identifier, if it's a
+built-in or already registered type, or if 'pattern' doesn't compile.
+*/
+func RegisterType(name, pattern string) {
+	if !pseTypeName.MatchString(name) {
+		panic(fmt.Sprintf("relax: Invalid PSE type name %q", name))
+	}
+	if pseBuiltinTypes[name] {
+		panic(fmt.Sprintf("relax: PSE type %q is built-in", name))
+	}
+	rx, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("relax: Invalid pattern for PSE type %q: %s", name, err))
+	}
+	for _, sub := range rx.SubexpNames() {
+		if sub != "" {
+			panic(fmt.Sprintf("relax: Pattern for PSE type %q has named group %q", name, sub))
+		}
+	}
+
+	pseTypes.Lock()
+	defer pseTypes.Unlock()
+	if _, ok := pseTypes.patterns[name]; ok {
+		panic(fmt.Sprintf("relax: PSE type %q is already registered", name))
+	}
+	pseTypes.patterns[name] = pattern
+}
+
+// customTypeExp replaces the custom PSE types in 'p' with their patterns.
+// Returns an error if a PSE type is not known.
+func customTypeExp(p string) (string, error) {
+	var err error
+	pseTypes.RLock()
+	defer pseTypes.RUnlock()
+	p = pseTypeExp.ReplaceAllStringFunc(p, func(m string) string {
+		sm := pseTypeExp.FindStringSubmatch(m)
+		pattern, ok := pseTypes.patterns[sm[1]]
+		if !ok {
+			err = fmt.Errorf("unknown PSE type %q in %q", sm[1], m)
+			return m
+		}
+		return fmt.Sprintf(`(?P<%s>%s)`, sm[2], pattern)
+	})
+	return p, err
+}
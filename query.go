@@ -0,0 +1,133 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// QueryValues are the request query values, with typed getters. The getters
+// return the first value of a key; or the default value, if any, when the key
+// is missing or its value can't be parsed. See: Context.Query
+type QueryValues struct {
+	url.Values
+	raw string
+}
+
+/*
+Query returns the request query values. The query is parsed once and cached,
+unless the request query changes.
+
+	// GET /posts?page=2&all&since=2024-02-15T00:00:00Z
+	q := ctx.Query()
+	page := q.GetInt("page", 1)                 // 2
+	all := q.GetBool("all")                     // true
+	since := q.GetTime("since", time.RFC3339)   // 2024-02-15 00:00:00 +0000 UTC
+	order := q.GetString("order", "desc")       // "desc"
+
+Invalid query values are ignored, as in url.ParseQuery.
+*/
+func (ctx *Context) Query() *QueryValues {
+	raw := ctx.Request.URL.RawQuery
+	if ctx.query == nil || ctx.query.raw != raw {
+		values, _ := url.ParseQuery(raw)
+		ctx.query = &QueryValues{Values: values, raw: raw}
+	}
+	return ctx.query
+}
+
+// Has returns true if the query has the key, even without a value.
+func (q *QueryValues) Has(key string) bool {
+	_, ok := q.Values[key]
+	return ok
+}
+
+// GetString returns the value of 'key', or 'def' if the key is missing.
+func (q *QueryValues) GetString(key string, def ...string) string {
+	if vs, ok := q.Values[key]; ok && len(vs) > 0 {
+		return vs[0]
+	}
+	if def != nil {
+		return def[0]
+	}
+	return ""
+}
+
+// GetInt returns the value of 'key' as an int, or 'def'.
+func (q *QueryValues) GetInt(key string, def ...int) int {
+	if n, err := strconv.Atoi(q.Get(key)); err == nil {
+		return n
+	}
+	if def != nil {
+		return def[0]
+	}
+	return 0
+}
+
+// GetInt64 returns the value of 'key' as an int64, or 'def'.
+func (q *QueryValues) GetInt64(key string, def ...int64) int64 {
+	if n, err := strconv.ParseInt(q.Get(key), 10, 64); err == nil {
+		return n
+	}
+	if def != nil {
+		return def[0]
+	}
+	return 0
+}
+
+// GetFloat returns the value of 'key' as a float64, or 'def'.
+func (q *QueryValues) GetFloat(key string, def ...float64) float64 {
+	if f, err := strconv.ParseFloat(q.Get(key), 64); err == nil {
+		return f
+	}
+	if def != nil {
+		return def[0]
+	}
+	return 0
+}
+
+// GetBool returns the value of 'key' as a bool, or 'def'. Keys without a
+// value, such as "?all", are true.
+func (q *QueryValues) GetBool(key string, def ...bool) bool {
+	if q.Has(key) && q.Get(key) == "" {
+		return true
+	}
+	if b, err := strconv.ParseBool(q.Get(key)); err == nil {
+		return b
+	}
+	if def != nil {
+		return def[0]
+	}
+	return false
+}
+
+// GetDuration returns the value of 'key' as a time.Duration, such as "1h30m",
+// or 'def'.
+func (q *QueryValues) GetDuration(key string, def ...time.Duration) time.Duration {
+	if d, err := time.ParseDuration(q.Get(key)); err == nil {
+		return d
+	}
+	if def != nil {
+		return def[0]
+	}
+	return 0
+}
+
+// GetTime returns the value of 'key' as a time.Time in 'layout', or 'def'.
+// An empty 'layout' is time.RFC3339.
+func (q *QueryValues) GetTime(key, layout string, def ...time.Time) time.Time {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	if t, err := time.Parse(layout, q.Get(key)); err == nil {
+		return t
+	}
+	if def != nil {
+		return def[0]
+	}
+	return time.Time{}
+}
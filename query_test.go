@@ -0,0 +1,69 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	ctx := &Context{Request: httptest.NewRequest("GET", "/posts?page=2&all&since=2024-02-15T00:00:00Z&limit=x", nil)}
+	q := ctx.Query()
+	if q.GetInt("page", 1) != 2 || q.GetInt("limit", 10) != 10 || q.GetInt("missing") != 0 {
+		t.Errorf("GetInt: unexpected values %v", q.Values)
+	}
+	if !q.GetBool("all") || q.GetBool("none") || !q.GetBool("none", true) {
+		t.Error("GetBool: unexpected values")
+	}
+	if since := q.GetTime("since", ""); !since.Equal(time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("GetTime: got %v", since)
+	}
+	if q.GetString("order", "desc") != "desc" {
+		t.Error("GetString: expected default")
+	}
+	if ctx.Query() != q {
+		t.Error("expected cached query")
+	}
+	ctx.Request.URL.RawQuery = "page=3"
+	if ctx.Query().GetInt("page") != 3 {
+		t.Error("expected query parsed again after change")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		Target, Range  string
+		Number, Offset int
+		Limit, Status  int
+		Links          []string
+		ContentRange   string
+	}{
+		{"/posts", "", 1, 0, 10, 200, []string{`</posts?page=1&per_page=10>; rel="first"`, `</posts?page=2&per_page=10>; rel="next"`, `</posts?page=3&per_page=10>; rel="last"`}, ""},
+		{"/posts?page=3&per_page=10&q=go", "", 3, 20, 5, 200, []string{`</posts?page=1&per_page=10&q=go>; rel="first"`, `</posts?page=2&per_page=10&q=go>; rel="prev"`, `</posts?page=3&per_page=10&q=go>; rel="last"`}, ""},
+		{"/posts?per_page=1000", "", 1, 0, 25, 200, []string{`</posts?page=1&per_page=100>; rel="first"`, `</posts?page=1&per_page=100>; rel="last"`}, ""},
+		{"/posts", "items=10-14", 3, 10, 5, 206, []string{`</posts?page=1&per_page=5>; rel="first"`, `</posts?page=2&per_page=5>; rel="prev"`, `</posts?page=4&per_page=5>; rel="next"`, `</posts?page=5&per_page=5>; rel="last"`}, "items 10-14/25"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", tt.Target, nil)
+		if tt.Range != "" {
+			req.Header.Set("Range", tt.Range)
+		}
+		w := httptest.NewRecorder()
+		ctx := &Context{Request: req, ResponseWriter: w}
+		page := Paginate(ctx, 25, 10)
+		if page.Number != tt.Number || page.Offset != tt.Offset || page.Limit != tt.Limit || page.Status() != tt.Status {
+			t.Errorf("%d: expected page %d offset %d limit %d status %d, got %+v", i, tt.Number, tt.Offset, tt.Limit, tt.Status, page)
+		}
+		if links := w.Header()["Link"]; strings.Join(links, ",") != strings.Join(tt.Links, ",") {
+			t.Errorf("%d: expected links %v, got %v", i, tt.Links, links)
+		}
+		if w.Header().Get("X-Total-Count") != "25" || w.Header().Get("Content-Range") != tt.ContentRange {
+			t.Errorf("%d: expected headers, got %v", i, w.Header())
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+)
+
+// Readier is implemented by Resourcer objects that need time to initialize
+// before they can serve requests; such as warming up a cache or waiting for
+// a database migration.
+type Readier interface {
+	// Ready returns nil if the resource can serve requests, or an error
+	// explaining why not. It should be fast, it may be called per request.
+	Ready() error
+}
+
+// ReadyDetails are the details of a 503 response for a resource that is not ready.
+type ReadyDetails struct {
+	Resource string `json:"resource"`
+	Reason   string `json:"reason"`
+}
+
+// Ready checks the readiness of all the service resources that implement Readier.
+// Returns nil if all are ready, or a StatusError with a list of ReadyDetails
+// for the resources that are not.
+func (svc *Service) Ready() error {
+	var details []*ReadyDetails
+	for _, res := range svc.resources {
+		readier, ok := res.collection.(Readier)
+		if !ok {
+			continue
+		}
+		if err := readier.Ready(); err != nil {
+			details = append(details, &ReadyDetails{Resource: res.name, Reason: err.Error()})
+		}
+	}
+	if details == nil {
+		return nil
+	}
+	return &StatusError{http.StatusServiceUnavailable, "The service is not ready.", details}
+}
+
+/*
+Readyz is a handler that responds to readiness probes. It responds with HTTP
+status 200-"OK" if all resources are ready, or 503-"Service Unavailable" with
+the resources that are not ready.
+
+	svc.Root().GET("readyz", svc.Readyz)
+*/
+func (svc *Service) Readyz(ctx *Context) {
+	if err := svc.Ready(); err != nil {
+		e := err.(*StatusError)
+		ctx.Header().Set("Retry-After", "5")
+		ctx.Error(e.Code, e.Message, e.Details)
+		return
+	}
+	ctx.Respond(map[string]string{"status": "ready"})
+}
+
+// readyHandler is a filter that responds with HTTP status 503-"Service Unavailable"
+// while the resource is not ready, if the service ReadyGate is enabled.
+func (r *Resource) readyHandler(next HandlerFunc) HandlerFunc {
+	readier, ok := r.collection.(Readier)
+	if !ok {
+		return next
+	}
+	return func(ctx *Context) {
+		if r.service.ReadyGate {
+			if err := readier.Ready(); err != nil {
+				ctx.Header().Set("Retry-After", "5")
+				ctx.Error(errNotReady.Code, errNotReady.Message, &ReadyDetails{Resource: r.name, Reason: err.Error()})
+				return
+			}
+		}
+		next(ctx)
+	}
+}
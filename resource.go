@@ -57,12 +57,27 @@ type CRUD interface {
 
 // Resource is an object that implements Resourcer; serves requests for a resource.
 type Resource struct {
-	service    *Service    // service points to the service this resource belongs
-	name       string      // name of this resource, derived from collection
-	path       string      // path is the URI to this resource
-	collection interface{} // the object that implements Resourcer; a collection
-	links      []*Link     // links contains all the relation links
-	filters    []Filter    // list of resource-level filters
+	service    *Service           // service points to the service this resource belongs
+	name       string             // name of this resource, derived from collection
+	path       string             // path is the URI to this resource
+	collection interface{}        // the object that implements Resourcer; a collection
+	links      []*Link            // links contains all the relation links
+	filters    []Filter           // list of resource-level filters
+	last       *routeEntry        // last route added, see Name
+	host       *Host              // virtual host, nil for all hosts
+	version    *APIVersion        // API version, nil if not versioned
+	hidden     bool               // hidden from the service index, see Hidden
+	scopes     []string           // auth scopes needed to see it in the index, see Scopes
+	encoders   map[string]Encoder // resource encoders, see UseEncoder
+	allow      []string           // allowed media types, see AllowOnly
+}
+
+// router returns the routing engine of the resource, the host or service router.
+func (r *Resource) router() Router {
+	if r.host != nil {
+		return r.host.router
+	}
+	return r.service.router
 }
 
 // Path similar to Service.Path but returns the path to this resource.
@@ -71,12 +86,55 @@ func (r *Resource) Path(absolute bool) string {
 	return r.service.Path(absolute) + strings.TrimPrefix(r.path[len(r.service.Path(false))-1:], "/")
 }
 
+// Hidden hides the resource from the service Index, such as internal or admin
+// resources. The resource routes are not affected.
+// Returns the resource itself for chaining.
+func (r *Resource) Hidden() *Resource {
+	r.hidden = true
+	return r
+}
+
+// Scopes lists the resource in the service Index only to requesters with all
+// of the auth 'scopes'. Auth filters pass the scopes of the requester in
+// "auth.scopes", as []string. Access to the resource is not affected, it must
+// be protected with auth filters.
+// Returns the resource itself for chaining.
+func (r *Resource) Scopes(scopes ...string) *Resource {
+	r.scopes = scopes
+	return r
+}
+
+// visible returns true if the resource can be listed in the service Index for
+// the request in 'ctx'.
+func (r *Resource) visible(ctx *Context) bool {
+	if r.hidden {
+		return false
+	}
+	if len(r.scopes) == 0 {
+		return true
+	}
+	granted, _ := ctx.Get("auth.scopes").([]string)
+	for _, scope := range r.scopes {
+		found := false
+		for i := range granted {
+			if granted[i] == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // NotImplemented is a handler used to send a response when a resource route is
 // not yet implemented.
 //		// Route "GET /myresource/apikey" => 501 Not Implemented
 //		myresource.GET("apikey", myresource.NotImplemented)
 func (r *Resource) NotImplemented(ctx *Context) {
-	ctx.Error(http.StatusNotImplemented, "That route is not implemented.")
+	ctx.Error(errNotImplemented.Code, errNotImplemented.Message)
 }
 
 // MethodNotAllowed is a handler used to send a response when a method is not
@@ -84,27 +142,63 @@ func (r *Resource) NotImplemented(ctx *Context) {
 //		// Route "PATCH /users/profile" => 405 Method Not Allowed
 //		users.PATCH("profile", users.MethodNotAllowed)
 func (r *Resource) MethodNotAllowed(ctx *Context) {
-	ctx.Header().Set("Allow", r.service.router.PathMethods(ctx.Request.URL.Path))
-	ctx.Error(http.StatusMethodNotAllowed, "The method "+ctx.Request.Method+" is not allowed.")
+	ctx.Header().Set("Allow", r.router().PathMethods(ctx.Request.URL.Path))
+	ctx.Error(errMethodNotAllowed.Code, fmt.Sprintf(ctx.Localize(errMethodNotAllowed.Message), ctx.Request.Method))
 }
 
 // OptionsHandler responds to OPTION requests. It returns an Allow header listing
 // the methods allowed for an URI. If the URI is the Service's path then it returns information
-// about the service.
+// about the service. If the resource routes are documented, it returns the routes.
+// If the URI allows PATCH or POST, the Accept-Patch and Accept-Post headers list the
+// media types of the payloads the resource can decode. See: Describe, UseEncoder
 func (r *Resource) OptionsHandler(ctx *Context) {
-	methods := r.service.router.PathMethods(ctx.Request.URL.Path)
+	methods := r.router().PathMethods(ctx.Request.URL.Path)
 	ctx.Header().Set("Allow", methods)
-	if strings.Contains(methods, "PATCH") {
-		// FIXME: this is wrong! perhaps we need Patch.ContentType() or even Service.encoders keys.
-		ctx.Header().Set("Accept-Patch", ctx.Get("content.encoding").(string))
+	if strings.Contains(methods, "PATCH") || strings.Contains(methods, "POST") {
+		accept := strings.Join(mediaTypes(r.encoderSet()), ", ")
+		if strings.Contains(methods, "PATCH") {
+			ctx.Header().Set("Accept-Patch", accept)
+		}
+		if strings.Contains(methods, "POST") {
+			ctx.Header().Set("Accept-Post", accept)
+		}
 	}
 	if options, ok := r.collection.(Optioner); ok {
 		options.Options(ctx)
 		return
 	}
+	if routes := r.describedRoutes(); routes != nil {
+		ctx.Respond(routes)
+		return
+	}
 	ctx.WriteHeader(http.StatusNoContent)
 }
 
+// describedRoutes returns the routes of the resource, if any of them is
+// documented or has examples; or nil otherwise. See: Describe, Example
+func (r *Resource) describedRoutes() []RouteInfo {
+	r.service.routesMu.RLock()
+	defer r.service.routesMu.RUnlock()
+	var routes []RouteInfo
+	described := false
+	for _, e := range r.service.routes {
+		if e.res != r {
+			continue
+		}
+		route := RouteInfo{Method: e.method, Path: e.path, Params: pathParams(e.path), Host: e.host}
+		if route.Path == "" {
+			route.Path = "/"
+		}
+		e.describe(&route)
+		routes = append(routes, route)
+		described = described || route.Title != "" || route.Description != "" || route.Examples != nil
+	}
+	if !described {
+		return nil
+	}
+	return routes
+}
+
 /*
 Route adds a resource route (method + path) and its handler to the router.
 
@@ -117,29 +211,134 @@ resource-level filters will run before route-level filters.
 Returns the resource itself for chaining.
 */
 func (r *Resource) Route(method, path string, h HandlerFunc, filters ...Filter) *Resource {
-	handler := r.relationHandler(h)
+	handler, usable := r.routeHandler(h, filters)
+
+	if r.service.RouteConflicts {
+		if err := r.routeConflict(strings.ToUpper(method), r.path+"/"+path); err != nil {
+			if r.service.Strict {
+				panic(err)
+			}
+			r.service.log.Warnf("%s", err)
+		}
+	}
+	r.router().AddRoute(strings.ToUpper(method), r.path+"/"+path, handler)
+	r.addRouteEntry(strings.ToUpper(method), r.path+"/"+path, usable)
+
+	return r
+}
+
+/*
+RouteE is like Route, but returns an error instead of panicking, so routes
+composed from user configuration can be checked. The errors are:
+ErrRoutePattern if a PSE is not valid, and ErrRouteConflict if the route
+conflicts with another route and Service.RouteConflicts is true.
+The route is not added if there is an error.
+
+	for _, rc := range config.Routes {
+		if err := res.RouteE(rc.Method, rc.Path, handlers[rc.Handler]); err != nil {
+			return err
+		}
+	}
+*/
+func (r *Resource) RouteE(method, path string, h HandlerFunc, filters ...Filter) error {
+	for _, pseg := range strings.Split(path, "/") {
+		if isPattern(pseg) {
+			if _, err := compileSegment(pseg); err != nil {
+				return err
+			}
+		}
+	}
+	if r.service.RouteConflicts {
+		if err := r.routeConflict(strings.ToUpper(method), r.path+"/"+path); err != nil {
+			return err
+		}
+	}
+	handler, usable := r.routeHandler(h, filters)
+	r.router().AddRoute(strings.ToUpper(method), r.path+"/"+path, handler)
+	r.addRouteEntry(strings.ToUpper(method), r.path+"/"+path, usable)
+	return nil
+}
+
+// routeHandler returns handler 'h' wrapped by the resource filters and the
+// route 'filters' that are usable.
+func (r *Resource) routeHandler(h HandlerFunc, filters []Filter) (HandlerFunc, []Filter) {
+	handler := r.relationHandler(r.readyHandler(h))
 
 	// route-specific filters
-	r.attachFilters(handler, filters...)
+	usable := make([]Filter, 0, len(filters))
+	for i := range filters {
+		if l, ok := filters[i].(LimitedFilter); ok && !l.RunIn(r.service.Router()) {
+			r.service.ignore(fmt.Errorf("%w for route: %T", ErrFilterNotUsable, filters[i]))
+			continue
+		}
+		usable = append(usable, filters[i])
+	}
+	handler = r.attachFilters(handler, usable...)
 
 	// inherited resource filters
-	r.attachFilters(handler, r.filters...)
+	handler = r.attachFilters(handler, r.filters...)
 
-	r.service.router.AddRoute(strings.ToUpper(method), r.path+"/"+path, handler)
+	return r.contentHandler(handler), usable
+}
 
-	return r
+/*
+RemoveRoute removes the resource route (method + path), as added with Route.
+Requests to the route get a 404-"Not Found" or 405-"Method Not Allowed" response,
+until the route is added again.
+
+	// maintenance window
+	orders.RemoveRoute("POST", "")
+	...
+	orders.POST("", orders.Create)
+
+Returns ErrRouteNotFound if there is no such route, or ErrRouterImmutable if
+the service router doesn't implement MutableRouter.
+*/
+func (r *Resource) RemoveRoute(method, path string) error {
+	mr, ok := r.router().(MutableRouter)
+	if !ok {
+		return ErrRouterImmutable
+	}
+	if err := mr.RemoveRoute(strings.ToUpper(method), r.path+"/"+path); err != nil {
+		return err
+	}
+	r.removeRouteEntry(strings.ToUpper(method), r.path+"/"+path)
+	return nil
 }
 
-func (r *Resource) attachFilters(h HandlerFunc, filters ...Filter) {
-	if filters == nil {
-		return
+/*
+ReplaceRoute atomically replaces the handler of the resource route (method + path),
+as added with Route. The new handler is wrapped by the resource filters and
+'filters', like Route does.
+
+	// answer with 503 during maintenance, then restore.
+	orders.ReplaceRoute("POST", "", maintenance)
+	...
+	orders.ReplaceRoute("POST", "", orders.Create)
+
+Returns ErrRouteNotFound if there is no such route, or ErrRouterImmutable if
+the service router doesn't implement MutableRouter.
+*/
+func (r *Resource) ReplaceRoute(method, path string, h HandlerFunc, filters ...Filter) error {
+	mr, ok := r.router().(MutableRouter)
+	if !ok {
+		return ErrRouterImmutable
+	}
+	handler, usable := r.routeHandler(h, filters)
+	if err := mr.ReplaceRoute(strings.ToUpper(method), r.path+"/"+path, handler); err != nil {
+		return err
 	}
+	// keep the route name and documentation, if any.
+	r.replaceRouteEntry(strings.ToUpper(method), r.path+"/"+path, usable)
+	return nil
+}
+
+// attachFilters returns handler 'h' wrapped by 'filters', which run in order.
+func (r *Resource) attachFilters(h HandlerFunc, filters ...Filter) HandlerFunc {
 	for i := len(filters) - 1; i >= 0; i-- {
-		if l, ok := filters[i].(LimitedFilter); ok && !l.RunIn(r.service.Router) {
-			continue
-		}
-		h = filters[i].Run(h)
+		h = runFilter(filters[i], h)
 	}
+	return h
 }
 
 // DELETE is a convenient alias to Route using DELETE as method
@@ -179,7 +378,8 @@ handlers, but those that aren't implemented should respond with
 "Method Not Allowed" or "Not Implemented".
 
 pse is a route path segment expression (PSE) - see Router for details. If pse is
-empty string "", then CRUD() will guess a value or use "{item}".
+empty string "", then CRUD() will use the singular of the resource name, such
+as "{status}" for "statuses", or "{item}". See: Singular
 
 	type Jobs struct{}
 
@@ -209,8 +409,8 @@ func (r *Resource) CRUD(pse string) *Resource {
 	coll := r.collection.(CRUD)
 
 	if pse == "" {
-		// use resource collection name
-		pse = "{" + strings.TrimRight(r.name, "s") + "}"
+		// use the singular of the resource collection name
+		pse = "{" + Singular(r.name) + "}"
 		if pse == "{}" {
 			pse = "{item}" // give up
 		}
@@ -243,6 +443,13 @@ This function will panic if it can't determine the name of a collection
 through reflection.
 */
 func (svc *Service) Resource(collection Resourcer, filters ...Filter) *Resource {
+	return svc.resource(nil, "", collection, filters)
+}
+
+// resource creates a new Resource object for virtual host 'host', or for all
+// hosts if nil. The resource path is prefixed with 'prefix', such as a version.
+// See: Resource
+func (svc *Service) resource(host *Host, prefix string, collection Resourcer, filters []Filter) *Resource {
 	if collection == nil {
 		panic("relax: Resource collection cannot be nil")
 	}
@@ -262,17 +469,18 @@ func (svc *Service) Resource(collection Resourcer, filters ...Filter) *Resource
 	res := &Resource{
 		service:    svc,
 		name:       name,
-		path:       svc.Path(false) + name,
+		path:       svc.Path(false) + prefix + name,
 		collection: collection,
 		links:      make([]*Link, 0),
 		filters:    nil,
+		host:       host,
 	}
 
 	// user-specified filters
 	if filters != nil {
 		for i := range filters {
 			if l, ok := filters[i].(LimitedFilter); ok && !l.RunIn(res) {
-				svc.Logf("relax: Filter not usable for resource: %T", filters[i])
+				svc.ignore(fmt.Errorf("%w for resource %q: %T", ErrFilterNotUsable, name, filters[i]))
 				continue
 			}
 			res.filters = append(res.filters, filters[i])
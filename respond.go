@@ -0,0 +1,144 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Redirect sends a redirection response to 'url', with the status 'code' and the
+Location header. The URL may be relative to the request path.
+
+	ctx.Redirect(http.StatusSeeOther, "/v1/orders/"+id)
+
+This function will panic if 'code' is not a redirection status (3xx).
+*/
+func (ctx *Context) Redirect(code int, url string) {
+	if code < 300 || code > 399 {
+		panic("relax: Redirect with non-redirection status " + strconv.Itoa(code))
+	}
+	ctx.Header().Set("Location", url)
+	ctx.Header().Del("Content-Type")
+	ctx.WriteHeader(code)
+}
+
+// NoContent sends a response with status 204-"No Content", such as after a
+// successful DELETE.
+func (ctx *Context) NoContent() {
+	ctx.WriteHeader(http.StatusNoContent)
+}
+
+/*
+Created sends a response with status 201-"Created" for a new resource item
+at 'location', set in the Location header. 'v' is the item representation,
+encoded like Respond does; if nil the response has no content.
+
+	func (u *Users) Create(ctx *relax.Context) {
+		...
+		ctx.Created(u.Path(true)+"/"+user.ID, user)
+	}
+
+Returns the error of Respond, if any.
+*/
+func (ctx *Context) Created(location string, v interface{}) error {
+	ctx.Header().Set("Location", location)
+	if v == nil {
+		ctx.Header().Del("Content-Type")
+		ctx.WriteHeader(http.StatusCreated)
+		return nil
+	}
+	return ctx.Respond(v, http.StatusCreated)
+}
+
+// Accepted sends a response with status 202-"Accepted", for requests that
+// will be completed later. 'statusURL' is the location where the client can
+// check the status of the request, set in the Location header.
+func (ctx *Context) Accepted(statusURL string) {
+	ctx.Header().Set("Location", statusURL)
+	ctx.Header().Del("Content-Type")
+	ctx.WriteHeader(http.StatusAccepted)
+}
+
+/*
+RespondCached is like Respond, but sets the cache validators of the response
+'v': the entity tag 'etag' and the modification time 'lastMod', in the ETag
+and Last-Modified headers. The etag is quoted if needed, a weak etag keeps its
+"W/" prefix. Empty etag or zero lastMod are not set.
+
+For GET and HEAD requests with a matching If-None-Match, or If-Modified-Since
+not before lastMod, the response has status 304-"Not Modified" without
+content. So handlers can validate with their own data, such as a version
+column, instead of encoding the whole response:
+
+	func (u *Users) Read(ctx *relax.Context) {
+		user := u.find(ctx.PathValues.Get("id"))
+		ctx.RespondCached(user, strconv.Itoa(user.Version), user.UpdatedAt)
+	}
+
+Other methods are always answered with 'v': their preconditions must be checked
+before the change is made, not after.
+The etag filter keeps the ETag set, and doesn't hash the content.
+Returns the error of Respond, if any.
+*/
+func (ctx *Context) RespondCached(v interface{}, etag string, lastMod time.Time, code ...int) error {
+	if etag != "" {
+		etag = quoteETag(etag)
+		ctx.Header().Set("ETag", etag)
+	}
+	if !lastMod.IsZero() {
+		lastMod = lastMod.UTC().Truncate(time.Second)
+		ctx.Header().Set("Last-Modified", lastMod.Format(http.TimeFormat))
+	}
+
+	if ctx.Request.Method != "GET" && ctx.Request.Method != "HEAD" {
+		return ctx.Respond(v, code...)
+	}
+	if inm := ctx.Request.Header.Get("If-None-Match"); inm != "" {
+		if matchETag(inm, etag) {
+			ctx.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	} else if ims := ctx.Request.Header.Get("If-Modified-Since"); ims != "" && !lastMod.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastMod.After(t) {
+			ctx.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	return ctx.Respond(v, code...)
+}
+
+// quoteETag returns 'etag' as a quoted entity tag, keeping its weak prefix.
+func quoteETag(etag string) string {
+	weak := strings.HasPrefix(etag, "W/")
+	if weak {
+		etag = etag[2:]
+	}
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		etag = strconv.Quote(etag)
+	}
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// matchETag returns true if the If-None-Match value 'inm' matches 'etag',
+// using weak comparison. "*" matches any etag.
+func matchETag(inm, etag string) bool {
+	if strings.TrimSpace(inm) == "*" {
+		return etag != ""
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(inm, ",") {
+		if etag != "" && strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
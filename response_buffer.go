@@ -8,9 +8,17 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"os"
 	"sync"
 )
 
+// SpillSize is the content size in bytes after which a ResponseBuffer moves
+// its content to a temporary file, so very large responses, such as exports,
+// aren't kept in memory. If the file can't be created, the content stays in
+// memory. Zero disables spilling.
+// Default: 32MB
+var SpillSize int64 = 32 << 20
+
 /*
 ResponseBuffer implements http.ResponseWriter, but redirects all
 writes and headers to a buffer. This allows to inspect the response before
@@ -19,12 +27,21 @@ Flush or WriteTo to send it.
 
 ResponseBuffer also implements io.WriteTo to write data to any object that
 implements io.Writer.
+
+Content larger than SpillSize is moved to a temporary file, transparently.
+Use Reader to read the content without loading a spilled file in memory.
+The methods of ResponseBuffer read and write spilled content; other methods
+of the embedded bytes.Buffer, such as ReadString or Cap, only see the content
+that is in memory.
 */
 type ResponseBuffer struct {
 	bytes.Buffer
 	wroteHeader bool
 	status      int
 	header      http.Header
+	file        *os.File // spill file, if any
+	size        int64    // content size in the spill file
+	off         int64    // read offset in the spill file
 }
 
 // Header returns the buffered header map.
@@ -32,12 +49,180 @@ func (rb *ResponseBuffer) Header() http.Header {
 	return rb.header
 }
 
-// Write writes the data to the buffer.
+// Write writes the data to the buffer, or to the spill file if the content
+// is larger than SpillSize.
 // Returns the number of bytes written or error on failure.
 func (rb *ResponseBuffer) Write(b []byte) (int, error) {
+	if rb.file == nil && SpillSize > 0 && int64(rb.Buffer.Len()+len(b)) > SpillSize {
+		rb.spill()
+	}
+	if rb.file != nil {
+		n, err := rb.file.WriteAt(b, rb.size)
+		rb.size += int64(n)
+		return n, err
+	}
 	return rb.Buffer.Write(b)
 }
 
+// WriteString is like Write, but writes the contents of string 's'.
+func (rb *ResponseBuffer) WriteString(s string) (int, error) {
+	return rb.Write([]byte(s))
+}
+
+// WriteByte is like Write, but writes the byte 'c'.
+func (rb *ResponseBuffer) WriteByte(c byte) error {
+	_, err := rb.Write([]byte{c})
+	return err
+}
+
+// WriteRune is like Write, but writes the UTF-8 encoding of rune 'r'.
+func (rb *ResponseBuffer) WriteRune(r rune) (int, error) {
+	return rb.Write([]byte(string(r)))
+}
+
+// Read reads the next len(p) bytes of content, or until the buffer is empty.
+// Returns the number of bytes read, or io.EOF if the buffer is empty.
+func (rb *ResponseBuffer) Read(p []byte) (int, error) {
+	if rb.file == nil {
+		return rb.Buffer.Read(p)
+	}
+	if rb.off >= rb.size {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > rb.size-rb.off {
+		p = p[:rb.size-rb.off]
+	}
+	n, err := rb.file.ReadAt(p, rb.off)
+	rb.off += int64(n)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadByte reads and returns the next byte of content, or io.EOF if the buffer
+// is empty.
+func (rb *ResponseBuffer) ReadByte() (byte, error) {
+	if rb.file == nil {
+		return rb.Buffer.ReadByte()
+	}
+	var b [1]byte
+	if _, err := rb.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Next returns the next 'n' bytes of content, or all of it if it's shorter,
+// as if they were read.
+func (rb *ResponseBuffer) Next(n int) []byte {
+	if rb.file == nil {
+		return rb.Buffer.Next(n)
+	}
+	if n > rb.Len() {
+		n = rb.Len()
+	}
+	b := make([]byte, n)
+	n, _ = rb.Read(b)
+	return b[:n]
+}
+
+// Truncate discards all but the first 'n' unread bytes of content. It panics
+// if 'n' is negative or greater than the length of the content.
+func (rb *ResponseBuffer) Truncate(n int) {
+	if rb.file == nil {
+		rb.Buffer.Truncate(n)
+		return
+	}
+	if n < 0 || n > rb.Len() {
+		panic("relax: ResponseBuffer truncation out of range")
+	}
+	rb.size = rb.off + int64(n)
+}
+
+// String returns the buffered content as a string. If the content was
+// spilled, the file is read in memory.
+func (rb *ResponseBuffer) String() string {
+	if rb == nil {
+		return "<nil>"
+	}
+	return string(rb.Bytes())
+}
+
+// ReadFrom implements io.ReaderFrom, it writes the data from 'r' until EOF.
+// Returns the number of bytes written or error on failure.
+func (rb *ResponseBuffer) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{rb}, r)
+}
+
+// spill moves the buffered content to a temporary file.
+func (rb *ResponseBuffer) spill() {
+	f, err := os.CreateTemp("", "relax-response-")
+	if err != nil {
+		return
+	}
+	n, err := f.Write(rb.Buffer.Bytes())
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	rb.file, rb.size = f, int64(n)
+	rb.Buffer.Reset()
+}
+
+// removeFile closes and removes the spill file, if any.
+func (rb *ResponseBuffer) removeFile() {
+	if rb.file == nil {
+		return
+	}
+	rb.file.Close()
+	os.Remove(rb.file.Name())
+	rb.file, rb.size, rb.off = nil, 0, 0
+}
+
+// Spilled returns true if the content was moved to a temporary file.
+func (rb *ResponseBuffer) Spilled() bool {
+	return rb.file != nil
+}
+
+// Len returns the size of the unread buffered content.
+func (rb *ResponseBuffer) Len() int {
+	if rb.file != nil {
+		return int(rb.size - rb.off)
+	}
+	return rb.Buffer.Len()
+}
+
+// Bytes returns the buffered content. If the content was spilled, the file
+// is read in memory; use Reader instead.
+func (rb *ResponseBuffer) Bytes() []byte {
+	if rb.file != nil {
+		b := make([]byte, rb.size-rb.off)
+		n, _ := rb.file.ReadAt(b, rb.off)
+		return b[:n]
+	}
+	return rb.Buffer.Bytes()
+}
+
+// Reader returns a reader of the buffered content, that doesn't change the
+// buffer. It can be used to hash or inspect spilled content.
+func (rb *ResponseBuffer) Reader() io.ReadSeeker {
+	if rb.file != nil {
+		return io.NewSectionReader(rb.file, rb.off, rb.size-rb.off)
+	}
+	return bytes.NewReader(rb.Buffer.Bytes())
+}
+
+// Reset empties the buffer and removes the spill file, if any.
+func (rb *ResponseBuffer) Reset() {
+	rb.removeFile()
+	rb.Buffer.Reset()
+}
+
 // WriteHeader stores the value of status code.
 func (rb *ResponseBuffer) WriteHeader(code int) {
 	if rb.wroteHeader {
@@ -61,6 +246,10 @@ func (rb *ResponseBuffer) Status() int {
 // this call.
 // Returns the number of bytes written or error on failure.
 func (rb *ResponseBuffer) WriteTo(w io.Writer) (int64, error) {
+	if rb.file != nil {
+		defer rb.removeFile()
+		return io.Copy(w, io.NewSectionReader(rb.file, rb.off, rb.size-rb.off))
+	}
 	return rb.Buffer.WriteTo(w)
 }
 
@@ -112,7 +301,11 @@ func NewResponseBuffer(w http.ResponseWriter) *ResponseBuffer {
 // arent used. The values of the ResponseBuffer are reset and must be
 // re-initialized.
 func (rb *ResponseBuffer) Free() {
-	rb.Buffer.Reset()
+	rb.Reset()
+	// don't keep the memory of very large responses in the pool.
+	if rb.Cap() > 2*bufferClasses[len(bufferClasses)-1] {
+		rb.Buffer = bytes.Buffer{}
+	}
 	rb.wroteHeader = false
 	rb.status = 0
 	rb.header = nil
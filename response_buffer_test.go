@@ -0,0 +1,89 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestResponseBufferSpill(t *testing.T) {
+	defer func(size int64) { SpillSize = size }(SpillSize)
+	SpillSize = 16
+
+	w := httptest.NewRecorder()
+	rb := NewResponseBuffer(w)
+	rb.Write([]byte("0123456789"))
+	if rb.Spilled() {
+		t.Fatal("expected buffer in memory")
+	}
+	rb.Write([]byte("0123456789"))
+	if !rb.Spilled() {
+		t.Fatal("expected buffer spilled to file")
+	}
+	name := rb.file.Name()
+
+	if rb.Len() != 20 {
+		t.Errorf("expected length 20, got %d", rb.Len())
+	}
+	b, _ := io.ReadAll(rb.Reader())
+	if !bytes.Equal(b, rb.Bytes()) || string(b) != "01234567890123456789" {
+		t.Errorf("unexpected content %q", b)
+	}
+
+	rb.WriteHeader(201)
+	if _, err := rb.Flush(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != 201 || w.Body.String() != "01234567890123456789" {
+		t.Errorf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(name); err == nil {
+		t.Errorf("expected spill file %s removed", name)
+	}
+}
+
+func TestResponseBufferSpillRead(t *testing.T) {
+	defer func(size int64) { SpillSize = size }(SpillSize)
+	SpillSize = 8
+
+	rb := NewResponseBuffer(httptest.NewRecorder())
+	defer rb.Free()
+	rb.WriteString("0123456789")
+	rb.WriteByte('a')
+	rb.WriteRune('b')
+	if !rb.Spilled() || rb.String() != "0123456789ab" || rb.Buffer.Len() != 0 {
+		t.Fatalf("expected spilled content, got %v %q", rb.Spilled(), rb.String())
+	}
+
+	if c, err := rb.ReadByte(); c != '0' || err != nil {
+		t.Errorf("expected byte '0', got %q %v", c, err)
+	}
+	if b := rb.Next(3); string(b) != "123" {
+		t.Errorf("expected next 123, got %q", b)
+	}
+	p := make([]byte, 4)
+	if n, err := rb.Read(p); n != 4 || err != nil || string(p) != "4567" {
+		t.Errorf("expected read 4567, got %d %v %q", n, err, p)
+	}
+	rb.Truncate(2)
+	if rb.Len() != 2 || rb.String() != "89" {
+		t.Errorf("expected truncated 89, got %d %q", rb.Len(), rb.String())
+	}
+	b, _ := io.ReadAll(rb)
+	if string(b) != "89" {
+		t.Errorf("expected rest 89, got %q", b)
+	}
+	if _, err := rb.Read(p); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+	rb.WriteString("cd")
+	if rb.String() != "cd" {
+		t.Errorf("expected written cd, got %q", rb.String())
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// RouteCacher is implemented by routers that can cache the resolution of
+// request paths, such as the default router. See: Service.CacheRoutes
+type RouteCacher interface {
+	// CacheRoutes sets the maximum number of resolved paths kept in the
+	// cache, zero disables the cache. The cache is emptied when routes change.
+	CacheRoutes(size int)
+}
+
+// routeCache is a bounded LRU cache of resolved routes, keyed by method and path.
+type routeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+// cachedRoute is a resolved route: its handler, path pattern and PSE submatches.
+type cachedRoute struct {
+	key     string
+	handler HandlerFunc
+	pattern string
+	matches [][]string
+}
+
+// newRouteCache returns a new routeCache for 'size' routes.
+func newRouteCache(size int) *routeCache {
+	return &routeCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// get returns the route cached for 'key', if any.
+func (c *routeCache) get(key string) (*cachedRoute, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedRoute), true
+}
+
+// put caches route 'cr', removing the least recently used route if full.
+func (c *routeCache) put(cr *cachedRoute) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[cr.key]; ok {
+		e.Value = cr
+		c.order.MoveToFront(e)
+		return
+	}
+	if c.order.Len() >= c.size {
+		last := c.order.Back()
+		delete(c.entries, last.Value.(*cachedRoute).key)
+		c.order.Remove(last)
+	}
+	c.entries[cr.key] = c.order.PushFront(cr)
+}
+
+// clear removes all the cached routes.
+func (c *routeCache) clear() {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element, c.size)
+	c.order.Init()
+	c.mu.Unlock()
+}
+
+// CacheRoutes implements RouteCacher. Routes without PSE's are not cached,
+// they are found in constant time.
+func (r *trieRegexpRouter) CacheRoutes(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = nil
+	if size > 0 {
+		r.cache = newRouteCache(size)
+	}
+}
+
+/*
+CacheRoutes enables a bounded LRU cache of size 'size' in the service and host
+routers, that keeps the handlers and path values of the most requested paths.
+It saves the PSE regexp matching of services with many requests to routes with
+PSE's. The cache is emptied when routes are added or removed. Zero disables
+the cache.
+
+	svc.CacheRoutes(10000)
+
+If the router doesn't implement RouteCacher, the call is ignored.
+Returns the service itself, for chaining.
+*/
+func (svc *Service) CacheRoutes(size int) *Service {
+	svc.routeCacheSize = size
+	if err := cacheRoutes(svc.router, size); err != nil {
+		svc.ignore(err)
+	}
+	for _, h := range svc.hosts {
+		cacheRoutes(h.router, size)
+	}
+	return svc
+}
+
+// cacheRoutes sets the cache size of 'router', if it's a RouteCacher.
+func cacheRoutes(router Router, size int) error {
+	rc, ok := router.(RouteCacher)
+	if !ok {
+		return fmt.Errorf("relax: Router %T doesn't implement RouteCacher, cache ignored", router)
+	}
+	rc.CacheRoutes(size)
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 /*
@@ -40,12 +41,33 @@ for a value and varname is the name to give the variable that matches the value.
 
 	"{uuid:varname}" // matches an UUID.
 
+	"{ulid:varname}" // matches an ULID.
+
+	"{ip:varname}" // matches an IPv4 or IPv6 address.
+
+	"{email:varname}" // matches an email address.
+
+	"{slug:varname}" // matches a lowercase slug, words joined by dashes.
+
+	"{semver:varname}" // matches a semantic version, with optional "v" prefix.
+
+	"{cidr:varname}" // matches an IP network in CIDR notation, with "-" instead of "/".
+
 	"{varname}" // catch-all; matches anything. it may overlap other matches.
 
+	"{path:varname}" // matches the rest of the path, with slashes. Only as the last segment.
+
 	"*" // translated into "{wild}"
 
 	"{re:pattern}" // custom regexp pattern.
 
+More PSE types can be added with RegisterType.
+
+Path segments are matched by precedence, regardless of the order routes are added:
+plain segments first, then typed PSE's, then catch-all PSE's ("{varname}" and "*").
+If a path doesn't lead to a route, the next match is tried. PSE's with the same
+precedence are tried in the order added, see Service.RouteConflicts.
+
 Some sample routes supported by trieRegexpRouter:
 
 	GET /api/users/@{word:name}
@@ -69,11 +91,16 @@ type Router interface {
 	// FindHandler should match request parameters to an existing resource handler and
 	// return it. If no match is found, it should return an StatusError error which will
 	// be sent to the requester. The default errors ErrRouteNotFound and
-	// ErrRouteBadMethod cover the default cases.
+	// ErrRouteBadMethod cover the default cases; ErrRouteBadMethod is for paths
+	// that match a route of another method.
 	FindHandler(string, string, *url.Values) (HandlerFunc, error)
 
 	// AddRoute is used to create new routes to resources. It expects the HTTP method
 	// (GET, POST, ...) followed by the resource path and the handler function.
+	// The default router's AddRoute is safe for concurrent use, routes may be
+	// added while requests are served. So are the routes added, removed or
+	// replaced through a Resource, as long as each Resource is changed by one
+	// goroutine at a time.
 	AddRoute(string, string, HandlerFunc)
 
 	// PathMethods returns a comma-separated list of HTTP methods that are matched
@@ -81,6 +108,113 @@ type Router interface {
 	PathMethods(string) string
 }
 
+/*
+MutableRouter is implemented by routers that can change routes at runtime,
+such as the default router. It allows disabling routes during maintenance
+windows and enabling them again without restarting the service.
+
+	if mr, ok := svc.Router().(relax.MutableRouter); ok {
+		mr.RemoveRoute("POST", "/api/v1/orders")
+	}
+
+See also: Resource.RemoveRoute and Resource.ReplaceRoute
+*/
+type MutableRouter interface {
+	Router
+
+	// RemoveRoute removes the route (method + path), where path is the same
+	// used with AddRoute. Returns ErrRouteNotFound if there is no such route.
+	RemoveRoute(string, string) error
+
+	// ReplaceRoute atomically replaces the handler of the route (method + path).
+	// Requests are served by either the old or new handler, never neither.
+	// Returns ErrRouteNotFound if there is no such route.
+	ReplaceRoute(string, string, HandlerFunc) error
+}
+
+// RouteInfo describes a route, for documentation and reports.
+type RouteInfo struct {
+	// Method is the HTTP method of the route.
+	Method string `json:"method"`
+	// Path is the path pattern, with PSE's.
+	Path string `json:"path"`
+	// Params are the PSE's in the path, in order.
+	Params []ParamInfo `json:"params,omitempty"`
+	// Host is the virtual host of the route, empty for all hosts. See: Host
+	Host string `json:"host,omitempty"`
+	// Resource is the name of the resource that added the route, if known.
+	Resource string `json:"resource,omitempty"`
+	// Name is the route name, see Resource.Name.
+	Name string `json:"name,omitempty"`
+	// Title and Description document the route, see Resource.Describe.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Examples are sample responses keyed by status code, see Resource.Example.
+	Examples map[string]interface{} `json:"examples,omitempty"`
+}
+
+// ParamInfo describes a PSE in a route path.
+type ParamInfo struct {
+	// Name is the PSE variable name, empty for "{re:pattern}" PSE's.
+	Name string `json:"name"`
+	// Type is the PSE type, such as "uint" or "re". It's "any" for catch-all PSE's.
+	Type string `json:"type"`
+	// Description documents the PSE, see Resource.Param.
+	Description string `json:"description,omitempty"`
+}
+
+// CanonicalRouter is implemented by routers that can find the canonical path of
+// a request path, such as the default router. It's used by the service options
+// IgnoreCase and RedirectTrailingSlash.
+type CanonicalRouter interface {
+	Router
+
+	// CanonicalPath returns the path that matches a route of 'method' exactly,
+	// for request 'path': without a trailing slash, and if 'ignoreCase' is true,
+	// with the case of the route static segments. Returns false if there is
+	// no such route.
+	CanonicalPath(method, path string, ignoreCase bool) (string, bool)
+}
+
+// PathParam is a value matched by a PSE in the request path. See: Context.PathParams
+type PathParam struct {
+	// Name is the PSE variable name, or the name of a PSE part, such as
+	// "day_year" of "{date:day}". It's empty for unnamed regexp groups.
+	Name string
+	// Value is the matched value.
+	Value string
+	// Type is the PSE type, such as "uint" or "re". It's "any" for catch-all
+	// PSE's, and "matrix" for matrix parameters, see Service.MatrixParams.
+	Type string
+}
+
+// ParamsRouter is implemented by routers that return the path values in the
+// order matched, with their PSE types, such as the default router.
+type ParamsRouter interface {
+	Router
+
+	// FindParams is like FindHandler, but returns the path values in order.
+	// The values of FindHandler are numbered by their index in this list.
+	FindParams(method, path string) (HandlerFunc, []PathParam, error)
+}
+
+// PatternRouter is implemented by routers that can tell the path pattern of
+// the route that matches a request, such as the default router. The service
+// uses it to find the resource route of a request, see Context.RouteFilters.
+type PatternRouter interface {
+	// FindPattern returns the path of the route that matches (method + path),
+	// as added with AddRoute but without trailing slashes. The errors are the
+	// same as FindHandler.
+	FindPattern(method, path string) (string, error)
+}
+
+// RouteLister is implemented by routers that can list their routes, such as
+// the default router. See also: Service.Routes
+type RouteLister interface {
+	// Routes returns the routes added to the router.
+	Routes() []RouteInfo
+}
+
 // These are errors returned by the default routing engine. You are encouraged to
 // reuse them with your own Router.
 var (
@@ -91,34 +225,39 @@ var (
 	ErrRouteBadMethod = &StatusError{http.StatusMethodNotAllowed, "That method is not supported", nil}
 )
 
-// pathRegexpCache is a cache of all compiled regexp's so they can be reused.
-var pathRegexpCache = make(map[string]*regexp.Regexp)
-
 // trieRegexpRouter implements Router with a trie that can store regular expressions.
 // root points to the top of the tree from which all routes are searched and matched.
 // methods is a list of all the methods used in routes.
+// static is a table of the routes without PSE's, keyed by method and path; these
+// are matched with a single lookup before walking the trie.
+// exps is a cache of the compiled PSE regexp's, keyed by path segment, so they
+// can be reused. types are the PSE types of their groups, see groupTypes.
+// mu guards all of the above, so routes can be added while serving requests.
 type trieRegexpRouter struct {
+	mu      sync.RWMutex
 	root    *trieNode
 	methods []string
+	static  map[string]HandlerFunc
+	exps    map[string]*regexp.Regexp
+	types   map[string][]string
+	cache   *routeCache // resolved routes, nil if disabled. See CacheRoutes
 }
 
 // trieNode contains the routing information.
-// handler, if not nil, points to the resource handler served by a specific route.
-// numExp is non-zero if the current path segment has regexp links.
-// depth is the path depth of the current segment; 0 == HTTP verb.
-// links are the contiguous path segments.
+// handler, if not nil, points to the resource handler served by a specific route,
+// and pattern is the route path as added.
+// rank is the match precedence of the path segment, see segmentRank.
+// links are the contiguous path segments, sorted by rank.
 //
 // For example, given the following route and handler:
 //		"GET /api/users/111" -> users.GetUser()
 //        - the path segment links are ["GET", "api", "users", "111"]
-//        - "GET" has depth=0 and "111" has depth=3
-//        - suppose "111" might be matched via regexp, then "users".numExp > 0
 //        - "111" segment will point to the handler users.GetUser()
 type trieNode struct {
 	pseg    string
 	handler HandlerFunc
-	numExp  int
-	depth   int
+	pattern string
+	rank    int
 	links   []*trieNode
 }
 
@@ -131,12 +270,72 @@ func (n *trieNode) findLink(pseg string) *trieNode {
 	return nil
 }
 
+// addLink adds 'link' after the links with the same or lower rank, so links
+// are tried by precedence and then in the order added.
+func (n *trieNode) addLink(link *trieNode) {
+	i := len(n.links)
+	for i > 0 && n.links[i-1].rank > link.rank {
+		i--
+	}
+	n.links = append(n.links, nil)
+	copy(n.links[i+1:], n.links[i:])
+	n.links[i] = link
+}
+
+// Path segments are matched by precedence: plain segments, then typed PSE's,
+// then catch-all PSE's, then the rest of the path.
+const (
+	rankStatic = iota
+	rankTyped
+	rankCatchAll
+	rankRest
+)
+
+// ipv4Exp matches an IPv4 address, see the ip PSE.
+const ipv4Exp = `(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)`
+
+// semverExp matches a semantic version without prefix, see the semver PSE.
+const semverExp = `(?:0|[1-9]\d*)\.(?:0|[1-9]\d*)\.(?:0|[1-9]\d*)` +
+	`(?:-(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*)?` +
+	`(?:\+[0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*)?`
+
+// restExp matches a "{path:varname}" PSE, which matches the rest of the path.
+var restExp = regexp.MustCompile(`^\{path:\w+\}$`)
+
+// segmentRank returns the match precedence of path segment 'pseg'.
+func segmentRank(pseg string) int {
+	switch {
+	case !isPattern(pseg):
+		return rankStatic
+	case restExp.MatchString(pseg):
+		return rankRest
+	case pseg == "*" || isCatchAll(pseg):
+		return rankCatchAll
+	}
+	return rankTyped
+}
+
 // segmentExp compiles the pattern string into a regexp so it can used in a
 // path segment match. This function will panic if the regexp compilation fails.
+// See also: compileSegment
 func segmentExp(pattern string) *regexp.Regexp {
+	rx, err := compileSegment(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return rx
+}
+
+// compileSegment compiles the pattern string into a regexp so it can used in a
+// path segment match. Returns an ErrRoutePattern error if the pattern is not valid.
+func compileSegment(pattern string) (*regexp.Regexp, error) {
 	// custom regexp pattern.
 	if strings.HasPrefix(pattern, "{re:") {
-		return regexp.MustCompile(pattern[4 : len(pattern)-1])
+		rx, err := regexp.Compile(pattern[4 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %s", ErrRoutePattern, pattern, err)
+		}
+		return rx, nil
 	}
 
 	// turn "*" => "{wild}"
@@ -146,6 +345,11 @@ func segmentExp(pattern string) *regexp.Regexp {
 		ReplaceAllStringFunc(pattern, func(m string) string {
 			return fmt.Sprintf(`(?P<%s>.+)`, m[1:len(m)-1])
 		})
+	// path: matches the rest of the path, see trieNode.match.
+	p = regexp.MustCompile(`\{(?:path\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>.+)`, m[6:len(m)-1])
+		})
 	// word: matches an alphanumeric word, with underscores.
 	p = regexp.MustCompile(`\{(?:word\:)\w+\}`).
 		ReplaceAllStringFunc(p, func(m string) string {
@@ -204,6 +408,12 @@ func segmentExp(pattern string) *regexp.Regexp {
 				`[[:xdigit:]]{4}\-?`+
 				`[[:xdigit:]]{12})`, m[6:len(m)-1])
 		})
+	// ulid: matches an ULID, 26 chars in Crockford's base32, in any case.
+	// accepted value: 01ARZ3NDEKTSV4RRFFQ69G5FAV
+	p = regexp.MustCompile(`\{(?:ulid\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>[0-7][0-9A-HJKMNP-TV-Za-hjkmnp-tv-z]{25})`, m[6:len(m)-1])
+		})
 	// float: matches a floating-point number
 	p = regexp.MustCompile(`\{(?:float\:)\w+\}`).
 		ReplaceAllStringFunc(p, func(m string) string {
@@ -219,76 +429,385 @@ func segmentExp(pattern string) *regexp.Regexp {
 		ReplaceAllStringFunc(p, func(m string) string {
 			return fmt.Sprintf(`(?P<%s>[-+]?\d{1,18})`, m[5:len(m)-1])
 		})
-	return regexp.MustCompile(p)
+	// ip: matches an IPv4 address in dotted decimal, or an IPv6 address.
+	// accepted values:
+	// 	192.168.0.1
+	// 	2001:db8::1
+	// 	::ffff:192.168.0.1
+	// IPv6 addresses are matched loosely, use net.ParseIP to check them.
+	p = regexp.MustCompile(`\{(?:ip\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>`+ipv4Exp+`|(?:[[:xdigit:]]{0,4}:){2,7}(?:`+ipv4Exp+`|[[:xdigit:]]{1,4})?)`, m[4:len(m)-1])
+		})
+	// email: matches an email address, user@domain.
+	p = regexp.MustCompile(`\{(?:email\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>[\w.!#$%%&'*+=?^~-]+@`+
+				`[[:alnum:]](?:[[:alnum:]-]{0,61}[[:alnum:]])?`+
+				`(?:\.[[:alnum:]](?:[[:alnum:]-]{0,61}[[:alnum:]])?)+)`, m[7:len(m)-1])
+		})
+	// slug: matches lowercase alphanumeric words joined by single dashes.
+	// accepted value: hello-world-2
+	p = regexp.MustCompile(`\{(?:slug\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>[a-z0-9]+(?:-[a-z0-9]+)*)`, m[6:len(m)-1])
+		})
+	// semver: matches a semantic version. See https://semver.org
+	// accepted values:
+	// 	1.2.3
+	// 	v1.2.3
+	// 	1.2.3-beta.1+build.42
+	p = regexp.MustCompile(`\{(?:semver\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>v?`+semverExp+`)`, m[8:len(m)-1])
+		})
+	// cidr: matches an IP network in CIDR notation. Slashes separate path
+	// segments, so the prefix length follows a dash.
+	// accepted values:
+	// 	192.168.0.0-16
+	// 	2001:db8::-32
+	p = regexp.MustCompile(`\{(?:cidr\:)\w+\}`).
+		ReplaceAllStringFunc(p, func(m string) string {
+			return fmt.Sprintf(`(?P<%s>(?:`+ipv4Exp+`-(?:3[0-2]|[12]?\d))|`+
+				`(?:(?:[[:xdigit:]]{0,4}:){2,7}[[:xdigit:]]{0,4}-(?:12[0-8]|1[01]\d|[1-9]?\d)))`, m[6:len(m)-1])
+		})
+	// custom types, see RegisterType.
+	p, err := customTypeExp(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %s", ErrRoutePattern, pattern, err)
+	}
+	rx, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %s", ErrRoutePattern, pattern, err)
+	}
+	return rx, nil
 }
 
 // AddRoute breaks a path into segments and inserts them in the tree. If a
 // segment contains matching {}'s then it is tried as a regexp segment, otherwise it is
 // treated as a regular string segment.
+// AddRoute is safe for concurrent use, also with FindHandler and PathMethods.
+// This function will panic if a PSE is not valid, see AddRouteE.
 func (r *trieRegexpRouter) AddRoute(method, path string, handler HandlerFunc) {
-	node := r.root
+	if err := r.AddRouteE(method, path, handler); err != nil {
+		panic(err)
+	}
+}
+
+// AddRouteE is like AddRoute, but returns an ErrRoutePattern error if a PSE
+// is not valid, instead of panicking. The route is not added in that case.
+// It's meant for routes composed from user configuration.
+func (r *trieRegexpRouter) AddRouteE(method, path string, handler HandlerFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache != nil {
+		defer r.cache.clear()
+	}
+
 	pseg := strings.Split(method+strings.TrimRight(path, "/"), "/")
 	for i := range pseg {
-		if (strings.Contains(pseg[i], "{") && strings.Contains(pseg[i], "}")) || strings.Contains(pseg[i], "*") {
-			if _, ok := pathRegexpCache[pseg[i]]; !ok {
-				pathRegexpCache[pseg[i]] = segmentExp(pseg[i])
+		if !isPattern(pseg[i]) {
+			continue
+		}
+		if strings.Contains(pseg[i], "{path:") && (i != len(pseg)-1 || !restExp.MatchString(pseg[i])) {
+			return fmt.Errorf("%w %q: the path PSE must be the whole last segment", ErrRoutePattern, pseg[i])
+		}
+		if _, ok := r.exps[pseg[i]]; !ok {
+			rx, err := compileSegment(pseg[i])
+			if err != nil {
+				return err
 			}
-			node.numExp++
+			r.exps[pseg[i]] = rx
+			r.types[pseg[i]] = groupTypes(pseg[i], rx)
 		}
+	}
+
+	node := r.root
+	for i := range pseg {
 		link := node.findLink(pseg[i])
 		if link == nil {
 			link = &trieNode{
-				pseg:  pseg[i],
-				depth: node.depth + 1,
+				pseg: pseg[i],
+				rank: segmentRank(pseg[i]),
 			}
-			node.links = append(node.links, link)
+			node.addLink(link)
 		}
 		node = link
 	}
 
 	node.handler = handler
+	node.pattern = strings.TrimRight(path, "/")
+
+	// routes without PSE's go in the static table too.
+	if !strings.ContainsAny(path, "{}*") {
+		r.static[method+strings.TrimRight(path, "/")] = handler
+	}
 
 	// update methods list
 	if !strings.Contains(strings.Join(r.methods, ","), method) {
 		r.methods = append(r.methods, method)
 	}
+	return nil
+}
+
+// findRoute returns the node of the route (method + path) as added, following
+// the path segments literally, and its parent nodes. Returns nil if the route
+// doesn't exist.
+func (r *trieRegexpRouter) findRoute(method, path string) (*trieNode, []*trieNode) {
+	var parents []*trieNode
+	node := r.root
+	for _, pseg := range strings.Split(method+strings.TrimRight(path, "/"), "/") {
+		parents = append(parents, node)
+		if node = node.findLink(pseg); node == nil {
+			return nil, nil
+		}
+	}
+	if node.handler == nil {
+		return nil, nil
+	}
+	return node, parents
+}
+
+// RemoveRoute removes a route and prunes the trie segments that are no
+// longer used. RemoveRoute is safe for concurrent use.
+func (r *trieRegexpRouter) RemoveRoute(method, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache != nil {
+		defer r.cache.clear()
+	}
+
+	node, parents := r.findRoute(method, path)
+	if node == nil {
+		return ErrRouteNotFound
+	}
+	node.handler, node.pattern = nil, ""
+	delete(r.static, method+strings.TrimRight(path, "/"))
+
+	// prune segments without handlers or links, from the bottom up.
+	for i := len(parents) - 1; i >= 0 && node.handler == nil && len(node.links) == 0; i-- {
+		parent := parents[i]
+		for j := range parent.links {
+			if parent.links[j] == node {
+				parent.links = append(parent.links[:j], parent.links[j+1:]...)
+				break
+			}
+		}
+		node = parent
+	}
+	return nil
 }
 
-// matchSegment tries to match a path segment 'pseg' to the node's regexp links.
-// This function will return any path values matched so they can be used in
-// Request.PathValues.
-func (n *trieNode) matchSegment(pseg string, depth int, values *url.Values) *trieNode {
-	if n.numExp == 0 {
-		return n.findLink(pseg)
+// ReplaceRoute replaces the handler of a route. ReplaceRoute is safe for
+// concurrent use.
+func (r *trieRegexpRouter) ReplaceRoute(method, path string, handler HandlerFunc) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache != nil {
+		defer r.cache.clear()
 	}
-	for pexp := range n.links {
-		rx := pathRegexpCache[n.links[pexp].pseg]
-		if rx == nil {
+
+	node, _ := r.findRoute(method, path)
+	if node == nil {
+		return ErrRouteNotFound
+	}
+	node.handler = handler
+	if _, ok := r.static[method+strings.TrimRight(path, "/")]; ok {
+		r.static[method+strings.TrimRight(path, "/")] = handler
+	}
+	return nil
+}
+
+// Routes returns the routes in the router, in the order their segments were
+// added. The Resource and Name of the routes are not known to the router.
+func (r *trieRegexpRouter) Routes() []RouteInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var routes []RouteInfo
+	var walk func(n *trieNode, psegs []string)
+	walk = func(n *trieNode, psegs []string) {
+		psegs = append(psegs, n.pseg)
+		if n.handler != nil {
+			path := "/" + strings.Join(psegs[1:], "/")
+			routes = append(routes, RouteInfo{
+				Method: psegs[0],
+				Path:   path,
+				Params: pathParams(path),
+			})
+		}
+		for i := range n.links {
+			walk(n.links[i], psegs)
+		}
+	}
+	for i := range r.root.links {
+		walk(r.root.links[i], nil)
+	}
+	return routes
+}
+
+// pathParams returns the PSE's in 'path'.
+func pathParams(path string) []ParamInfo {
+	var params []ParamInfo
+	for _, pseg := range strings.Split(path, "/") {
+		if !isPattern(pseg) {
+			continue
+		}
+		if strings.HasPrefix(pseg, "{re:") {
+			params = append(params, ParamInfo{Type: "re"})
 			continue
 		}
-		// this prevents the matching to be side-tracked by smaller paths.
-		if depth > n.links[pexp].depth && n.links[pexp].links == nil {
+		for _, m := range pseExp.FindAllString(pseg, -1) {
+			if m == "*" {
+				params = append(params, ParamInfo{Name: "wild", Type: "any"})
+				continue
+			}
+			typ, name := "any", m[1:len(m)-1]
+			if idx := strings.Index(name, ":"); idx != -1 {
+				typ, name = name[:idx], name[idx+1:]
+			}
+			params = append(params, ParamInfo{Name: name, Type: typ})
+		}
+	}
+	return params
+}
+
+// groupTypes returns the PSE type of each group in 'rx', the regexp of path
+// segment 'pseg'. The groups of a PSE, such as the parts of a date, have its type.
+func groupTypes(pseg string, rx *regexp.Regexp) []string {
+	params := pathParams(pseg)
+	names := rx.SubexpNames()
+	types := make([]string, len(names))
+	typ := ""
+	if len(params) > 0 {
+		typ = params[0].Type
+	}
+	for i := 1; i < len(names); i++ {
+		for _, p := range params {
+			if p.Name != "" && (names[i] == p.Name || strings.HasPrefix(names[i], p.Name+"_")) {
+				typ = p.Type
+				break
+			}
+		}
+		types[i] = typ
+	}
+	return types
+}
+
+// match returns the node of the route that matches the path segments 'psegs',
+// below this node, or nil if none. Links are tried by precedence, and if a
+// link doesn't lead to a route the next one is tried. The PSE regexp's are in
+// 'exps'. The PSE submatches of the route are appended to 'matches'.
+func (n *trieNode) match(psegs []string, exps map[string]*regexp.Regexp, matches *[][]string) *trieNode {
+	if len(psegs) == 0 {
+		if n.handler == nil {
+			return nil
+		}
+		return n
+	}
+	for _, link := range n.links {
+		if link.rank == rankStatic {
+			if link.pseg != psegs[0] {
+				continue
+			}
+			if node := link.match(psegs[1:], exps, matches); node != nil {
+				return node
+			}
 			continue
 		}
-		m := rx.FindStringSubmatch(pseg)
-		if len(m) > 1 && m[0] == pseg {
-			if values != nil {
-				if *values == nil {
-					*values = make(url.Values)
-				}
-				sub := rx.SubexpNames()
-				for i, n := 1, len(*values)/2; i < len(m); i++ {
-					_n := fmt.Sprintf("_%d", n+i)
-					(*values).Set(_n, m[i])
-					if sub[i] != "" {
-						(*values).Add(sub[i], m[i])
-					}
-				}
+		if link.rank == rankRest {
+			// the rest of the path, it's always the last segment.
+			rest := strings.Join(psegs, "/")
+			if link.handler == nil {
+				continue
+			}
+			if matches != nil {
+				*matches = append(*matches, []string{rest, rest, link.pseg})
 			}
-			return n.links[pexp]
+			return link
+		}
+		rx := exps[link.pseg]
+		m := rx.FindStringSubmatch(psegs[0])
+		if len(m) == 0 || m[0] != psegs[0] {
+			continue
+		}
+		if matches != nil {
+			*matches = append(*matches, append(m, link.pseg))
+		}
+		if node := link.match(psegs[1:], exps, matches); node != nil {
+			return node
+		}
+		if matches != nil {
+			*matches = (*matches)[:len(*matches)-1]
+		}
+	}
+	return nil
+}
+
+// fold is like match but returns the path segments of the route that matches
+// 'psegs', below this node, with the static segments of the route. Static
+// segments are compared ignoring case if 'ignoreCase' is true. Returns nil if
+// no route matches.
+func (n *trieNode) fold(psegs []string, exps map[string]*regexp.Regexp, ignoreCase bool) []string {
+	if len(psegs) == 0 {
+		if n.handler == nil {
+			return nil
+		}
+		return []string{}
+	}
+	for _, link := range n.links {
+		switch link.rank {
+		case rankStatic:
+			if link.pseg != psegs[0] && !(ignoreCase && strings.EqualFold(link.pseg, psegs[0])) {
+				continue
+			}
+			if rest := link.fold(psegs[1:], exps, ignoreCase); rest != nil {
+				return append([]string{link.pseg}, rest...)
+			}
+		case rankRest:
+			if link.handler != nil {
+				return psegs
+			}
+		default:
+			m := exps[link.pseg].FindString(psegs[0])
+			if m != psegs[0] {
+				continue
+			}
+			if rest := link.fold(psegs[1:], exps, ignoreCase); rest != nil {
+				return append([]string{psegs[0]}, rest...)
+			}
+		}
+	}
+	return nil
+}
+
+// matchParams returns the PSE submatches in 'matches' as path params, in order.
+// The caller must hold the read lock.
+func (r *trieRegexpRouter) matchParams(matches [][]string) []PathParam {
+	var params []PathParam
+	for _, m := range matches {
+		// the last item is the path segment.
+		pseg := m[len(m)-1]
+		sub, types := r.exps[pseg].SubexpNames(), r.types[pseg]
+		for i := 1; i < len(m)-1; i++ {
+			params = append(params, PathParam{Name: sub[i], Value: m[i], Type: types[i]})
+		}
+	}
+	return params
+}
+
+// setValues sets the path 'params' to 'values', by name and by index: "_1",
+// "_2", ...
+func setValues(values *url.Values, params []PathParam) {
+	if *values == nil {
+		*values = make(url.Values)
+	}
+	for i, p := range params {
+		(*values).Set(fmt.Sprintf("_%d", i+1), p.Value)
+		if p.Name != "" {
+			(*values).Add(p.Name, p.Value)
 		}
 	}
-	return n.findLink(pseg)
 }
 
 // FindHandler returns a resource handler that matches the requested route; or
@@ -296,47 +815,119 @@ func (n *trieNode) matchSegment(pseg string, depth int, values *url.Values) *tri
 // method is the HTTP verb.
 // path is the relative URI path.
 // values is a pointer to an url.Values map to store parameters from the path.
+// Path segments are matched by precedence: plain segments, then typed PSE's,
+// then catch-all PSE's; and in the order added. So "/users/me" is preferred over
+// "/users/{word:name}", which is preferred over "/users/{name}", regardless of
+// the order the routes were added.
 func (r *trieRegexpRouter) FindHandler(method, path string, values *url.Values) (HandlerFunc, error) {
+	if values == nil {
+		handler, _, err := r.find(method, path, nil)
+		return handler, err
+	}
+	var params []PathParam
+	handler, _, err := r.find(method, path, &params)
+	if err == nil {
+		setValues(values, params)
+	}
+	return handler, err
+}
+
+// FindParams implements ParamsRouter.
+func (r *trieRegexpRouter) FindParams(method, path string) (HandlerFunc, []PathParam, error) {
+	var params []PathParam
+	handler, _, err := r.find(method, path, &params)
+	return handler, params, err
+}
+
+// FindPattern implements PatternRouter.
+func (r *trieRegexpRouter) FindPattern(method, path string) (string, error) {
+	_, pattern, err := r.find(method, path, nil)
+	return pattern, err
+}
+
+// find returns the handler and path pattern of the route that matches (method
+// + path), and its path values in 'params' if not nil. See FindHandler.
+func (r *trieRegexpRouter) find(method, path string, params *[]PathParam) (HandlerFunc, string, error) {
 	if method == "HEAD" {
 		method = "GET"
 	}
-	node := r.root
-	pseg := strings.Split(method+strings.TrimRight(path, "/"), "/") // ex: GET/api/users
-	slen := len(pseg)
-	for i := range make([]struct{}, slen) {
-		if node == nil {
-			if i <= 1 {
-				return nil, ErrRouteBadMethod
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key := method + strings.TrimRight(path, "/")
+	if h, ok := r.static[key]; ok {
+		return h, key[len(method):], nil
+	}
+	if r.cache != nil {
+		if cr, ok := r.cache.get(key); ok {
+			if params != nil {
+				*params = r.matchParams(cr.matches)
 			}
-			return nil, ErrRouteNotFound
+			return cr.handler, cr.pattern, nil
+		}
+	}
+	var node *trieNode
+	var matches [][]string
+	pseg := strings.Split(strings.TrimRight(path, "/"), "/") // ex: ["", "api", "users"]
+	if root := r.root.findLink(method); root != nil {
+		node = root.match(pseg[1:], r.exps, &matches)
+	}
+	if node != nil && r.cache != nil {
+		r.cache.put(&cachedRoute{key: key, handler: node.handler, pattern: node.pattern, matches: matches})
+	}
+	if node == nil {
+		// the path is matched first, then the method.
+		if r.matchAny(pseg[1:]) {
+			return nil, "", ErrRouteBadMethod
 		}
-		node = node.matchSegment(pseg[i], slen, values)
+		return nil, "", ErrRouteNotFound
+	}
+	if params != nil {
+		*params = r.matchParams(matches)
 	}
+	return node.handler, node.pattern, nil
+}
 
-	if node == nil || node.handler == nil {
-		return nil, ErrRouteNotFound
+// CanonicalPath implements CanonicalRouter.
+func (r *trieRegexpRouter) CanonicalPath(method, path string, ignoreCase bool) (string, bool) {
+	if method == "HEAD" {
+		method = "GET"
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	root := r.root.findLink(method)
+	if root == nil {
+		return "", false
 	}
-	return node.handler, nil
+	pseg := strings.Split(strings.TrimRight(path, "/"), "/")
+	psegs := root.fold(pseg[1:], r.exps, ignoreCase)
+	if psegs == nil {
+		return "", false
+	}
+	return "/" + strings.Join(psegs, "/"), true
+}
+
+// matchAny returns true if the path segments 'psegs' match a route of any
+// method. The caller must hold the read lock.
+func (r *trieRegexpRouter) matchAny(psegs []string) bool {
+	for _, method := range r.methods {
+		if root := r.root.findLink(method); root != nil && root.match(psegs, r.exps, nil) != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // PathMethods returns a string with comma-separated HTTP methods that match
 // the path. This list is suitable for Allow header response. Note that this
 // function only lists the methods, not if they are allowed.
 func (r *trieRegexpRouter) PathMethods(path string) string {
-	var node *trieNode
 	methods := "HEAD" // cheat
-	pseg := strings.Split("*"+strings.TrimRight(path, "/"), "/")
-	slen := len(pseg)
+	pseg := strings.Split(strings.TrimRight(path, "/"), "/")
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	for _, method := range r.methods {
-		node = r.root
-		pseg[0] = method
-		for i := range pseg {
-			if node == nil {
-				continue
-			}
-			node = node.matchSegment(pseg[i], slen, nil)
-		}
-		if node == nil || node.handler == nil {
+		root := r.root.findLink(method)
+		if root == nil || root.match(pseg[1:], r.exps, nil) == nil {
 			continue
 		}
 		methods += ", " + method
@@ -346,5 +937,10 @@ func (r *trieRegexpRouter) PathMethods(path string) string {
 
 // newRouter returns a new trieRegexpRouter object with an initialized tree.
 func newRouter() *trieRegexpRouter {
-	return &trieRegexpRouter{root: new(trieNode)}
+	return &trieRegexpRouter{
+		root:   new(trieNode),
+		static: make(map[string]HandlerFunc),
+		exps:   make(map[string]*regexp.Regexp),
+		types:  make(map[string][]string),
+	}
 }
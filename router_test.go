@@ -5,8 +5,15 @@
 package relax
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var testRouter = newRouter()
@@ -49,3 +56,940 @@ func TestFindHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterType(t *testing.T) {
+	RegisterType("kebab", `[a-z0-9]+(?:-[a-z0-9]+)*`)
+
+	router := newRouter()
+	router.AddRoute("GET", "/posts/{kebab:title}", testHandler)
+
+	var v url.Values
+	if _, err := router.FindHandler("GET", "/posts/hello-world", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Get("title") != "hello-world" {
+		t.Errorf("expected title %q, got %q", "hello-world", v.Get("title"))
+	}
+	if _, err := router.FindHandler("GET", "/posts/Hello_World", nil); err == nil {
+		t.Error("expected no match for bad kebab")
+	}
+
+	for _, bad := range [][2]string{{"kebab", `.+`}, {"uint", `\d+`}, {"Bad", `.+`}, {"bad", `(`}, {"bad", `(?P<x>.+)`}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for type %q pattern %q", bad[0], bad[1])
+				}
+			}()
+			RegisterType(bad[0], bad[1])
+		}()
+	}
+}
+
+var benchRequests = []string{"/api/v1/users", "/api/v1/users/profile/settings", "/api/v1/users/123/links"}
+
+func BenchmarkFindHandler(b *testing.B) {
+	router := newRouter()
+	for i := 0; i < 50; i++ {
+		router.AddRoute("GET", fmt.Sprintf("/api/v1/things%d/items", i), testHandler)
+	}
+	router.AddRoute("GET", "/api/v1/users", testHandler)
+	router.AddRoute("GET", "/api/v1/users/profile/settings", testHandler)
+	router.AddRoute("GET", "/api/v1/users/{uint:id}", testHandler)
+	router.AddRoute("GET", "/api/v1/users/{uint:id}/links", testHandler)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v url.Values
+		if _, err := router.FindHandler("GET", benchRequests[i%len(benchRequests)], &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	svc := NewService("http://api.company.com/v1/")
+	svc.Resource(svc).
+		GET("users/{uint:id}", testHandler).Name("user").
+		GET("users/{uint:id}/posts/{date:day}", testHandler).Name("user.posts").
+		GET("files/{name}", testHandler).Name("file").
+		GET("static/{path:rest}", testHandler).Name("static")
+	svc.Host("admin.company.com").Resource(&testAdmin{}).GET("", testHandler).Name("admin")
+
+	tests := []struct {
+		Name   string
+		Params []interface{}
+		URL    string
+		Err    error
+	}{
+		{"user", []interface{}{123}, "http://api.company.com/v1/users/123", nil},
+		{"user.posts", []interface{}{123, "2014-10-01"}, "http://api.company.com/v1/users/123/posts/2014-10-01", nil},
+		{"file", []interface{}{"a b"}, "http://api.company.com/v1/files/a%20b", nil},
+		{"static", []interface{}{"css/a b.css"}, "http://api.company.com/v1/static/css/a%20b.css", nil},
+		{"user", []interface{}{"abc"}, "", ErrRouteParams},
+		{"user", nil, "", ErrRouteParams},
+		{"user", []interface{}{1, 2}, "", ErrRouteParams},
+		{"nope", nil, "", ErrRouteName},
+		{"admin", nil, "http://admin.company.com/v1/testadmin", nil},
+	}
+	for i, tt := range tests {
+		href, err := svc.URLFor(tt.Name, tt.Params...)
+		if !errors.Is(err, tt.Err) {
+			t.Errorf("%d: expected error %v, got %v", i, tt.Err, err)
+			continue
+		}
+		if href != tt.URL {
+			t.Errorf("%d: expected URL %q, got %q", i, tt.URL, href)
+		}
+	}
+
+	svc = NewService("http://api.company.com:8080/v1/")
+	svc.Host("admin.company.com").Resource(&testAdmin{}).GET("", testHandler).Name("admin")
+	if href, _ := svc.URLFor("admin"); href != "http://admin.company.com:8080/v1/testadmin" {
+		t.Errorf("expected host URL with the service port, got %q", href)
+	}
+}
+
+func TestConcurrentAddRoute(t *testing.T) {
+	router := newRouter()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			router.AddRoute("GET", fmt.Sprintf("/posts%d/{uint:id}", i), testHandler)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			var v url.Values
+			router.FindHandler("GET", fmt.Sprintf("/posts%d/123", i), &v)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		if _, err := router.FindHandler("GET", fmt.Sprintf("/posts%d/123", i), nil); err != nil {
+			t.Errorf("%d: %s", i, err)
+		}
+	}
+}
+
+func TestConcurrentResourceRoutes(t *testing.T) {
+	svc := NewService("/")
+	reports := svc.Resource(&testReports{})
+	reports.GET("{uint:id}", testHandler).Name("report").Describe("Get a report", "")
+
+	admin := svc.Resource(&testAdmin{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 4; i++ {
+			admin.GET(fmt.Sprintf("r%d", i), testHandler)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			reports.ReplaceRoute("GET", "{uint:id}", testHandler)
+			reports.RemoveRoute("DELETE", fmt.Sprintf("x%d", i))
+		}(i)
+		go func() {
+			defer wg.Done()
+			svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("OPTIONS", "/testreports", nil))
+			svc.URLFor("report", 1)
+			(&Context{Request: httptest.NewRequest("GET", "/testreports/1", nil), service: svc}).RouteFilters("")
+		}()
+	}
+	wg.Wait()
+
+	if _, err := svc.URLFor("report", 1); err != nil {
+		t.Errorf("expected route name kept, got %v", err)
+	}
+}
+
+func TestRemoveRoute(t *testing.T) {
+	var called string
+	router := newRouter()
+	router.AddRoute("GET", "/posts", func(ctx *Context) { called = "posts" })
+	router.AddRoute("GET", "/posts/{uint:id}", func(ctx *Context) { called = "post" })
+
+	if err := router.ReplaceRoute("GET", "/posts", func(ctx *Context) { called = "replaced" }); err != nil {
+		t.Fatal(err)
+	}
+	h, err := router.FindHandler("GET", "/posts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h(nil); called != "replaced" {
+		t.Errorf("expected replaced handler, got %q", called)
+	}
+
+	if err := router.RemoveRoute("GET", "/posts/{uint:id}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := router.FindHandler("GET", "/posts/123", nil); err != ErrRouteNotFound {
+		t.Errorf("expected route not found, got %v", err)
+	}
+	if _, err := router.FindHandler("GET", "/posts", nil); err != nil {
+		t.Errorf("expected route /posts, got %v", err)
+	}
+	if err := router.RemoveRoute("GET", "/posts/{uint:id}"); err != ErrRouteNotFound {
+		t.Errorf("expected route not found, got %v", err)
+	}
+
+	router.AddRoute("GET", "/posts/{uint:id}", func(ctx *Context) { called = "post" })
+	if _, err := router.FindHandler("GET", "/posts/123", nil); err != nil {
+		t.Errorf("expected route added again, got %v", err)
+	}
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	var called string
+	route := func(name string) HandlerFunc { return func(ctx *Context) { called = name } }
+
+	router := newRouter()
+	router.AddRoute("GET", "/users/{item}", route("item"))
+	router.AddRoute("GET", "/users/{word:name}/posts", route("posts"))
+	router.AddRoute("GET", "/users/{word:name}", route("name"))
+	router.AddRoute("GET", "/users/me/profile", route("profile"))
+	router.AddRoute("GET", "/users/{item}/links", route("links"))
+
+	tests := []struct {
+		Path  string
+		Route string
+		Value string
+	}{
+		{"/users/me", "name", "me"},
+		{"/users/me/profile", "profile", ""},
+		{"/users/me/posts", "posts", "me"},
+		{"/users/a.b", "item", "a.b"},
+		{"/users/me/links", "links", "me"},
+	}
+	for i, tt := range tests {
+		var v url.Values
+		h, err := router.FindHandler("GET", tt.Path, &v)
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+		h(nil)
+		if called != tt.Route {
+			t.Errorf("%d: expected route %q, got %q", i, tt.Route, called)
+		}
+		if v.Get("_1") != tt.Value {
+			t.Errorf("%d: expected value %q, got %q", i, tt.Value, v.Get("_1"))
+		}
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	tests := []struct {
+		A, B     string
+		Conflict bool
+	}{
+		{"/users/{word:name}", "/users/{uint:id}", true},
+		{"/users/{item}", "/users/{name}", true},
+		{"/users/{word:name}", "/users/{item}", false},
+		{"/users/me", "/users/{word:name}", false},
+		{"/users/{word:name}/posts", "/users/{uint:id}/links", false},
+	}
+	for i, tt := range tests {
+		if c := conflicts(tt.A, tt.B); c != tt.Conflict {
+			t.Errorf("%d: expected conflict %v, got %v", i, tt.Conflict, c)
+		}
+	}
+}
+
+func TestAddRouteE(t *testing.T) {
+	router := newRouter()
+	for _, path := range []string{"/posts/{re:([a-z}", "/posts/{nope:id}"} {
+		if err := router.AddRouteE("GET", path, testHandler); !errors.Is(err, ErrRoutePattern) {
+			t.Errorf("%s: expected invalid pattern, got %v", path, err)
+		}
+	}
+	if routes := router.Routes(); len(routes) != 0 {
+		t.Errorf("expected no routes, got %v", routes)
+	}
+	if err := router.AddRouteE("GET", "/posts/{uint:id}", testHandler); err != nil {
+		t.Error(err)
+	}
+}
+
+type testHosts struct{ name string }
+
+func (h *testHosts) Index(ctx *Context) { ctx.Respond(h.name) }
+
+func TestHost(t *testing.T) {
+	svc := NewService("/v1/")
+	svc.Host("api.example.com").Resource(&testHosts{"api"})
+	svc.Host("internal.example.com:8000").Resource(&testHosts{"internal"})
+	svc.Resource(&testHosts{"any"})
+
+	tests := []struct {
+		Host   string
+		Status int
+		Body   string
+	}{
+		{"api.example.com", 200, `"api"`},
+		{"API.example.com:443", 200, `"api"`},
+		{"internal.example.com", 200, `"internal"`},
+		{"other.example.com", 200, `"any"`},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/testhosts", nil)
+		req.Host = tt.Host
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		if w.Code != tt.Status || strings.TrimSpace(w.Body.String()) != tt.Body {
+			t.Errorf("%d: expected %d %s, got %d %s", i, tt.Status, tt.Body, w.Code, w.Body.String())
+		}
+	}
+	if problems := svc.Doctor(); problems != nil {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestRestPath(t *testing.T) {
+	var called string
+	route := func(name string) HandlerFunc { return func(ctx *Context) { called = name } }
+
+	router := newRouter()
+	router.AddRoute("GET", "/files/{path:rest}", route("rest"))
+	router.AddRoute("GET", "/files/{name}", route("name"))
+	router.AddRoute("GET", "/files/docs/index", route("index"))
+
+	tests := []struct {
+		Path  string
+		Route string
+		Rest  string
+	}{
+		{"/files/a.txt", "name", ""},
+		{"/files/docs/index", "index", ""},
+		{"/files/docs/2014/report.pdf", "rest", "docs/2014/report.pdf"},
+		{"/files/docs/index/more", "rest", "docs/index/more"},
+	}
+	for i, tt := range tests {
+		var v url.Values
+		h, err := router.FindHandler("GET", tt.Path, &v)
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+		h(nil)
+		if called != tt.Route || v.Get("rest") != tt.Rest {
+			t.Errorf("%d: expected %s %q, got %s %q", i, tt.Route, tt.Rest, called, v.Get("rest"))
+		}
+	}
+
+	if err := router.AddRouteE("GET", "/files/{path:rest}/edit", testHandler); !errors.Is(err, ErrRoutePattern) {
+		t.Errorf("expected invalid pattern, got %v", err)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	svc := NewService("http://api.example.com/api/")
+	v1, v2, v3 := svc.Version("v1"), svc.Version("/v2/"), svc.Version("v3")
+	v1.Resource(&testHosts{"v1"})
+	v3.Resource(&testHosts{"v3"})
+	v2.Resource(&testHosts{"v2"})
+
+	tests := []struct {
+		Path string
+		Body string
+		Link string
+	}{
+		{"/api/v1/testhosts", `"v1"`, `<http://api.example.com/api/v2/testhosts>; rel="successor-version"`},
+		{"/api/v2/testhosts", `"v2"`, `<http://api.example.com/api/v1/testhosts>; rel="predecessor-version"`},
+		{"/api/v2/testhosts", `"v2"`, `<http://api.example.com/api/v3/testhosts>; rel="successor-version"`},
+		{"/api/v3/testhosts", `"v3"`, `<http://api.example.com/api/v2/testhosts>; rel="predecessor-version"`},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", tt.Path, nil))
+		if strings.TrimSpace(w.Body.String()) != tt.Body {
+			t.Errorf("%d: expected %s, got %d %s", i, tt.Body, w.Code, w.Body.String())
+		}
+		if links := strings.Join(w.Header()["Link"], ", "); !strings.Contains(links, tt.Link) {
+			t.Errorf("%d: expected link %s, got %s", i, tt.Link, links)
+		}
+	}
+}
+
+func TestBadMethod(t *testing.T) {
+	router := newRouter()
+	router.AddRoute("GET", "/v1/users/{uint:id}", testHandler)
+	router.AddRoute("PUT", "/v1/users/{uint:id}/avatar", testHandler)
+	router.AddRoute("POST", "/v1/users", testHandler)
+
+	tests := []struct {
+		Method string
+		Path   string
+		Err    error
+	}{
+		{"POST", "/v1/users/123", ErrRouteBadMethod},
+		{"DELETE", "/v1/users/123/avatar", ErrRouteBadMethod},
+		{"GET", "/v1/users", ErrRouteBadMethod},
+		{"PATCH", "/v1/users/123", ErrRouteBadMethod},
+		{"POST", "/v1/users/abc", ErrRouteNotFound},
+		{"GET", "/v1/groups/123", ErrRouteNotFound},
+		{"GET", "/v1/users/123", nil},
+	}
+	for i, tt := range tests {
+		if _, err := router.FindHandler(tt.Method, tt.Path, nil); err != tt.Err {
+			t.Errorf("%d: %s %s expected %v, got %v", i, tt.Method, tt.Path, tt.Err, err)
+		}
+	}
+	if methods := router.PathMethods("/v1/users/123"); methods != "HEAD, GET" {
+		t.Errorf("expected methods HEAD, GET, got %s", methods)
+	}
+}
+
+type testAdmin struct{}
+
+func (a *testAdmin) Index(ctx *Context) {}
+
+type testReports struct{}
+
+func (r *testReports) Index(ctx *Context) {}
+
+// testScopes passes the auth scopes in the header "X-Scopes".
+type testScopes struct{}
+
+func (f *testScopes) Run(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context) {
+		if scopes := ctx.Request.Header.Get("X-Scopes"); scopes != "" {
+			ctx.Set("auth.scopes", strings.Split(scopes, " "))
+		}
+		next(ctx)
+	}
+}
+
+func TestHiddenResources(t *testing.T) {
+	svc := NewService("/")
+	svc.Use(&testScopes{})
+	svc.Resource(&testHosts{})
+	svc.Resource(&testAdmin{}).Hidden()
+	svc.Resource(&testReports{}).Scopes("reports")
+
+	tests := []struct {
+		Scopes string
+		Listed []string
+		Hidden []string
+	}{
+		{"", []string{"testhosts"}, []string{"testadmin", "testreports"}},
+		{"read", []string{"testhosts"}, []string{"testadmin", "testreports"}},
+		{"read reports", []string{"testhosts", "testreports"}, []string{"testadmin"}},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Scopes", tt.Scopes)
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, req)
+		for _, name := range tt.Listed {
+			if !strings.Contains(w.Body.String(), `"`+name+`"`) {
+				t.Errorf("%d: expected %s listed, got %s", i, name, w.Body.String())
+			}
+		}
+		for _, name := range tt.Hidden {
+			if strings.Contains(w.Body.String(), `"`+name+`"`) {
+				t.Errorf("%d: expected %s hidden, got %s", i, name, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	svc := NewService("/")
+	svc.Resource(&testReports{}).
+		GET("{uint:id}", testHandler).
+		Describe("Get a report", "Returns a report.").
+		Param("id", "report id").
+		DELETE("{uint:id}", testHandler)
+
+	var found bool
+	for _, route := range svc.Routes() {
+		if route.Method != "GET" || route.Path != "/testreports/{uint:id}" {
+			continue
+		}
+		found = true
+		if route.Title != "Get a report" || route.Description != "Returns a report." {
+			t.Errorf("expected route documentation, got %q %q", route.Title, route.Description)
+		}
+		if len(route.Params) != 1 || route.Params[0].Description != "report id" {
+			t.Errorf("expected param documentation, got %v", route.Params)
+		}
+	}
+	if !found {
+		t.Fatal("expected route GET /testreports/{uint:id}")
+	}
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/testreports", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"title":"Get a report"`) {
+		t.Errorf("expected documented routes, got %d %s", w.Code, w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for unknown param")
+		}
+	}()
+	svc.Resource(&testAdmin{}).GET("{name}", testHandler).Param("id", "")
+}
+
+func TestExample(t *testing.T) {
+	svc := NewService("/")
+	svc.Resource(&testReports{}).
+		GET("{uint:id}", testHandler).
+		Example(200, map[string]string{"name": "weekly"}).
+		Example(404, &StatusError{404, "That report was not found.", nil})
+
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/testreports", nil))
+	body := w.Body.String()
+	if w.Code != 200 || !strings.Contains(body, `"examples":{"200":{"name":"weekly"},"404":{"code":404,"message":"That report was not found."}}`) {
+		t.Errorf("expected route examples, got %d %s", w.Code, body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid status")
+		}
+	}()
+	svc.Resource(&testAdmin{}).GET("", testHandler).Example(42, nil)
+}
+
+func TestCanonicalPaths(t *testing.T) {
+	tests := []struct {
+		IgnoreCase bool
+		Redirect   bool
+		Method     string
+		Path       string
+		Status     int
+		Location   string
+	}{
+		{false, false, "GET", "/v1/Users/123", 404, ""},
+		{false, false, "GET", "/v1/users/123/", 200, ""},
+		{true, false, "GET", "/V1/Users/123", 200, ""},
+		{true, false, "GET", "/v1/groups", 404, ""},
+		{false, true, "GET", "/v1/users/123/?full=1", 301, "/v1/users/123?full=1"},
+		{false, true, "GET", "/v1/Users/123/", 404, ""},
+		{false, true, "DELETE", "/v1/users/123/", 308, "/v1/users/123"},
+		{true, true, "GET", "/V1/USERS/abc", 301, "/v1/users/abc"},
+		{true, true, "GET", "/v1/users/123", 200, ""},
+	}
+	for i, tt := range tests {
+		svc := NewService("/v1/")
+		svc.IgnoreCase, svc.RedirectTrailingSlash = tt.IgnoreCase, tt.Redirect
+		svc.Resource(svc).
+			GET("users/{id}", testHandler).
+			DELETE("users/{id}", testHandler)
+
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest(tt.Method, tt.Path, nil))
+		if w.Code != tt.Status || w.Header().Get("Location") != tt.Location {
+			t.Errorf("%d: expected %d %q, got %d %q", i, tt.Status, tt.Location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+type testPrimed struct{ hits []string }
+
+func (p *testPrimed) Index(ctx *Context) { p.hits = append(p.hits, ctx.Request.URL.Path) }
+
+func (p *testPrimed) PrimeValues(path string) [][]interface{} {
+	return [][]interface{}{{1}, {2}, {"x"}}
+}
+
+func TestPrime(t *testing.T) {
+	svc := NewService("/")
+	primed := &testPrimed{}
+	svc.Resource(primed).
+		GET("{uint:id}", primed.Index).
+		POST("{uint:id}", primed.Index)
+	svc.Resource(&testReports{}).GET("{uint:id}", testHandler)
+
+	results := svc.Prime(nil)
+	expected := []string{"/testprimed", "/testprimed/1", "/testprimed/2"}
+	if strings.Join(primed.hits, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected requests %v, got %v", expected, primed.hits)
+	}
+	var errs int
+	for _, res := range results {
+		if res.Error != "" {
+			errs++
+		} else if res.Status != 200 {
+			t.Errorf("expected status 200 for %s, got %d", res.Path, res.Status)
+		}
+	}
+	if errs != 1 {
+		t.Errorf("expected 1 error, got %d: %v", errs, results)
+	}
+}
+
+func TestDo(t *testing.T) {
+	svc := NewService("http://api.example.com/v1/")
+	svc.Resource(&testReports{}).
+		GET("{uint:id}", func(ctx *Context) {
+			ctx.Respond(map[string]string{"id": ctx.PathValues.Get("id"), "q": ctx.Request.URL.Query().Get("q")})
+		}).
+		POST("", func(ctx *Context) {
+			var v map[string]string
+			if err := ctx.Decode(ctx.Request.Body, &v); err != nil {
+				ctx.Error(400, err.Error())
+				return
+			}
+			ctx.Respond(v, 201)
+		})
+
+	tests := []struct {
+		Method string
+		Path   string
+		Body   string
+		Status int
+		Resp   string
+	}{
+		{"GET", "testreports/7?q=a", "", 200, `{"id":"7","q":"a"}`},
+		{"GET", "/v1/testreports/8", "", 200, `{"id":"8","q":""}`},
+		{"POST", "testreports", `{"name":"x"}`, 201, `{"name":"x"}`},
+		{"GET", "testreports/x", "", 404, ""},
+	}
+	for i, tt := range tests {
+		var body io.Reader
+		if tt.Body != "" {
+			body = strings.NewReader(tt.Body)
+		}
+		rb, err := svc.Do(tt.Method, tt.Path, body, DoHeader("Accept", "application/json"))
+		if err != nil {
+			t.Errorf("%d: %s", i, err)
+			continue
+		}
+		if rb.Status() != tt.Status || !strings.HasPrefix(rb.String(), tt.Resp) {
+			t.Errorf("%d: expected %d %s, got %d %s", i, tt.Status, tt.Resp, rb.Status(), rb.String())
+		}
+		rb.Free()
+	}
+}
+
+func TestRouteCache(t *testing.T) {
+	var called string
+	route := func(name string) HandlerFunc { return func(ctx *Context) { called = name } }
+
+	router := newRouter()
+	router.CacheRoutes(2)
+	router.AddRoute("GET", "/users/{name}", route("name"))
+
+	for i, path := range []string{"/users/a", "/users/b", "/users/a", "/users/c", "/users/123"} {
+		var v url.Values
+		h, err := router.FindHandler("GET", path, &v)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		h(nil)
+		if called != "name" || v.Get("name") != path[7:] {
+			t.Errorf("%d: expected name %q, got %s %q", i, path[7:], called, v.Get("name"))
+		}
+	}
+	if n := router.cache.order.Len(); n != 2 {
+		t.Errorf("expected 2 cached routes, got %d", n)
+	}
+
+	// new routes empty the cache.
+	router.AddRoute("GET", "/users/{uint:id}", route("id"))
+	var v url.Values
+	h, _ := router.FindHandler("GET", "/users/123", &v)
+	h(nil)
+	if called != "id" || v.Get("id") != "123" {
+		t.Errorf("expected id 123, got %s %q", called, v.Get("id"))
+	}
+}
+
+func TestMatrixParams(t *testing.T) {
+	var values url.Values
+	svc := NewService("/")
+	svc.MatrixParams = true
+	svc.Resource(&testReports{}).
+		GET("cities/list", func(ctx *Context) { values = ctx.PathValues }).
+		GET("cities/{uint:id}", func(ctx *Context) { values = ctx.PathValues }).
+		GET("near/{geo:loc}", func(ctx *Context) { values = ctx.PathValues })
+
+	tests := []struct {
+		Path   string
+		Status int
+		Key    string
+		Value  string
+	}{
+		{"/testreports/cities;country=US;state=AZ/list", 200, "state", "AZ"},
+		{"/testreports/cities/123;fields=name", 200, "id", "123"},
+		{"/testreports/cities/123;fields=name", 200, "fields", "name"},
+		{"/testreports;v=2/cities/list;flag", 200, "flag", ""},
+		{"/testreports/near/33.4,-111.9;u=10", 200, "loc_u", "10"},
+		{"/testreports/cities;x=1/other", 404, "", ""},
+	}
+	for i, tt := range tests {
+		values = nil
+		w := httptest.NewRecorder()
+		svc.ServeHTTP(w, httptest.NewRequest("GET", tt.Path, nil))
+		if w.Code != tt.Status {
+			t.Errorf("%d: expected status %d, got %d", i, tt.Status, w.Code)
+			continue
+		}
+		if tt.Key != "" {
+			if _, ok := values[tt.Key]; !ok || values.Get(tt.Key) != tt.Value {
+				t.Errorf("%d: expected %s=%q, got %v", i, tt.Key, tt.Value, values)
+			}
+		}
+	}
+}
+
+func TestBuiltinTypes(t *testing.T) {
+	router := newRouter()
+	router.AddRoute("GET", "/hosts/{ip:addr}", testHandler)
+	router.AddRoute("GET", "/users/{email:addr}", testHandler)
+	router.AddRoute("GET", "/items/{uuid:id}", testHandler)
+	router.AddRoute("GET", "/orders/{ulid:id}", testHandler)
+	router.AddRoute("GET", "/posts/{slug:id}", testHandler)
+	router.AddRoute("GET", "/releases/{semver:id}", testHandler)
+	router.AddRoute("GET", "/networks/{cidr:id}", testHandler)
+
+	tests := []struct {
+		Path  string
+		Value string
+	}{
+		{"/hosts/192.168.0.1", "192.168.0.1"},
+		{"/hosts/2001:db8::1", "2001:db8::1"},
+		{"/hosts/::ffff:192.168.0.1", "::ffff:192.168.0.1"},
+		{"/hosts/256.1.1.1", ""},
+		{"/hosts/example.com", ""},
+		{"/users/jane.doe+api@mail.example.com", "jane.doe+api@mail.example.com"},
+		{"/users/jane@localhost", ""},
+		{"/users/@example.com", ""},
+		{"/items/0e3b8a1c-5f5e-4c7a-9a53-2d1f0c9b8e7a", "0e3b8a1c-5f5e-4c7a-9a53-2d1f0c9b8e7a"},
+		{"/orders/01ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{"/orders/01arz3ndektsv4rrffq69g5fav", "01arz3ndektsv4rrffq69g5fav"},
+		{"/orders/81ARZ3NDEKTSV4RRFFQ69G5FAV", ""},
+		{"/orders/01ARZ3NDEKTSV4RRFFQ69G5FAU", ""},
+		{"/posts/hello-world-2", "hello-world-2"},
+		{"/posts/Hello--World", ""},
+		{"/releases/v1.2.3-beta.1+build.42", "v1.2.3-beta.1+build.42"},
+		{"/releases/1.02.3", ""},
+		{"/networks/10.1.0.0-16", "10.1.0.0-16"},
+		{"/networks/2001:db8::-32", "2001:db8::-32"},
+		{"/networks/10.1.0.0-33", ""},
+	}
+	for i, tt := range tests {
+		var v url.Values
+		_, err := router.FindHandler("GET", tt.Path, &v)
+		if tt.Value == "" {
+			if err == nil {
+				t.Errorf("%d: expected no match for %s, got %v", i, tt.Path, v)
+			}
+			continue
+		}
+		if err != nil || (v.Get("addr") != tt.Value && v.Get("id") != tt.Value) {
+			t.Errorf("%d: expected %q, got %v %v", i, tt.Value, v, err)
+		}
+	}
+}
+
+func TestPathAccessors(t *testing.T) {
+	router := newRouter()
+	router.AddRoute("GET", "/n/{int:i}/{uint:u}/{hex:h}/{float:f}/{word:b}", testHandler)
+	router.AddRoute("GET", "/d/{date:day}", testHandler)
+
+	ctx := &Context{}
+	if _, err := router.FindHandler("GET", "/n/-42/7/0xff/1.5/true", &ctx.PathValues); err != nil {
+		t.Fatal(err)
+	}
+	if i, err := ctx.PathInt("i"); i != -42 || err != nil {
+		t.Errorf("PathInt: got %d %v", i, err)
+	}
+	if u, err := ctx.PathUint("u"); u != 7 || err != nil {
+		t.Errorf("PathUint: got %d %v", u, err)
+	}
+	if h, err := ctx.PathInt("h"); h != 255 || err != nil {
+		t.Errorf("PathInt hex: got %d %v", h, err)
+	}
+	if f, err := ctx.PathFloat("f"); f != 1.5 || err != nil {
+		t.Errorf("PathFloat: got %f %v", f, err)
+	}
+	if b, err := ctx.PathBool("b"); !b || err != nil {
+		t.Errorf("PathBool: got %t %v", b, err)
+	}
+	if _, err := ctx.PathUint("i"); err == nil || err.(*StatusError).Code != 400 {
+		t.Errorf("PathUint: expected 400 error, got %v", err)
+	}
+	if _, err := ctx.PathUUID("b"); err == nil {
+		t.Error("PathUUID: expected error for invalid UUID")
+	}
+	ctx.PathValues.Set("id", "6BA7B8109DAD11D180B400C04FD430C8")
+	if id, _ := ctx.PathUUID("id"); id != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("PathUUID: got %q", id)
+	}
+	ctx.PathValues.Set("id", "01arz3ndektsv4rrffq69g5fav")
+	if id, _ := ctx.PathULID("id"); id != "01ARZ3NDEKTSV4RRFFQ69G5FAV" {
+		t.Errorf("PathULID: got %q", id)
+	}
+	ctx.PathValues.Set("id", "v1.2.3-beta.1+build.42")
+	if v, err := ctx.PathSemver("id"); err != nil || v.Minor != 2 || v.Pre != "beta.1" || v.String() != "1.2.3-beta.1+build.42" {
+		t.Errorf("PathSemver: got %v %v", v, err)
+	}
+	ctx.PathValues.Set("id", "10.1.2.0-16")
+	if n, err := ctx.PathCIDR("id"); err != nil || n.String() != "10.1.0.0/16" {
+		t.Errorf("PathCIDR: got %v %v", n, err)
+	}
+	ctx.PathValues.Set("id", "::1")
+	if ip, err := ctx.PathIP("id"); err != nil || !ip.IsLoopback() {
+		t.Errorf("PathIP: got %v %v", ip, err)
+	}
+	ctx.PathValues.Set("id", "jane@example.com")
+	if addr, err := ctx.PathEmail("id"); err != nil || addr != "jane@example.com" {
+		t.Errorf("PathEmail: got %v %v", addr, err)
+	}
+	if _, err := ctx.PathInt("missing"); err == nil {
+		t.Error("PathInt: expected error for missing value")
+	}
+
+	tests := []struct {
+		Path string
+		Time string
+	}{
+		{"/d/2024", "2024-01-01T00:00:00Z"},
+		{"/d/2024-02", "2024-02-01T00:00:00Z"},
+		{"/d/20240215", "2024-02-15T00:00:00Z"},
+		{"/d/2024-02-15T10:30", "2024-02-15T10:30:00Z"},
+		{"/d/2024-02-15T10:30:05.25-05:00", "2024-02-15T10:30:05.25-05:00"},
+		{"/d/2024-02-30", ""},
+	}
+	for i, tt := range tests {
+		ctx := &Context{}
+		if _, err := router.FindHandler("GET", tt.Path, &ctx.PathValues); err != nil {
+			t.Fatal(err)
+		}
+		day, err := ctx.PathTime("day")
+		if tt.Time == "" {
+			if err == nil {
+				t.Errorf("%d: expected error for %s, got %v", i, tt.Path, day)
+			}
+			continue
+		}
+		if err != nil || day.Format(time.RFC3339Nano) != tt.Time {
+			t.Errorf("%d: expected %s, got %v %v", i, tt.Time, day, err)
+		}
+	}
+}
+
+func TestTraceRoute(t *testing.T) {
+	svc := NewService("/")
+	svc.TraceHeader = "X-Trace-Route"
+	svc.Root().GET("users/{uint:id}/posts", testHandler).GET("users/me", testHandler)
+
+	req := httptest.NewRequest("GET", "/users/12a/posts", nil)
+	req.Header.Set("X-Trace-Route", "1")
+	w := httptest.NewRecorder()
+	svc.ServeHTTP(w, req)
+	if w.Code != 404 {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+	for _, s := range []string{`"node":"{uint:id}"`, `"result":"partial"`, `"match":"12"`, `"node":"me","result":"mismatch"`} {
+		if !strings.Contains(w.Body.String(), s) {
+			t.Errorf("expected %s in trace, got %s", s, w.Body.String())
+		}
+	}
+
+	steps := svc.Router().(RouteTracer).TraceRoute("GET", "/users/12")
+	last := steps[len(steps)-1]
+	if last.Node != "{uint:id}" || last.Result != TraceNoHandler {
+		t.Errorf("expected no handler at {uint:id}, got %+v", steps)
+	}
+
+	// no trace without the header.
+	w = httptest.NewRecorder()
+	svc.ServeHTTP(w, httptest.NewRequest("GET", "/users/12a/posts", nil))
+	if strings.Contains(w.Body.String(), "service") {
+		t.Errorf("expected no trace, got %s", w.Body.String())
+	}
+}
+
+func TestPathParams(t *testing.T) {
+	router := newRouter()
+	router.AddRoute("GET", "/users/{uint:id}/posts/{date:day}/{slug}", testHandler)
+
+	_, params, err := router.FindParams("GET", "/users/7/posts/2024-02/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params[0] != (PathParam{"id", "7", "uint"}) || params[len(params)-1] != (PathParam{"slug", "hello", "any"}) {
+		t.Errorf("unexpected params %v", params)
+	}
+	var v url.Values
+	router.FindHandler("GET", "/users/7/posts/2024-02/hello", &v)
+	for i, p := range params {
+		if p.Type == "" || (i > 0 && i < len(params)-1 && p.Type != "date") {
+			t.Errorf("%d: unexpected type %q", i, p.Type)
+		}
+		if v.Get(fmt.Sprintf("_%d", i+1)) != p.Value {
+			t.Errorf("%d: expected _%d = %q, got %q", i, i+1, p.Value, v.Get(fmt.Sprintf("_%d", i+1)))
+		}
+	}
+	if v.Get("day_year") != "2024" {
+		t.Errorf("expected day_year 2024, got %v", v)
+	}
+}
+
+func TestRouteFilters(t *testing.T) {
+	svc := NewService("/")
+	svc.IgnoreCase = true
+	scopes := &testScopes{}
+	svc.Resource(&testReports{}).GET("{uint:id}", testHandler, scopes)
+	svc.Router().AddRoute("GET", "/plain", testHandler)
+
+	tests := []struct {
+		Method  string
+		Path    string
+		Filters int
+	}{
+		{"GET", "/testreports/1", 1},
+		{"HEAD", "/testreports/1/", 1},
+		{"GET", "/TestReports/1", 1},
+		{"POST", "/testreports/1", 0},
+		{"GET", "/plain", 0},
+		{"GET", "/missing", 0},
+	}
+	for i, tt := range tests {
+		ctx := &Context{Request: httptest.NewRequest(tt.Method, tt.Path, nil), service: svc}
+		if filters := ctx.RouteFilters(""); len(filters) != tt.Filters {
+			t.Errorf("%d: expected %d filters, got %v", i, tt.Filters, filters)
+		}
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	var pattern, logged string
+	handler := func(ctx *Context) {
+		pattern = ctx.RoutePattern()
+		logged = fmt.Sprintf("%o", ctx.Clone(nil))
+	}
+	svc := NewService("/")
+	svc.Resource(&testReports{}).
+		GET("", handler).
+		GET("{uint:id}", handler)
+	svc.Router().AddRoute("GET", "/direct", handler)
+
+	tests := []struct {
+		Path, Pattern, Logged string
+	}{
+		{"/testreports", "/testreports", "/testreports"},
+		{"/testreports/42", "/testreports/{uint:id}", "/testreports/{uint:id}"},
+		{"/direct", "", "-"},
+	}
+	for i, tt := range tests {
+		pattern, logged = "?", "?"
+		svc.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.Path, nil))
+		if pattern != tt.Pattern || logged != tt.Logged {
+			t.Errorf("%d: expected %q %q, got %q %q", i, tt.Pattern, tt.Logged, pattern, logged)
+		}
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// routeEntry is a route added through a Resource, kept for reporting.
+type routeEntry struct {
+	method   string
+	path     string
+	resource string
+	filters  []Filter
+	name     string
+	host     string
+	meta     *routeMeta
+	res      *Resource
+}
+
+// routeMeta is the documentation of a route, see Resource.Describe.
+type routeMeta struct {
+	title       string
+	description string
+	params      map[string]string
+	examples    map[int]interface{}
+}
+
+// key returns the route key, with the host if any: "GET example.com/v1/users".
+func (e *routeEntry) key() string {
+	return e.method + " " + e.host + e.path
+}
+
+// filterNames returns the type names of the route filters, in run order.
+func (e *routeEntry) filterNames() string {
+	if len(e.filters) == 0 {
+		return "-"
+	}
+	names := make([]string, len(e.filters))
+	for i := range e.filters {
+		names[i] = fmt.Sprintf("%T", e.filters[i])
+	}
+	return strings.Join(names, ",")
+}
+
+// addRouteEntry records a route added by resource 'r'.
+func (r *Resource) addRouteEntry(method, path string, filters []Filter) {
+	r.service.routesMu.Lock()
+	defer r.service.routesMu.Unlock()
+	r.addEntry(method, path, filters)
+}
+
+// addEntry is addRouteEntry, the caller must hold the service routes lock.
+func (r *Resource) addEntry(method, path string, filters []Filter) {
+	all := make([]Filter, 0, len(r.filters)+len(filters))
+	all = append(all, r.filters...)
+	all = append(all, filters...)
+	r.last = &routeEntry{
+		method:   method,
+		path:     strings.TrimRight(path, "/"),
+		resource: r.name,
+		filters:  all,
+		res:      r,
+	}
+	if r.host != nil {
+		r.last.host = r.host.name
+	}
+	r.service.routes = append(r.service.routes, r.last)
+	if r.service.entries == nil {
+		r.service.entries = make(map[string]*routeEntry)
+	}
+	r.service.entries[r.last.key()] = r.last
+}
+
+// routeEntryFor returns the entry of the resource route that matches (method +
+// path) for 'host', or nil if none. The route is matched by the router of the
+// host, or the service router, which must implement PatternRouter.
+func (svc *Service) routeEntryFor(host, method, path string) *routeEntry {
+	if method == "HEAD" {
+		method = "GET"
+	}
+	name := hostName(host)
+	if h, ok := svc.hosts[name]; ok {
+		if e, ok := svc.routerEntry(h.router, name, method, path); ok {
+			return e
+		}
+	}
+	e, _ := svc.routerEntry(svc.router, "", method, path)
+	return e
+}
+
+// routerEntry returns the entry of the route that matches (method + path) in
+// 'router' for host 'host', and true if a route matched; the entry is nil if
+// the route wasn't added by a resource. Paths in other case are matched too,
+// if the service IgnoreCase is set.
+func (svc *Service) routerEntry(router Router, host, method, path string) (*routeEntry, bool) {
+	pr, ok := router.(PatternRouter)
+	if !ok {
+		return nil, false
+	}
+	pattern, err := pr.FindPattern(method, path)
+	if err == ErrRouteNotFound && svc.IgnoreCase {
+		if cr, ok := router.(CanonicalRouter); ok {
+			if cpath, ok := cr.CanonicalPath(method, path, true); ok {
+				pattern, err = pr.FindPattern(method, cpath)
+			}
+		}
+	}
+	if err != nil {
+		return nil, false
+	}
+	svc.routesMu.RLock()
+	defer svc.routesMu.RUnlock()
+	return svc.entries[method+" "+host+pattern], true
+}
+
+/*
+RouteFilters returns the resource and route filters of the route that serves
+the request path with 'method', in the order they run; or the request method
+if 'method' is empty. Service-level filters can use it to find the settings of
+a route before it's dispatched, such as CORS preflight requests:
+
+	method := ctx.Request.Header.Get("Access-Control-Request-Method")
+	for _, f := range ctx.RouteFilters(method) {
+		...
+	}
+
+Returns nil if no route matches, or if the route was added directly with
+Router.AddRoute.
+*/
+func (ctx *Context) RouteFilters(method string) []Filter {
+	if method == "" {
+		method = ctx.Request.Method
+	}
+	if e := ctx.routeEntry(strings.ToUpper(method)); e != nil {
+		return e.filters
+	}
+	return nil
+}
+
+// routeEntry returns the entry of the resource route that serves the request
+// path with 'method', or nil if none. The entry of the request method is
+// found once per request.
+func (ctx *Context) routeEntry(method string) *routeEntry {
+	if ctx.service == nil {
+		return nil
+	}
+	if method == ctx.Request.Method && ctx.route != nil {
+		ctx.route.Do(func() {
+			ctx.route.entry = ctx.findRouteEntry(method)
+		})
+		return ctx.route.entry
+	}
+	return ctx.findRouteEntry(method)
+}
+
+// findRouteEntry looks up the entry of routeEntry.
+func (ctx *Context) findRouteEntry(method string) *routeEntry {
+	path := ctx.Request.URL.Path
+	if ctx.service.MatrixParams {
+		path, _ = matrixParams(path)
+	}
+	return ctx.service.routeEntryFor(ctx.Request.Host, method, path)
+}
+
+/*
+RoutePattern returns the path pattern of the resource route that matched the
+request, such as "/users/{uint:id}", or "" if no resource route matched.
+It's the path in Service.Routes, useful to group metrics and logs by route
+instead of by request path.
+*/
+func (ctx *Context) RoutePattern() string {
+	e := ctx.routeEntry(ctx.Request.Method)
+	if e == nil {
+		return ""
+	}
+	if e.path == "" {
+		return "/"
+	}
+	return e.path
+}
+
+// removeRouteEntry removes the entries of route (method + path) of the resource
+// host, and returns the last one removed, or nil if none.
+func (r *Resource) removeRouteEntry(method, path string) *routeEntry {
+	r.service.routesMu.Lock()
+	defer r.service.routesMu.Unlock()
+	return r.removeEntry(method, path)
+}
+
+// replaceRouteEntry replaces the entry of route (method + path) of the resource
+// host with a new one, that keeps the name and documentation of the old entry.
+func (r *Resource) replaceRouteEntry(method, path string, filters []Filter) {
+	svc := r.service
+	svc.routesMu.Lock()
+	defer svc.routesMu.Unlock()
+	old := r.removeEntry(method, path)
+	r.addEntry(method, path, filters)
+	if old != nil {
+		r.last.meta = old.meta
+		if old.name != "" {
+			r.last.name = old.name
+			svc.names[old.name] = r.last
+		}
+	}
+}
+
+// removeEntry is removeRouteEntry, the caller must hold the service routes lock.
+// The routes list is copied, so lists read before are not changed.
+func (r *Resource) removeEntry(method, path string) *routeEntry {
+	var removed *routeEntry
+	key := (&routeEntry{method: method, path: strings.TrimRight(path, "/"), host: r.hostName()}).key()
+	svc := r.service
+	routes := make([]*routeEntry, 0, len(svc.routes))
+	for _, e := range svc.routes {
+		if e.key() == key {
+			if e.name != "" {
+				delete(svc.names, e.name)
+			}
+			delete(svc.entries, key)
+			removed = e
+			continue
+		}
+		routes = append(routes, e)
+	}
+	svc.routes = routes
+	return removed
+}
+
+/*
+Describe documents the route added last to the resource with a 'title' and a
+longer 'description'. Together with Param, the documentation is listed by
+Service.Routes and in the OPTIONS responses of the resource, for doc generators
+and clients.
+
+	users.GET("{uint:id}", users.Read).
+		Describe("Get a user", "Returns the profile of a user.").
+		Param("id", "user id")
+
+This function will panic if the resource has no routes.
+*/
+func (r *Resource) Describe(title, description string) *Resource {
+	m := r.lastMeta("Describe")
+	m.title, m.description = title, description
+	return r
+}
+
+// Param documents the PSE 'name' of the route added last to the resource.
+// See Describe.
+// This function will panic if the resource has no routes, or if the route
+// has no such PSE.
+func (r *Resource) Param(name, description string) *Resource {
+	m := r.lastMeta("Param")
+	found := false
+	for _, p := range pathParams(r.last.path) {
+		if p.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		panic("relax: Param " + name + " not in route " + r.last.path)
+	}
+	if m.params == nil {
+		m.params = make(map[string]string)
+	}
+	m.params[name] = description
+	return r
+}
+
+/*
+Example registers 'v' as a sample response with 'status' code for the route
+added last to the resource. Examples are listed with the route documentation
+by Service.Routes and in the OPTIONS responses of the resource, encoded like
+any other response, so clients can see what to expect before calling.
+
+	users.GET("{uint:id}", users.Read).
+		Describe("Get a user", "Returns the profile of a user.").
+		Example(http.StatusOK, &User{ID: 1, Name: "Jane"}).
+		Example(http.StatusNotFound, &StatusError{404, "That user was not found.", nil})
+
+This function will panic if the resource has no routes, or if 'status' is not
+a valid HTTP status code.
+*/
+func (r *Resource) Example(status int, v interface{}) *Resource {
+	m := r.lastMeta("Example")
+	if status < 100 || status > 599 {
+		panic("relax: Example status " + strconv.Itoa(status) + " is not valid")
+	}
+	if m.examples == nil {
+		m.examples = make(map[int]interface{})
+	}
+	m.examples[status] = v
+	return r
+}
+
+// lastMeta returns the documentation of the route added last, for function 'fn'.
+func (r *Resource) lastMeta(fn string) *routeMeta {
+	if r.last == nil {
+		panic("relax: " + fn + " called on a resource without routes")
+	}
+	if r.last.meta == nil {
+		r.last.meta = &routeMeta{}
+	}
+	return r.last.meta
+}
+
+// describe sets the documentation of 'e' to the route 'info'.
+func (e *routeEntry) describe(info *RouteInfo) {
+	info.Resource = e.resource
+	info.Name = e.name
+	if e.meta == nil {
+		return
+	}
+	info.Title = e.meta.title
+	info.Description = e.meta.description
+	for i := range info.Params {
+		info.Params[i].Description = e.meta.params[info.Params[i].Name]
+	}
+	if len(e.meta.examples) > 0 {
+		info.Examples = make(map[string]interface{}, len(e.meta.examples))
+		for status, v := range e.meta.examples {
+			info.Examples[strconv.Itoa(status)] = v
+		}
+	}
+}
+
+// hostName returns the name of the resource host, or "" for all hosts.
+func (r *Resource) hostName() string {
+	if r.host == nil {
+		return ""
+	}
+	return r.host.name
+}
+
+/*
+Routes returns all the routes of the service, with their method, path pattern,
+PSE's, resource, name and documentation. It's meant to generate documentation, sitemaps and
+reports from the live routing table.
+
+	for _, route := range svc.Routes() {
+		fmt.Println(route.Method, route.Path, route.Resource)
+	}
+
+If the router implements RouteLister, the routes added directly with
+Router.AddRoute are included too, without a resource.
+*/
+func (svc *Service) Routes() []RouteInfo {
+	svc.routesMu.RLock()
+	defer svc.routesMu.RUnlock()
+	entries := make(map[string]*routeEntry, len(svc.routes))
+	for _, e := range svc.routes {
+		entries[e.key()] = e
+	}
+
+	routes := svc.routerRoutes(svc.router, "")
+	for _, name := range svc.hostNames() {
+		routes = append(routes, svc.routerRoutes(svc.hosts[name].router, name)...)
+	}
+	for i := range routes {
+		key := routes[i].Method + " " + routes[i].Host + strings.TrimRight(routes[i].Path, "/")
+		if e, ok := entries[key]; ok {
+			e.describe(&routes[i])
+		}
+	}
+	return routes
+}
+
+// routerRoutes returns the routes of 'router', for host 'host'. The caller
+// must hold the service routes read lock.
+func (svc *Service) routerRoutes(router Router, host string) []RouteInfo {
+	var routes []RouteInfo
+	if rl, ok := router.(RouteLister); ok {
+		routes = rl.Routes()
+	} else {
+		for _, e := range svc.routes {
+			if e.host == host {
+				routes = append(routes, RouteInfo{Method: e.method, Path: e.path, Params: pathParams(e.path)})
+			}
+		}
+	}
+	for i := range routes {
+		routes[i].Host = host
+	}
+	return routes
+}
+
+// routeEntries returns the routes added through resources. The list must not
+// be changed, routes are removed from a copy.
+func (svc *Service) routeEntries() []*routeEntry {
+	svc.routesMu.RLock()
+	defer svc.routesMu.RUnlock()
+	return svc.routes
+}
+
+// hostNames returns the sorted names of the service virtual hosts.
+func (svc *Service) hostNames() []string {
+	names := make([]string, 0, len(svc.hosts))
+	for name := range svc.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+PrintRoutes writes a table of all the routes added through resources, with
+their method, path pattern, resource and filters. The paths of virtual host
+routes start with the host name. Service-level filters run
+before all routes and are not listed. It's useful to review routes at startup:
+
+	svc.PrintRoutes(os.Stdout)
+
+Routes added directly with Router.AddRoute are not listed.
+*/
+func (svc *Service) PrintRoutes(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tRESOURCE\tFILTERS")
+	for _, e := range svc.routeEntries() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.method, e.host+e.path, e.resource, e.filterNames())
+	}
+	return tw.Flush()
+}
+
+/*
+Doctor checks the service for common misconfigurations and returns a list of
+the problems found, or nil if none. Each problem is also logged at LevelWarn.
+The checks are: no JSON encoder, which is the default representation;
+encoders whose media type can't be requested by subtype; routes added more
+than once, where only the last handler is used; routes that conflict with
+routes added before, where the order decides which is matched; and entities
+and filters that were ignored.
+
+	if problems := svc.Doctor(); problems != nil {
+		os.Exit(1)
+	}
+*/
+func (svc *Service) Doctor() []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		svc.log.Warnf("relax: Doctor: %s", msg)
+		problems = append(problems, msg)
+	}
+
+	if _, ok := svc.encoders["application/json"]; !ok {
+		report("no encoder for the default media type %q", "application/json")
+	}
+	for mt := range svc.encoders {
+		if exts, _ := mime.ExtensionsByType(mt); len(exts) == 0 {
+			report("encoder for %q can't be requested by subtype, the media type has no file extension", mt)
+		}
+	}
+
+	seen := make(map[string]int)
+	routes := svc.routeEntries()
+	for i, e := range routes {
+		key := e.key()
+		if n, ok := seen[key]; ok {
+			report("route %q is added more than once, by resources %q and %q", key, routes[n].resource, e.resource)
+			continue
+		}
+		seen[key] = i
+		for _, other := range routes[:i] {
+			if other.method == e.method && other.host == e.host && conflicts(other.path, e.path) {
+				report("route %q conflicts with %q, which is matched first", key, other.key())
+				break
+			}
+		}
+	}
+
+	for _, entity := range svc.ignored {
+		report("ignored entity, %s", entity)
+	}
+
+	return problems
+}
+
+// conflicts returns true if some requests can be matched by both path patterns
+// 'a' and 'b', and the order they were added decides which route is used. That
+// is, at every path segment the patterns are equal, or both are PSE's with the
+// same precedence. For example, "{word:name}" and "{uint:id}", or "{item}"
+// and "{name}". See also: segmentRank
+func conflicts(a, b string) bool {
+	if a == b {
+		return false
+	}
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if as[i] == bs[i] {
+			continue
+		}
+		ra, rb := segmentRank(as[i]), segmentRank(bs[i])
+		if ra == rankStatic || ra != rb {
+			return false
+		}
+	}
+	return true
+}
+
+// routeConflict returns an ErrRouteConflict error if the route (method + path)
+// conflicts with a route added before to the resource host, or nil if none.
+func (r *Resource) routeConflict(method, path string) error {
+	path = strings.TrimRight(path, "/")
+	host := r.hostName()
+	for _, e := range r.service.routeEntries() {
+		if e.method == method && e.host == host && conflicts(e.path, path) {
+			return fmt.Errorf("%w: %s %s with %s", ErrRouteConflict, method, host+path, e.key())
+		}
+	}
+	return nil
+}
+
+// isPattern returns true if the path segment is a PSE.
+func isPattern(pseg string) bool {
+	return (strings.Contains(pseg, "{") && strings.Contains(pseg, "}")) || strings.Contains(pseg, "*")
+}
+
+// isCatchAll returns true if the path segment is a single "{varname}" PSE.
+func isCatchAll(pseg string) bool {
+	return strings.HasPrefix(pseg, "{") && strings.HasSuffix(pseg, "}") &&
+		!strings.ContainsAny(pseg[1:len(pseg)-1], ":{}")
+}
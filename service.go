@@ -5,10 +5,14 @@
 package relax
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"context"
@@ -34,6 +38,8 @@ type Service struct {
 	URI *url.URL
 	// router is the routing engine
 	router Router
+	// negotiator does content negotiation, if nil VendorNegotiator is used.
+	negotiator Negotiator
 	// encoders contains a list of our service media encoders.
 	// Format: {mediatype}:{encoder object}. e.g., encoders["application/json"].
 	encoders map[string]Encoder
@@ -41,32 +47,116 @@ type Service struct {
 	filters []Filter
 	// resources is a list of all mapped resources
 	resources []*Resource
+	// routes is a list of all the routes added through resources.
+	routes []*routeEntry
+	// versions are the API versions, oldest first. See Service.Version.
+	versions []*APIVersion
+	// hosts are the virtual hosts, see Host.
+	hosts map[string]*Host
+	// scopedEncoders is true if resources have their own encoders, see
+	// Resource.UseEncoder.
+	scopedEncoders bool
+	// routeCacheSize is the size of the router caches, see CacheRoutes.
+	routeCacheSize int
+	// requestTimeout is the request deadline, see RequestTimeout.
+	requestTimeout time.Duration
+	// cookieKeys holds the *cookieKeyring of signed and encrypted cookies.
+	// See CookieKey.
+	cookieKeys atomic.Value
+	// routesMu guards routes, names and entries, which change when resource
+	// routes are added, removed or replaced while requests are served.
+	routesMu sync.RWMutex
+	// names are the named routes, see URLFor.
+	names map[string]*routeEntry
+	// entries are the routes of the resources by key, see routeEntry.key.
+	// They are found with the path pattern of the router. See RouteFilters.
+	entries map[string]*routeEntry
+	// ignored is a list of the entities ignored by Use.
+	ignored []string
 	// uptime is a timestamp when service was started
 	uptime time.Time
-	// logger is the service logging system.
-	logger Logger
+	// log is the service logging system.
+	log *Log
 	// Recovery is a handler function used to intervene after panic occur.
-	Recovery http.HandlerFunc
+	// Handlers with the former http.HandlerFunc signature can be used with
+	// RecoveryFunc. Defaults to Recover.
+	Recovery RecoveryHandler
+	// EncodeFailure is a handler function used to respond when Context.Respond
+	// can't encode a response value. Defaults to EncodeFailed.
+	EncodeFailure EncodeFailureHandler
+	// ResponseWrapper if set, is called by Context.Respond with the response
+	// value before it's encoded, and the value it returns is encoded instead.
+	// See: Context.Respond
+	ResponseWrapper func(ctx *Context, v interface{}) interface{}
+	// Catalog contains the localized messages used in error responses.
+	// If nil, messages are sent in their default language (English).
+	Catalog Catalog
+	// Strict if true, Use and Resource panic when an entity or filter is
+	// ignored, so misconfigurations are found at startup instead of
+	// shipping filters that do nothing.
+	Strict bool
+	// PathExtensions if true, the response media type can be requested with
+	// an extension in the URL path, such as "/users.xml". See: Content
+	PathExtensions bool
+	// MediaAliases maps legacy media type names to the media types used
+	// during content negotiation, so older clients keep working while media
+	// types are migrated. See: Content
+	MediaAliases map[string]string
+	// MatrixParams if true, requests with matrix parameters in path segments,
+	// such as "/cities;country=US/list", that don't match a route are matched
+	// without them; and the parameters are added to Context.PathValues, such
+	// as "country". Segments matched by PSE's with ";", such as geo, keep
+	// their parameters.
+	MatrixParams bool
+	// IgnoreCase if true, request paths match routes ignoring the case of
+	// their static segments, so "/V1/Users" is served by "/v1/users".
+	// See: CanonicalRouter
+	IgnoreCase bool
+	// RedirectTrailingSlash if true, requests with a trailing slash, such as
+	// "/v1/users/", are redirected to the canonical path of the route. With
+	// IgnoreCase, requests with a different case are redirected too instead
+	// of served. The redirect is 301-"Moved Permanently" for GET and HEAD, and
+	// 308-"Permanent Redirect" for other methods. See: CanonicalRouter
+	RedirectTrailingSlash bool
+	// RouteConflicts if true, Route checks that new routes don't conflict with
+	// routes added before, where the order they were added decides which route
+	// is matched, such as "{word:name}" and "{uint:id}". Conflicts are logged,
+	// or panic if Strict is true.
+	RouteConflicts bool
+	// TraceRoutes if true, the routes tried for requests that don't match a
+	// route are logged at LevelDebug, to find why a PSE doesn't match.
+	// See: RouteTracer
+	TraceRoutes bool
+	// TraceHeader is the name of a request header, such as "X-Trace-Route",
+	// that sends the routes tried in the details of 404 responses when the
+	// request has it, see RouteTraceDetails. The trace shows the routes of the
+	// service, so it should only be set in development. Empty disables it.
+	TraceHeader string
+	// ReadyGate if true, requests to resources that implement Readier and are
+	// not ready get a 503-"Service Unavailable" response. See: Readier
+	ReadyGate bool
 }
 
 // Logf prints an log entry to logger if set, or stdlog if nil.
 // Based on the unexported function logf() in ``net/http``.
+// Entries are logged at LevelInfo, see Log for other levels.
 func (svc *Service) Logf(format string, args ...interface{}) {
-	if svc.logger == nil {
-		log.Printf(format, args...)
-		return
-	}
-	svc.logger.Printf(format, args...)
+	svc.log.Infof(format, args...)
 }
 
 // Index is a handler that responds with a list of all resources managed
 // by the service. This is the default route to the base URI.
 // With this function Service implements the Resourcer interface which is
 // a resource of itself (the "root" resource).
+// Resources that are hidden, or need auth scopes the requester doesn't have,
+// are not listed. See: Resource.Hidden, Resource.Scopes
 // FIXME: this pukes under XML (maps of course).
 func (svc *Service) Index(ctx *Context) {
 	resources := make(map[string]string)
 	for _, r := range svc.resources {
+		if !r.visible(ctx) {
+			continue
+		}
 		resources[r.name] = r.Path(true)
 		for _, l := range r.links {
 			if l.Rel == "collection" {
@@ -93,60 +183,124 @@ func (svc *Service) Options(ctx *Context) {
 }
 
 // InternalServerError responds with HTTP status code 500-"Internal Server Error".
-// This function is the default service recovery handler.
+// It was the default service recovery handler, see Recover.
 func InternalServerError(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// RecoveryHandler responds to a request after its handler panics with 'err'.
+// 'ctx' is the request context, with the request ID, the negotiated encoder
+// and the response headers set before the panic. See: Service.Recovery
+type RecoveryHandler func(ctx *Context, err interface{})
+
+// RecoveryFunc adapts 'h', a recovery handler with the former http.HandlerFunc
+// signature, to a RecoveryHandler. The response keeps the headers set before
+// the panic.
+//
+//	svc.Recovery = relax.RecoveryFunc(myRecovery)
+func RecoveryFunc(h http.HandlerFunc) RecoveryHandler {
+	return func(ctx *Context, err interface{}) {
+		h(ctx, ctx.Request)
+	}
+}
+
+// Recover responds with HTTP status code 500-"Internal Server Error", encoded
+// with the negotiated encoder, so the response has the same content type and
+// request ID as others. It does nothing if the response was already started,
+// with WriteHeader or by writing content.
+// This function is the default service recovery handler.
+func Recover(ctx *Context, err interface{}) {
+	if ctx.wroteHeader {
+		return
+	}
+	if ctx.Encode == nil {
+		InternalServerError(ctx, ctx.Request)
+		return
+	}
+	ctx.Error(errInternal.Code, errInternal.Message)
+}
+
 // dispatch tries to connect the request to a resource handler. If it can't find
 // an appropriate handler it will return an HTTP error response.
 func (svc *Service) dispatch(ctx *Context) {
-	handler, err := svc.router.FindHandler(ctx.Request.Method, ctx.Request.URL.Path, &ctx.PathValues)
+	handler, router, err := svc.findHandler(ctx.Request, &ctx.PathValues, &ctx.PathParams)
+	if svc.IgnoreCase || svc.RedirectTrailingSlash {
+		if path, ok := svc.canonicalPath(ctx.Request, err); ok {
+			if svc.RedirectTrailingSlash {
+				u := *ctx.Request.URL
+				u.Path, u.RawPath = path, ""
+				code := http.StatusMovedPermanently
+				if ctx.Request.Method != "GET" && ctx.Request.Method != "HEAD" {
+					code = http.StatusPermanentRedirect
+				}
+				ctx.Header().Set("Location", u.RequestURI())
+				ctx.WriteHeader(code)
+				return
+			}
+			ctx.Request.URL.Path, ctx.Request.URL.RawPath = path, ""
+			ctx.PathValues, ctx.PathParams = nil, nil
+			handler, router, err = svc.findHandler(ctx.Request, &ctx.PathValues, &ctx.PathParams)
+		}
+	}
 	if err != nil {
 		ctx.Header().Set("Cache-Control", "max-age=300, stale-if-error=600")
 		if err == ErrRouteBadMethod { // 405-Method Not Allowed
-			ctx.Header().Set("Allow", svc.router.PathMethods(ctx.Request.URL.Path))
+			ctx.Header().Set("Allow", router.PathMethods(ctx.Request.URL.Path))
+		}
+		if err == ErrRouteNotFound && svc.tracing(ctx.Request) {
+			trace := svc.traceRoute(ctx.Request)
+			if svc.TraceRoutes {
+				ctx.Debugf("relax: Route trace %s %s: host=%v service=%v", trace.Method, trace.Path, trace.Host, trace.Service)
+			}
+			if svc.TraceHeader != "" && ctx.Request.Header.Get(svc.TraceHeader) != "" {
+				ctx.Error(http.StatusNotFound, err.Error(), trace)
+				return
+			}
 		}
 		ctx.Error(err.(*StatusError).Code, err.Error(), err.(*StatusError).Details)
 		return
 	}
+	setPathValues(ctx.Request, ctx.PathValues)
 	handler(ctx)
 }
 
 /*
 Adapter creates a new request context, sets default HTTP headers, creates the
 link-chain of service filters, then passes the request to content negotiation.
-Also, it uses a recovery function for panics, that responds with HTTP status
-500-"Internal Server Error" and logs the event.
+Also, it uses a recovery function for panics, Service.Recovery, that by default
+responds with HTTP status 500-"Internal Server Error" and logs the event.
 
 Info passed down by the adapter:
 
 	ctx.Get("request.start_time").(time.Time)  // Time when request started, as string time.Time.
 	ctx.Get("request.id").(string)             // Unique or user-supplied request ID.
 
+The Context is done when the client disconnects, or when the request deadline
+is exceeded, see RequestTimeout.
+
 Returns an http.HandlerFunc function that can be used with http.Handle.
 */
 func (svc *Service) Adapter() http.HandlerFunc {
 	handler := svc.dispatch
 	for i := len(svc.filters) - 1; i >= 0; i-- {
-		handler = svc.filters[i].Run(handler)
+		handler = runFilter(svc.filters[i], handler)
 	}
 	handler = svc.content(handler)
 
-	// parent context
-	parent := context.Background()
-
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := newContext(r.Context(), w, r)
+		ctx.service = svc
 		defer func() {
 			if err := recover(); err != nil {
-				svc.Recovery(w, r)
-				svc.Logf("relax: Panic recovery: %s", err)
+				ctx.runPanicHooks(err)
+				if svc.Recovery != nil {
+					svc.Recovery(ctx, err)
+				}
+				svc.log.Errorf("relax: Panic recovery: %s", err)
 			}
+			ctx.free()
 		}()
 
-		ctx := newContext(parent, w, r)
-		defer ctx.free()
-
 		requestID := NewRequestID(r.Header.Get("Request-Id"))
 
 		ctx.Set("request.start_time", time.Now())
@@ -156,7 +310,17 @@ func (svc *Service) Adapter() http.HandlerFunc {
 		ctx.Header().Set("Server", serverVersion)
 		ctx.Header().Set("Request-Id", requestID)
 
+		if svc.requestTimeout > 0 {
+			c, cancel := context.WithTimeout(ctx.Context, svc.requestTimeout)
+			defer cancel()
+			ctx.Context, ctx.Request = c, r.WithContext(c)
+		}
+
 		handler(ctx)
+		if ctx.Context.Err() == context.DeadlineExceeded {
+			svc.timedOut(ctx)
+		}
+		ctx.sendTrailers()
 	}
 }
 
@@ -231,6 +395,11 @@ Router interface:
 
 	myservice.Use(MyFastRouter())
 
+To change the content negotiation, assign an object that implements the
+Negotiator interface:
+
+	myservice.Use(relax.NegotiatorFunc(myNegotiate))
+
 To change the logging system, assign an object that implements the Logger
 interface:
 
@@ -245,30 +414,82 @@ interface:
 	}
 	myservice.Use(log)
 
-Any entities that don't implement the required interfaces, will be ignored.
+The logger is wrapped in the service Log, which adds level support. Loggers
+that implement LeveledLogger, like logrus, get entries in their level methods.
+
+Any entities that don't implement the required interfaces, will be ignored
+and logged; or cause a panic if Strict is true. See also: UseE, Doctor
 */
 func (svc *Service) Use(entities ...interface{}) *Service {
 	for _, e := range entities {
-		switch entity := e.(type) {
-		case LimitedFilter:
-			if !e.(LimitedFilter).RunIn(svc) {
-				svc.Logf("relax: Filter not usable for service: %T", entity)
-			}
-		case Encoder:
-			svc.encoders[entity.Accept()] = entity
-		case Filter:
-			svc.filters = append(svc.filters, entity)
-		case Router:
-			svc.router = entity
-		case Logger:
-			svc.logger = entity
-		default:
-			svc.Logf("relax: Unknown entity to use: %T", entity)
+		if err := svc.use(e); err != nil {
+			svc.ignore(err)
 		}
 	}
 	return svc
 }
 
+/*
+UseE is like Use but returns an error if any of the entities is ignored,
+instead of only logging it. The error is a *UseError with all the entities
+ignored; the other entities are still used.
+
+	if err := myservice.UseE(&cors.Filter{}, myEncoder); err != nil {
+		log.Fatal(err)
+	}
+*/
+func (svc *Service) UseE(entities ...interface{}) error {
+	var errs []error
+	for _, e := range entities {
+		if err := svc.use(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return &UseError{Errors: errs}
+	}
+	return nil
+}
+
+// use adds an entity to the service, or returns an error if it's not usable.
+func (svc *Service) use(e interface{}) error {
+	switch entity := e.(type) {
+	case Encoder:
+		svc.encoders[entity.Accept()] = entity
+	case Filter:
+		if l, ok := entity.(LimitedFilter); ok && !l.RunIn(svc) {
+			return fmt.Errorf("%w: %T", ErrFilterNotUsable, entity)
+		}
+		if _, ok := entity.(Logger); ok {
+			svc.log.Warnf("relax: %T implements both Filter and Logger, it's used as Filter", entity)
+		}
+		svc.filters = append(svc.filters, entity)
+	case Router:
+		svc.router = entity
+	case Negotiator:
+		svc.negotiator = entity
+	case *Log:
+		svc.log = entity
+	case Logger:
+		level := svc.log.Level()
+		svc.log = NewLog(entity)
+		svc.log.SetLevel(level)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnknownEntity, entity)
+	}
+	return nil
+}
+
+// ignore logs an entity that was not used, and records it for Doctor.
+// In Strict mode it panics instead.
+func (svc *Service) ignore(err error) {
+	if svc.Strict {
+		panic(err)
+	}
+	svc.log.Warnf("%s", err)
+	svc.ignored = append(svc.ignored, err.Error())
+}
+
 /*
 Router returns the service routing engine.
 
@@ -290,9 +511,31 @@ func (svc *Service) Router() Router {
 	return svc.router
 }
 
-// Logger returns the service logging system.
+// Negotiator returns the service content negotiator.
+func (svc *Service) Negotiator() Negotiator {
+	if svc.negotiator == nil {
+		return VendorNegotiator{}
+	}
+	return svc.negotiator
+}
+
+// Logger returns the service logging system, or nil if it's the standard log.
 func (svc *Service) Logger() Logger {
-	return svc.logger
+	return svc.log.Logger()
+}
+
+// Log returns the service leveled logging facade. Each service has its own,
+// so the level of one service doesn't affect others.
+func (svc *Service) Log() *Log {
+	return svc.log
+}
+
+// SetLogLevel changes the service log level, it's safe to use while serving
+// requests.
+//
+//	svc.SetLogLevel(relax.LevelDebug)
+func (svc *Service) SetLogLevel(level Level) {
+	svc.log.SetLevel(level)
 }
 
 // Uptime returns the service uptime in seconds.
@@ -372,7 +615,8 @@ func (svc *Service) Run(args ...string) {
 	}
 
 	if err != nil {
-		log.Fatal(err)
+		svc.log.Errorf("relax: %s", err)
+		os.Exit(1)
 	}
 }
 
@@ -404,13 +648,15 @@ func NewService(uri string, entities ...interface{}) *Service {
 	u.Fragment = ""
 
 	svc := &Service{
-		URI:       u,
-		router:    newRouter(),
-		encoders:  make(map[string]Encoder),
-		filters:   make([]Filter, 0),
-		resources: make([]*Resource, 0),
-		uptime:    time.Now(),
-		Recovery:  InternalServerError,
+		URI:           u,
+		router:        newRouter(),
+		encoders:      make(map[string]Encoder),
+		filters:       make([]Filter, 0),
+		resources:     make([]*Resource, 0),
+		uptime:        time.Now(),
+		log:           NewLog(nil),
+		Recovery:      Recover,
+		EncodeFailure: EncodeFailed,
 	}
 
 	// Make JSON the default encoder
@@ -436,7 +682,7 @@ func NewService(uri string, entities ...interface{}) *Service {
 
 	svc.resources = append(svc.resources, root)
 
-	log.Printf("relax: New service %q", u.String())
+	svc.Logf("relax: New service %q", u.String())
 
 	return svc
 }
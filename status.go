@@ -0,0 +1,171 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// statusText is the registry of HTTP status codes and their reason phrases.
+// See: https://www.rfc-editor.org/rfc/rfc9110#section-15
+var statusText = map[int]string{
+	100: "Continue",
+	101: "Switching Protocols",
+	102: "Processing",
+	103: "Early Hints",
+
+	200: "OK",
+	201: "Created",
+	202: "Accepted",
+	203: "Non-Authoritative Information",
+	204: "No Content",
+	205: "Reset Content",
+	206: "Partial Content",
+	207: "Multi-Status",
+	208: "Already Reported",
+	226: "IM Used",
+
+	300: "Multiple Choices",
+	301: "Moved Permanently",
+	302: "Found",
+	303: "See Other",
+	304: "Not Modified",
+	305: "Use Proxy",
+	307: "Temporary Redirect",
+	308: "Permanent Redirect",
+
+	400: "Bad Request",
+	401: "Unauthorized",
+	402: "Payment Required",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	406: "Not Acceptable",
+	407: "Proxy Authentication Required",
+	408: "Request Timeout",
+	409: "Conflict",
+	410: "Gone",
+	411: "Length Required",
+	412: "Precondition Failed",
+	413: "Content Too Large",
+	414: "URI Too Long",
+	415: "Unsupported Media Type",
+	416: "Range Not Satisfiable",
+	417: "Expectation Failed",
+	418: "I'm a teapot",
+	421: "Misdirected Request",
+	422: "Unprocessable Content",
+	423: "Locked",
+	424: "Failed Dependency",
+	425: "Too Early",
+	426: "Upgrade Required",
+	428: "Precondition Required",
+	429: "Too Many Requests",
+	431: "Request Header Fields Too Large",
+	451: "Unavailable For Legal Reasons",
+
+	500: "Internal Server Error",
+	501: "Not Implemented",
+	502: "Bad Gateway",
+	503: "Service Unavailable",
+	504: "Gateway Timeout",
+	505: "HTTP Version Not Supported",
+	506: "Variant Also Negotiates",
+	507: "Insufficient Storage",
+	508: "Loop Detected",
+	510: "Not Extended",
+	511: "Network Authentication Required",
+}
+
+var statusMu sync.RWMutex
+
+/*
+StatusTextHook if set, is called by StatusText to get the reason phrase of a
+status code, so phrases can be customized or localized. If it returns an empty
+string, the registry phrase is used.
+
+	relax.StatusTextHook = func(code int) string {
+		if code == http.StatusTooManyRequests {
+			return "Slow Down"
+		}
+		return ""
+	}
+
+The hook must be set before the service starts.
+*/
+var StatusTextHook func(code int) string
+
+/*
+StatusText returns the reason phrase of HTTP status 'code', from the hook
+StatusTextHook or the status registry. The registry has all the codes in
+RFC 9110 and the common extensions (WebDAV, RFC 6585, RFC 8297, RFC 8470, ...).
+Codes not in the registry return "Status {code}".
+
+Status code constants are in net/http, such as http.StatusTooEarly.
+*/
+func StatusText(code int) string {
+	if StatusTextHook != nil {
+		if text := StatusTextHook(code); text != "" {
+			return text
+		}
+	}
+	statusMu.RLock()
+	text, ok := statusText[code]
+	statusMu.RUnlock()
+	if !ok {
+		return "Status " + strconv.Itoa(code)
+	}
+	return text
+}
+
+// RegisterStatus adds status 'code' with reason phrase 'text' to the registry,
+// or replaces the phrase of a registered code. Codes must be between 100 and 999.
+//
+//	relax.RegisterStatus(599, "Network Connect Timeout Error")
+func RegisterStatus(code int, text string) {
+	if code < 100 || code > 999 {
+		panic("relax: invalid status code: " + strconv.Itoa(code))
+	}
+	statusMu.Lock()
+	statusText[code] = text
+	statusMu.Unlock()
+}
+
+// StatusText returns the reason phrase of HTTP status 'code', localized to
+// the content language of the request with the service Catalog.
+// See also: StatusText
+func (ctx *Context) StatusText(code int) string {
+	return ctx.Localize(StatusText(code))
+}
+
+// BodyAllowed returns true if responses with status 'code' can have content.
+// Informational (1xx), 204-"No Content", 205-"Reset Content" and 304-"Not Modified"
+// responses can't. See: https://www.rfc-editor.org/rfc/rfc9110#section-6.4.1
+func BodyAllowed(code int) bool {
+	switch {
+	case code >= 100 && code < 200:
+		return false
+	case code == http.StatusNoContent, code == http.StatusResetContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// contentHeaders are the headers that describe response content, removed from
+// responses that can't have content.
+var contentHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Encoding", "Content-Language",
+	"Content-Range", "Transfer-Encoding",
+}
+
+// stripContentHeaders removes the content headers from 'header', for responses
+// that can't have content.
+func stripContentHeaders(header http.Header) {
+	for _, k := range contentHeaders {
+		header.Del(k)
+	}
+}
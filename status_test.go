@@ -0,0 +1,56 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatusText(t *testing.T) {
+	RegisterStatus(599, "Network Connect Timeout Error")
+	defer func() {
+		statusMu.Lock()
+		delete(statusText, 599)
+		statusMu.Unlock()
+	}()
+
+	tests := []struct {
+		Code int
+		Hook func(int) string
+		Text string
+	}{
+		{http.StatusOK, nil, "OK"},
+		{http.StatusTooEarly, nil, "Too Early"},
+		{http.StatusUnprocessableEntity, nil, "Unprocessable Content"},
+		{599, nil, "Network Connect Timeout Error"},
+		{799, nil, "Status 799"},
+		{http.StatusTooManyRequests, func(code int) string {
+			if code == http.StatusTooManyRequests {
+				return "Slow Down"
+			}
+			return ""
+		}, "Slow Down"},
+		{http.StatusNotFound, func(int) string { return "" }, "Not Found"},
+	}
+	for i, tt := range tests {
+		StatusTextHook = tt.Hook
+		if text := StatusText(tt.Code); text != tt.Text {
+			t.Errorf("%d: expected %q, got %q", i, tt.Text, text)
+		}
+	}
+	StatusTextHook = nil
+
+	for _, code := range []int{0, 99, 1000} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for status %d", code)
+				}
+			}()
+			RegisterStatus(code, "Bad")
+		}()
+	}
+}
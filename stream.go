@@ -0,0 +1,72 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"io"
+	"net/http"
+)
+
+// Flush implements http.Flusher. It sends the response written so far to the
+// client, if the ResponseWriter supports it. Writers set by filters are
+// unwrapped until one that supports it is found, if they have an Unwrap method
+// like Context. Filters that buffer the response, such as gzip and etag, keep
+// the content until the handler returns.
+func (ctx *Context) Flush() {
+	w := ctx.ResponseWriter
+	for w != nil {
+		switch v := w.(type) {
+		case http.Flusher:
+			v.Flush()
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+/*
+Stream sends the response in parts, as they are made, instead of encoding it
+all at once. 'step' writes the next part to 'w' and returns true if there are
+more parts; each part is flushed to the client after it's written. Streaming
+stops when 'step' returns false, or when the request Context is done, such as
+when the client disconnects.
+
+	func (r *Reports) Export(ctx *relax.Context) {
+		rows := r.query(ctx)
+		ctx.Header().Set("Content-Type", "text/csv")
+		ctx.Stream(func(w io.Writer) bool {
+			if !rows.Next() {
+				return false
+			}
+			fmt.Fprintln(w, rows.CSV())
+			return true
+		})
+	}
+
+The response status is 200-"OK", unless it was set with WriteHeader before
+streaming. The Content-Type header should be set before calling Stream.
+Returns the Context error if streaming stopped because the Context is done,
+or nil otherwise.
+*/
+func (ctx *Context) Stream(step func(w io.Writer) bool) error {
+	if !ctx.wroteHeader {
+		ctx.WriteHeader(http.StatusOK)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		more := step(ctx)
+		ctx.Flush()
+		if !more {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+	"time"
+)
+
+/*
+RequestTimeout sets a deadline of 'd' to all requests. The request Context, and
+Request.Context(), are cancelled when the deadline is exceeded, as when the
+client disconnects; so handlers, and the calls they make, can stop early:
+
+	svc.RequestTimeout(5 * time.Second)
+
+	func (r *Reports) Read(ctx *relax.Context) {
+		rows, err := r.db.QueryContext(ctx, query) // cancelled after 5s
+		...
+		select {
+		case <-ctx.Done():
+			return
+		case report := <-build(rows):
+			ctx.Respond(report)
+		}
+	}
+
+Handlers are not interrupted, they must return when the Context is done. If the
+deadline was exceeded and the handler didn't send a response, the response has
+HTTP status 503-"Service Unavailable". Zero disables the deadline.
+Returns the service itself, for chaining.
+*/
+func (svc *Service) RequestTimeout(d time.Duration) *Service {
+	svc.requestTimeout = d
+	return svc
+}
+
+// timedOut responds to a request whose deadline was exceeded, unless the
+// response was already sent.
+func (svc *Service) timedOut(ctx *Context) {
+	if ctx.wroteHeader {
+		return
+	}
+	if ctx.Encode == nil {
+		http.Error(ctx, errTimedOut.Message, errTimedOut.Code)
+		return
+	}
+	ctx.Error(errTimedOut.Code, errTimedOut.Message)
+}
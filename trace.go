@@ -0,0 +1,150 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RouteTracer is implemented by routers that can explain how a path was
+// matched, such as the default router. See: Service.TraceRoutes
+type RouteTracer interface {
+	// TraceRoute returns the route segments tried to match the route
+	// (method + path), in order.
+	TraceRoute(method, path string) []TraceStep
+}
+
+// Results of a TraceStep.
+const (
+	TraceMatch     = "match"      // the segment matched, and a route below
+	TraceMismatch  = "mismatch"   // the segment didn't match
+	TracePartial   = "partial"    // the PSE regexp matched only part of the segment
+	TraceDeadEnd   = "dead end"   // the segment matched, but no route below
+	TraceNoHandler = "no handler" // the segment matched, but no route ends there
+	TraceNoMethod  = "no method"  // no routes have the method
+)
+
+// TraceStep is a route segment tried by the router to match a path segment.
+type TraceStep struct {
+	// Depth is the index of the path segment; the method is 0.
+	Depth int `json:"depth"`
+	// Segment is the path segment, or the method.
+	Segment string `json:"segment"`
+	// Node is the route segment tried, such as "users" or "{uint:id}".
+	Node string `json:"node"`
+	// Pattern is the regexp of PSE nodes.
+	Pattern string `json:"pattern,omitempty"`
+	// Match is the part of the segment matched by Pattern, for partial matches.
+	Match string `json:"match,omitempty"`
+	// Result is one of TraceMatch, TraceMismatch, TracePartial, TraceDeadEnd,
+	// TraceNoHandler or TraceNoMethod.
+	Result string `json:"result"`
+}
+
+// RouteTraceDetails are the details of 404 responses with route tracing.
+// See: Service.TraceRoutes
+type RouteTraceDetails struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Host are the steps in the routes of the request host, if any.
+	Host []TraceStep `json:"host,omitempty"`
+	// Service are the steps in the service routes.
+	Service []TraceStep `json:"service"`
+}
+
+// trace is like match, but appends the route segments tried to 'steps', at
+// path segment index 'depth'. Returns true if a route matches.
+func (n *trieNode) trace(psegs []string, exps map[string]*regexp.Regexp, depth int, steps *[]TraceStep) bool {
+	if len(psegs) == 0 {
+		return n.handler != nil
+	}
+	for _, link := range n.links {
+		step := TraceStep{Depth: depth, Segment: psegs[0], Node: link.pseg}
+		switch link.rank {
+		case rankStatic:
+			if link.pseg != psegs[0] {
+				step.Result = TraceMismatch
+				*steps = append(*steps, step)
+				continue
+			}
+		case rankRest:
+			step.Segment = strings.Join(psegs, "/")
+			step.Result = TraceMatch
+			if link.handler == nil {
+				step.Result = TraceNoHandler
+			}
+			*steps = append(*steps, step)
+			if link.handler != nil {
+				return true
+			}
+			continue
+		default:
+			rx := exps[link.pseg]
+			step.Pattern = rx.String()
+			if m := rx.FindString(psegs[0]); m != psegs[0] {
+				step.Result = TraceMismatch
+				if m != "" {
+					step.Result, step.Match = TracePartial, m
+				}
+				*steps = append(*steps, step)
+				continue
+			}
+		}
+		idx := len(*steps)
+		*steps = append(*steps, step)
+		if link.trace(psegs[1:], exps, depth+1, steps) {
+			(*steps)[idx].Result = TraceMatch
+			return true
+		}
+		(*steps)[idx].Result = TraceDeadEnd
+		if len(psegs) == 1 {
+			(*steps)[idx].Result = TraceNoHandler
+		}
+	}
+	return false
+}
+
+// TraceRoute implements RouteTracer.
+func (r *trieRegexpRouter) TraceRoute(method, path string) []TraceStep {
+	if method == "HEAD" {
+		method = "GET"
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	steps := []TraceStep{}
+	root := r.root.findLink(method)
+	if root == nil {
+		return append(steps, TraceStep{Segment: method, Node: method, Result: TraceNoMethod})
+	}
+	steps = append(steps, TraceStep{Segment: method, Node: method, Result: TraceMatch})
+	pseg := strings.Split(strings.TrimRight(path, "/"), "/")
+	if !root.trace(pseg[1:], r.exps, 1, &steps) {
+		steps[0].Result = TraceDeadEnd
+	}
+	return steps
+}
+
+// tracing returns true if route tracing is enabled for request 'r'.
+// See: TraceRoutes, TraceHeader
+func (svc *Service) tracing(r *http.Request) bool {
+	return svc.TraceRoutes || (svc.TraceHeader != "" && r.Header.Get(svc.TraceHeader) != "")
+}
+
+// traceRoute returns the trace of the routes tried for request 'r', in the
+// request host and service routers that implement RouteTracer.
+func (svc *Service) traceRoute(r *http.Request) *RouteTraceDetails {
+	details := &RouteTraceDetails{Method: r.Method, Path: r.URL.Path}
+	if h, ok := svc.hosts[hostName(r.Host)]; ok {
+		if rt, ok := h.router.(RouteTracer); ok {
+			details.Host = rt.TraceRoute(r.Method, r.URL.Path)
+		}
+	}
+	if rt, ok := svc.router.(RouteTracer); ok {
+		details.Service = rt.TraceRoute(r.Method, r.URL.Path)
+	}
+	return details
+}
@@ -0,0 +1,131 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/http"
+)
+
+// ErrDigestAlgorithm is returned by DigestTrailer when the digest algorithm
+// is not supported.
+var ErrDigestAlgorithm = errors.New("relax: Unsupported digest algorithm")
+
+// trailers are the response trailers of a request. They are shared by the
+// request context and its clones, so trailers declared by any handler are
+// sent, and the digest is computed from the content sent to the client.
+type trailers struct {
+	root   *Context
+	names  []string
+	values map[string]func() string
+	alg    string
+	hash   hash.Hash
+}
+
+// reset clears the trailers, for context 'root'.
+func (t *trailers) reset(root *Context) {
+	t.root = root
+	t.names = t.names[:0]
+	t.values = nil
+	t.alg = ""
+	t.hash = nil
+}
+
+/*
+Trailer declares the response trailer 'name', with its value returned by
+'value' after the handlers are done. Trailers allow sending metadata computed
+while the response is streamed, such as checksums, without buffering.
+
+	ctx.Trailer("X-Row-Count", func() string { return strconv.Itoa(rows) })
+	for rows = 0; cursor.Next(); rows++ {
+		ctx.Encode(ctx, cursor.Item())
+	}
+
+Trailers should be declared before the response headers are written, so
+they are listed in the Trailer header. Trailers declared later are still sent
+if the client supports them, see http.TrailerPrefix. Trailers with an empty
+value are not sent, and a nil 'value' is ignored.
+*/
+func (ctx *Context) Trailer(name string, value func() string) {
+	if value == nil {
+		return
+	}
+	if ctx.trailers == nil {
+		ctx.trailers = &trailers{root: ctx}
+	}
+	t := ctx.trailers
+	name = http.CanonicalHeaderKey(name)
+	if t.values == nil {
+		t.values = make(map[string]func() string)
+	}
+	if _, ok := t.values[name]; !ok {
+		t.names = append(t.names, name)
+		if !t.root.wroteHeader {
+			t.root.Header().Add("Trailer", name)
+		}
+	}
+	t.values[name] = value
+}
+
+/*
+DigestTrailer computes a digest of the response content, as sent to the client,
+and sends it in the trailer "Content-Digest". The algorithm 'alg' is "sha-256"
+or "sha-512". It must be called before the response content is written.
+
+	Content-Digest: sha-256=:RK/0qy18MlBSVnWgjwz6lZEWjP/lF5HF9bvEF8FabDg=:
+
+The digest is computed from the content written to the request context,
+directly or flushed from response buffers of its clones. Filters that write
+to the underlying ResponseWriter, such as the gzip filter, bypass it and the
+digest doesn't match their content; don't use both in the same route.
+
+Returns ErrDigestAlgorithm if the algorithm is not supported.
+See: https://www.rfc-editor.org/rfc/rfc9530
+*/
+func (ctx *Context) DigestTrailer(alg string) error {
+	var h hash.Hash
+	switch alg {
+	case "sha-256":
+		h = sha256.New()
+	case "sha-512":
+		h = sha512.New()
+	default:
+		return ErrDigestAlgorithm
+	}
+	ctx.Trailer("Content-Digest", func() string {
+		t := ctx.trailers
+		return t.alg + "=:" + base64.StdEncoding.EncodeToString(t.hash.Sum(nil)) + ":"
+	})
+	ctx.trailers.alg, ctx.trailers.hash = alg, h
+	return nil
+}
+
+// sendTrailers sets the values of the declared trailers, after the handlers
+// are done. net/http sends them after the response content.
+func (ctx *Context) sendTrailers() {
+	t := ctx.trailers
+	if t == nil || len(t.names) == 0 || ctx.hijacked {
+		return
+	}
+	declared := ctx.Header()["Trailer"]
+	for _, name := range t.names {
+		value := t.values[name]()
+		if value == "" {
+			continue
+		}
+		key := http.TrailerPrefix + name
+		for i := range declared {
+			if declared[i] == name {
+				key = name
+				break
+			}
+		}
+		ctx.Header().Set(key, value)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDigestTrailer(t *testing.T) {
+	svc := NewService("/")
+	svc.Root().GET("export", func(ctx *Context) {
+		if err := ctx.DigestTrailer("sha-256"); err != nil {
+			t.Fatal(err)
+		}
+		ctx.Trailer("X-Rows", func() string { return "2" })
+		ctx.Trailer("X-Nil", nil)
+		ctx.WriteHeader(http.StatusOK)
+		io.WriteString(ctx, "row1\n")
+		io.WriteString(ctx, "row2\n")
+	})
+	ts := httptest.NewServer(svc)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	sum := sha256.Sum256(body)
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	if v := res.Trailer.Get("Content-Digest"); v != digest {
+		t.Errorf("expected digest %q, got %q", digest, v)
+	}
+	if v := res.Trailer.Get("X-Rows"); v != "2" {
+		t.Errorf("expected X-Rows 2, got %q", v)
+	}
+	if _, ok := res.Trailer["X-Nil"]; ok {
+		t.Errorf("expected nil trailer ignored, got %v", res.Trailer)
+	}
+}
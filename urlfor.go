@@ -0,0 +1,126 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// pseExp matches the PSE's in a path segment, see URLFor.
+var pseExp = regexp.MustCompile(`\{[^{}]*\}|\*`)
+
+/*
+Name names the route added last to the resource, so its URL can be built
+with Service.URLFor. Route names are unique to the service.
+
+	users.GET("{uint:id}", users.Read).Name("user")
+
+This function will panic if the resource has no routes, or if the name is
+already used by another route.
+*/
+func (r *Resource) Name(name string) *Resource {
+	if r.last == nil {
+		panic("relax: Name called on a resource without routes")
+	}
+	r.service.routesMu.Lock()
+	defer r.service.routesMu.Unlock()
+	if _, ok := r.service.names[name]; ok {
+		panic("relax: route name already used: " + name)
+	}
+	if r.service.names == nil {
+		r.service.names = make(map[string]*routeEntry)
+	}
+	r.last.name = name
+	r.service.names[name] = r.last
+	return r
+}
+
+/*
+URLFor returns the absolute URL of the route named 'name', with its PSE's
+replaced by the values in 'params', in order. Values are formatted with
+fmt.Sprint and must match their PSE. This avoids building hrefs by hand,
+which break when routes change.
+
+	users.GET("{uint:id}/posts/{date:day}", users.Posts).Name("user.posts")
+
+	href, err := svc.URLFor("user.posts", 123, "2014-10-01")
+	// href = "http://api.company.com/v1/users/123/posts/2014-10-01"
+
+Returns ErrRouteName if no route has that name, or ErrRouteParams if the
+values don't match the route PSE's.
+*/
+func (svc *Service) URLFor(name string, params ...interface{}) (string, error) {
+	svc.routesMu.RLock()
+	e, ok := svc.names[name]
+	svc.routesMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrRouteName, name)
+	}
+	return svc.routeURL(e, params)
+}
+
+// routeURL returns the absolute URL of route 'e' with 'params', see URLFor.
+func (svc *Service) routeURL(e *routeEntry, params []interface{}) (string, error) {
+	name := e.name
+	if name == "" {
+		name = e.path
+	}
+	n := 0
+	next := func(string) string {
+		n++
+		if n > len(params) {
+			return ""
+		}
+		return fmt.Sprint(params[n-1])
+	}
+	segs := strings.Split(e.path, "/")
+	raw := make([]string, len(segs))
+	for i, pseg := range segs {
+		raw[i] = pseg
+		if !isPattern(pseg) {
+			continue
+		}
+		var value string
+		if strings.HasPrefix(pseg, "{re:") {
+			value = next(pseg)
+		} else {
+			value = pseExp.ReplaceAllStringFunc(pseg, next)
+		}
+		if n > len(params) {
+			return "", fmt.Errorf("%w: %s needs more values", ErrRouteParams, name)
+		}
+		if m := segmentExp(pseg).FindString(value); m != value {
+			return "", fmt.Errorf("%w: %q doesn't match %s", ErrRouteParams, value, pseg)
+		}
+		segs[i], raw[i] = value, url.PathEscape(value)
+		if restExp.MatchString(pseg) {
+			// the rest of the path keeps its slashes.
+			parts := strings.Split(value, "/")
+			for j := range parts {
+				parts[j] = url.PathEscape(parts[j])
+			}
+			raw[i] = strings.Join(parts, "/")
+		}
+	}
+	if n != len(params) {
+		return "", fmt.Errorf("%w: %s has %d values, got %d", ErrRouteParams, name, n, len(params))
+	}
+
+	u := *svc.URI
+	if e.host != "" {
+		// host names don't have ports, keep the service port.
+		u.Host = e.host
+		if port := svc.URI.Port(); port != "" {
+			u.Host = net.JoinHostPort(e.host, port)
+		}
+	}
+	u.Path = strings.Join(segs, "/")
+	u.RawPath = strings.Join(raw, "/")
+	return u.String(), nil
+}
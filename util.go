@@ -12,25 +12,36 @@ import (
 	"github.com/gofrs/uuid"
 )
 
-// These status codes are inaccessible in net/http but they work with http.StatusText().
-// They are included here as they might be useful.
-// See: https://tools.ietf.org/html/rfc6585
+// These status codes were inaccessible in net/http, they are kept for
+// compatibility.
+//
+// Deprecated: Use the constants in net/http, which has all the status codes
+// in the registry of StatusText.
 const (
 	// StatusUnprocessableEntity indicates the user sent content that while it is
 	// syntactically correct, it might be erroneous.
-	// See: http://tools.ietf.org/html/rfc4918#section-11.2
+	//
+	// Deprecated: Use http.StatusUnprocessableEntity
 	StatusUnprocessableEntity = 422
 	// StatusPreconditionRequired indicates that the origin server requires the
 	// request to be conditional.
+	//
+	// Deprecated: Use http.StatusPreconditionRequired
 	StatusPreconditionRequired = 428
 	// StatusTooManyRequests indicates that the user has sent too many requests
 	// in a given amount of time ("rate limiting").
+	//
+	// Deprecated: Use http.StatusTooManyRequests
 	StatusTooManyRequests = 429
 	// StatusRequestHeaderFieldsTooLarge indicates that the server is unwilling to
 	// process the request because its header fields are too large.
+	//
+	// Deprecated: Use http.StatusRequestHeaderFieldsTooLarge
 	StatusRequestHeaderFieldsTooLarge = 431
 	// StatusNetworkAuthenticationRequired indicates that the client needs to
 	// authenticate to gain network access.
+	//
+	// Deprecated: Use http.StatusNetworkAuthenticationRequired
 	StatusNetworkAuthenticationRequired = 511
 )
 
@@ -63,17 +74,46 @@ func NewRequestID(id string) string {
 	return id
 }
 
+// IsUUID returns true if 'id' is an UUID in hex octets, with or without dashes,
+// in any case. Such as the values matched by the uuid PSE.
+func IsUUID(id string) bool {
+	if len(id) != 36 && len(id) != 32 {
+		return false
+	}
+	_, err := uuid.FromString(id)
+	return err == nil
+}
+
+// IsULID returns true if 'id' is an ULID: 26 chars in Crockford's base32, in
+// any case, with a timestamp that fits in 48 bits. Such as the values matched
+// by the ulid PSE. See https://github.com/ulid/spec
+func IsULID(id string) bool {
+	if len(id) != 26 || id[0] < '0' || id[0] > '7' {
+		return false
+	}
+	for _, c := range strings.ToUpper(id) {
+		if !strings.ContainsRune(ulidAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ulidAlphabet is Crockford's base32 alphabet, used by ULID's.
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
 /*
 PathExt returns the media subtype extension in an URL path.
-The extension begins from the last dot:
+The extension begins from the last dot of the last path segment:
 
 	/api/v1/tickets.xml => ".xml"
+	/api/v1.2/tickets   => ""
 
 Returns the extension with dot, or empty string "" if not found.
 */
 func PathExt(path string) string {
 	dot := strings.LastIndex(path, ".")
-	if dot > -1 {
+	if dot > -1 && dot > strings.LastIndex(path, "/") {
 		return path[dot:]
 	}
 	return ""
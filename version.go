@@ -0,0 +1,112 @@
+// Copyright 2014 Codehack http://codehack.com
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package relax
+
+import "strings"
+
+/*
+APIVersion is a version of a service. Resources added to a version are
+mounted under the version path, and share the service filters, encoders and
+registries. Versions are ordered by when they are created, oldest first.
+
+	svc := relax.NewService("/api/")
+
+	// GET /api/v1/users
+	svc.Version("v1").Resource(&UsersV1{})
+
+	// GET /api/v2/users
+	svc.Version("v2").Resource(&UsersV2{})
+
+When a resource is in more than one version, the responses link to the
+adjacent versions with the relations "predecessor-version" and
+"successor-version", so clients can find newer versions:
+
+	Link: <http://company.com/api/v2/users>; rel="successor-version"
+
+See: https://tools.ietf.org/html/rfc5829
+*/
+type APIVersion struct {
+	service *Service
+	name    string
+}
+
+// Version returns the API version 'name' of the service, such as "v2",
+// creating it if needed.
+func (svc *Service) Version(name string) *APIVersion {
+	name = strings.Trim(name, "/")
+	for _, v := range svc.versions {
+		if v.name == name {
+			return v
+		}
+	}
+	v := &APIVersion{service: svc, name: name}
+	svc.versions = append(svc.versions, v)
+	return v
+}
+
+// Name returns the version name.
+func (v *APIVersion) Name() string {
+	return v.name
+}
+
+// Path returns the path of the version, under the service path.
+// 'absolute' whether or not it should return an absolute URL.
+func (v *APIVersion) Path(absolute bool) string {
+	return v.service.Path(absolute) + v.name
+}
+
+// Resource is like Service.Resource, but the resource is mounted under the
+// version path; and linked to the same resource in the adjacent versions.
+func (v *APIVersion) Resource(collection Resourcer, filters ...Filter) *Resource {
+	res := v.service.resource(nil, v.name+"/", collection, filters)
+	res.version = v
+	v.linkVersions(res)
+	return res
+}
+
+// linkVersions adds the version link relations between 'res' and the
+// resources with the same name in the nearest older and newer versions.
+func (v *APIVersion) linkVersions(res *Resource) {
+	var older, newer *Resource
+	seen := false
+	for _, ver := range v.service.versions {
+		if ver == v {
+			seen = true
+			continue
+		}
+		other := v.service.versionResource(ver, res.name)
+		if other == nil {
+			continue
+		}
+		if !seen {
+			older = other
+		} else if newer == nil {
+			newer = other
+		}
+	}
+	if older != nil && newer != nil {
+		// 'res' is now between them.
+		older.removeLink(newer.Path(true), "successor-version")
+		newer.removeLink(older.Path(true), "predecessor-version")
+	}
+	if older != nil {
+		older.NewLink(&Link{URI: res.Path(true), Rel: "successor-version"})
+		res.NewLink(&Link{URI: older.Path(true), Rel: "predecessor-version"})
+	}
+	if newer != nil {
+		newer.NewLink(&Link{URI: res.Path(true), Rel: "predecessor-version"})
+		res.NewLink(&Link{URI: newer.Path(true), Rel: "successor-version"})
+	}
+}
+
+// versionResource returns the resource 'name' of version 'v', or nil.
+func (svc *Service) versionResource(v *APIVersion, name string) *Resource {
+	for _, res := range svc.resources {
+		if res.version == v && res.name == name {
+			return res
+		}
+	}
+	return nil
+}